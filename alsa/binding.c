@@ -0,0 +1,199 @@
+//go:build linux && cgo
+
+#include "binding.h"
+
+// Encodes a MIDI 1.0 byte stream into sequencer events and sends them from
+// port to its subscribers, either directly or scheduled at an absolute real
+// time on queue.
+int send_bytes(snd_seq_t *seq, snd_midi_event_t *enc, int port, int queue, int direct, unsigned int sec, unsigned int nsec, const unsigned char *buf, long len) {
+    snd_seq_event_t ev;
+    snd_seq_real_time_t rt = { sec, nsec };
+    long pos = 0;
+    int err;
+
+    snd_midi_event_reset_encode(enc);
+
+    while (pos < len) {
+        snd_seq_ev_clear(&ev);
+        long n = snd_midi_event_encode(enc, buf + pos, len - pos, &ev);
+        if (n <= 0) {
+            return n < 0 ? (int)n : -EINVAL;
+        }
+        pos += n;
+        if (ev.type == SND_SEQ_EVENT_NONE) {
+            continue;
+        }
+
+        snd_seq_ev_set_source(&ev, port);
+        snd_seq_ev_set_subs(&ev);
+        if (direct) {
+            snd_seq_ev_set_direct(&ev);
+        } else {
+            snd_seq_ev_schedule_real(&ev, queue, 0, &rt);
+        }
+
+        if ((err = snd_seq_event_output(seq, &ev)) < 0) {
+            return err;
+        }
+    }
+
+    return snd_seq_drain_output(seq);
+}
+
+// snd_seq_ev_ext_t is packed, so its fields can't be read from Go.
+void *event_ext_ptr(const snd_seq_event_t *ev) {
+    return ev->data.ext.ptr;
+}
+
+unsigned int event_ext_len(const snd_seq_event_t *ev) {
+    return ev->data.ext.len;
+}
+
+// Sends an event from port to itself, telling the read loop to exit.
+int send_quit(snd_seq_t *seq, int port) {
+    snd_seq_event_t ev;
+
+    snd_seq_ev_clear(&ev);
+    ev.type = SND_SEQ_EVENT_USR0;
+    snd_seq_ev_set_source(&ev, port);
+    snd_seq_ev_set_dest(&ev, snd_seq_client_id(seq), port);
+    snd_seq_ev_set_direct(&ev);
+
+    return snd_seq_event_output_direct(seq, &ev);
+}
+
+// Creates a port whose incoming events are timestamped in real time on
+// queue, or not timestamped if queue is negative. Returns the port ID.
+int create_port(snd_seq_t *seq, const char *name, unsigned int caps, unsigned int type, int queue) {
+    snd_seq_port_info_t *info;
+    int err;
+
+    snd_seq_port_info_alloca(&info);
+    snd_seq_port_info_set_name(info, name);
+    snd_seq_port_info_set_capability(info, caps);
+    snd_seq_port_info_set_type(info, type);
+    if (queue >= 0) {
+        snd_seq_port_info_set_timestamping(info, 1);
+        snd_seq_port_info_set_timestamp_real(info, 1);
+        snd_seq_port_info_set_timestamp_queue(info, queue);
+    }
+
+    if ((err = snd_seq_create_port(seq, info)) < 0) {
+        return err;
+    }
+
+    return snd_seq_port_info_get_port(info);
+}
+
+// MARK: UMP
+
+// UMP support needs alsa-lib 1.2.10 or later; against older versions the
+// functions below fail with -ENOSYS and the driver stays in legacy mode.
+#ifdef SND_SEQ_EVENT_UMP
+
+// Switches the client to MIDI 2.0 UMP mode. The sequencer converts events
+// to and from legacy clients.
+int set_ump_mode(snd_seq_t *seq) {
+    return snd_seq_set_client_midi_version(seq, SND_SEQ_CLIENT_UMP_MIDI_2_0);
+}
+
+// Opens a temporary client to check whether the kernel accepts UMP mode.
+int probe_ump(void) {
+    snd_seq_t *seq;
+    int err = snd_seq_open(&seq, "default", SND_SEQ_OPEN_DUPLEX, 0);
+    if (err < 0) {
+        return err;
+    }
+    err = set_ump_mode(seq);
+    snd_seq_close(seq);
+    return err;
+}
+
+// Sends a single UMP message of count words from port to its subscribers,
+// either directly or scheduled at an absolute real time on queue. Output
+// is not drained.
+int send_ump(snd_seq_t *seq, int port, int queue, int direct, unsigned int sec, unsigned int nsec, const unsigned int *words, int count) {
+    snd_seq_ump_event_t ev;
+    snd_seq_real_time_t rt = { sec, nsec };
+
+    if (count < 1 || count > 4) {
+        return -EINVAL;
+    }
+
+    snd_seq_ump_ev_clear(&ev);
+    snd_seq_ev_set_ump_data(&ev, (void *)words, count * 4);
+    snd_seq_ev_set_source(&ev, port);
+    snd_seq_ev_set_subs(&ev);
+    if (direct) {
+        snd_seq_ev_set_direct(&ev);
+    } else {
+        snd_seq_ev_schedule_real(&ev, queue, 0, &rt);
+    }
+
+    return snd_seq_ump_event_output(seq, &ev);
+}
+
+// Reads the next event in UMP mode. The header of a UMP event matches
+// snd_seq_event_t, so it is returned as one; see event_ump_data.
+int input_ump(snd_seq_t *seq, snd_seq_event_t **ev) {
+    return snd_seq_ump_event_input(seq, (snd_seq_ump_event_t **)ev);
+}
+
+int event_is_ump(const snd_seq_event_t *ev) {
+    return snd_seq_ev_is_ump(ev) ? 1 : 0;
+}
+
+const unsigned int *event_ump_data(const snd_seq_event_t *ev) {
+    return ((const snd_seq_ump_event_t *)ev)->ump;
+}
+
+int get_ump_endpoint(snd_seq_t *seq, int client, struct ump_endpoint *out) {
+    snd_ump_endpoint_info_t *info = calloc(1, snd_ump_endpoint_info_sizeof());
+    int err;
+
+    if (info == NULL) {
+        return -ENOMEM;
+    }
+    if ((err = snd_seq_get_ump_endpoint_info(seq, client, info)) >= 0) {
+        snprintf(out->name, sizeof(out->name), "%s", snd_ump_endpoint_info_get_name(info));
+        snprintf(out->product_id, sizeof(out->product_id), "%s", snd_ump_endpoint_info_get_product_id(info));
+        out->protocol = snd_ump_endpoint_info_get_protocol(info);
+        out->num_blocks = snd_ump_endpoint_info_get_num_blocks(info);
+    }
+
+    free(info);
+    return err;
+}
+
+int get_ump_block(snd_seq_t *seq, int client, int blk, struct ump_block *out) {
+    snd_ump_block_info_t *info = calloc(1, snd_ump_block_info_sizeof());
+    int err;
+
+    if (info == NULL) {
+        return -ENOMEM;
+    }
+    if ((err = snd_seq_get_ump_block_info(seq, client, blk, info)) >= 0) {
+        snprintf(out->name, sizeof(out->name), "%s", snd_ump_block_info_get_name(info));
+        out->id = snd_ump_block_info_get_block_id(info);
+        out->active = snd_ump_block_info_get_active(info);
+        out->direction = snd_ump_block_info_get_direction(info);
+        out->first_group = snd_ump_block_info_get_first_group(info);
+        out->num_groups = snd_ump_block_info_get_num_groups(info);
+    }
+
+    free(info);
+    return err;
+}
+
+#else
+
+int set_ump_mode(snd_seq_t *seq) { return -ENOSYS; }
+int probe_ump(void) { return -ENOSYS; }
+int send_ump(snd_seq_t *seq, int port, int queue, int direct, unsigned int sec, unsigned int nsec, const unsigned int *words, int count) { return -ENOSYS; }
+int input_ump(snd_seq_t *seq, snd_seq_event_t **ev) { return -ENOSYS; }
+int event_is_ump(const snd_seq_event_t *ev) { return 0; }
+const unsigned int *event_ump_data(const snd_seq_event_t *ev) { return NULL; }
+int get_ump_endpoint(snd_seq_t *seq, int client, struct ump_endpoint *out) { return -ENOSYS; }
+int get_ump_block(snd_seq_t *seq, int client, int blk, struct ump_block *out) { return -ENOSYS; }
+
+#endif
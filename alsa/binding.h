@@ -2,3 +2,33 @@
 #include <stdlib.h>
 #include <alsa/asoundlib.h>
 
+int send_bytes(snd_seq_t *seq, snd_midi_event_t *enc, int port, int queue, int direct, unsigned int sec, unsigned int nsec, const unsigned char *buf, long len);
+void *event_ext_ptr(const snd_seq_event_t *ev);
+unsigned int event_ext_len(const snd_seq_event_t *ev);
+int send_quit(snd_seq_t *seq, int port);
+int create_port(snd_seq_t *seq, const char *name, unsigned int caps, unsigned int type, int queue);
+
+struct ump_endpoint {
+    char name[128];
+    char product_id[128];
+    unsigned int protocol;
+    unsigned int num_blocks;
+};
+
+struct ump_block {
+    char name[128];
+    unsigned int id;
+    unsigned int active;
+    unsigned int direction;
+    unsigned int first_group;
+    unsigned int num_groups;
+};
+
+int set_ump_mode(snd_seq_t *seq);
+int probe_ump(void);
+int send_ump(snd_seq_t *seq, int port, int queue, int direct, unsigned int sec, unsigned int nsec, const unsigned int *words, int count);
+int input_ump(snd_seq_t *seq, snd_seq_event_t **ev);
+int event_is_ump(const snd_seq_event_t *ev);
+const unsigned int *event_ump_data(const snd_seq_event_t *ev);
+int get_ump_endpoint(snd_seq_t *seq, int client, struct ump_endpoint *out);
+int get_ump_block(snd_seq_t *seq, int client, int blk, struct ump_block *out);
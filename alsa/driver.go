@@ -1,4 +1,4 @@
-//go:build linux
+//go:build linux && cgo
 
 package alsa
 
@@ -10,7 +10,9 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"os"
 	"strings"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -20,9 +22,17 @@ import (
 
 const (
 	driverName = "alsa"
+
+	// size of the MIDI event encoder's buffer; longer SysEx messages are
+	// sent as several events
+	encoderBufferSize = 256
 )
 
-var ErrALSA = errors.New("failed with status")
+var (
+	ErrALSA          = errors.New("failed with status")
+	ErrInputNotOpen  = errors.New("input not open")
+	ErrOutputNotOpen = errors.New("output not open")
+)
 
 func alsaError(funcName string, exitCode C.int) error {
 	return fmt.Errorf("%s() %w %d", funcName, ErrALSA, exitCode)
@@ -32,34 +42,68 @@ func alsaError(funcName string, exitCode C.int) error {
 
 func init() {
 	midi.Register(&midi.Stub{
-		Name:      driverName,
-		Available: true,
+		Name:              driverName,
+		Available:         true,
+		Probe:             probe,
+		Priority:          20,
+		Capabilities:      capabilities,
+		ProbeCapabilities: probeCapabilities,
 		CreateDriver: func(clientName string) (midi.Driver, error) {
 			d := &driver{
-				queueID: -1,
+				queueID:      -1,
+				announcePort: -1,
+				outputs:      map[midi.Entity]C.int{},
+				sysex:        map[midi.Entity][]byte{},
+
+				inputs:        map[midi.Entity]C.int{},
+				virtualInputs: map[C.uchar]midi.Entity{},
 			}
 
-			err := C.snd_seq_open(&d.seq, C.CString("default"), C.SND_SEQ_OPEN_DUPLEX, 0)
+			defaultName := C.CString("default")
+			defer C.free(unsafe.Pointer(defaultName))
+
+			err := C.snd_seq_open(&d.seq, defaultName, C.SND_SEQ_OPEN_DUPLEX, 0)
 			if err < 0 {
 				return nil, alsaError("snd_seq_open", err)
 			}
 
-			C.snd_seq_set_client_name(d.seq, C.CString(clientName))
+			cClientName := C.CString(clientName)
+			C.snd_seq_set_client_name(d.seq, cClientName)
+			C.free(unsafe.Pointer(cClientName))
 			d.clientID = C.uchar(C.snd_seq_client_id(d.seq))
 
-			d.queueID = C.snd_seq_alloc_named_queue(d.seq, C.CString("default"))
+			// UMP mode needs Linux 6.5 and alsa-lib 1.2.10; without it the
+			// driver converts to and from MIDI 1.0 itself
+			d.umpMode = C.set_ump_mode(d.seq) >= 0
+
+			d.queueID = C.snd_seq_alloc_named_queue(d.seq, defaultName)
 			if d.queueID < 0 {
 				d.Close()
 				return nil, alsaError("snd_seq_alloc_named_queue", d.queueID)
 			}
 
 			d.onReceive = midi.NopHandler
+			d.onNotify = midi.NopNotificationHandler
 
 			err = C.snd_seq_control_queue(d.seq, d.queueID, C.SND_SEQ_EVENT_START, 0, nil)
 			if err < 0 {
+				d.Close()
 				return nil, alsaError("snd_seq_control_queue", err)
 			}
+			C.snd_seq_drain_output(d.seq)
+			d.queueStart = time.Now()
+
+			if err := C.snd_midi_event_new(encoderBufferSize, &d.encoder); err < 0 {
+				d.Close()
+				return nil, alsaError("snd_midi_event_new", err)
+			}
 
+			if err := d.subscribeAnnounce(); err != nil {
+				d.Close()
+				return nil, err
+			}
+
+			d.stopped = make(chan struct{})
 			go d.readLoop()
 
 			// d.client = C.allocateClient()         // allocate C struct for client
@@ -81,20 +125,107 @@ func init() {
 	})
 }
 
+// capabilities are those of the driver in legacy mode; UMP needs Linux 6.5
+// and alsa-lib 1.2.10, which probeCapabilities checks for.
+var capabilities = midi.Capabilities{
+	NativeScheduling: true,
+	VirtualPorts:     true,
+	Hotplug:          true,
+	SysExStreaming:   true,
+}
+
+var probeCapabilities = sync.OnceValue(func() midi.Capabilities {
+	caps := capabilities
+	caps.NativeUMP = C.probe_ump() >= 0
+	return caps
+})
+
+// probe reports whether the kernel has a sequencer device to open.
+func probe() bool {
+	_, err := os.Stat("/dev/snd/seq")
+	return err == nil
+}
+
 type driver struct {
-	seq       *C.snd_seq_t
-	queueID   C.int
-	clientID  C.uchar
-	onReceive midi.ReceiveEventHandler
+	seq      *C.snd_seq_t
+	queueID  C.int
+	clientID C.uchar
+
+	handlerLock sync.Mutex // guards the handlers, which readLoop calls
+	onReceive   midi.ReceiveEventHandler
+	onNotify    midi.NotificationHandler
+
+	// held for reading by every operation that uses seq, and for writing
+	// by Close while it releases it
+	closeLock sync.RWMutex
+	closed    bool
+	stopped   chan struct{} // closed when readLoop exits
+
+	announcePort C.int
+
+	// client is in MIDI 2.0 UMP mode and exchanges UMP packets natively
+	umpMode bool
+
+	// approximate wall clock time at which the queue started; queue real
+	// time is measured from here
+	queueStart time.Time
+
+	outputLock sync.Mutex
+	outputs    map[midi.Entity]C.int // our source port for each open output
+	encoder    *C.snd_midi_event_t
+	sendBuf    []byte
+
+	// partial SysEx messages by source; only touched by readLoop
+	sysex map[midi.Entity][]byte
+
+	inputLock     sync.Mutex
+	inputs        map[midi.Entity]C.int   // our destination port for each open input
+	virtualInputs map[C.uchar]midi.Entity // our virtual input ports
 }
 
 func (d *driver) Name() string {
 	return driverName
 }
 
+// Close stops the read loop, frees the queue and encoder, and closes the
+// sequencer, which removes our ports and their subscriptions. It must not
+// be called from the receive or notification handler.
 func (d *driver) Close() error {
-	// TODO: free queue
-	C.snd_seq_close(d.seq)
+	d.closeLock.Lock()
+	if d.closed {
+		d.closeLock.Unlock()
+		return nil
+	}
+	d.closed = true
+	wait := false
+	if d.stopped != nil {
+		if status := C.send_quit(d.seq, d.announcePort); status < 0 {
+			log.Printf("failed to stop read loop: %s", alsaError("send_quit", status))
+		} else {
+			wait = true
+		}
+	}
+	d.closeLock.Unlock()
+
+	// wait without the lock held: the read loop may still be delivering
+	// events to handlers which call back into the driver
+	if wait {
+		<-d.stopped
+	}
+
+	d.closeLock.Lock()
+	defer d.closeLock.Unlock()
+
+	if d.queueID >= 0 {
+		C.snd_seq_free_queue(d.seq, d.queueID)
+	}
+	if d.encoder != nil {
+		C.snd_midi_event_free(d.encoder)
+		d.encoder = nil
+	}
+	if status := C.snd_seq_close(d.seq); status < 0 {
+		return alsaError("snd_seq_close", status)
+	}
 	return nil
 }
 
@@ -102,14 +233,68 @@ func (d *driver) SetReceiveHandler(handler midi.ReceiveEventHandler) {
 	if handler == nil {
 		handler = midi.NopHandler
 	}
+	d.handlerLock.Lock()
 	d.onReceive = handler
+	d.handlerLock.Unlock()
+}
+
+func (d *driver) SetNotificationHandler(handler midi.NotificationHandler) {
+	if handler == nil {
+		handler = midi.NopNotificationHandler
+	}
+	d.handlerLock.Lock()
+	d.onNotify = handler
+	d.handlerLock.Unlock()
+}
+
+// receive passes words to the receive handler.
+func (d *driver) receive(t time.Time, ent midi.Entity, words []ump.Word) {
+	d.handlerLock.Lock()
+	onReceive := d.onReceive
+	d.handlerLock.Unlock()
+	onReceive(t, ent, words)
+}
+
+// notify passes n to the notification handler.
+func (d *driver) notify(n midi.Notification) {
+	d.handlerLock.Lock()
+	onNotify := d.onNotify
+	d.handlerLock.Unlock()
+	onNotify(n)
+}
+
+// acquire locks the driver against Close for the duration of an
+// operation, failing with midi.ErrClosed once the driver is closed. The
+// caller must release the lock with closeLock.RUnlock.
+func (d *driver) acquire() error {
+	d.closeLock.RLock()
+	if d.closed {
+		d.closeLock.RUnlock()
+		return midi.ErrClosed
+	}
+	return nil
 }
 
 // MARK: Open Input
 
 func (d *driver) OpenInput(ent midi.Entity) error {
+	if err := d.acquire(); err != nil {
+		return err
+	}
+	defer d.closeLock.RUnlock()
+
+	d.inputLock.Lock()
+	defer d.inputLock.Unlock()
+
+	if _, ok := d.inputs[ent]; ok {
+		return nil
+	}
+
+	name := C.CString(fmt.Sprintf("output %d", ent))
+	defer C.free(unsafe.Pointer(name))
+
 	portID := C.snd_seq_create_simple_port(d.seq,
-		C.CString(fmt.Sprintf("output %d", ent)),
+		name,
 		C.SND_SEQ_PORT_CAP_WRITE|C.SND_SEQ_PORT_CAP_SUBS_WRITE,
 		C.SND_SEQ_PORT_TYPE_MIDI_GENERIC,
 	)
@@ -124,7 +309,8 @@ func (d *driver) OpenInput(ent midi.Entity) error {
 	dest.client = d.clientID
 	dest.port = C.uchar(portID)
 
-	subscribePtr := (*C.snd_seq_port_subscribe_t)(C.malloc(C.snd_seq_port_subscribe_sizeof()))
+	subscribePtr := (*C.snd_seq_port_subscribe_t)(C.calloc(1, C.snd_seq_port_subscribe_sizeof()))
+	defer C.free(unsafe.Pointer(subscribePtr))
 
 	C.snd_seq_port_subscribe_set_sender(subscribePtr, &sender)
 	C.snd_seq_port_subscribe_set_dest(subscribePtr, &dest)
@@ -133,35 +319,385 @@ func (d *driver) OpenInput(ent midi.Entity) error {
 	C.snd_seq_port_subscribe_set_queue(subscribePtr, d.queueID)
 
 	if status := C.snd_seq_subscribe_port(d.seq, subscribePtr); status < 0 {
-		C.free(unsafe.Pointer(subscribePtr))
 		C.snd_seq_delete_port(d.seq, portID)
 		return alsaError("snd_seq_subscribe_port", status)
 	}
 
+	d.inputs[ent] = portID
+
+	return nil
+}
+
+// CloseInput closes an input opened with OpenInput, or a virtual input.
+// Deleting our port removes its subscription.
+func (d *driver) CloseInput(ent midi.Entity) error {
+	if err := d.acquire(); err != nil {
+		return err
+	}
+	defer d.closeLock.RUnlock()
+
+	d.inputLock.Lock()
+	defer d.inputLock.Unlock()
+
+	portID, ok := d.inputs[ent]
+	if ok {
+		delete(d.inputs, ent)
+	} else if entityClientID(ent) == d.clientID && d.virtualInputs[entityPortID(ent)] == ent {
+		portID = C.int(entityPortID(ent))
+		delete(d.virtualInputs, entityPortID(ent))
+	} else {
+		return ErrInputNotOpen
+	}
+
+	if status := C.snd_seq_delete_port(d.seq, portID); status < 0 {
+		return alsaError("snd_seq_delete_port", status)
+	}
+
 	return nil
 }
 
 // MARK: Open Output
 
-func (d *driver) OpenOutput(midi.Entity) error {
+func (d *driver) OpenOutput(ent midi.Entity) error {
+	if err := d.acquire(); err != nil {
+		return err
+	}
+	defer d.closeLock.RUnlock()
+
+	d.outputLock.Lock()
+	defer d.outputLock.Unlock()
+
+	if _, ok := d.outputs[ent]; ok {
+		return nil
+	}
+
+	name := C.CString(fmt.Sprintf("input %d", ent))
+	defer C.free(unsafe.Pointer(name))
+
+	portID := C.snd_seq_create_simple_port(d.seq,
+		name,
+		C.SND_SEQ_PORT_CAP_READ|C.SND_SEQ_PORT_CAP_SUBS_READ,
+		C.SND_SEQ_PORT_TYPE_MIDI_GENERIC|C.SND_SEQ_PORT_TYPE_APPLICATION,
+	)
+
+	if portID < 0 {
+		return alsaError("snd_seq_create_simple_port", portID)
+	}
+
+	if status := C.snd_seq_connect_to(d.seq, portID, C.int(entityClientID(ent)), C.int(entityPortID(ent))); status < 0 {
+		C.snd_seq_delete_port(d.seq, portID)
+		return alsaError("snd_seq_connect_to", status)
+	}
+
+	d.outputs[ent] = portID
+
 	return nil
 }
 
-func (d *driver) Send(time.Time, midi.Entity, []ump.Word) error {
+// CloseOutput closes an output opened with OpenOutput, or a virtual output.
+func (d *driver) CloseOutput(ent midi.Entity) error {
+	if err := d.acquire(); err != nil {
+		return err
+	}
+	defer d.closeLock.RUnlock()
+
+	d.outputLock.Lock()
+	defer d.outputLock.Unlock()
+
+	portID, ok := d.outputs[ent]
+	if !ok {
+		return ErrOutputNotOpen
+	}
+	delete(d.outputs, ent)
+
+	if status := C.snd_seq_delete_port(d.seq, portID); status < 0 {
+		return alsaError("snd_seq_delete_port", status)
+	}
+
 	return nil
 }
 
-func (d *driver) SendSysEx(midi.Entity, []ump.Word) error {
+// MARK: Virtual Ports
+
+// CreateVirtualInput creates a port that other clients can subscribe to
+// and send to. Events arriving on it are timestamped on the driver's queue
+// and reported with the port's own Entity, whichever client sent them.
+func (d *driver) CreateVirtualInput(name string) (midi.Entity, error) {
+	if err := d.acquire(); err != nil {
+		return 0, err
+	}
+	defer d.closeLock.RUnlock()
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	portID := C.create_port(d.seq, cName,
+		C.SND_SEQ_PORT_CAP_WRITE|C.SND_SEQ_PORT_CAP_SUBS_WRITE,
+		C.SND_SEQ_PORT_TYPE_MIDI_GENERIC|C.SND_SEQ_PORT_TYPE_APPLICATION,
+		d.queueID,
+	)
+	if portID < 0 {
+		return 0, alsaError("create_port", portID)
+	}
+
+	ent := makePortEntity(C.int(d.clientID), portID)
+
+	d.inputLock.Lock()
+	d.virtualInputs[C.uchar(portID)] = ent
+	d.inputLock.Unlock()
+
+	return ent, nil
+}
+
+// CreateVirtualOutput creates a port that other clients can subscribe to.
+// Data sent to the returned Entity is delivered to every subscriber.
+func (d *driver) CreateVirtualOutput(name string) (midi.Entity, error) {
+	if err := d.acquire(); err != nil {
+		return 0, err
+	}
+	defer d.closeLock.RUnlock()
+
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	portID := C.create_port(d.seq, cName,
+		C.SND_SEQ_PORT_CAP_READ|C.SND_SEQ_PORT_CAP_SUBS_READ,
+		C.SND_SEQ_PORT_TYPE_MIDI_GENERIC|C.SND_SEQ_PORT_TYPE_APPLICATION,
+		-1,
+	)
+	if portID < 0 {
+		return 0, alsaError("create_port", portID)
+	}
+
+	ent := makePortEntity(C.int(d.clientID), portID)
+
+	d.outputLock.Lock()
+	d.outputs[ent] = portID
+	d.outputLock.Unlock()
+
+	return ent, nil
+}
+
+// eventEntity returns the Entity an event is reported with: the virtual
+// input it arrived on, if any, otherwise its source.
+func (d *driver) eventEntity(evt *C.snd_seq_event_t) midi.Entity {
+	d.inputLock.Lock()
+	defer d.inputLock.Unlock()
+
+	if ent, ok := d.virtualInputs[evt.dest.port]; ok && evt.dest.client == d.clientID {
+		return ent
+	}
+	return makePortEntityFromEvent(evt)
+}
+
+// MARK: Send
+
+// Send schedules words for delivery to ent at time t on the driver's queue,
+// or delivers them immediately if t is the zero time. In UMP mode words are
+// sent as they are; otherwise they are converted to MIDI 1.0 first (see
+// ump.AppendMIDI1Stream).
+func (d *driver) Send(t time.Time, ent midi.Entity, words []ump.Word) error {
+	if err := d.acquire(); err != nil {
+		return err
+	}
+	defer d.closeLock.RUnlock()
+
+	d.outputLock.Lock()
+	defer d.outputLock.Unlock()
+
+	if d.umpMode {
+		return d.sendUMP(t, ent, words)
+	}
+
+	d.sendBuf = ump.AppendMIDI1Stream(d.sendBuf[:0], words)
+	return d.sendBytes(t, ent, d.sendBuf)
+}
+
+func (d *driver) SendSysEx(ent midi.Entity, words []ump.Word) error {
+	return d.Send(time.Time{}, ent, words)
+}
+
+func (d *driver) SendSysExV1(ent midi.Entity, data []byte) error {
+	if err := d.acquire(); err != nil {
+		return err
+	}
+	defer d.closeLock.RUnlock()
+
+	d.outputLock.Lock()
+	defer d.outputLock.Unlock()
+
+	if d.umpMode {
+		if len(data) < 2 {
+			return nil
+		}
+		return d.sendUMP(time.Time{}, ent, ump.AppendSysEx7(nil, 0, data))
+	}
+
+	return d.sendBytes(time.Time{}, ent, data)
+}
+
+// schedule returns the send_bytes/send_ump timing arguments for t.
+func (d *driver) schedule(t time.Time) (direct C.int, sec, nsec C.uint) {
+	if !t.IsZero() {
+		if offset := t.Sub(d.queueStart); offset > 0 {
+			return 0, C.uint(offset / time.Second), C.uint(offset % time.Second)
+		}
+	}
+	return 1, 0, 0
+}
+
+// sendUMP must be called with outputLock held.
+func (d *driver) sendUMP(t time.Time, ent midi.Entity, words []ump.Word) error {
+	portID, ok := d.outputs[ent]
+	if !ok {
+		return ErrOutputNotOpen
+	}
+
+	direct, sec, nsec := d.schedule(t)
+	for len(words) > 0 {
+		msg, rest := ump.Next(words)
+		if msg == nil {
+			break
+		}
+		words = rest
+
+		status := C.send_ump(d.seq, portID, d.queueID, direct, sec, nsec,
+			(*C.uint)(unsafe.Pointer(&msg[0])), C.int(len(msg)))
+		if status < 0 {
+			return alsaError("send_ump", status)
+		}
+	}
+
+	if status := C.snd_seq_drain_output(d.seq); status < 0 {
+		return alsaError("snd_seq_drain_output", status)
+	}
+
 	return nil
 }
 
-func (d *driver) SendSysExV1(midi.Entity, []byte) error {
+// sendBytes must be called with outputLock held.
+func (d *driver) sendBytes(t time.Time, ent midi.Entity, data []byte) error {
+	portID, ok := d.outputs[ent]
+	if !ok {
+		return ErrOutputNotOpen
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	direct, sec, nsec := d.schedule(t)
+	status := C.send_bytes(d.seq, d.encoder, portID, d.queueID, direct, sec, nsec,
+		(*C.uchar)(unsafe.Pointer(&data[0])), C.long(len(data)))
+	if status < 0 {
+		return alsaError("send_bytes", status)
+	}
+
+	return nil
+}
+
+// MARK: Connections
+
+// Connect subscribes dst to src, as aconnect does.
+func (d *driver) Connect(src, dst midi.Entity) error {
+	if err := d.acquire(); err != nil {
+		return err
+	}
+	defer d.closeLock.RUnlock()
+
+	sub := newSubscription(src, dst)
+	defer C.free(unsafe.Pointer(sub))
+
+	if status := C.snd_seq_subscribe_port(d.seq, sub); status < 0 {
+		return alsaError("snd_seq_subscribe_port", status)
+	}
+	return nil
+}
+
+func (d *driver) Disconnect(src, dst midi.Entity) error {
+	if err := d.acquire(); err != nil {
+		return err
+	}
+	defer d.closeLock.RUnlock()
+
+	sub := newSubscription(src, dst)
+	defer C.free(unsafe.Pointer(sub))
+
+	if status := C.snd_seq_unsubscribe_port(d.seq, sub); status < 0 {
+		return alsaError("snd_seq_unsubscribe_port", status)
+	}
 	return nil
 }
 
+// newSubscription allocates a subscription from src to dst. The caller
+// must free it.
+func newSubscription(src, dst midi.Entity) *C.snd_seq_port_subscribe_t {
+	var sender, dest C.snd_seq_addr_t
+	sender.client = entityClientID(src)
+	sender.port = entityPortID(src)
+	dest.client = entityClientID(dst)
+	dest.port = entityPortID(dst)
+
+	sub := (*C.snd_seq_port_subscribe_t)(C.calloc(1, C.snd_seq_port_subscribe_sizeof()))
+	C.snd_seq_port_subscribe_set_sender(sub, &sender)
+	C.snd_seq_port_subscribe_set_dest(sub, &dest)
+	return sub
+}
+
+// Connections lists the subscribers of every port, including the driver's
+// own.
+func (d *driver) Connections() ([]midi.Connection, error) {
+	if err := d.acquire(); err != nil {
+		return nil, err
+	}
+	defer d.closeLock.RUnlock()
+
+	clientInfo := (*C.snd_seq_client_info_t)(C.calloc(1, C.snd_seq_client_info_sizeof()))
+	defer C.free(unsafe.Pointer(clientInfo))
+	portInfo := (*C.snd_seq_port_info_t)(C.calloc(1, C.snd_seq_port_info_sizeof()))
+	defer C.free(unsafe.Pointer(portInfo))
+	query := (*C.snd_seq_query_subscribe_t)(C.calloc(1, C.snd_seq_query_subscribe_sizeof()))
+	defer C.free(unsafe.Pointer(query))
+
+	var out []midi.Connection
+
+	C.snd_seq_client_info_set_client(clientInfo, -1)
+	for C.snd_seq_query_next_client(d.seq, clientInfo) >= 0 {
+		clientID := C.snd_seq_client_info_get_client(clientInfo)
+
+		C.snd_seq_port_info_set_client(portInfo, clientID)
+		C.snd_seq_port_info_set_port(portInfo, -1)
+		for C.snd_seq_query_next_port(d.seq, portInfo) >= 0 {
+			portID := C.snd_seq_port_info_get_port(portInfo)
+
+			var root C.snd_seq_addr_t
+			root.client = C.uchar(clientID)
+			root.port = C.uchar(portID)
+
+			C.snd_seq_query_subscribe_set_root(query, &root)
+			C.snd_seq_query_subscribe_set_type(query, C.SND_SEQ_QUERY_SUBS_READ)
+			C.snd_seq_query_subscribe_set_index(query, 0)
+			for C.snd_seq_query_port_subscribers(d.seq, query) >= 0 {
+				addr := C.snd_seq_query_subscribe_get_addr(query)
+				out = append(out, midi.Connection{
+					Source: makePortEntity(clientID, portID),
+					Dest:   makePortEntity(C.int(addr.client), C.int(addr.port)),
+				})
+				C.snd_seq_query_subscribe_set_index(query, C.snd_seq_query_subscribe_get_index(query)+1)
+			}
+		}
+	}
+
+	return out, nil
+}
+
 // MARK: Enumerate
 
 func (d *driver) Enumerate() (*midi.Node, error) {
+	if err := d.acquire(); err != nil {
+		return nil, err
+	}
+	defer d.closeLock.RUnlock()
+
 	root := &midi.Node{
 		Type: midi.Root,
 	}
@@ -199,6 +735,12 @@ func (d *driver) Enumerate() (*midi.Node, error) {
 			Entity:       makeClientEntity(clientID),
 		}
 
+		if ep, ok := d.umpEndpoint(clientID); ok {
+			device.Metadata = map[string]any{
+				fmt.Sprintf("%s:ump", driverName): ep,
+			}
+		}
+
 		// clientName :=
 		// clientPortCount := C.snd_seq_client_info_get_num_ports(clientInfo)
 		// clientType := C.snd_seq_client_info_get_type(clientInfo)
@@ -259,9 +801,123 @@ func (d *driver) Enumerate() (*midi.Node, error) {
 	return root, nil
 }
 
+// UMPEndpoint describes the UMP endpoint behind a client. Enumerate stores
+// it in the metadata of device nodes under "alsa:ump".
+type UMPEndpoint struct {
+	Name      string
+	ProductID string
+	Protocol  int // SND_UMP_EP_INFO_PROTO_* bits
+	Blocks    []FunctionBlock
+}
+
+// FunctionBlock is a function block of a UMP endpoint.
+type FunctionBlock struct {
+	ID         int
+	Name       string
+	Active     bool
+	Direction  int // 1 = input, 2 = output, 3 = bidirectional
+	FirstGroup uint8
+	NumGroups  uint8
+}
+
+func (d *driver) umpEndpoint(clientID C.int) (*UMPEndpoint, bool) {
+	var info C.struct_ump_endpoint
+	if C.get_ump_endpoint(d.seq, clientID, &info) < 0 {
+		return nil, false
+	}
+
+	ep := &UMPEndpoint{
+		Name:      C.GoString(&info.name[0]),
+		ProductID: C.GoString(&info.product_id[0]),
+		Protocol:  int(info.protocol),
+	}
+
+	for i := 0; i < int(info.num_blocks); i++ {
+		var blk C.struct_ump_block
+		if C.get_ump_block(d.seq, clientID, C.int(i), &blk) < 0 {
+			continue
+		}
+		ep.Blocks = append(ep.Blocks, FunctionBlock{
+			ID:         int(blk.id),
+			Name:       C.GoString(&blk.name[0]),
+			Active:     blk.active != 0,
+			Direction:  int(blk.direction),
+			FirstGroup: uint8(blk.first_group),
+			NumGroups:  uint8(blk.num_groups),
+		})
+	}
+
+	return ep, true
+}
+
+// MARK: Announcements
+
+// subscribeAnnounce connects a private port to the System Announce port,
+// which reports clients and ports starting, exiting and changing. Close
+// also uses the port to wake the read loop.
+func (d *driver) subscribeAnnounce() error {
+	name := C.CString("announce")
+	defer C.free(unsafe.Pointer(name))
+
+	portID := C.create_port(d.seq, name,
+		C.SND_SEQ_PORT_CAP_WRITE|C.SND_SEQ_PORT_CAP_NO_EXPORT,
+		C.SND_SEQ_PORT_TYPE_APPLICATION,
+		-1,
+	)
+	if portID < 0 {
+		return alsaError("create_port", portID)
+	}
+
+	if status := C.snd_seq_connect_from(d.seq, portID, C.SND_SEQ_CLIENT_SYSTEM, C.SND_SEQ_PORT_SYSTEM_ANNOUNCE); status < 0 {
+		C.snd_seq_delete_port(d.seq, portID)
+		return alsaError("snd_seq_connect_from", status)
+	}
+
+	d.announcePort = portID
+
+	return nil
+}
+
+// announce relays a System Announce event to the notification handler. It
+// reports false if evt is not an announcement.
+func (d *driver) announce(evt *C.snd_seq_event_t) bool {
+	var typ midi.NotificationType
+	switch evt._type {
+	case C.SND_SEQ_EVENT_CLIENT_START:
+		typ = midi.DeviceAdded
+	case C.SND_SEQ_EVENT_CLIENT_EXIT:
+		typ = midi.DeviceRemoved
+	case C.SND_SEQ_EVENT_CLIENT_CHANGE:
+		typ = midi.DeviceChanged
+	case C.SND_SEQ_EVENT_PORT_START:
+		typ = midi.PortAdded
+	case C.SND_SEQ_EVENT_PORT_EXIT:
+		typ = midi.PortRemoved
+	case C.SND_SEQ_EVENT_PORT_CHANGE:
+		typ = midi.PortChanged
+	default:
+		return false
+	}
+
+	addr := (*C.snd_seq_addr_t)(unsafe.Pointer(&evt.data))
+	if addr.client == d.clientID {
+		return true // our own ports
+	}
+
+	ent := makeClientEntity(C.int(addr.client))
+	if typ >= midi.PortAdded {
+		ent = makePortEntity(C.int(addr.client), C.int(addr.port))
+	}
+	d.notify(midi.Notification{Type: typ, Entity: ent})
+
+	return true
+}
+
 // MARK: Read Loop
 
 func (d *driver) readLoop() {
+	defer close(d.stopped)
+
 	var event *C.snd_seq_event_t
 	var words []ump.Word
 
@@ -269,62 +925,187 @@ func (d *driver) readLoop() {
 		var batchTimestamp time.Time
 		var batchEntity midi.Entity
 
-		remain := C.snd_seq_event_input(d.seq, &event)
+		remain := d.input(&event)
 		if remain < 0 {
 			// TODO: I think there are some error codes here that only constitute
 			// a warning (e.g. underrun)
 			log.Printf("read loop returned error %d, exiting", remain)
 			return
 		}
+		if d.isQuit(event) {
+			return
+		}
 
-		batchTimestamp = time.Time{} // TODO
-		batchEntity = makePortEntityFromEvent(event)
-		words = append(words, parseEvent(event))
+		batchTimestamp = d.eventTime(event)
+		batchEntity = d.eventEntity(event)
+		words = d.appendEvent(words, event)
 
 		for remain > 1 {
-			remain = C.snd_seq_event_input(d.seq, &event)
+			remain = d.input(&event)
 			if remain < 0 {
 				// TODO: I think there are some error codes here that only constitute
 				// a warning (e.g. underrun)
 				log.Printf("read loop returned error %d, exiting", remain)
 				return
 			}
+			if d.isQuit(event) {
+				if len(words) > 0 {
+					d.receive(batchTimestamp, batchEntity, words)
+				}
+				return
+			}
 
-			thisTimestamp := time.Time{}
-			thisEntity := makePortEntityFromEvent(event)
-			if thisTimestamp != batchTimestamp || thisEntity != batchEntity {
-				d.onReceive(batchTimestamp, batchEntity, words)
+			thisTimestamp := d.eventTime(event)
+			thisEntity := d.eventEntity(event)
+			if !thisTimestamp.Equal(batchTimestamp) || thisEntity != batchEntity {
+				if len(words) > 0 {
+					d.receive(batchTimestamp, batchEntity, words)
+				}
 				batchTimestamp = thisTimestamp
 				batchEntity = thisEntity
 				words = words[:0]
 			}
 
-			words = append(words, parseEvent(event))
+			words = d.appendEvent(words, event)
 		}
 
-		d.onReceive(batchTimestamp, batchEntity, words)
+		if len(words) > 0 {
+			d.receive(batchTimestamp, batchEntity, words)
+		}
 		words = words[:0]
 	}
 }
 
-func parseEvent(evt *C.snd_seq_event_t) ump.Word {
+// isQuit reports whether evt is the event sent by Close to stop the loop.
+func (d *driver) isQuit(evt *C.snd_seq_event_t) bool {
+	return evt._type == C.SND_SEQ_EVENT_USR0 && evt.source.client == d.clientID
+}
+
+// input reads the next event, in UMP form if the client is in UMP mode.
+func (d *driver) input(evt **C.snd_seq_event_t) C.int {
+	if d.umpMode {
+		return C.input_ump(d.seq, evt)
+	}
+	return C.snd_seq_event_input(d.seq, evt)
+}
+
+// eventTime returns the time at which evt was received. Events timestamped
+// in real time on our queue are converted to wall clock time; anything else
+// is stamped with the current time.
+func (d *driver) eventTime(evt *C.snd_seq_event_t) time.Time {
+	if evt.flags&C.SND_SEQ_TIME_STAMP_MASK != C.SND_SEQ_TIME_STAMP_REAL || C.int(evt.queue) != d.queueID {
+		return time.Now()
+	}
+	rt := (*C.snd_seq_real_time_t)(unsafe.Pointer(&evt.time))
+	return d.queueStart.Add(time.Duration(rt.tv_sec)*time.Second + time.Duration(rt.tv_nsec))
+}
+
+// appendEvent appends the UMP encoding of evt to dst; UMP events are
+// appended as they are. Announcements go to the notification handler, and
+// other events with no MIDI equivalent are ignored. SysEx arrives from ALSA in chunks, which are
+// buffered per source until the message is complete.
+func (d *driver) appendEvent(dst []ump.Word, evt *C.snd_seq_event_t) []ump.Word {
+	if d.announce(evt) {
+		return dst
+	}
+
+	if C.event_is_ump(evt) != 0 {
+		words := unsafe.Slice((*ump.Word)(unsafe.Pointer(C.event_ump_data(evt))), 4)
+		return append(dst, words[:ump.Size(words[0])]...)
+	}
+
+	data := unsafe.Pointer(&evt.data)
+
 	switch evt._type {
-	case C.SND_SEQ_EVENT_NOTEON:
-		return ump.NoteOn(byte(evt.data[0]), int8(evt.data[1]), int8(evt.data[2]))
+	case C.SND_SEQ_EVENT_NOTEON, C.SND_SEQ_EVENT_NOTE:
+		n := (*C.snd_seq_ev_note_t)(data)
+		return append(dst, ump.NoteOn(uint8(n.channel), int8(n.note), int8(n.velocity)))
 	case C.SND_SEQ_EVENT_NOTEOFF:
-		return ump.NoteOff(byte(evt.data[0]), int8(evt.data[1]), int8(evt.data[2]))
+		n := (*C.snd_seq_ev_note_t)(data)
+		return append(dst, ump.NoteOff(uint8(n.channel), int8(n.note), int8(n.velocity)))
+	case C.SND_SEQ_EVENT_KEYPRESS:
+		n := (*C.snd_seq_ev_note_t)(data)
+		return append(dst, ump.PolyPressure(uint8(n.channel), int8(n.note), int8(n.velocity)))
+	}
+
+	c := (*C.snd_seq_ev_ctrl_t)(data)
+	ch, param, value := uint8(c.channel), int(c.param), int(c.value)
+
+	switch evt._type {
 	case C.SND_SEQ_EVENT_CONTROLLER:
-		// TODO(jason): are there endianness issues here?
-		return ump.ControlChange(byte(evt.data[0]), int8(evt.data[4]), int8(evt.data[8]))
+		return append(dst, ump.ControlChange(ch, int8(param&0x7F), int8(value&0x7F)))
+	case C.SND_SEQ_EVENT_CONTROL14:
+		if param >= 32 {
+			return append(dst, ump.ControlChange(ch, int8(param&0x7F), int8(value&0x7F)))
+		}
+		return append(dst,
+			ump.ControlChange(ch, int8(param), int8(value>>7&0x7F)),
+			ump.ControlChange(ch, int8(param+32), int8(value&0x7F)))
+	case C.SND_SEQ_EVENT_REGPARAM, C.SND_SEQ_EVENT_NONREGPARAM:
+		msb, lsb := int8(101), int8(100)
+		if evt._type == C.SND_SEQ_EVENT_NONREGPARAM {
+			msb, lsb = 99, 98
+		}
+		return append(dst,
+			ump.ControlChange(ch, msb, int8(param>>7&0x7F)),
+			ump.ControlChange(ch, lsb, int8(param&0x7F)),
+			ump.ControlChange(ch, 6, int8(value>>7&0x7F)),
+			ump.ControlChange(ch, 38, int8(value&0x7F)))
 	case C.SND_SEQ_EVENT_PGMCHANGE:
-		// TODO
+		return append(dst, ump.ProgramChange(ch, int8(value&0x7F)))
 	case C.SND_SEQ_EVENT_CHANPRESS:
-		// TODO
+		return append(dst, ump.ChannelPressure(ch, int8(value&0x7F)))
 	case C.SND_SEQ_EVENT_PITCHBEND:
-		// TODO
+		return append(dst, ump.PitchBend(ch, uint16(value+8192)&0x3FFF))
+	case C.SND_SEQ_EVENT_SONGPOS:
+		return append(dst, ump.SongPosition(uint16(value)))
+	case C.SND_SEQ_EVENT_SONGSEL:
+		return append(dst, ump.SongSelect(uint8(value)))
+	case C.SND_SEQ_EVENT_QFRAME:
+		return append(dst, ump.TimeCode(uint8(value)))
+	case C.SND_SEQ_EVENT_TUNE_REQUEST:
+		return append(dst, ump.TuneRequest)
+	case C.SND_SEQ_EVENT_CLOCK:
+		return append(dst, ump.Clock)
+	case C.SND_SEQ_EVENT_START:
+		return append(dst, ump.Start)
+	case C.SND_SEQ_EVENT_CONTINUE:
+		return append(dst, ump.Continue)
+	case C.SND_SEQ_EVENT_STOP:
+		return append(dst, ump.Stop)
+	case C.SND_SEQ_EVENT_SENSING:
+		return append(dst, ump.ActiveSensing)
+	case C.SND_SEQ_EVENT_RESET:
+		return append(dst, ump.Reset)
+	case C.SND_SEQ_EVENT_SYSEX:
+		chunk := unsafe.Slice((*byte)(C.event_ext_ptr(evt)), int(C.event_ext_len(evt)))
+		return d.appendSysEx(dst, makePortEntityFromEvent(evt), chunk)
+	}
+
+	return dst
+}
+
+func (d *driver) appendSysEx(dst []ump.Word, src midi.Entity, chunk []byte) []ump.Word {
+	if len(chunk) == 0 {
+		return dst
+	}
+
+	buf := d.sysex[src]
+	if chunk[0] == 0xF0 {
+		buf = buf[:0]
+	} else if len(buf) == 0 {
+		return dst // continuation with no start
+	}
+	buf = append(buf, chunk...)
+
+	if buf[len(buf)-1] != 0xF7 {
+		d.sysex[src] = buf
+		return dst
 	}
 
-	return 0
+	dst = ump.AppendSysEx7(dst, 0, buf)
+	d.sysex[src] = buf[:0]
+	return dst
 }
 
 var portCapBits = []string{
@@ -0,0 +1,17 @@
+//go:build !linux || !cgo
+
+package alsa
+
+import (
+	"github.com/jaz303/midi"
+)
+
+func init() {
+	midi.Register(&midi.Stub{
+		Name:      "alsa",
+		Available: false,
+		CreateDriver: func(string) (midi.Driver, error) {
+			return nil, midi.ErrDriverNotAvailable
+		},
+	})
+}
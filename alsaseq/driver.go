@@ -0,0 +1,835 @@
+//go:build linux
+
+// Package alsaseq is a Linux driver that talks to the ALSA sequencer
+// through /dev/snd/seq, without cgo or libasound, so it is available in
+// CGO_ENABLED=0 builds. It registers as "alsa-seq" and behaves like package
+// alsa, except that the client always runs in legacy mode: MIDI 2.0
+// messages are converted to MIDI 1.0 before sending.
+package alsaseq
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+const (
+	driverName = "alsa-seq"
+	devicePath = "/dev/snd/seq"
+
+	readBufferSize = 64 * 1024
+)
+
+// Port capabilities, types and flags
+const (
+	capRead      = 1 << 0
+	capWrite     = 1 << 1
+	capSubsRead  = 1 << 5
+	capSubsWrite = 1 << 6
+	capNoExport  = 1 << 7
+
+	typeMIDIGeneric = 1 << 1
+	typeApplication = 1 << 20
+
+	portFlagTimestamp = 1 << 1
+	portFlagTimeReal  = 1 << 2
+
+	subsFlagTimestamp = 1 << 1
+	subsFlagTimeReal  = 1 << 2
+
+	querySubsRead = 0 // subscribers of the root port
+)
+
+var (
+	ErrInputNotOpen  = errors.New("input not open")
+	ErrOutputNotOpen = errors.New("output not open")
+)
+
+func seqError(op string, err error) error {
+	return fmt.Errorf("%s: %w", op, err)
+}
+
+// MARK: Init
+
+func init() {
+	midi.Register(&midi.Stub{
+		Name:      driverName,
+		Available: true,
+		Probe:     probe,
+		Priority:  10,
+		Capabilities: midi.Capabilities{
+			NativeScheduling: true,
+			VirtualPorts:     true,
+			Hotplug:          true,
+			SysExStreaming:   true,
+		},
+		CreateDriver: newDriver,
+	})
+}
+
+// probe reports whether the kernel has a sequencer device to open.
+func probe() bool {
+	_, err := os.Stat(devicePath)
+	return err == nil
+}
+
+func newDriver(clientName string) (midi.Driver, error) {
+	f, err := os.OpenFile(devicePath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &driver{
+		f:             f,
+		onReceive:     midi.NopHandler,
+		onNotify:      midi.NopNotificationHandler,
+		outputs:       map[midi.Entity]*output{},
+		inputs:        map[midi.Entity]uint8{},
+		virtualInputs: map[uint8]midi.Entity{},
+		stopped:       make(chan struct{}),
+	}
+
+	if d.conn, err = f.SyscallConn(); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	if err := d.init(clientName); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	go d.readLoop()
+
+	return d, nil
+}
+
+func (d *driver) init(clientName string) error {
+	var id int32
+	if err := d.ioctl(ioctlClientID, unsafe.Pointer(&id)); err != nil {
+		return seqError("CLIENT_ID", err)
+	}
+	d.clientID = uint8(id)
+
+	ci := clientInfo{Client: id}
+	if err := d.ioctl(ioctlGetClientInfo, unsafe.Pointer(&ci)); err != nil {
+		return seqError("GET_CLIENT_INFO", err)
+	}
+	setName(&ci.Name, clientName)
+	if err := d.ioctl(ioctlSetClientInfo, unsafe.Pointer(&ci)); err != nil {
+		return seqError("SET_CLIENT_INFO", err)
+	}
+
+	qi := queueInfo{Owner: id, Locked: 1}
+	setName(&qi.Name, "default")
+	if err := d.ioctl(ioctlCreateQueue, unsafe.Pointer(&qi)); err != nil {
+		return seqError("CREATE_QUEUE", err)
+	}
+	d.queueID = uint8(qi.Queue)
+
+	start := event{
+		Type:  evStart,
+		Queue: queueDirect,
+		Dest:  addr{clientSystem, portSystemTimer},
+	}
+	start.Data[0] = d.queueID
+	if _, err := d.f.Write(appendEvent(nil, &start)); err != nil {
+		return seqError("start queue", err)
+	}
+	d.queueStart = time.Now()
+
+	return d.subscribeAnnounce()
+}
+
+type output struct {
+	port uint8
+	enc  encoder
+}
+
+type driver struct {
+	f        *os.File
+	conn     syscall.RawConn
+	clientID uint8
+	queueID  uint8
+	closed   atomic.Bool
+	stopped  chan struct{} // closed when readLoop exits
+
+	// approximate wall clock time at which the queue started; queue real
+	// time is measured from here
+	queueStart time.Time
+
+	handlerLock sync.Mutex // guards the handlers, which readLoop calls
+	onReceive   midi.ReceiveEventHandler
+	onNotify    midi.NotificationHandler
+
+	outputLock sync.Mutex
+	outputs    map[midi.Entity]*output
+	sendBuf    []byte
+
+	inputLock     sync.Mutex
+	inputs        map[midi.Entity]uint8 // our destination port for each open input
+	virtualInputs map[uint8]midi.Entity // our virtual input ports
+}
+
+func (d *driver) ioctl(req uintptr, arg unsafe.Pointer) error {
+	var ioErr error
+	if err := d.conn.Control(func(fd uintptr) {
+		ioErr = ioctl(fd, req, arg)
+	}); err != nil {
+		return err
+	}
+	return ioErr
+}
+
+func (d *driver) Name() string {
+	return driverName
+}
+
+// Close deletes the driver's queue and closes the sequencer, which removes
+// its ports and subscriptions, then waits for the read loop to exit. It
+// must not be called from the receive or notification handler.
+func (d *driver) Close() error {
+	if !d.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	qi := queueInfo{Queue: int32(d.queueID), Owner: int32(d.clientID)}
+	d.ioctl(ioctlDeleteQueue, unsafe.Pointer(&qi))
+
+	err := d.f.Close()
+	<-d.stopped
+
+	return err
+}
+
+func (d *driver) SetReceiveHandler(handler midi.ReceiveEventHandler) {
+	if handler == nil {
+		handler = midi.NopHandler
+	}
+	d.handlerLock.Lock()
+	d.onReceive = handler
+	d.handlerLock.Unlock()
+}
+
+func (d *driver) SetNotificationHandler(handler midi.NotificationHandler) {
+	if handler == nil {
+		handler = midi.NopNotificationHandler
+	}
+	d.handlerLock.Lock()
+	d.onNotify = handler
+	d.handlerLock.Unlock()
+}
+
+// receive passes words to the receive handler.
+func (d *driver) receive(t time.Time, ent midi.Entity, words []ump.Word) {
+	d.handlerLock.Lock()
+	onReceive := d.onReceive
+	d.handlerLock.Unlock()
+	onReceive(t, ent, words)
+}
+
+// notify passes n to the notification handler.
+func (d *driver) notify(n midi.Notification) {
+	d.handlerLock.Lock()
+	onNotify := d.onNotify
+	d.handlerLock.Unlock()
+	onNotify(n)
+}
+
+// MARK: Ports
+
+// createPort creates a port of ours. If timestamp is set, events arriving
+// on it are stamped with the real time of the driver's queue.
+func (d *driver) createPort(name string, caps, typ uint32, timestamp bool) (uint8, error) {
+	pi := portInfo{
+		Addr:         addr{Client: d.clientID},
+		Capability:   caps,
+		Type:         typ,
+		MIDIChannels: 16,
+		MIDIVoices:   64,
+	}
+	setName(&pi.Name, name)
+	if timestamp {
+		pi.Flags = portFlagTimestamp | portFlagTimeReal
+		pi.TimeQueue = d.queueID
+	}
+
+	if err := d.ioctl(ioctlCreatePort, unsafe.Pointer(&pi)); err != nil {
+		return 0, seqError("CREATE_PORT", err)
+	}
+	return pi.Addr.Port, nil
+}
+
+func (d *driver) deletePort(port uint8) error {
+	pi := portInfo{Addr: addr{d.clientID, port}}
+	if err := d.ioctl(ioctlDeletePort, unsafe.Pointer(&pi)); err != nil {
+		return seqError("DELETE_PORT", err)
+	}
+	return nil
+}
+
+func (d *driver) subscribe(sender, dest addr, timestamp bool) error {
+	ps := portSubscribe{Sender: sender, Dest: dest}
+	if timestamp {
+		ps.Flags = subsFlagTimestamp | subsFlagTimeReal
+		ps.Queue = d.queueID
+	}
+	if err := d.ioctl(ioctlSubscribePort, unsafe.Pointer(&ps)); err != nil {
+		return seqError("SUBSCRIBE_PORT", err)
+	}
+	return nil
+}
+
+// MARK: Open Input
+
+func (d *driver) OpenInput(ent midi.Entity) error {
+	if d.closed.Load() {
+		return midi.ErrClosed
+	}
+
+	d.inputLock.Lock()
+	defer d.inputLock.Unlock()
+
+	if _, ok := d.inputs[ent]; ok {
+		return nil
+	}
+
+	port, err := d.createPort(fmt.Sprintf("output %d", ent), capWrite|capSubsWrite, typeMIDIGeneric, true)
+	if err != nil {
+		return err
+	}
+
+	if err := d.subscribe(entityAddr(ent), addr{d.clientID, port}, true); err != nil {
+		d.deletePort(port)
+		return err
+	}
+
+	d.inputs[ent] = port
+
+	return nil
+}
+
+// CloseInput closes an input opened with OpenInput, or a virtual input.
+// Deleting our port removes its subscription.
+func (d *driver) CloseInput(ent midi.Entity) error {
+	if d.closed.Load() {
+		return midi.ErrClosed
+	}
+
+	d.inputLock.Lock()
+	defer d.inputLock.Unlock()
+
+	port, ok := d.inputs[ent]
+	if ok {
+		delete(d.inputs, ent)
+	} else if a := entityAddr(ent); a.Client == d.clientID && d.virtualInputs[a.Port] == ent {
+		port = a.Port
+		delete(d.virtualInputs, port)
+	} else {
+		return ErrInputNotOpen
+	}
+
+	return d.deletePort(port)
+}
+
+// MARK: Open Output
+
+func (d *driver) OpenOutput(ent midi.Entity) error {
+	if d.closed.Load() {
+		return midi.ErrClosed
+	}
+
+	d.outputLock.Lock()
+	defer d.outputLock.Unlock()
+
+	if _, ok := d.outputs[ent]; ok {
+		return nil
+	}
+
+	port, err := d.createPort(fmt.Sprintf("input %d", ent), capRead|capSubsRead, typeMIDIGeneric|typeApplication, false)
+	if err != nil {
+		return err
+	}
+
+	if err := d.subscribe(addr{d.clientID, port}, entityAddr(ent), false); err != nil {
+		d.deletePort(port)
+		return err
+	}
+
+	d.outputs[ent] = &output{port: port}
+
+	return nil
+}
+
+// CloseOutput closes an output opened with OpenOutput, or a virtual output.
+func (d *driver) CloseOutput(ent midi.Entity) error {
+	if d.closed.Load() {
+		return midi.ErrClosed
+	}
+
+	d.outputLock.Lock()
+	defer d.outputLock.Unlock()
+
+	out, ok := d.outputs[ent]
+	if !ok {
+		return ErrOutputNotOpen
+	}
+	delete(d.outputs, ent)
+
+	return d.deletePort(out.port)
+}
+
+// MARK: Virtual Ports
+
+// CreateVirtualInput creates a port that other clients can subscribe to
+// and send to. Events arriving on it are timestamped on the driver's queue
+// and reported with the port's own Entity, whichever client sent them.
+func (d *driver) CreateVirtualInput(name string) (midi.Entity, error) {
+	if d.closed.Load() {
+		return 0, midi.ErrClosed
+	}
+
+	port, err := d.createPort(name, capWrite|capSubsWrite, typeMIDIGeneric|typeApplication, true)
+	if err != nil {
+		return 0, err
+	}
+
+	ent := makeEntity(addr{d.clientID, port})
+
+	d.inputLock.Lock()
+	d.virtualInputs[port] = ent
+	d.inputLock.Unlock()
+
+	return ent, nil
+}
+
+// CreateVirtualOutput creates a port that other clients can subscribe to.
+// Data sent to the returned Entity is delivered to every subscriber.
+func (d *driver) CreateVirtualOutput(name string) (midi.Entity, error) {
+	if d.closed.Load() {
+		return 0, midi.ErrClosed
+	}
+
+	port, err := d.createPort(name, capRead|capSubsRead, typeMIDIGeneric|typeApplication, false)
+	if err != nil {
+		return 0, err
+	}
+
+	ent := makeEntity(addr{d.clientID, port})
+
+	d.outputLock.Lock()
+	d.outputs[ent] = &output{port: port}
+	d.outputLock.Unlock()
+
+	return ent, nil
+}
+
+// eventEntity returns the Entity an event is reported with: the virtual
+// input it arrived on, if any, otherwise its source.
+func (d *driver) eventEntity(evt *event) midi.Entity {
+	d.inputLock.Lock()
+	defer d.inputLock.Unlock()
+
+	if ent, ok := d.virtualInputs[evt.Dest.Port]; ok && evt.Dest.Client == d.clientID {
+		return ent
+	}
+	return makeEntity(evt.Source)
+}
+
+// MARK: Send
+
+// Send schedules words for delivery to ent at time t on the driver's queue,
+// or delivers them immediately if t is the zero time.
+func (d *driver) Send(t time.Time, ent midi.Entity, words []ump.Word) error {
+	if d.closed.Load() {
+		return midi.ErrClosed
+	}
+
+	d.outputLock.Lock()
+	defer d.outputLock.Unlock()
+
+	out, ok := d.outputs[ent]
+	if !ok {
+		return ErrOutputNotOpen
+	}
+
+	var events []event
+	d.sendBuf = d.sendBuf[:0]
+	for len(words) > 0 {
+		msg, rest := ump.Next(words)
+		if msg == nil {
+			break
+		}
+		words = rest
+
+		events = out.enc.encode(events[:0], msg)
+		for i := range events {
+			d.sendBuf = d.appendOutputEvent(d.sendBuf, &events[i], out.port, t)
+		}
+	}
+
+	return d.write(d.sendBuf)
+}
+
+func (d *driver) SendSysEx(ent midi.Entity, words []ump.Word) error {
+	return d.Send(time.Time{}, ent, words)
+}
+
+func (d *driver) SendSysExV1(ent midi.Entity, data []byte) error {
+	if d.closed.Load() {
+		return midi.ErrClosed
+	}
+
+	d.outputLock.Lock()
+	defer d.outputLock.Unlock()
+
+	out, ok := d.outputs[ent]
+	if !ok {
+		return ErrOutputNotOpen
+	}
+
+	evt := event{Type: evSysEx, Flags: flagLengthVariable, Ext: data}
+	d.sendBuf = d.appendOutputEvent(d.sendBuf[:0], &evt, out.port, time.Time{})
+	return d.write(d.sendBuf)
+}
+
+func (d *driver) appendOutputEvent(dst []byte, evt *event, port uint8, t time.Time) []byte {
+	evt.Source = addr{d.clientID, port}
+	evt.Dest = addr{addressSubscribers, addressUnknown}
+	evt.schedule(d.queueID, d.queueStart, t)
+	return appendEvent(dst, evt)
+}
+
+func (d *driver) write(buf []byte) error {
+	for len(buf) > 0 {
+		n, err := d.f.Write(buf)
+		if err != nil {
+			return seqError("write", err)
+		}
+		buf = buf[n:]
+	}
+	return nil
+}
+
+// MARK: Connections
+
+// Connect subscribes dst to src, as aconnect does.
+func (d *driver) Connect(src, dst midi.Entity) error {
+	if d.closed.Load() {
+		return midi.ErrClosed
+	}
+
+	ps := portSubscribe{Sender: entityAddr(src), Dest: entityAddr(dst)}
+	if err := d.ioctl(ioctlSubscribePort, unsafe.Pointer(&ps)); err != nil {
+		return seqError("SUBSCRIBE_PORT", err)
+	}
+	return nil
+}
+
+func (d *driver) Disconnect(src, dst midi.Entity) error {
+	if d.closed.Load() {
+		return midi.ErrClosed
+	}
+
+	ps := portSubscribe{Sender: entityAddr(src), Dest: entityAddr(dst)}
+	if err := d.ioctl(ioctlUnsubscribePort, unsafe.Pointer(&ps)); err != nil {
+		return seqError("UNSUBSCRIBE_PORT", err)
+	}
+	return nil
+}
+
+// Connections lists the subscribers of every port, including the driver's
+// own.
+func (d *driver) Connections() ([]midi.Connection, error) {
+	if d.closed.Load() {
+		return nil, midi.ErrClosed
+	}
+
+	var out []midi.Connection
+
+	ci := clientInfo{Client: -1}
+	for d.ioctl(ioctlQueryNextClient, unsafe.Pointer(&ci)) == nil {
+		pi := portInfo{Addr: addr{uint8(ci.Client), 0xFF}}
+		for d.ioctl(ioctlQueryNextPort, unsafe.Pointer(&pi)) == nil {
+			qs := querySubs{Root: pi.Addr, Type: querySubsRead}
+			for ; d.ioctl(ioctlQuerySubs, unsafe.Pointer(&qs)) == nil; qs.Index++ {
+				out = append(out, midi.Connection{
+					Source: makeEntity(pi.Addr),
+					Dest:   makeEntity(qs.Addr),
+				})
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// MARK: Enumerate
+
+func (d *driver) Enumerate() (*midi.Node, error) {
+	if d.closed.Load() {
+		return nil, midi.ErrClosed
+	}
+
+	root := &midi.Node{
+		Type: midi.Root,
+	}
+
+	ci := clientInfo{Client: -1}
+	for d.ioctl(ioctlQueryNextClient, unsafe.Pointer(&ci)) == nil {
+		clientID := uint8(ci.Client)
+		if clientID == d.clientID {
+			continue
+		}
+
+		device := &midi.Node{
+			Type:         midi.Device,
+			Manufacturer: "",
+			Model:        "",
+			Name:         getName(&ci.Name),
+			Driver:       d,
+			Entity:       makeEntity(addr{Client: clientID}),
+		}
+
+		pi := portInfo{Addr: addr{clientID, 0xFF}}
+		for d.ioctl(ioctlQueryNextPort, unsafe.Pointer(&pi)) == nil {
+			portName := getName(&pi.Name)
+			ent := makeEntity(pi.Addr)
+
+			portGroup := &midi.Node{
+				Type:         midi.PortGroup,
+				Manufacturer: "",
+				Model:        "",
+				Name:         portName,
+				Driver:       d,
+				Entity:       ent,
+				Metadata: map[string]any{
+					fmt.Sprintf("%s:type", driverName): stringFromBitmask(pi.Type, portTypeBits),
+					fmt.Sprintf("%s:caps", driverName): stringFromBitmask(pi.Capability, portCapBits),
+				},
+			}
+
+			if pi.Capability&capRead > 0 {
+				portGroup.Children = append(portGroup.Children, &midi.Node{
+					Type:         midi.Input,
+					Manufacturer: "",
+					Model:        "",
+					Name:         fmt.Sprintf("%s input", portName),
+					Driver:       d,
+					Entity:       ent,
+				})
+			}
+
+			if pi.Capability&capWrite > 0 {
+				portGroup.Children = append(portGroup.Children, &midi.Node{
+					Type:         midi.Output,
+					Manufacturer: "",
+					Model:        "",
+					Name:         fmt.Sprintf("%s output", portName),
+					Driver:       d,
+					Entity:       ent,
+				})
+			}
+
+			device.Children = append(device.Children, portGroup)
+		}
+
+		root.Children = append(root.Children, device)
+	}
+
+	return root, nil
+}
+
+// MARK: Announcements
+
+// subscribeAnnounce connects a private port to the System Announce port,
+// which reports clients and ports starting, exiting and changing.
+func (d *driver) subscribeAnnounce() error {
+	port, err := d.createPort("announce", capWrite|capNoExport, typeApplication, false)
+	if err != nil {
+		return err
+	}
+
+	if err := d.subscribe(addr{clientSystem, portSystemAnnounce}, addr{d.clientID, port}, false); err != nil {
+		d.deletePort(port)
+		return err
+	}
+
+	return nil
+}
+
+// announce relays a System Announce event to the notification handler. It
+// reports false if evt is not an announcement.
+func (d *driver) announce(evt *event) bool {
+	var typ midi.NotificationType
+	switch evt.Type {
+	case evClientStart:
+		typ = midi.DeviceAdded
+	case evClientExit:
+		typ = midi.DeviceRemoved
+	case evClientChange:
+		typ = midi.DeviceChanged
+	case evPortStart:
+		typ = midi.PortAdded
+	case evPortExit:
+		typ = midi.PortRemoved
+	case evPortChange:
+		typ = midi.PortChanged
+	default:
+		return false
+	}
+
+	a := evt.addr()
+	if a.Client == d.clientID {
+		return true // our own ports
+	}
+
+	ent := makeEntity(addr{Client: a.Client})
+	if typ >= midi.PortAdded {
+		ent = makeEntity(a)
+	}
+	d.notify(midi.Notification{Type: typ, Entity: ent})
+
+	return true
+}
+
+// MARK: Read Loop
+
+func (d *driver) readLoop() {
+	defer close(d.stopped)
+
+	buf := make([]byte, readBufferSize)
+	dec := decoder{sysex: map[addr][]byte{}}
+
+	var evt event
+	var words []ump.Word
+
+	for {
+		n, err := d.f.Read(buf)
+		if errors.Is(err, syscall.ENOSPC) {
+			log.Printf("%s: input overrun, events lost", driverName)
+			continue
+		} else if err != nil {
+			if !d.closed.Load() {
+				log.Printf("read loop returned error %s, exiting", err)
+			}
+			return
+		}
+
+		now := time.Now()
+
+		var batchTimestamp time.Time
+		var batchEntity midi.Entity
+
+		for p := buf[:n]; len(p) > 0; {
+			size := parseEvent(&evt, p)
+			if size == 0 {
+				break
+			}
+			p = p[size:]
+
+			if d.announce(&evt) {
+				continue
+			}
+
+			thisTimestamp := d.eventTime(&evt, now)
+			thisEntity := d.eventEntity(&evt)
+			if len(words) > 0 && (!thisTimestamp.Equal(batchTimestamp) || thisEntity != batchEntity) {
+				d.receive(batchTimestamp, batchEntity, words)
+				words = words[:0]
+			}
+			batchTimestamp = thisTimestamp
+			batchEntity = thisEntity
+
+			words = dec.append(words, &evt)
+		}
+
+		if len(words) > 0 {
+			d.receive(batchTimestamp, batchEntity, words)
+			words = words[:0]
+		}
+	}
+}
+
+// eventTime returns the time at which evt was received. Events timestamped
+// in real time on our queue are converted to wall clock time; anything else
+// is stamped with now.
+func (d *driver) eventTime(evt *event, now time.Time) time.Time {
+	if evt.Flags&flagTimeStampReal == 0 || evt.Queue != d.queueID {
+		return now
+	}
+	return d.queueStart.Add(time.Duration(evt.Sec)*time.Second + time.Duration(evt.Nsec))
+}
+
+// MARK: Helpers
+
+var portCapBits = []string{
+	"READ",
+	"WRITE",
+	"SYNC_READ",
+	"SYNC_WRITE",
+	"DUPLEX",
+	"SUBS_READ",
+	"SUBS_WRITE",
+	"NO_EXPORT",
+	"INACTIVE",
+	"UMP_ENDPOINT",
+}
+
+var portTypeBits = []string{
+	"SPECIFIC",
+	"GENERIC",
+	"GM",
+	"GS",
+	"XG",
+	"MT32",
+	"GM2",
+	"UMP",
+	"",
+	"",
+	"SYNTH",
+	"DIRECT_SAMPLE",
+	"SAMPLE",
+	"",
+	"",
+	"",
+	"HARDWARE",
+	"SOFTWARE",
+	"SYNTHESIZER",
+	"PORT",
+	"APPLICATION",
+}
+
+func stringFromBitmask(val uint32, bitNames []string) string {
+	out := strings.Builder{}
+	for i, n := range bitNames {
+		if n == "" {
+			continue
+		}
+		if val&(1<<i) > 0 {
+			out.WriteString(":" + n)
+		}
+	}
+	if out.Len() > 0 {
+		out.WriteRune(':')
+	}
+	return out.String()
+}
+
+func makeEntity(a addr) midi.Entity {
+	return midi.Entity(uint32(a.Client)<<8 | uint32(a.Port))
+}
+
+func entityAddr(e midi.Entity) addr {
+	return addr{uint8(uint32(e) >> 8), uint8(e)}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package alsaseq
+
+import (
+	"github.com/jaz303/midi"
+)
+
+func init() {
+	midi.Register(&midi.Stub{
+		Name:      "alsa-seq",
+		Available: false,
+		CreateDriver: func(string) (midi.Driver, error) {
+			return nil, midi.ErrDriverNotAvailable
+		},
+	})
+}
@@ -0,0 +1,399 @@
+//go:build linux
+
+package alsaseq
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/jaz303/midi/ump"
+)
+
+// Event types, from <sound/asequencer.h>
+const (
+	evNote         = 5
+	evNoteOn       = 6
+	evNoteOff      = 7
+	evKeyPress     = 8
+	evController   = 10
+	evPgmChange    = 11
+	evChanPress    = 12
+	evPitchBend    = 13
+	evControl14    = 14
+	evNonRegParam  = 15
+	evRegParam     = 16
+	evSongPos      = 20
+	evSongSel      = 21
+	evQFrame       = 22
+	evStart        = 30
+	evContinue     = 31
+	evStop         = 32
+	evClock        = 36
+	evTuneRequest  = 40
+	evReset        = 41
+	evSensing      = 42
+	evClientStart  = 60
+	evClientExit   = 61
+	evClientChange = 62
+	evPortStart    = 63
+	evPortExit     = 64
+	evPortChange   = 65
+	evSysEx        = 130
+)
+
+// Event flags
+const (
+	flagTimeStampReal  = 1 << 0
+	flagTimeModeRel    = 1 << 1
+	flagLengthVariable = 1 << 2
+	flagLengthMask     = 3 << 2
+
+	extLengthMask = 0x3FFFFFFF
+)
+
+// Special addresses and queues
+const (
+	clientSystem       = 0
+	portSystemTimer    = 0
+	portSystemAnnounce = 1
+	addressUnknown     = 253
+	addressSubscribers = 254
+	queueDirect        = 253
+)
+
+// eventSize is the size of struct snd_seq_event; variable length data
+// follows the event on read and write.
+const eventSize = 28
+
+// event is struct snd_seq_event. Data holds the union; its layout depends
+// on Type.
+type event struct {
+	Type   uint8
+	Flags  uint8
+	Tag    uint8
+	Queue  uint8
+	Sec    uint32 // real time, or tick in Sec
+	Nsec   uint32
+	Source addr
+	Dest   addr
+	Data   [12]byte
+
+	Ext []byte // variable length data
+}
+
+// parseEvent decodes the event at the start of buf and returns the number
+// of bytes it occupies, or 0 if buf does not hold a complete event.
+func parseEvent(evt *event, buf []byte) int {
+	if len(buf) < eventSize {
+		return 0
+	}
+
+	ne := binary.NativeEndian
+	evt.Type, evt.Flags, evt.Tag, evt.Queue = buf[0], buf[1], buf[2], buf[3]
+	evt.Sec = ne.Uint32(buf[4:])
+	evt.Nsec = ne.Uint32(buf[8:])
+	evt.Source = addr{buf[12], buf[13]}
+	evt.Dest = addr{buf[14], buf[15]}
+	copy(evt.Data[:], buf[16:eventSize])
+	evt.Ext = nil
+
+	if evt.Flags&flagLengthMask != flagLengthVariable {
+		return eventSize
+	}
+
+	n := int(ne.Uint32(evt.Data[:]) & extLengthMask)
+	if len(buf) < eventSize+n {
+		return 0
+	}
+	evt.Ext = buf[eventSize : eventSize+n]
+	return eventSize + n
+}
+
+// appendEvent appends the wire form of evt to dst, followed by Ext for
+// variable length events.
+func appendEvent(dst []byte, evt *event) []byte {
+	ne := binary.NativeEndian
+	dst = append(dst, evt.Type, evt.Flags, evt.Tag, evt.Queue)
+	dst = ne.AppendUint32(dst, evt.Sec)
+	dst = ne.AppendUint32(dst, evt.Nsec)
+	dst = append(dst, evt.Source.Client, evt.Source.Port, evt.Dest.Client, evt.Dest.Port)
+
+	data := evt.Data
+	if evt.Flags&flagLengthMask == flagLengthVariable {
+		ne.PutUint32(data[:], uint32(len(evt.Ext)))
+		// the pointer is ignored; the kernel reads the data that follows
+		clear(data[4:])
+	}
+	dst = append(dst, data[:]...)
+
+	if evt.Flags&flagLengthMask == flagLengthVariable {
+		dst = append(dst, evt.Ext...)
+	}
+	return dst
+}
+
+// schedule sets evt to be delivered directly, or at t on queue if t is
+// after start.
+func (evt *event) schedule(queue uint8, start, t time.Time) {
+	evt.Queue = queueDirect
+	if t.IsZero() {
+		return
+	}
+	if offset := t.Sub(start); offset > 0 {
+		evt.Queue = queue
+		evt.Flags = evt.Flags&^(flagTimeModeRel) | flagTimeStampReal
+		evt.Sec = uint32(offset / time.Second)
+		evt.Nsec = uint32(offset % time.Second)
+	}
+}
+
+// Accessors for the data union
+
+func (evt *event) note() (channel, note, velocity uint8) {
+	return evt.Data[0], evt.Data[1], evt.Data[2]
+}
+
+func (evt *event) control() (channel uint8, param uint32, value int32) {
+	ne := binary.NativeEndian
+	return evt.Data[0], ne.Uint32(evt.Data[4:]), int32(ne.Uint32(evt.Data[8:]))
+}
+
+func (evt *event) setNote(channel, note, velocity uint8) {
+	evt.Data = [12]byte{channel & 0x0F, note & 0x7F, velocity & 0x7F}
+}
+
+func (evt *event) setControl(channel uint8, param uint32, value int32) {
+	ne := binary.NativeEndian
+	evt.Data = [12]byte{channel & 0x0F}
+	ne.PutUint32(evt.Data[4:], param)
+	ne.PutUint32(evt.Data[8:], uint32(value))
+}
+
+func (evt *event) addr() addr {
+	return addr{evt.Data[0], evt.Data[1]}
+}
+
+// MARK: Decoding
+
+// decoder converts received events to UMP. SysEx arrives in chunks, which
+// are buffered per source until the message is complete.
+type decoder struct {
+	sysex map[addr][]byte
+}
+
+func (dec *decoder) append(dst []ump.Word, evt *event) []ump.Word {
+	switch evt.Type {
+	case evNoteOn, evNote:
+		ch, note, vel := evt.note()
+		return append(dst, ump.NoteOn(ch, int8(note), int8(vel)))
+	case evNoteOff:
+		ch, note, vel := evt.note()
+		return append(dst, ump.NoteOff(ch, int8(note), int8(vel)))
+	case evKeyPress:
+		ch, note, vel := evt.note()
+		return append(dst, ump.PolyPressure(ch, int8(note), int8(vel)))
+	case evSysEx:
+		return dec.appendSysEx(dst, evt.Source, evt.Ext)
+	}
+
+	ch, p, v := evt.control()
+	param, value := int(p), int(v)
+
+	switch evt.Type {
+	case evController:
+		return append(dst, ump.ControlChange(ch, int8(param&0x7F), int8(value&0x7F)))
+	case evControl14:
+		if param >= 32 {
+			return append(dst, ump.ControlChange(ch, int8(param&0x7F), int8(value&0x7F)))
+		}
+		return append(dst,
+			ump.ControlChange(ch, int8(param), int8(value>>7&0x7F)),
+			ump.ControlChange(ch, int8(param+32), int8(value&0x7F)))
+	case evRegParam, evNonRegParam:
+		msb, lsb := int8(101), int8(100)
+		if evt.Type == evNonRegParam {
+			msb, lsb = 99, 98
+		}
+		return append(dst,
+			ump.ControlChange(ch, msb, int8(param>>7&0x7F)),
+			ump.ControlChange(ch, lsb, int8(param&0x7F)),
+			ump.ControlChange(ch, 6, int8(value>>7&0x7F)),
+			ump.ControlChange(ch, 38, int8(value&0x7F)))
+	case evPgmChange:
+		return append(dst, ump.ProgramChange(ch, int8(value&0x7F)))
+	case evChanPress:
+		return append(dst, ump.ChannelPressure(ch, int8(value&0x7F)))
+	case evPitchBend:
+		return append(dst, ump.PitchBend(ch, uint16(value+8192)&0x3FFF))
+	case evSongPos:
+		return append(dst, ump.SongPosition(uint16(value)))
+	case evSongSel:
+		return append(dst, ump.SongSelect(uint8(value)))
+	case evQFrame:
+		return append(dst, ump.TimeCode(uint8(value)))
+	case evTuneRequest:
+		return append(dst, ump.TuneRequest)
+	case evClock:
+		return append(dst, ump.Clock)
+	case evStart:
+		return append(dst, ump.Start)
+	case evContinue:
+		return append(dst, ump.Continue)
+	case evStop:
+		return append(dst, ump.Stop)
+	case evSensing:
+		return append(dst, ump.ActiveSensing)
+	case evReset:
+		return append(dst, ump.Reset)
+	}
+
+	return dst
+}
+
+func (dec *decoder) appendSysEx(dst []ump.Word, src addr, chunk []byte) []ump.Word {
+	if len(chunk) == 0 {
+		return dst
+	}
+
+	buf := dec.sysex[src]
+	if chunk[0] == 0xF0 {
+		buf = buf[:0]
+	} else if len(buf) == 0 {
+		return dst // continuation with no start
+	}
+	buf = append(buf, chunk...)
+
+	if buf[len(buf)-1] != 0xF7 {
+		dec.sysex[src] = buf
+		return dst
+	}
+
+	dst = ump.AppendSysEx7(dst, 0, buf)
+	dec.sysex[src] = buf[:0]
+	return dst
+}
+
+// MARK: Encoding
+
+// encoder converts UMP to events. SysEx7 packets are collected until the
+// message is complete and sent as a single variable length event.
+type encoder struct {
+	sysex []byte
+}
+
+// encode converts a single UMP message to events and appends them to dst.
+// MIDI 2.0 channel voice messages are converted to MIDI 1.0 first, which
+// can take several events, e.g. for an RPN or a program change with bank
+// select.
+func (enc *encoder) encode(dst []event, msg []ump.Word) []event {
+	if ump.MessageType(msg[0]) == ump.MsgTypeMIDIv2 {
+		var buf [4]ump.Word
+		out, ok := ump.ToMIDI1(buf[:0], msg)
+		if !ok {
+			return dst
+		}
+		for _, w := range out {
+			dst = enc.encode(dst, []ump.Word{w})
+		}
+		return dst
+	}
+
+	var evt event
+	if enc.encodeEvent(&evt, msg) {
+		dst = append(dst, evt)
+	}
+	return dst
+}
+
+// encodeEvent converts a single MIDI 1.0, system or SysEx7 message to evt,
+// reporting false if it has no event equivalent or is an incomplete SysEx
+// packet.
+func (enc *encoder) encodeEvent(evt *event, msg []ump.Word) bool {
+	evt.Flags, evt.Data, evt.Ext = 0, [12]byte{}, nil
+
+	switch ump.MessageType(msg[0]) {
+	case ump.MsgTypeData:
+		status := ump.SysEx7Status(msg[0])
+		if status == ump.SysEx7Complete || status == ump.SysEx7Start {
+			enc.sysex = append(enc.sysex[:0], 0xF0)
+		} else if len(enc.sysex) == 0 {
+			return false
+		}
+		enc.sysex = ump.AppendSysEx7Payload(enc.sysex, msg)
+		if status != ump.SysEx7Complete && status != ump.SysEx7End {
+			return false
+		}
+		enc.sysex = append(enc.sysex, 0xF7)
+		evt.Type = evSysEx
+		evt.Flags = flagLengthVariable
+		evt.Ext = enc.sysex
+		return true
+	case ump.MsgTypeMIDIv1, ump.MsgTypeSystem:
+	default:
+		return false
+	}
+
+	w := msg[0]
+	status, d1, d2 := ump.Status(w), uint8(w>>8)&0x7F, uint8(w)&0x7F
+	ch := status & 0x0F
+
+	switch status >> 4 {
+	case 0x8:
+		evt.Type = evNoteOff
+		evt.setNote(ch, d1, d2)
+	case 0x9:
+		evt.Type = evNoteOn
+		evt.setNote(ch, d1, d2)
+	case 0xA:
+		evt.Type = evKeyPress
+		evt.setNote(ch, d1, d2)
+	case 0xB:
+		evt.Type = evController
+		evt.setControl(ch, uint32(d1), int32(d2))
+	case 0xC:
+		evt.Type = evPgmChange
+		evt.setControl(ch, 0, int32(d1))
+	case 0xD:
+		evt.Type = evChanPress
+		evt.setControl(ch, 0, int32(d1))
+	case 0xE:
+		evt.Type = evPitchBend
+		evt.setControl(ch, 0, (int32(d1)|int32(d2)<<7)-8192)
+	case 0xF:
+		return encodeSystem(evt, status, d1, d2)
+	default:
+		return false
+	}
+	return true
+}
+
+func encodeSystem(evt *event, status, d1, d2 uint8) bool {
+	switch status {
+	case 0xF1:
+		evt.Type = evQFrame
+		evt.setControl(0, 0, int32(d1))
+	case 0xF2:
+		evt.Type = evSongPos
+		evt.setControl(0, 0, int32(d1)|int32(d2)<<7)
+	case 0xF3:
+		evt.Type = evSongSel
+		evt.setControl(0, 0, int32(d1))
+	case 0xF6:
+		evt.Type = evTuneRequest
+	case 0xF8:
+		evt.Type = evClock
+	case 0xFA:
+		evt.Type = evStart
+	case 0xFB:
+		evt.Type = evContinue
+	case 0xFC:
+		evt.Type = evStop
+	case 0xFE:
+		evt.Type = evSensing
+	case 0xFF:
+		evt.Type = evReset
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+//go:build linux
+
+package alsaseq
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// Mirrors of the structures in <sound/asequencer.h>. Field order and types
+// follow the kernel's so that Go lays them out identically.
+
+type addr struct {
+	Client uint8
+	Port   uint8
+}
+
+type clientInfo struct {
+	Client          int32
+	Type            int32
+	Name            [64]byte
+	Filter          uint32
+	MulticastFilter [8]byte
+	EventFilter     [32]byte
+	NumPorts        int32
+	EventLost       int32
+	Card            int32
+	PID             int32
+	MIDIVersion     uint32
+	GroupFilter     uint32
+	Reserved        [48]byte
+}
+
+type portInfo struct {
+	Addr         addr
+	Name         [64]byte
+	Capability   uint32
+	Type         uint32
+	MIDIChannels int32
+	MIDIVoices   int32
+	SynthVoices  int32
+	ReadUse      int32
+	WriteUse     int32
+	Kernel       uintptr
+	Flags        uint32
+	TimeQueue    uint8
+	Direction    uint8
+	UMPGroup     uint8
+	Reserved     [57]byte
+}
+
+type portSubscribe struct {
+	Sender   addr
+	Dest     addr
+	Voices   uint32
+	Flags    uint32
+	Queue    uint8
+	Pad      [3]byte
+	Reserved [64]byte
+}
+
+type queueInfo struct {
+	Queue    int32
+	Owner    int32
+	Locked   uint32 // bit 0
+	Name     [64]byte
+	Flags    uint32
+	Reserved [60]byte
+}
+
+type querySubs struct {
+	Root     addr
+	Type     int32
+	Index    int32
+	NumSubs  int32
+	Addr     addr
+	Queue    uint8
+	Flags    uint32
+	Reserved [64]byte
+}
+
+const (
+	iocWrite = 1
+	iocRead  = 2
+)
+
+func ioc(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | 'S'<<8 | nr
+}
+
+var (
+	ioctlClientID        = ioc(iocRead, 0x01, 4)
+	ioctlGetClientInfo   = ioc(iocRead|iocWrite, 0x10, unsafe.Sizeof(clientInfo{}))
+	ioctlSetClientInfo   = ioc(iocWrite, 0x11, unsafe.Sizeof(clientInfo{}))
+	ioctlCreatePort      = ioc(iocRead|iocWrite, 0x20, unsafe.Sizeof(portInfo{}))
+	ioctlDeletePort      = ioc(iocWrite, 0x21, unsafe.Sizeof(portInfo{}))
+	ioctlSubscribePort   = ioc(iocWrite, 0x30, unsafe.Sizeof(portSubscribe{}))
+	ioctlUnsubscribePort = ioc(iocWrite, 0x31, unsafe.Sizeof(portSubscribe{}))
+	ioctlCreateQueue     = ioc(iocRead|iocWrite, 0x32, unsafe.Sizeof(queueInfo{}))
+	ioctlDeleteQueue     = ioc(iocWrite, 0x33, unsafe.Sizeof(queueInfo{}))
+	ioctlQuerySubs       = ioc(iocRead|iocWrite, 0x4F, unsafe.Sizeof(querySubs{}))
+	ioctlQueryNextClient = ioc(iocRead|iocWrite, 0x51, unsafe.Sizeof(clientInfo{}))
+	ioctlQueryNextPort   = ioc(iocRead|iocWrite, 0x52, unsafe.Sizeof(portInfo{}))
+)
+
+func ioctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func setName(dst *[64]byte, name string) {
+	*dst = [64]byte{}
+	copy(dst[:len(dst)-1], name)
+}
+
+func getName(src *[64]byte) string {
+	for i, b := range src {
+		if b == 0 {
+			return string(src[:i])
+		}
+	}
+	return string(src[:])
+}
@@ -0,0 +1,304 @@
+package ci
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+const (
+	DefaultTimeout      = 3 * time.Second
+	DefaultMaxSysExSize = 512
+)
+
+// Config describes the local device an Agent represents.
+type Config struct {
+	Device     DeviceInfo
+	Categories Category
+
+	// Largest SysEx message we can receive; DefaultMaxSysExSize if zero.
+	MaxSysExSize uint32
+
+	// UMP group used for sending and receiving.
+	Group uint8
+
+	// Function block reported in Reply to Discovery; 0x7F if none.
+	FunctionBlock byte
+
+	// Reported in reply to Endpoint Information inquiries, if non-empty.
+	ProductInstanceID string
+
+	// Time to wait for replies to requests; DefaultTimeout if zero.
+	Timeout time.Duration
+
+	// If non-nil, called from the receive path each time a remote device
+	// is discovered or its MUID is invalidated.
+	OnRemote func(r *Remote, added bool)
+
+	// If non-nil, called from the receive path for each profile
+	// notification received from a remote device.
+	OnProfile func(evt *ProfileEvent)
+
+	// If non-nil, MIDI Message Report inquiries are answered from this
+	// state, which the application must keep up to date with everything
+	// it sends on the agent's group.
+	State *ChannelState
+}
+
+// Remote describes a device that has been seen through Discovery.
+type Remote struct {
+	MUID MUID
+	Discovery
+}
+
+// Agent is a MIDI-CI endpoint bound to one output entity of a Driver.
+//
+// Incoming data must be passed to Handle, typically by wrapping the
+// driver's receive handler with Handler.
+type Agent struct {
+	driver midi.Driver
+	output midi.Entity
+	cfg    Config
+
+	syx ump.SysEx7Assembler
+
+	mu       sync.Mutex
+	muid     MUID
+	remotes  map[MUID]*Remote
+	pending  map[txKey]*transaction
+	handlers map[byte]func(*Message)
+	profiles map[profileKey]*LocalProfile
+	closed   bool
+
+	peChunks          map[peKey]*pePartial
+	peRequestID       byte
+	peResources       map[string]*Resource
+	peSubscribers     map[string]*serverSubscription
+	peSubscriptions   map[string]*clientSubscription
+	peNextSubscribeID int
+
+	reportWords []ump.Word
+}
+
+// New creates an Agent that sends through output on driver. A random MUID is
+// allocated immediately.
+func New(driver midi.Driver, output midi.Entity, cfg *Config) *Agent {
+	a := &Agent{
+		driver:  driver,
+		output:  output,
+		cfg:     *cfg,
+		muid:    NewMUID(),
+		remotes: map[MUID]*Remote{},
+		pending: map[txKey]*transaction{},
+
+		profiles: map[profileKey]*LocalProfile{},
+
+		peChunks:        map[peKey]*pePartial{},
+		peResources:     map[string]*Resource{},
+		peSubscribers:   map[string]*serverSubscription{},
+		peSubscriptions: map[string]*clientSubscription{},
+	}
+
+	if a.cfg.MaxSysExSize == 0 {
+		a.cfg.MaxSysExSize = DefaultMaxSysExSize
+	}
+	if a.cfg.Timeout == 0 {
+		a.cfg.Timeout = DefaultTimeout
+	}
+	if a.cfg.FunctionBlock == 0 {
+		a.cfg.FunctionBlock = 0x7F
+	}
+
+	a.handlers = map[byte]func(*Message){
+		SubDiscovery:      a.onDiscovery,
+		SubDiscoveryReply: a.onDiscoveryReply,
+		SubEndpointInfo:   a.onEndpointInfo,
+		SubInvalidateMUID: a.onInvalidateMUID,
+
+		SubProfileInquiry:        a.onProfileInquiry,
+		SubSetProfileOn:          a.onSetProfile,
+		SubSetProfileOff:         a.onSetProfile,
+		SubProfileDetailsInquiry: a.onProfileDetails,
+		SubProfileEnabled:        a.onProfileNotification,
+		SubProfileDisabled:       a.onProfileNotification,
+		SubProfileAdded:          a.onProfileNotification,
+		SubProfileRemoved:        a.onProfileNotification,
+		SubProfileSpecificData:   a.onProfileNotification,
+
+		SubPECapabilities:   a.onPECapabilities,
+		SubPEGet:            a.onPEMessage,
+		SubPEGetReply:       a.onPEMessage,
+		SubPESet:            a.onPEMessage,
+		SubPESetReply:       a.onPEMessage,
+		SubPESubscribe:      a.onPEMessage,
+		SubPESubscribeReply: a.onPEMessage,
+		SubPENotify:         a.onPENotify,
+
+		SubProcessCapabilities: a.onProcessCapabilities,
+		SubMessageReport:       a.onMessageReport,
+	}
+
+	return a
+}
+
+// MUID returns the agent's current MUID.
+func (a *Agent) MUID() MUID {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.muid
+}
+
+// Remotes returns the devices discovered so far.
+func (a *Agent) Remotes() []*Remote {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]*Remote, 0, len(a.remotes))
+	for _, r := range a.remotes {
+		out = append(out, r)
+	}
+	return out
+}
+
+// Remote returns the discovered device with the given MUID, or nil.
+func (a *Agent) Remote(muid MUID) *Remote {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.remotes[muid]
+}
+
+// Close invalidates the agent's MUID on the network and fails any
+// outstanding requests with ErrClosed.
+func (a *Agent) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	for k, tx := range a.pending {
+		delete(a.pending, k)
+		tx.abort(ErrClosed)
+	}
+	muid := a.muid
+	a.mu.Unlock()
+
+	return a.invalidate(muid)
+}
+
+// Handler returns a ReceiveEventHandler that passes events from input to
+// the agent before forwarding all events to next. next may be nil.
+func (a *Agent) Handler(input midi.Entity, next midi.ReceiveEventHandler) midi.ReceiveEventHandler {
+	if next == nil {
+		next = midi.NopHandler
+	}
+	return func(time time.Time, entity midi.Entity, words []ump.Word) {
+		if entity == input {
+			a.Handle(words)
+		}
+		next(time, entity, words)
+	}
+}
+
+// Handle processes UMP data received from the device's input. SysEx7
+// messages on the agent's group are reassembled and complete MIDI-CI
+// messages are dispatched. Other messages are only retained while a MIDI
+// Message Report is in progress.
+//
+// Handle must not be called concurrently with itself.
+func (a *Agent) Handle(words []ump.Word) {
+	for len(words) > 0 {
+		msg, rest := ump.Next(words)
+		if msg == nil {
+			return
+		}
+		words = rest
+
+		if ump.MessageType(msg[0]) != ump.MsgTypeData {
+			a.collectReport(msg)
+			continue
+		} else if ump.Group(msg[0]) != a.cfg.Group {
+			continue
+		}
+		if data, ok := a.syx.Push(msg); ok {
+			if m, err := Parse(append([]byte(nil), data...)); err == nil {
+				a.dispatch(m)
+			}
+		}
+	}
+}
+
+func (a *Agent) dispatch(m *Message) {
+	a.mu.Lock()
+	muid, closed := a.muid, a.closed
+	handler := a.handlers[m.SubID]
+	a.mu.Unlock()
+
+	if closed || (m.Destination != muid && m.Destination != Broadcast) {
+		return
+	}
+
+	if m.Source == muid && (m.SubID == SubDiscovery || m.SubID == SubDiscoveryReply) {
+		a.onCollision(m)
+		return
+	}
+
+	if handler != nil {
+		handler(m)
+	}
+
+	if a.complete(m) || handler != nil {
+		return
+	}
+
+	if m.Destination == muid && m.SubID != SubACK && m.SubID != SubNAK {
+		a.sendNAK(m, StatusMessageNotSupported, "")
+	}
+}
+
+// send encodes m and transmits it immediately.
+func (a *Agent) send(m *Message) error {
+	a.mu.Lock()
+	closed := a.closed
+	a.mu.Unlock()
+	if closed && m.SubID != SubInvalidateMUID {
+		return ErrClosed
+	}
+
+	words := ump.AppendSysEx7(nil, a.cfg.Group, m.Append(nil))
+	return a.driver.SendSysEx(a.output, words)
+}
+
+// newMessage returns a message from the agent to dest with the current
+// MUID and version filled in.
+func (a *Agent) newMessage(sub byte, deviceID byte, dest MUID, data []byte) *Message {
+	return &Message{
+		DeviceID:    deviceID,
+		SubID:       sub,
+		Version:     Version,
+		Source:      a.MUID(),
+		Destination: dest,
+		Data:        data,
+	}
+}
+
+// reply sends a reply to req with the given Sub-ID#2 and body.
+func (a *Agent) reply(req *Message, sub byte, data []byte) error {
+	return a.send(a.newMessage(sub, req.DeviceID, req.Source, data))
+}
+
+func (a *Agent) sendNAK(req *Message, status byte, text string) error {
+	nak := &NAK{SubID: req.SubID, Status: status, Text: text}
+	return a.reply(req, SubNAK, nak.Append(nil))
+}
+
+func (a *Agent) sendACK(req *Message, status byte, text string) error {
+	ack := &NAK{SubID: req.SubID, Status: status, Text: text}
+	return a.reply(req, SubACK, ack.Append(nil))
+}
+
+func (a *Agent) deadline(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, a.cfg.Timeout)
+}
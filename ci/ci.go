@@ -0,0 +1,137 @@
+// Package ci implements MIDI Capability Inquiry (MIDI-CI) over SysEx7 UMP.
+//
+// An Agent sits between a midi.Driver output and the events arriving on a
+// corresponding input. It owns a MUID, answers inquiries from other devices
+// and provides request/reply operations that wait for the matching reply.
+package ci
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// MUID is a 28-bit MIDI-CI Unique Identifier.
+type MUID uint32
+
+const (
+	// Broadcast addresses every device.
+	Broadcast = MUID(0x0FFFFFFF)
+
+	maxMUID = MUID(0x0FFFFEFF) // 0x0FFFFF00-0x0FFFFFFE are reserved
+)
+
+func (m MUID) String() string {
+	return fmt.Sprintf("%07X", uint32(m))
+}
+
+// NewMUID returns a random MUID, excluding the reserved and broadcast
+// values.
+func NewMUID() MUID {
+	for {
+		var b [4]byte
+		rand.Read(b[:])
+		if m := MUID(binary.LittleEndian.Uint32(b[:]) & 0x0FFFFFFF); m <= maxMUID {
+			return m
+		}
+	}
+}
+
+// Version is the MIDI-CI message format version sent by this package
+// (MIDI-CI 1.2).
+const Version = 0x02
+
+// Device IDs, used to address messages to a channel (0x00-0x0F) or to the
+// group or function block as a whole.
+const (
+	ToGroup         = 0x7E
+	ToFunctionBlock = 0x7F
+)
+
+// Sub-ID#2 values
+const (
+	SubProfileInquiry        = 0x20
+	SubProfileInquiryReply   = 0x21
+	SubSetProfileOn          = 0x22
+	SubSetProfileOff         = 0x23
+	SubProfileEnabled        = 0x24
+	SubProfileDisabled       = 0x25
+	SubProfileAdded          = 0x26
+	SubProfileRemoved        = 0x27
+	SubProfileDetailsInquiry = 0x28
+	SubProfileDetailsReply   = 0x29
+	SubProfileSpecificData   = 0x2F
+
+	SubPECapabilities      = 0x30
+	SubPECapabilitiesReply = 0x31
+	SubPEGet               = 0x34
+	SubPEGetReply          = 0x35
+	SubPESet               = 0x36
+	SubPESetReply          = 0x37
+	SubPESubscribe         = 0x38
+	SubPESubscribeReply    = 0x39
+	SubPENotify            = 0x3F
+
+	SubProcessCapabilities      = 0x40
+	SubProcessCapabilitiesReply = 0x41
+	SubMessageReport            = 0x42
+	SubMessageReportReply       = 0x43
+	SubEndOfMessageReport       = 0x44
+
+	SubDiscovery         = 0x70
+	SubDiscoveryReply    = 0x71
+	SubEndpointInfo      = 0x72
+	SubEndpointInfoReply = 0x73
+	SubACK               = 0x7D
+	SubInvalidateMUID    = 0x7E
+	SubNAK               = 0x7F
+)
+
+// Category is the bitmap of MIDI-CI categories supported by a device.
+type Category byte
+
+const (
+	CategoryProfiles         = Category(1 << 2)
+	CategoryPropertyExchange = Category(1 << 3)
+	CategoryProcessInquiry   = Category(1 << 4)
+)
+
+// ACK/NAK status codes
+const (
+	StatusACK                 = 0x00
+	StatusNAK                 = 0x00
+	StatusMessageNotSupported = 0x01
+	StatusVersionNotSupported = 0x02
+	StatusTargetNotInUse      = 0x03
+	StatusProfileNotSupported = 0x04
+	StatusTerminateInquiry    = 0x20
+	StatusChunksOutOfSequence = 0x21
+	StatusErrorRetry          = 0x40
+	StatusMalformed           = 0x41
+	StatusTimeout             = 0x42
+	StatusTimeoutRetry        = 0x43
+)
+
+var (
+	ErrNotCI     = errors.New("not a MIDI-CI message")
+	ErrMalformed = errors.New("malformed MIDI-CI message")
+	ErrTimeout   = errors.New("timed out waiting for MIDI-CI reply")
+	ErrClosed    = errors.New("MIDI-CI agent closed")
+
+	ErrSuperseded  = errors.New("MIDI-CI request superseded by an identical request")
+	ErrMUIDChanged = errors.New("MIDI-CI request abandoned because the local MUID changed")
+)
+
+// NAKError is returned by request operations when the remote device replies
+// with a NAK.
+type NAKError struct {
+	NAK
+}
+
+func (e *NAKError) Error() string {
+	if e.Text != "" {
+		return fmt.Sprintf("MIDI-CI NAK for sub-ID 0x%02X: status 0x%02X: %s", e.SubID, e.Status, e.Text)
+	}
+	return fmt.Sprintf("MIDI-CI NAK for sub-ID 0x%02X: status 0x%02X", e.SubID, e.Status)
+}
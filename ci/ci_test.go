@@ -0,0 +1,413 @@
+package ci
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+// wire is a driver whose output is cabled to an agent's input. Everything
+// sent is recorded and, once connected, passed to the agent's Handle in
+// order on a goroutine of its own, as a receive handler would be.
+type wire struct {
+	midi.Driver
+
+	lock sync.Mutex
+	sent [][]ump.Word
+	to   chan []ump.Word
+}
+
+func (w *wire) Send(_ time.Time, _ midi.Entity, words []ump.Word) error {
+	w.send(words)
+	return nil
+}
+
+func (w *wire) SendSysEx(_ midi.Entity, words []ump.Word) error {
+	w.send(words)
+	return nil
+}
+
+func (w *wire) send(words []ump.Word) {
+	words = append([]ump.Word(nil), words...)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.sent = append(w.sent, words)
+	if w.to != nil {
+		w.to <- words
+	}
+}
+
+// Sent returns everything sent so far, one entry per call.
+func (w *wire) Sent() [][]ump.Word {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return append([][]ump.Word(nil), w.sent...)
+}
+
+// connect delivers what is sent from now on to a, until the test ends.
+func (w *wire) connect(t *testing.T, a *Agent) {
+	to := make(chan []ump.Word, 64)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for words := range to {
+			a.Handle(words)
+		}
+	}()
+
+	w.lock.Lock()
+	w.to = to
+	w.lock.Unlock()
+
+	t.Cleanup(func() {
+		w.lock.Lock()
+		close(w.to)
+		w.to = nil
+		w.lock.Unlock()
+		<-done
+	})
+}
+
+// pair returns two agents connected to each other: whatever one sends
+// arrives at the other.
+func pair(t *testing.T, cfgA, cfgB *Config) (a, b *Agent) {
+	t.Helper()
+
+	wa, wb := &wire{}, &wire{}
+	a = New(wa, 1, cfgA)
+	b = New(wb, 1, cfgB)
+	wa.connect(t, b)
+	wb.connect(t, a)
+
+	t.Cleanup(func() {
+		a.Close()
+		b.Close()
+	})
+	return a, b
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// discover makes a and b known to each other.
+func discover(t *testing.T, a, b *Agent) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	remotes, err := a.Discover(ctx)
+	must(t, err)
+	if len(remotes) != 1 || remotes[0].MUID != b.MUID() {
+		t.Fatalf("Discover = %v, want only %s", remotes, b.MUID())
+	}
+	if b.Remote(a.MUID()) == nil {
+		t.Fatalf("%s was not recorded by the remote", a.MUID())
+	}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+	}{
+		{"empty body", Message{DeviceID: ToFunctionBlock, SubID: SubProcessCapabilities, Version: Version, Source: 1, Destination: Broadcast}},
+		{"body", Message{DeviceID: 3, SubID: SubSetProfileOn, Version: Version, Source: 0x0ABCDEF, Destination: 0x0123456, Data: []byte{0x7E, 1, 2, 3, 4, 0, 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.msg.Append(nil))
+			must(t, err)
+			if len(got.Data) == 0 && len(tt.msg.Data) == 0 {
+				got.Data = tt.msg.Data
+			}
+			if !reflect.DeepEqual(*got, tt.msg) {
+				t.Errorf("got %+v, want %+v", *got, tt.msg)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		sysex []byte
+		want  error
+	}{
+		{"empty", nil, ErrNotCI},
+		{"realtime", []byte{0xF0, 0x7F, 0x7F, 0x06, 0x01, 0xF7}, ErrNotCI},
+		{"identity", []byte{0xF0, 0x7E, 0x7F, 0x06, 0x01, 0xF7}, ErrNotCI},
+		{"short header", []byte{0xF0, 0x7E, 0x7F, 0x0D, 0x70, 0x02, 0, 0, 0, 0, 0xF7}, ErrMalformed},
+		{"unterminated", append([]byte{0xF0, 0x7E, 0x7F, 0x0D, 0x70, 0x02}, make([]byte, 10)...), ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(tt.sysex); !errors.Is(err, tt.want) {
+				t.Errorf("Parse = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNAK(t *testing.T) {
+	nak := NAK{SubID: SubPEGet, Status: StatusChunksOutOfSequence, StatusData: 1, Details: [5]byte{1, 2, 3, 4, 5}, Text: "out of order"}
+	got, err := ParseNAK(nak.Append(nil))
+	must(t, err)
+	if *got != nak {
+		t.Errorf("got %+v, want %+v", *got, nak)
+	}
+
+	// MIDI-CI 1.1 NAKs have no body
+	if got, err := ParseNAK(nil); err != nil || *got != (NAK{}) {
+		t.Errorf("ParseNAK(nil) = %+v, %v; want zero NAK", got, err)
+	}
+	if _, err := ParseNAK([]byte{SubPEGet, 0}); !errors.Is(err, ErrMalformed) {
+		t.Errorf("ParseNAK(truncated) = %v, want %v", err, ErrMalformed)
+	}
+}
+
+func TestProfileTag(t *testing.T) {
+	// every byte of the profile ID and the device ID must reach the tag
+	base := ProfileID{0x7E, 0x31, 0x00, 0x01, 0x01}
+	seen := map[uint64]string{base.tag(0): "base"}
+	for i := range base {
+		id := base
+		id[i] ^= 0x40
+		if prev, ok := seen[id.tag(0)]; ok {
+			t.Errorf("byte %d: tag collides with %s", i, prev)
+		}
+		seen[id.tag(0)] = id.String()
+	}
+	for _, dev := range []byte{1, ToGroup, ToFunctionBlock} {
+		if prev, ok := seen[base.tag(dev)]; ok {
+			t.Errorf("device 0x%02X: tag collides with %s", dev, prev)
+		}
+		seen[base.tag(dev)] = "device"
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	cfgB := &Config{
+		Device:            DeviceInfo{Manufacturer: [3]byte{0x41}, Family: 0x1234, Model: 7, Revision: [4]byte{1, 0, 0, 0}},
+		Categories:        CategoryPropertyExchange,
+		MaxSysExSize:      1024,
+		ProductInstanceID: "SN-42",
+	}
+	a, b := pair(t, &Config{}, cfgB)
+	discover(t, a, b)
+
+	r := a.Remote(b.MUID())
+	if r.Device != cfgB.Device || r.Categories != cfgB.Categories || r.MaxSysExSize != 1024 {
+		t.Errorf("remote = %+v, want the details in %+v", r.Discovery, cfgB)
+	}
+
+	info, err := b.EndpointInfo(context.Background(), a.MUID(), EndpointProductInstanceID)
+	var nak *NAKError
+	if !errors.As(err, &nak) || nak.Status != StatusMessageNotSupported {
+		t.Errorf("EndpointInfo without an instance ID = %q, %v; want a NAK", info, err)
+	}
+	info, err = a.EndpointInfo(context.Background(), b.MUID(), EndpointProductInstanceID)
+	if err != nil || string(info) != "SN-42" {
+		t.Errorf("EndpointInfo = %q, %v; want SN-42", info, err)
+	}
+
+	// closing b invalidates its MUID
+	b.Close()
+	for deadline := time.Now().Add(time.Second); a.Remote(b.MUID()) != nil; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("remote still known after Close")
+		}
+	}
+}
+
+// reply encodes a message from remote to a as UMP.
+func reply(a *Agent, sub byte, remote MUID, data []byte) []ump.Word {
+	m := &Message{DeviceID: ToFunctionBlock, SubID: sub, Version: Version, Source: remote, Destination: a.MUID(), Data: data}
+	return ump.AppendSysEx7(nil, 0, m.Append(nil))
+}
+
+func TestWaitSkipsACK(t *testing.T) {
+	d := &wire{}
+	a := New(d, 1, &Config{})
+	const remote = MUID(0x1234)
+
+	tests := []struct {
+		name    string
+		replies [][]ump.Word
+		want    error
+	}{
+		{
+			"ack then reply",
+			[][]ump.Word{
+				reply(a, SubACK, remote, (&NAK{SubID: SubProcessCapabilities, Text: "busy"}).Append(nil)),
+				reply(a, SubProcessCapabilitiesReply, remote, []byte{ProcessMessageReport}),
+			},
+			nil,
+		},
+		{
+			"nak",
+			[][]ump.Word{reply(a, SubNAK, remote, (&NAK{SubID: SubProcessCapabilities}).Append(nil))},
+			&NAKError{},
+		},
+		{
+			"only ack",
+			[][]ump.Word{reply(a, SubACK, remote, (&NAK{SubID: SubProcessCapabilities}).Append(nil))},
+			ErrTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tx, err := a.begin(SubProcessCapabilities, remote, 0)
+			must(t, err)
+			defer a.finish(tx)
+
+			for _, words := range tt.replies {
+				a.Handle(words)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			m, err := tx.wait(ctx)
+			switch want := tt.want.(type) {
+			case nil:
+				if err != nil || m.SubID != SubProcessCapabilitiesReply {
+					t.Errorf("wait = %v, %v; want the reply", m, err)
+				}
+			case *NAKError:
+				if !errors.As(err, &want) {
+					t.Errorf("wait = %v, want a NAK", err)
+				}
+			default:
+				if !errors.Is(err, want) {
+					t.Errorf("wait = %v, want %v", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPEReplyWithoutPayload(t *testing.T) {
+	d := &wire{}
+	a := New(d, 1, &Config{})
+	const remote = MUID(0x1234)
+
+	// answer the Get inquiry with an ACK, then with a reply that carries
+	// no reassembled Property Exchange message
+	go func() {
+		for len(d.Sent()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		a.Handle(reply(a, SubACK, remote, (&NAK{SubID: SubPEGet}).Append(nil)))
+		a.deliver(SubPEGet, 0, false, &Message{SubID: SubPEGetReply, Source: remote})
+	}()
+
+	if _, _, err := a.GetProperty(context.Background(), remote, Header{"resource": "DeviceInfo"}); !errors.Is(err, ErrMalformed) {
+		t.Errorf("GetProperty = %v, want %v", err, ErrMalformed)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	var events []ProfileEventKind
+	a, b := pair(t, &Config{OnProfile: func(evt *ProfileEvent) { events = append(events, evt.Kind) }}, &Config{})
+
+	must(t, b.AddProfile(&LocalProfile{
+		ID:       ProfileMPE,
+		DeviceID: ToGroup,
+		Details: func(target byte) ([]byte, bool) {
+			return []byte{target, 0x10}, target == 0
+		},
+	}))
+	if err := b.AddProfile(&LocalProfile{ID: ProfileMPE, DeviceID: ToGroup}); !errors.Is(err, ErrProfileExists) {
+		t.Errorf("second AddProfile = %v, want %v", err, ErrProfileExists)
+	}
+
+	ctx := context.Background()
+	replies, err := a.ProfileInquiry(ctx, b.MUID(), ToGroup)
+	must(t, err)
+	if len(replies) != 1 || !reflect.DeepEqual(replies[0].Disabled, []ProfileID{ProfileMPE}) {
+		t.Errorf("ProfileInquiry = %+v, want MPE disabled", replies)
+	}
+
+	must(t, a.SetProfileOn(ctx, b.MUID(), ToGroup, ProfileMPE, 4))
+	if p := b.localProfile(ToGroup, ProfileMPE); !p.Enabled || p.Channels != 4 {
+		t.Errorf("profile = %+v, want enabled on 4 channels", p)
+	}
+
+	details, err := a.ProfileDetails(ctx, b.MUID(), ToGroup, ProfileMPE, 0)
+	if err != nil || !bytes.Equal(details, []byte{0, 0x10}) {
+		t.Errorf("ProfileDetails = % x, %v", details, err)
+	}
+	var nak *NAKError
+	if _, err := a.ProfileDetails(ctx, b.MUID(), ToGroup, ProfileMPE, 1); !errors.As(err, &nak) {
+		t.Errorf("ProfileDetails for an unsupported target = %v, want a NAK", err)
+	}
+	if err := a.SetProfileOn(ctx, b.MUID(), ToGroup, ProfileDrawbarOrgan, 0); !errors.As(err, &nak) || nak.Status != StatusProfileNotSupported {
+		t.Errorf("SetProfileOn for an unknown profile = %v, want a NAK", err)
+	}
+
+	want := []ProfileEventKind{ProfileAdded, ProfileEnabled}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
+
+func TestMessageReport(t *testing.T) {
+	state := NewChannelState(0)
+	state.Update([]ump.Word{ump.ProgramChange(0, 5), ump.ControlChange(0, 7, 90), ump.NoteOn(0, 60, 100)})
+	a, b := pair(t, &Config{}, &Config{State: state})
+
+	features, err := a.ProcessCapabilities(context.Background(), b.MUID())
+	if err != nil || features != ProcessMessageReport {
+		t.Errorf("ProcessCapabilities = %d, %v; want %d", features, err, ProcessMessageReport)
+	}
+
+	report, err := a.RequestMessageReport(context.Background(), b.MUID(), 0, &ReportAll)
+	must(t, err)
+	if report.Reported != ReportAll {
+		t.Errorf("reported %+v, want %+v", report.Reported, ReportAll)
+	}
+	want := []ump.Word{ump.ProgramChange(0, 5), ump.ControlChange(0, 7, 90), ump.NoteOn(0, 60, 100)}
+	if !reflect.DeepEqual(report.Words, want) {
+		t.Errorf("report = %08X, want %08X", report.Words, want)
+	}
+
+	if _, err := b.RequestMessageReport(context.Background(), a.MUID(), 0, &ReportAll); !errors.As(err, new(*NAKError)) {
+		t.Errorf("report from a device without state = %v, want a NAK", err)
+	}
+}
+
+func TestMessageReportInProgress(t *testing.T) {
+	d := &wire{}
+	a := New(d, 1, &Config{})
+
+	first := make(chan error)
+	go func() {
+		_, err := a.RequestMessageReport(context.Background(), 0x1234, 0, &ReportAll)
+		first <- err
+	}()
+	for len(d.Sent()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := a.RequestMessageReport(context.Background(), 0x1234, 0, &ReportAll); !errors.Is(err, ErrReportInProgress) {
+		t.Errorf("second report = %v, want %v", err, ErrReportInProgress)
+	}
+
+	// the first report was not superseded, and fails only when the agent
+	// closes
+	a.Close()
+	if err := <-first; !errors.Is(err, ErrClosed) {
+		t.Errorf("first report = %v, want %v", err, ErrClosed)
+	}
+}
@@ -0,0 +1,181 @@
+package ci
+
+import (
+	"bytes"
+	"context"
+	"errors"
+)
+
+func (a *Agent) discovery() *Discovery {
+	return &Discovery{
+		Device:        a.cfg.Device,
+		Categories:    a.cfg.Categories,
+		MaxSysExSize:  a.cfg.MaxSysExSize,
+		FunctionBlock: a.cfg.FunctionBlock,
+	}
+}
+
+// Discover broadcasts a Discovery Inquiry and collects replies until the
+// agent's timeout elapses or ctx is done. Every device that replies is also
+// recorded and available through Remotes.
+func (a *Agent) Discover(ctx context.Context) ([]*Remote, error) {
+	m := a.newMessage(SubDiscovery, ToFunctionBlock, Broadcast, a.discovery().Append(nil, false))
+
+	tx, err := a.begin(SubDiscovery, Broadcast, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer a.finish(tx)
+
+	if err := a.send(m); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := a.deadline(ctx)
+	defer cancel()
+
+	var out []*Remote
+	for {
+		reply, err := tx.wait(ctx)
+		if errors.Is(err, ErrTimeout) {
+			return out, nil
+		} else if err != nil {
+			var nak *NAKError
+			if errors.As(err, &nak) {
+				continue
+			}
+			return out, err
+		}
+		if r := a.Remote(reply.Source); r != nil {
+			out = append(out, r)
+		}
+	}
+}
+
+// EndpointInfo requests endpoint information from a remote device and
+// returns the raw reply data for the given status (e.g.
+// EndpointProductInstanceID).
+func (a *Agent) EndpointInfo(ctx context.Context, remote MUID, status byte) ([]byte, error) {
+	m := a.newMessage(SubEndpointInfo, ToFunctionBlock, remote, []byte{status})
+	reply, err := a.request(ctx, m, 0)
+	if err != nil {
+		return nil, err
+	}
+	info, err := ParseEndpointInfoReply(reply.Data)
+	if err != nil {
+		return nil, err
+	}
+	return info.Data, nil
+}
+
+// InvalidateMUID broadcasts an Invalidate MUID message for target, which
+// asks every device to forget it.
+func (a *Agent) InvalidateMUID(target MUID) error {
+	return a.invalidate(target)
+}
+
+func (a *Agent) invalidate(target MUID) error {
+	data := put28(nil, uint32(target))
+	return a.send(a.newMessage(SubInvalidateMUID, ToFunctionBlock, Broadcast, data))
+}
+
+func (a *Agent) addRemote(muid MUID, d *Discovery) {
+	r := &Remote{MUID: muid, Discovery: *d}
+
+	a.mu.Lock()
+	a.remotes[muid] = r
+	a.mu.Unlock()
+
+	if a.cfg.OnRemote != nil {
+		a.cfg.OnRemote(r, true)
+	}
+}
+
+func (a *Agent) removeRemote(muid MUID) {
+	a.mu.Lock()
+	r, ok := a.remotes[muid]
+	delete(a.remotes, muid)
+	a.mu.Unlock()
+
+	if ok && a.cfg.OnRemote != nil {
+		a.cfg.OnRemote(r, false)
+	}
+}
+
+func (a *Agent) onDiscovery(m *Message) {
+	d, err := ParseDiscovery(m.Data)
+	if err != nil {
+		return
+	}
+	a.addRemote(m.Source, d)
+
+	reply := a.discovery()
+	reply.OutputPathID = d.OutputPathID
+	a.reply(m, SubDiscoveryReply, reply.Append(nil, true))
+}
+
+func (a *Agent) onDiscoveryReply(m *Message) {
+	if d, err := ParseDiscovery(m.Data); err == nil {
+		a.addRemote(m.Source, d)
+	}
+}
+
+func (a *Agent) onEndpointInfo(m *Message) {
+	if len(m.Data) < 1 || m.Data[0] != EndpointProductInstanceID || a.cfg.ProductInstanceID == "" {
+		a.sendNAK(m, StatusMessageNotSupported, "")
+		return
+	}
+	reply := &EndpointInfoReply{Status: m.Data[0], Data: []byte(a.cfg.ProductInstanceID)}
+	a.reply(m, SubEndpointInfoReply, reply.Append(nil))
+}
+
+func (a *Agent) onInvalidateMUID(m *Message) {
+	r := reader{data: m.Data}
+	target := MUID(r.u28())
+	if r.err() != nil {
+		return
+	}
+
+	if target == a.MUID() {
+		// another device believes our MUID is in use
+		a.renew()
+		return
+	}
+
+	a.removeRemote(target)
+}
+
+// onCollision handles a discovery message which carries our own MUID as
+// its source. Messages that exactly match what we would send are assumed
+// to be our own output looped back and are ignored.
+func (a *Agent) onCollision(m *Message) {
+	d, err := ParseDiscovery(m.Data)
+	if err != nil {
+		return
+	}
+	ours := a.discovery()
+	if bytes.Equal(d.Append(nil, false), ours.Append(nil, false)) {
+		return
+	}
+
+	a.invalidate(m.Source)
+	a.renew()
+}
+
+// renew replaces the agent's MUID with a new random value and announces it
+// with a fresh Discovery Inquiry. Outstanding requests are abandoned since
+// replies will be addressed to the old MUID.
+func (a *Agent) renew() {
+	a.mu.Lock()
+	old := a.muid
+	for a.muid == old {
+		a.muid = NewMUID()
+	}
+	for k, tx := range a.pending {
+		delete(a.pending, k)
+		tx.abort(ErrMUIDChanged)
+	}
+	a.mu.Unlock()
+
+	a.send(a.newMessage(SubDiscovery, ToFunctionBlock, Broadcast, a.discovery().Append(nil, false)))
+}
@@ -0,0 +1,220 @@
+package ci
+
+import "fmt"
+
+// Message is a MIDI-CI message with its common header decoded. Data holds
+// the message-specific body, excluding the trailing 0xF7.
+type Message struct {
+	DeviceID    byte
+	SubID       byte
+	Version     byte
+	Source      MUID
+	Destination MUID
+	Data        []byte
+
+	// set on the final chunk of a reassembled Property Exchange message
+	pe *peMessage
+}
+
+const headerLen = 14 // F0 7E dev 0D sub2 ver src(4) dst(4)
+
+// Parse decodes a complete MIDI-CI System Exclusive message, including its
+// 0xF0/0xF7 framing. The returned message's Data aliases sysex.
+func Parse(sysex []byte) (*Message, error) {
+	if len(sysex) < 4 || sysex[0] != 0xF0 || sysex[1] != 0x7E || sysex[3] != 0x0D {
+		return nil, ErrNotCI
+	}
+	if len(sysex) < headerLen+1 || sysex[len(sysex)-1] != 0xF7 {
+		return nil, ErrMalformed
+	}
+	return &Message{
+		DeviceID:    sysex[2],
+		SubID:       sysex[4],
+		Version:     sysex[5],
+		Source:      MUID(get28(sysex[6:])),
+		Destination: MUID(get28(sysex[10:])),
+		Data:        sysex[headerLen : len(sysex)-1],
+	}, nil
+}
+
+// Append appends the System Exclusive encoding of m, including 0xF0/0xF7
+// framing, to dst.
+func (m *Message) Append(dst []byte) []byte {
+	dst = append(dst, 0xF0, 0x7E, m.DeviceID, 0x0D, m.SubID, m.Version)
+	dst = put28(dst, uint32(m.Source))
+	dst = put28(dst, uint32(m.Destination))
+	dst = append(dst, m.Data...)
+	return append(dst, 0xF7)
+}
+
+func (m *Message) String() string {
+	return fmt.Sprintf("MIDI-CI sub=0x%02X dev=0x%02X %s->%s (%d bytes)", m.SubID, m.DeviceID, m.Source, m.Destination, len(m.Data))
+}
+
+// MIDI-CI multi-byte fields are 7 bits per byte, least significant first.
+
+func put14(dst []byte, v uint16) []byte {
+	return append(dst, byte(v&0x7F), byte((v>>7)&0x7F))
+}
+
+func put28(dst []byte, v uint32) []byte {
+	return append(dst, byte(v&0x7F), byte((v>>7)&0x7F), byte((v>>14)&0x7F), byte((v>>21)&0x7F))
+}
+
+func get14(b []byte) uint16 {
+	return uint16(b[0]&0x7F) | uint16(b[1]&0x7F)<<7
+}
+
+func get28(b []byte) uint32 {
+	return uint32(b[0]&0x7F) | uint32(b[1]&0x7F)<<7 | uint32(b[2]&0x7F)<<14 | uint32(b[3]&0x7F)<<21
+}
+
+// reader consumes fields from a message body, recording whether it ran out
+// of data.
+type reader struct {
+	data []byte
+	bad  bool
+}
+
+func (r *reader) bytes(n int) []byte {
+	if len(r.data) < n {
+		r.bad = true
+		r.data = nil
+		return make([]byte, n)
+	}
+	out := r.data[:n]
+	r.data = r.data[n:]
+	return out
+}
+
+func (r *reader) byte() byte   { return r.bytes(1)[0] }
+func (r *reader) u14() uint16  { return get14(r.bytes(2)) }
+func (r *reader) u28() uint32  { return get28(r.bytes(4)) }
+func (r *reader) more() bool   { return len(r.data) > 0 }
+func (r *reader) rest() []byte { out := r.data; r.data = nil; return out }
+func (r *reader) err() error {
+	if r.bad {
+		return ErrMalformed
+	}
+	return nil
+}
+
+// DeviceInfo identifies a device's manufacturer, family, model and software
+// revision, as carried in Discovery messages.
+type DeviceInfo struct {
+	Manufacturer [3]byte // SysEx ID; one-byte IDs are stored as {id, 0, 0}
+	Family       uint16
+	Model        uint16
+	Revision     [4]byte
+}
+
+func (d *DeviceInfo) append(dst []byte) []byte {
+	dst = append(dst, d.Manufacturer[:]...)
+	dst = put14(dst, d.Family)
+	dst = put14(dst, d.Model)
+	return append(dst, d.Revision[:]...)
+}
+
+func (d *DeviceInfo) read(r *reader) {
+	copy(d.Manufacturer[:], r.bytes(3))
+	d.Family = r.u14()
+	d.Model = r.u14()
+	copy(d.Revision[:], r.bytes(4))
+}
+
+// Discovery is the body of a Discovery Inquiry or Reply to Discovery.
+type Discovery struct {
+	Device       DeviceInfo
+	Categories   Category
+	MaxSysExSize uint32
+	OutputPathID byte
+
+	// Reply only
+	FunctionBlock byte
+}
+
+func (d *Discovery) Append(dst []byte, reply bool) []byte {
+	dst = d.Device.append(dst)
+	dst = append(dst, byte(d.Categories))
+	dst = put28(dst, d.MaxSysExSize)
+	dst = append(dst, d.OutputPathID)
+	if reply {
+		dst = append(dst, d.FunctionBlock)
+	}
+	return dst
+}
+
+// ParseDiscovery decodes the body of a Discovery Inquiry or Reply. Fields
+// added in later MIDI-CI versions are defaulted if absent: OutputPathID to
+// 0, and FunctionBlock to 0x7F (not a Function Block).
+func ParseDiscovery(data []byte) (*Discovery, error) {
+	r := reader{data: data}
+	d := &Discovery{FunctionBlock: 0x7F}
+	d.Device.read(&r)
+	d.Categories = Category(r.byte())
+	d.MaxSysExSize = r.u28()
+	if r.more() {
+		d.OutputPathID = r.byte()
+	}
+	if r.more() {
+		d.FunctionBlock = r.byte()
+	}
+	return d, r.err()
+}
+
+// EndpointInfoReply is the body of a Reply to Endpoint Information.
+type EndpointInfoReply struct {
+	Status byte
+	Data   []byte
+}
+
+func (e *EndpointInfoReply) Append(dst []byte) []byte {
+	dst = append(dst, e.Status)
+	dst = put14(dst, uint16(len(e.Data)))
+	return append(dst, e.Data...)
+}
+
+func ParseEndpointInfoReply(data []byte) (*EndpointInfoReply, error) {
+	r := reader{data: data}
+	e := &EndpointInfoReply{Status: r.byte()}
+	e.Data = r.bytes(int(r.u14()))
+	return e, r.err()
+}
+
+// Endpoint information statuses
+const (
+	EndpointProductInstanceID = 0x00
+)
+
+// NAK is the body of an ACK or NAK message. ACK messages share the same
+// layout.
+type NAK struct {
+	SubID      byte // Sub-ID#2 of the message being acknowledged
+	Status     byte
+	StatusData byte
+	Details    [5]byte
+	Text       string
+}
+
+func (n *NAK) Append(dst []byte) []byte {
+	dst = append(dst, n.SubID, n.Status, n.StatusData)
+	dst = append(dst, n.Details[:]...)
+	dst = put14(dst, uint16(len(n.Text)))
+	return append(dst, n.Text...)
+}
+
+// ParseNAK decodes the body of an ACK or NAK. MIDI-CI 1.1 NAKs have no body,
+// in which case a zero NAK is returned.
+func ParseNAK(data []byte) (*NAK, error) {
+	n := &NAK{}
+	if len(data) == 0 {
+		return n, nil
+	}
+	r := reader{data: data}
+	n.SubID = r.byte()
+	n.Status = r.byte()
+	n.StatusData = r.byte()
+	copy(n.Details[:], r.bytes(5))
+	n.Text = string(r.bytes(int(r.u14())))
+	return n, r.err()
+}
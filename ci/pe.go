@@ -0,0 +1,328 @@
+package ci
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Property Exchange status codes, carried in reply headers.
+const (
+	PEStatusOK                  = 200
+	PEStatusAccepted            = 202
+	PEStatusUnavailable         = 341
+	PEStatusBadData             = 342
+	PEStatusTooManyRequests     = 343
+	PEStatusBadRequest          = 400
+	PEStatusNotAuthorized       = 403
+	PEStatusNotFound            = 404
+	PEStatusNotAllowed          = 405
+	PEStatusPayloadTooLarge     = 413
+	PEStatusUnsupportedEncoding = 415
+	PEStatusInternalError       = 500
+)
+
+// Property data encodings
+const (
+	EncodingASCII   = "ASCII"
+	EncodingMcoded7 = "Mcoded7"
+)
+
+// Subscription commands
+const (
+	SubscribeStart   = "start"
+	SubscribeEnd     = "end"
+	SubscribeFull    = "full"
+	SubscribePartial = "partial"
+	SubscribeNotify  = "notify"
+)
+
+var (
+	ErrNot7Bit         = errors.New("property data contains bytes above 0x7F")
+	ErrPETerminated    = errors.New("property exchange inquiry terminated by remote device")
+	ErrUnknownEncoding = errors.New("unsupported property data encoding")
+	ErrNoSubscription  = errors.New("no such subscription")
+	ErrResourceExists  = errors.New("resource already registered")
+	ErrTooManyRequests = errors.New("too many outstanding property exchange requests")
+)
+
+// Header is a decoded Property Exchange JSON header.
+type Header map[string]any
+
+// String returns the string value of key, or "".
+func (h Header) String(key string) string {
+	s, _ := h[key].(string)
+	return s
+}
+
+// Int returns the integer value of key, or 0.
+func (h Header) Int(key string) int {
+	switch v := h[key].(type) {
+	case float64:
+		return int(v)
+	case int:
+		return v
+	}
+	return 0
+}
+
+// Status returns the reply status, or 0 if none is present.
+func (h Header) Status() int { return h.Int("status") }
+
+// Resource returns the resource name.
+func (h Header) Resource() string { return h.String("resource") }
+
+// PEStatusError is returned when a Property Exchange reply carries a
+// non-success status.
+type PEStatusError struct {
+	Status  int
+	Message string
+}
+
+func (e *PEStatusError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("property exchange status %d: %s", e.Status, e.Message)
+	}
+	return fmt.Sprintf("property exchange status %d", e.Status)
+}
+
+func statusError(h Header) error {
+	if s := h.Status(); s != 0 && (s < 200 || s >= 300) {
+		msg := h.String("message")
+		if msg == "" {
+			if m, ok := h["message"].(map[string]any); ok {
+				msg, _ = m["en"].(string)
+			}
+		}
+		return &PEStatusError{Status: s, Message: msg}
+	}
+	return nil
+}
+
+// asciiJSON marshals v as JSON, escaping all non-ASCII characters so the
+// result can be carried in SysEx.
+func asciiJSON(v any) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(raw))
+	for len(raw) > 0 {
+		r, n := utf8.DecodeRune(raw)
+		if r < 0x80 {
+			out = append(out, raw[0])
+		} else if r > 0xFFFF {
+			r1, r2 := utf16Surrogates(r)
+			out = append(out, `\u`+hex4(r1)+`\u`+hex4(r2)...)
+		} else {
+			out = append(out, `\u`+hex4(r)...)
+		}
+		raw = raw[n:]
+	}
+	return out, nil
+}
+
+func hex4(r rune) string {
+	s := strconv.FormatInt(int64(r), 16)
+	for len(s) < 4 {
+		s = "0" + s
+	}
+	return s
+}
+
+func utf16Surrogates(r rune) (rune, rune) {
+	r -= 0x10000
+	return 0xD800 + (r>>10)&0x3FF, 0xDC00 + r&0x3FF
+}
+
+// EncodeMcoded7 encodes 8-bit data so that it can be carried in SysEx. Each
+// group of up to 7 bytes is preceded by a byte holding their high bits.
+func EncodeMcoded7(data []byte) []byte {
+	out := make([]byte, 0, len(data)+(len(data)+6)/7)
+	for len(data) > 0 {
+		n := min(7, len(data))
+		var msbs byte
+		for i := 0; i < n; i++ {
+			msbs |= (data[i] >> 7) << (6 - i)
+		}
+		out = append(out, msbs)
+		for i := 0; i < n; i++ {
+			out = append(out, data[i]&0x7F)
+		}
+		data = data[n:]
+	}
+	return out
+}
+
+// DecodeMcoded7 reverses EncodeMcoded7.
+func DecodeMcoded7(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for len(data) > 0 {
+		msbs := data[0]
+		n := min(7, len(data)-1)
+		for i := 0; i < n; i++ {
+			out = append(out, data[1+i]|((msbs>>(6-i))&1)<<7)
+		}
+		data = data[1+n:]
+	}
+	return out
+}
+
+func encodeData(h Header, data []byte) ([]byte, error) {
+	switch h.String("mutualEncoding") {
+	case "", EncodingASCII:
+		for _, b := range data {
+			if b > 0x7F {
+				return nil, ErrNot7Bit
+			}
+		}
+		return data, nil
+	case EncodingMcoded7:
+		return EncodeMcoded7(data), nil
+	}
+	return nil, ErrUnknownEncoding
+}
+
+func decodeData(h Header, data []byte) ([]byte, error) {
+	switch h.String("mutualEncoding") {
+	case "", EncodingASCII:
+		return data, nil
+	case EncodingMcoded7:
+		return DecodeMcoded7(data), nil
+	}
+	return nil, ErrUnknownEncoding
+}
+
+// MARK: Wire format
+
+// peChunk is a single Property Exchange message.
+type peChunk struct {
+	requestID byte
+	header    []byte
+	total     uint16
+	index     uint16 // 1-based
+	data      []byte
+}
+
+func parsePEChunk(data []byte) (*peChunk, error) {
+	r := reader{data: data}
+	c := &peChunk{requestID: r.byte()}
+	c.header = r.bytes(int(r.u14()))
+	c.total = r.u14()
+	c.index = r.u14()
+	c.data = r.bytes(int(r.u14()))
+	return c, r.err()
+}
+
+func (c *peChunk) append(dst []byte) []byte {
+	dst = append(dst, c.requestID)
+	dst = put14(dst, uint16(len(c.header)))
+	dst = append(dst, c.header...)
+	dst = put14(dst, c.total)
+	dst = put14(dst, c.index)
+	dst = put14(dst, uint16(len(c.data)))
+	return append(dst, c.data...)
+}
+
+// pePartial accumulates the chunks of an incoming message.
+type pePartial struct {
+	header []byte
+	data   []byte
+	next   uint16
+}
+
+type peKey struct {
+	source    MUID
+	sub       byte
+	requestID byte
+}
+
+// peMessage is a complete, reassembled Property Exchange message.
+type peMessage struct {
+	*Message
+	requestID byte
+	header    Header
+	data      []byte
+}
+
+// sendPE sends a Property Exchange message, split into as many chunks as
+// required by the destination's maximum SysEx size.
+func (a *Agent) sendPE(sub byte, deviceID byte, dest MUID, requestID byte, header Header, data []byte) error {
+	hdr, err := asciiJSON(header)
+	if err != nil {
+		return err
+	}
+	if data, err = encodeData(header, data); err != nil {
+		return err
+	}
+
+	maxSize := uint32(DefaultMaxSysExSize)
+	if r := a.Remote(dest); r != nil && r.MaxSysExSize > 0 {
+		maxSize = r.MaxSysExSize
+	}
+	overhead := headerLen + 1 + 1 + 2 + len(hdr) + 6
+	chunkSize := max(int(maxSize)-overhead, 16)
+	chunkSize = min(chunkSize, 0x3FFF)
+
+	total := max((len(data)+chunkSize-1)/chunkSize, 1)
+	for i := 0; i < total; i++ {
+		c := &peChunk{requestID: requestID, total: uint16(total), index: uint16(i + 1)}
+		if i == 0 {
+			c.header = hdr
+		}
+		c.data = data[min(i*chunkSize, len(data)):min((i+1)*chunkSize, len(data))]
+		if err := a.send(a.newMessage(sub, deviceID, dest, c.append(nil))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// receivePE adds a chunk to the reassembly buffer, returning the complete
+// message once its final chunk has arrived.
+func (a *Agent) receivePE(m *Message) (*peMessage, error) {
+	c, err := parsePEChunk(m.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	key := peKey{m.Source, m.SubID, c.requestID}
+
+	a.mu.Lock()
+	p := a.peChunks[key]
+	if c.index == 1 {
+		p = &pePartial{header: c.header, next: 1}
+		a.peChunks[key] = p
+	}
+	if p == nil || c.index != p.next {
+		delete(a.peChunks, key)
+		a.mu.Unlock()
+		return nil, fmt.Errorf("%w: chunk %d out of sequence", ErrMalformed, c.index)
+	}
+	p.data = append(p.data, c.data...)
+	p.next++
+	done := c.index >= c.total
+	if done {
+		delete(a.peChunks, key)
+	}
+	a.mu.Unlock()
+
+	if !done {
+		return nil, nil
+	}
+
+	out := &peMessage{Message: m, requestID: c.requestID, header: Header{}}
+	if len(p.header) > 0 {
+		if err := json.Unmarshal(p.header, &out.header); err != nil {
+			return nil, fmt.Errorf("%w: bad header JSON: %s", ErrMalformed, err)
+		}
+	}
+	if out.data, err = decodeData(out.header, p.data); err != nil {
+		return nil, err
+	}
+
+	return out, nil
+}
@@ -0,0 +1,285 @@
+package ci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// PECapabilities describes a device's Property Exchange support.
+type PECapabilities struct {
+	SimultaneousRequests byte
+	MajorVersion         byte
+	MinorVersion         byte
+}
+
+// SubscriptionHandler receives subscription updates from a remote device.
+// command is one of SubscribeFull, SubscribePartial, SubscribeNotify or
+// SubscribeEnd.
+type SubscriptionHandler func(command string, header Header, data []byte)
+
+type clientSubscription struct {
+	remote   MUID
+	resource string
+	handler  SubscriptionHandler
+}
+
+// PECapabilities asks a remote device for its Property Exchange
+// capabilities.
+func (a *Agent) PECapabilities(ctx context.Context, remote MUID) (*PECapabilities, error) {
+	m := a.newMessage(SubPECapabilities, ToFunctionBlock, remote, a.peCapabilities().append(nil))
+	reply, err := a.request(ctx, m, 0)
+	if err != nil {
+		return nil, err
+	}
+	r := reader{data: reply.Data}
+	caps := &PECapabilities{SimultaneousRequests: r.byte()}
+	if r.more() {
+		caps.MajorVersion = r.byte()
+		caps.MinorVersion = r.byte()
+	}
+	return caps, r.err()
+}
+
+func (c *PECapabilities) append(dst []byte) []byte {
+	return append(dst, c.SimultaneousRequests, c.MajorVersion, c.MinorVersion)
+}
+
+func (a *Agent) peCapabilities() *PECapabilities {
+	return &PECapabilities{SimultaneousRequests: 127, MajorVersion: 0, MinorVersion: 0}
+}
+
+// nextRequestID allocates a Property Exchange request ID that is not in
+// use by any outstanding request to remote.
+func (a *Agent) nextRequestID(remote MUID) (byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i := 0; i < 128; i++ {
+		id := a.peRequestID
+		a.peRequestID = (a.peRequestID + 1) & 0x7F
+
+		inUse := false
+		for _, sub := range []byte{SubPEGet, SubPESet, SubPESubscribe} {
+			if _, ok := a.pending[txKey{sub: sub, remote: remote, tag: uint64(id)}]; ok {
+				inUse = true
+				break
+			}
+		}
+		if !inUse {
+			return id, nil
+		}
+	}
+
+	return 0, ErrTooManyRequests
+}
+
+// peRequest sends a Property Exchange inquiry and waits for the complete,
+// reassembled reply. Replies with a non-success status are returned as a
+// *PEStatusError.
+func (a *Agent) peRequest(ctx context.Context, sub byte, remote MUID, header Header, data []byte) (*peMessage, error) {
+	id, err := a.nextRequestID(remote)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := a.begin(sub, remote, uint64(id))
+	if err != nil {
+		return nil, err
+	}
+	defer a.finish(tx)
+
+	if err := a.sendPE(sub, ToFunctionBlock, remote, id, header, data); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := a.deadline(ctx)
+	defer cancel()
+
+	m, err := tx.wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := m.pe
+	if reply == nil {
+		return nil, ErrMalformed
+	}
+	if err := statusError(reply.header); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// GetProperty sends a Get Property Data inquiry with the given header,
+// which must include at least "resource", and returns the reply header and
+// decoded property data.
+func (a *Agent) GetProperty(ctx context.Context, remote MUID, header Header) (Header, []byte, error) {
+	reply, err := a.peRequest(ctx, SubPEGet, remote, header, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reply.header, reply.data, nil
+}
+
+// SetProperty sends a Set Property Data inquiry and returns the reply
+// header.
+func (a *Agent) SetProperty(ctx context.Context, remote MUID, header Header, data []byte) (Header, error) {
+	reply, err := a.peRequest(ctx, SubPESet, remote, header, data)
+	if err != nil {
+		return nil, err
+	}
+	return reply.header, nil
+}
+
+// GetJSON fetches a resource and unmarshals its data into v.
+func (a *Agent) GetJSON(ctx context.Context, remote MUID, header Header, v any) error {
+	_, data, err := a.GetProperty(ctx, remote, header)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// SetJSON marshals v and sets it as a resource's data.
+func (a *Agent) SetJSON(ctx context.Context, remote MUID, header Header, v any) error {
+	data, err := asciiJSON(v)
+	if err != nil {
+		return err
+	}
+	_, err = a.SetProperty(ctx, remote, header, data)
+	return err
+}
+
+// Subscribe starts a subscription to a resource on a remote device.
+// handler is called from the receive path for every update. The returned
+// subscription ID is passed to Unsubscribe.
+func (a *Agent) Subscribe(ctx context.Context, remote MUID, header Header, handler SubscriptionHandler) (string, error) {
+	h := Header{"command": SubscribeStart}
+	for k, v := range header {
+		h[k] = v
+	}
+
+	reply, err := a.peRequest(ctx, SubPESubscribe, remote, h, nil)
+	if err != nil {
+		return "", err
+	}
+
+	id := reply.header.String("subscribeId")
+	if id == "" {
+		return "", errors.New("subscription reply has no subscribeId")
+	}
+
+	a.mu.Lock()
+	a.peSubscriptions[id] = &clientSubscription{remote: remote, resource: h.Resource(), handler: handler}
+	a.mu.Unlock()
+
+	return id, nil
+}
+
+// Unsubscribe ends a subscription started with Subscribe.
+func (a *Agent) Unsubscribe(ctx context.Context, subscribeID string) error {
+	a.mu.Lock()
+	sub, ok := a.peSubscriptions[subscribeID]
+	delete(a.peSubscriptions, subscribeID)
+	a.mu.Unlock()
+
+	if !ok {
+		return ErrNoSubscription
+	}
+
+	h := Header{"command": SubscribeEnd, "subscribeId": subscribeID, "resource": sub.resource}
+	_, err := a.peRequest(ctx, SubPESubscribe, sub.remote, h, nil)
+	return err
+}
+
+// MARK: Standard resources
+
+// ResourceInfo is an entry in a ResourceList.
+type ResourceInfo struct {
+	Resource     string          `json:"resource"`
+	CanGet       *bool           `json:"canGet,omitempty"`
+	CanSet       string          `json:"canSet,omitempty"`
+	CanSubscribe bool            `json:"canSubscribe,omitempty"`
+	RequireResID bool            `json:"requireResId,omitempty"`
+	CanPaginate  bool            `json:"canPaginate,omitempty"`
+	Encodings    []string        `json:"encodings,omitempty"`
+	Schema       json.RawMessage `json:"schema,omitempty"`
+}
+
+// DeviceInfoResource is the data of the DeviceInfo resource.
+type DeviceInfoResource struct {
+	ManufacturerID []int  `json:"manufacturerId"`
+	Manufacturer   string `json:"manufacturer"`
+	FamilyID       []int  `json:"familyId"`
+	Family         string `json:"family"`
+	ModelID        []int  `json:"modelId"`
+	Model          string `json:"model"`
+	VersionID      []int  `json:"versionId"`
+	Version        string `json:"version"`
+	SerialNumber   string `json:"serialNumber,omitempty"`
+}
+
+// ChannelInfo is an entry in a ChannelList.
+type ChannelInfo struct {
+	Title         string `json:"title"`
+	Channel       int    `json:"channel"` // 1-16
+	ProgramTitle  string `json:"programTitle,omitempty"`
+	BankPC        []int  `json:"bankPC,omitempty"` // bank MSB, bank LSB, program
+	ClusterStart  int    `json:"clusterChannelStart,omitempty"`
+	ClusterLength int    `json:"clusterLength,omitempty"`
+	ClusterType   string `json:"clusterType,omitempty"`
+}
+
+// ProgramInfo is an entry in a ProgramList.
+type ProgramInfo struct {
+	Title    string   `json:"title"`
+	BankPC   []int    `json:"bankPC"` // bank MSB, bank LSB, program
+	Category []string `json:"category,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// Standard resource names
+const (
+	ResourceList        = "ResourceList"
+	ResourceDeviceInfo  = "DeviceInfo"
+	ResourceChannelList = "ChannelList"
+	ResourceProgramList = "ProgramList"
+)
+
+// GetResourceList fetches the list of resources supported by a remote
+// device.
+func (a *Agent) GetResourceList(ctx context.Context, remote MUID) ([]ResourceInfo, error) {
+	var out []ResourceInfo
+	err := a.GetJSON(ctx, remote, Header{"resource": ResourceList}, &out)
+	return out, err
+}
+
+// GetDeviceInfo fetches a remote device's DeviceInfo resource.
+func (a *Agent) GetDeviceInfo(ctx context.Context, remote MUID) (*DeviceInfoResource, error) {
+	out := &DeviceInfoResource{}
+	if err := a.GetJSON(ctx, remote, Header{"resource": ResourceDeviceInfo}, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetChannelList fetches a remote device's ChannelList resource.
+func (a *Agent) GetChannelList(ctx context.Context, remote MUID) ([]ChannelInfo, error) {
+	var out []ChannelInfo
+	err := a.GetJSON(ctx, remote, Header{"resource": ResourceChannelList}, &out)
+	return out, err
+}
+
+// GetProgramList fetches a remote device's ProgramList resource. resID
+// selects a particular list on devices that have more than one, and is
+// otherwise empty.
+func (a *Agent) GetProgramList(ctx context.Context, remote MUID, resID string) ([]ProgramInfo, error) {
+	h := Header{"resource": ResourceProgramList}
+	if resID != "" {
+		h["resId"] = resID
+	}
+	var out []ProgramInfo
+	err := a.GetJSON(ctx, remote, h, &out)
+	return out, err
+}
@@ -0,0 +1,315 @@
+package ci
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// PERequest is a Property Exchange inquiry received from a remote device.
+type PERequest struct {
+	Source MUID
+	Header Header
+	Data   []byte
+}
+
+// Resource is a Property Exchange resource served by the local device.
+//
+// Handlers are called from the receive path. Returning a *PEStatusError
+// replies with that status; any other error replies with
+// PEStatusInternalError.
+type Resource struct {
+	Info ResourceInfo
+
+	// Returns the resource's data. If nil, Get inquiries are refused.
+	Get func(req *PERequest) ([]byte, error)
+
+	// Applies new data to the resource. If nil, Set inquiries are refused.
+	Set func(req *PERequest) error
+}
+
+// JSONResource returns a read-only resource whose data is the JSON
+// encoding of the value returned by get.
+func JSONResource(info ResourceInfo, get func(req *PERequest) (any, error)) *Resource {
+	return &Resource{
+		Info: info,
+		Get: func(req *PERequest) ([]byte, error) {
+			v, err := get(req)
+			if err != nil {
+				return nil, err
+			}
+			return asciiJSON(v)
+		},
+	}
+}
+
+type serverSubscription struct {
+	remote   MUID
+	resource string
+	resID    string
+}
+
+// RegisterResource adds a resource to the local device. It is listed in
+// the ResourceList resource, which is provided automatically.
+func (a *Agent) RegisterResource(r *Resource) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.peResources[r.Info.Resource]; ok || r.Info.Resource == ResourceList {
+		return ErrResourceExists
+	}
+	a.peResources[r.Info.Resource] = r
+	return nil
+}
+
+// UnregisterResource removes a resource and ends all subscriptions to it.
+func (a *Agent) UnregisterResource(name string) {
+	a.mu.Lock()
+	delete(a.peResources, name)
+	var ended []string
+	for id, s := range a.peSubscribers {
+		if s.resource == name {
+			ended = append(ended, id)
+		}
+	}
+	a.mu.Unlock()
+
+	for _, id := range ended {
+		a.endSubscriber(id)
+	}
+}
+
+// NotifySubscribers sends a subscription update for resource to every
+// subscribed device. command is SubscribeFull, SubscribePartial or
+// SubscribeNotify; data is the new (or changed) resource data, if any.
+// Subscriptions that specified a resId only receive updates whose resID
+// matches.
+func (a *Agent) NotifySubscribers(resource string, resID string, command string, data []byte) error {
+	a.mu.Lock()
+	subs := map[string]serverSubscription{}
+	for id, s := range a.peSubscribers {
+		if s.resource == resource && (s.resID == "" || s.resID == resID) {
+			subs[id] = *s
+		}
+	}
+	a.mu.Unlock()
+
+	var errs []error
+	for id, s := range subs {
+		h := Header{"command": command, "subscribeId": id}
+		if command == SubscribeNotify {
+			data = nil
+		}
+		if err := a.sendSubscriptionMessage(s.remote, h, data); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (a *Agent) endSubscriber(id string) {
+	a.mu.Lock()
+	s, ok := a.peSubscribers[id]
+	delete(a.peSubscribers, id)
+	a.mu.Unlock()
+
+	if ok {
+		a.sendSubscriptionMessage(s.remote, Header{"command": SubscribeEnd, "subscribeId": id}, nil)
+	}
+}
+
+func (a *Agent) sendSubscriptionMessage(remote MUID, h Header, data []byte) error {
+	id, err := a.nextRequestID(remote)
+	if err != nil {
+		return err
+	}
+	return a.sendPE(SubPESubscribe, ToFunctionBlock, remote, id, h, data)
+}
+
+func (a *Agent) onPECapabilities(m *Message) {
+	a.reply(m, SubPECapabilitiesReply, a.peCapabilities().append(nil))
+}
+
+// onPEMessage handles all chunked Property Exchange messages, both
+// inquiries from remote initiators and replies to our own requests.
+func (a *Agent) onPEMessage(m *Message) {
+	pe, err := a.receivePE(m)
+	if err != nil {
+		a.sendNAK(m, StatusChunksOutOfSequence, err.Error())
+		return
+	} else if pe == nil {
+		return
+	}
+	m.pe = pe
+
+	switch m.SubID {
+	case SubPEGetReply, SubPESetReply, SubPESubscribeReply:
+		a.deliver(m.SubID-1, uint64(pe.requestID), false, m)
+	case SubPEGet:
+		a.serveGet(pe)
+	case SubPESet:
+		a.serveSet(pe)
+	case SubPESubscribe:
+		a.serveSubscribe(pe)
+	}
+}
+
+func (a *Agent) onPENotify(m *Message) {
+	c, err := parsePEChunk(m.Data)
+	if err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, sub := range []byte{SubPEGet, SubPESet, SubPESubscribe} {
+		key := txKey{sub: sub, remote: m.Source, tag: uint64(c.requestID)}
+		if tx, ok := a.pending[key]; ok {
+			delete(a.pending, key)
+			tx.abort(ErrPETerminated)
+		}
+	}
+}
+
+func (a *Agent) replyPE(req *peMessage, h Header, data []byte) {
+	if err := a.sendPE(req.SubID+1, req.DeviceID, req.Source, req.requestID, h, data); err != nil {
+		a.sendPE(req.SubID+1, req.DeviceID, req.Source, req.requestID, errorHeader(err), nil)
+	}
+}
+
+func errorHeader(err error) Header {
+	var se *PEStatusError
+	if errors.As(err, &se) {
+		h := Header{"status": se.Status}
+		if se.Message != "" {
+			h["message"] = se.Message
+		}
+		return h
+	}
+	return Header{"status": PEStatusInternalError, "message": err.Error()}
+}
+
+func (a *Agent) resource(name string) *Resource {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.peResources[name]
+}
+
+func (a *Agent) resourceList() []ResourceInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]ResourceInfo, 0, len(a.peResources))
+	for _, r := range a.peResources {
+		out = append(out, r.Info)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Resource < out[j].Resource
+	})
+	return out
+}
+
+func (a *Agent) serveGet(req *peMessage) {
+	name := req.header.Resource()
+	if name == ResourceList {
+		data, _ := asciiJSON(a.resourceList())
+		a.replyPE(req, Header{"status": PEStatusOK}, data)
+		return
+	}
+
+	r := a.resource(name)
+	switch {
+	case r == nil:
+		a.replyPE(req, Header{"status": PEStatusNotFound}, nil)
+	case r.Get == nil:
+		a.replyPE(req, Header{"status": PEStatusNotAllowed}, nil)
+	default:
+		data, err := r.Get(&PERequest{Source: req.Source, Header: req.header, Data: req.data})
+		if err != nil {
+			a.replyPE(req, errorHeader(err), nil)
+			return
+		}
+		h := Header{"status": PEStatusOK}
+		if enc := req.header.String("mutualEncoding"); enc != "" {
+			h["mutualEncoding"] = enc
+		}
+		a.replyPE(req, h, data)
+	}
+}
+
+func (a *Agent) serveSet(req *peMessage) {
+	r := a.resource(req.header.Resource())
+	switch {
+	case r == nil:
+		a.replyPE(req, Header{"status": PEStatusNotFound}, nil)
+	case r.Set == nil:
+		a.replyPE(req, Header{"status": PEStatusNotAllowed}, nil)
+	default:
+		if err := r.Set(&PERequest{Source: req.Source, Header: req.header, Data: req.data}); err != nil {
+			a.replyPE(req, errorHeader(err), nil)
+			return
+		}
+		a.replyPE(req, Header{"status": PEStatusOK}, nil)
+	}
+}
+
+func (a *Agent) serveSubscribe(req *peMessage) {
+	command := req.header.String("command")
+	id := req.header.String("subscribeId")
+
+	// updates for subscriptions we initiated
+	a.mu.Lock()
+	cs, ours := a.peSubscriptions[id]
+	if ours && cs.remote != req.Source {
+		ours = false
+	}
+	if ours && command == SubscribeEnd {
+		delete(a.peSubscriptions, id)
+	}
+	a.mu.Unlock()
+
+	if ours {
+		if cs.handler != nil {
+			cs.handler(command, req.header, req.data)
+		}
+		a.replyPE(req, Header{"status": PEStatusOK}, nil)
+		return
+	}
+
+	switch command {
+	case SubscribeStart:
+		name := req.header.Resource()
+		r := a.resource(name)
+		if r == nil {
+			a.replyPE(req, Header{"status": PEStatusNotFound}, nil)
+			return
+		} else if !r.Info.CanSubscribe {
+			a.replyPE(req, Header{"status": PEStatusNotAllowed}, nil)
+			return
+		}
+
+		a.mu.Lock()
+		a.peNextSubscribeID++
+		id = "sub" + strconv.Itoa(a.peNextSubscribeID)
+		a.peSubscribers[id] = &serverSubscription{remote: req.Source, resource: name, resID: req.header.String("resId")}
+		a.mu.Unlock()
+
+		a.replyPE(req, Header{"status": PEStatusOK, "subscribeId": id}, nil)
+	case SubscribeEnd:
+		// only the subscriber may end its subscription
+		a.mu.Lock()
+		ss, ok := a.peSubscribers[id]
+		ok = ok && ss.remote == req.Source
+		if ok {
+			delete(a.peSubscribers, id)
+		}
+		a.mu.Unlock()
+
+		if ok {
+			a.replyPE(req, Header{"status": PEStatusOK}, nil)
+		} else {
+			a.replyPE(req, Header{"status": PEStatusNotFound}, nil)
+		}
+	default:
+		a.replyPE(req, Header{"status": PEStatusBadRequest}, nil)
+	}
+}
@@ -0,0 +1,325 @@
+package ci
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jaz303/midi/ump"
+)
+
+func TestMcoded7(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		enc  []byte
+	}{
+		{"empty", nil, []byte{}},
+		{"7-bit", []byte{1, 2, 3}, []byte{0x00, 1, 2, 3}},
+		{"high bits", []byte{0x80, 0x01, 0xFF}, []byte{0x50, 0x00, 0x01, 0x7F}},
+		{
+			"two groups",
+			[]byte{0xFF, 0, 0, 0, 0, 0, 0x80, 0x81},
+			[]byte{0x41, 0x7F, 0, 0, 0, 0, 0, 0x00, 0x40, 0x01},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := EncodeMcoded7(tt.data)
+			if !bytes.Equal(enc, tt.enc) {
+				t.Errorf("EncodeMcoded7(% x) = % x, want % x", tt.data, enc, tt.enc)
+			}
+			for _, b := range enc {
+				if b > 0x7F {
+					t.Fatalf("encoded byte 0x%02X is not 7-bit", b)
+				}
+			}
+			if dec := DecodeMcoded7(enc); !bytes.Equal(dec, tt.data) && len(dec)+len(tt.data) > 0 {
+				t.Errorf("DecodeMcoded7(% x) = % x, want % x", enc, dec, tt.data)
+			}
+		})
+	}
+
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	if dec := DecodeMcoded7(EncodeMcoded7(all)); !bytes.Equal(dec, all) {
+		t.Errorf("round trip of every byte value = % x", dec)
+	}
+}
+
+func TestAsciiJSON(t *testing.T) {
+	got, err := asciiJSON(map[string]string{"title": "Piano é 🎹"})
+	must(t, err)
+	want := `{"title":"Piano \u00e9 \ud83c\udfb9"}`
+	if string(got) != want {
+		t.Errorf("asciiJSON = %s, want %s", got, want)
+	}
+}
+
+// sentMessages parses the MIDI-CI messages recorded by d.
+func sentMessages(t *testing.T, d *wire) []*Message {
+	t.Helper()
+
+	var syx ump.SysEx7Assembler
+	var out []*Message
+	for _, words := range d.Sent() {
+		for _, msg := range ump.Split(nil, words) {
+			if data, ok := syx.Push(msg); ok {
+				m, err := Parse(append([]byte(nil), data...))
+				must(t, err)
+				out = append(out, m)
+			}
+		}
+	}
+	return out
+}
+
+func TestPEChunks(t *testing.T) {
+	const remote = MUID(0x1234)
+	payload := bytes.Repeat([]byte("0123456789"), 30)
+
+	tests := []struct {
+		name    string
+		maxSize uint32
+		chunks  int
+		fits    bool // whether every chunk fits in maxSize
+	}{
+		{"one chunk", 0, 1, false},
+		{"several chunks", 100, 5, true},
+		{"minimum chunk size", 1, 19, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &wire{}
+			sender := New(d, 1, &Config{})
+			if tt.maxSize > 0 {
+				sender.addRemote(remote, &Discovery{MaxSysExSize: tt.maxSize})
+			}
+			must(t, sender.sendPE(SubPESet, ToFunctionBlock, remote, 5, Header{"resource": "X"}, payload))
+
+			msgs := sentMessages(t, d)
+			if len(msgs) != tt.chunks {
+				t.Fatalf("sent %d chunks, want %d", len(msgs), tt.chunks)
+			}
+			for i, m := range msgs {
+				if n := len(m.Append(nil)); tt.fits && n > int(tt.maxSize) {
+					t.Errorf("chunk %d is %d bytes, more than the remote's limit", i+1, n)
+				}
+			}
+
+			receiver := New(&wire{}, 1, &Config{})
+			var got *peMessage
+			for i, m := range msgs {
+				m.Destination = receiver.MUID()
+				pe, err := receiver.receivePE(m)
+				must(t, err)
+				if (pe != nil) != (i == len(msgs)-1) {
+					t.Fatalf("chunk %d: complete = %v", i+1, pe != nil)
+				}
+				got = pe
+			}
+			if got.requestID != 5 || got.header.Resource() != "X" || !bytes.Equal(got.data, payload) {
+				t.Errorf("reassembled request %d, header %v, data %q", got.requestID, got.header, got.data)
+			}
+		})
+	}
+}
+
+func TestPEChunksOutOfSequence(t *testing.T) {
+	const remote = MUID(0x1234)
+
+	d := &wire{}
+	sender := New(d, 1, &Config{})
+	sender.addRemote(remote, &Discovery{MaxSysExSize: 64})
+	must(t, sender.sendPE(SubPESet, ToFunctionBlock, remote, 5, Header{}, make([]byte, 100)))
+	msgs := sentMessages(t, d)
+	if len(msgs) < 3 {
+		t.Fatalf("sent %d chunks, want at least 3", len(msgs))
+	}
+
+	tests := []struct {
+		name  string
+		order []int
+	}{
+		{"missing first", []int{1}},
+		{"skipped", []int{0, 2}},
+		{"repeated", []int{0, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := New(&wire{}, 1, &Config{})
+			var err error
+			for _, i := range tt.order {
+				if _, err = receiver.receivePE(msgs[i]); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, ErrMalformed) {
+				t.Errorf("receivePE = %v, want %v", err, ErrMalformed)
+			}
+
+			// a new first chunk starts the message again
+			var pe *peMessage
+			for _, m := range msgs {
+				pe, err = receiver.receivePE(m)
+				must(t, err)
+			}
+			if pe == nil || len(pe.data) != 100 {
+				t.Errorf("message not reassembled after restart: %+v", pe)
+			}
+		})
+	}
+}
+
+func TestPropertyExchange(t *testing.T) {
+	a, b := pair(t, &Config{MaxSysExSize: 128}, &Config{MaxSysExSize: 128})
+	discover(t, a, b)
+
+	programs := make([]ProgramInfo, 20)
+	for i := range programs {
+		programs[i] = ProgramInfo{Title: "Program " + strings.Repeat("x", i), BankPC: []int{0, 0, i}}
+	}
+	must(t, b.RegisterResource(JSONResource(ResourceInfo{Resource: ResourceProgramList}, func(*PERequest) (any, error) {
+		return programs, nil
+	})))
+
+	var stored []byte
+	must(t, b.RegisterResource(&Resource{
+		Info: ResourceInfo{Resource: "X-Blob", Encodings: []string{EncodingMcoded7}},
+		Get:  func(*PERequest) ([]byte, error) { return stored, nil },
+		Set: func(req *PERequest) error {
+			if len(req.Data) == 0 {
+				return &PEStatusError{Status: PEStatusBadData, Message: "empty"}
+			}
+			stored = req.Data
+			return nil
+		},
+	}))
+	if err := b.RegisterResource(&Resource{Info: ResourceInfo{Resource: ResourceList}}); !errors.Is(err, ErrResourceExists) {
+		t.Errorf("registering ResourceList = %v, want %v", err, ErrResourceExists)
+	}
+
+	ctx := context.Background()
+
+	list, err := a.GetResourceList(ctx, b.MUID())
+	must(t, err)
+	var names []string
+	for _, r := range list {
+		names = append(names, r.Resource)
+	}
+	if want := []string{ResourceProgramList, "X-Blob"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("resources = %v, want %v", names, want)
+	}
+
+	// the reply is larger than one chunk in either direction
+	got, err := a.GetProgramList(ctx, b.MUID(), "")
+	must(t, err)
+	if !reflect.DeepEqual(got, programs) {
+		t.Errorf("GetProgramList = %v, want %v", got, programs)
+	}
+
+	blob := make([]byte, 300)
+	for i := range blob {
+		blob[i] = byte(i * 7)
+	}
+	header := Header{"resource": "X-Blob", "mutualEncoding": EncodingMcoded7}
+	_, err = a.SetProperty(ctx, b.MUID(), header, blob)
+	must(t, err)
+	if !bytes.Equal(stored, blob) {
+		t.Errorf("stored % x, want % x", stored, blob)
+	}
+	_, data, err := a.GetProperty(ctx, b.MUID(), header)
+	must(t, err)
+	if !bytes.Equal(data, blob) {
+		t.Errorf("GetProperty = % x, want % x", data, blob)
+	}
+
+	// 8-bit data can't be sent without an encoding
+	if _, err := a.SetProperty(ctx, b.MUID(), Header{"resource": "X-Blob"}, blob); !errors.Is(err, ErrNot7Bit) {
+		t.Errorf("SetProperty of 8-bit data = %v, want %v", err, ErrNot7Bit)
+	}
+
+	statusTests := []struct {
+		name   string
+		get    bool
+		header Header
+		status int
+	}{
+		{"unknown resource", true, Header{"resource": "X-None"}, PEStatusNotFound},
+		{"read-only", false, Header{"resource": ResourceProgramList}, PEStatusNotAllowed},
+		{"handler error", false, Header{"resource": "X-Blob"}, PEStatusBadData},
+	}
+	for _, tt := range statusTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.get {
+				_, _, err = a.GetProperty(ctx, b.MUID(), tt.header)
+			} else {
+				_, err = a.SetProperty(ctx, b.MUID(), tt.header, nil)
+			}
+			var se *PEStatusError
+			if !errors.As(err, &se) || se.Status != tt.status {
+				t.Errorf("got %v, want status %d", err, tt.status)
+			}
+		})
+	}
+}
+
+func TestSubscription(t *testing.T) {
+	a, b := pair(t, &Config{}, &Config{})
+	discover(t, a, b)
+	must(t, b.RegisterResource(&Resource{Info: ResourceInfo{Resource: "X-Level", CanSubscribe: true}}))
+
+	// notifications are not acknowledged, so wait for each to arrive
+	updates := make(chan string, 4)
+	id, err := a.Subscribe(context.Background(), b.MUID(), Header{"resource": "X-Level"}, func(command string, _ Header, data []byte) {
+		updates <- command + " " + string(data)
+	})
+	must(t, err)
+
+	must(t, b.NotifySubscribers("X-Level", "", SubscribeFull, []byte("1")))
+	must(t, b.NotifySubscribers("X-Level", "", SubscribeNotify, []byte("ignored")))
+	must(t, b.NotifySubscribers("X-Other", "", SubscribeFull, []byte("2")))
+	b.UnregisterResource("X-Level")
+
+	for _, want := range []string{SubscribeFull + " 1", SubscribeNotify + " ", SubscribeEnd + " "} {
+		select {
+		case got := <-updates:
+			if got != want {
+				t.Errorf("update %q, want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("no update, want %q", want)
+		}
+	}
+	if err := a.Unsubscribe(context.Background(), id); !errors.Is(err, ErrNoSubscription) {
+		t.Errorf("Unsubscribe after the remote ended it = %v, want %v", err, ErrNoSubscription)
+	}
+}
+
+func TestSubscribeEndFromOtherRemote(t *testing.T) {
+	a, b := pair(t, &Config{}, &Config{})
+	discover(t, a, b)
+	must(t, b.RegisterResource(&Resource{Info: ResourceInfo{Resource: "X-Level", CanSubscribe: true}}))
+	id, err := a.Subscribe(context.Background(), b.MUID(), Header{"resource": "X-Level"}, nil)
+	must(t, err)
+
+	// a third device tries to end a's subscription
+	d := &wire{}
+	c := New(d, 1, &Config{})
+	defer c.Close()
+	must(t, c.sendPE(SubPESubscribe, ToFunctionBlock, b.MUID(), 1, Header{"command": SubscribeEnd, "subscribeId": id}, nil))
+	for _, words := range d.Sent() {
+		b.Handle(words)
+	}
+
+	if err := a.Unsubscribe(context.Background(), id); err != nil {
+		t.Errorf("Unsubscribe after another device tried to end it = %v", err)
+	}
+}
@@ -0,0 +1,474 @@
+package ci
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jaz303/midi/ump"
+)
+
+var ErrReportInProgress = errors.New("message report already in progress")
+
+// Process Inquiry features
+const (
+	ProcessMessageReport = 1 << 0
+)
+
+// Message data control values for MIDI Message Report
+const (
+	ReportNone       = 0x00
+	ReportNonDefault = 0x01
+	ReportFull       = 0x7F
+)
+
+// System message bits
+const (
+	ReportMTCQuarterFrame = 1 << 0
+	ReportSongPosition    = 1 << 1
+	ReportSongSelect      = 1 << 2
+)
+
+// Channel controller message bits
+const (
+	ReportPitchBend            = 1 << 0
+	ReportControlChange        = 1 << 1
+	ReportRegisteredController = 1 << 2
+	ReportAssignableController = 1 << 3
+	ReportProgramChange        = 1 << 4
+	ReportChannelPressure      = 1 << 5
+)
+
+// Note data message bits
+const (
+	ReportNotes                       = 1 << 0
+	ReportPolyPressure                = 1 << 1
+	ReportPerNotePitchBend            = 1 << 2
+	ReportRegisteredPerNoteController = 1 << 3
+	ReportAssignablePerNoteController = 1 << 4
+)
+
+// ReportRequest selects the messages included in a MIDI Message Report.
+type ReportRequest struct {
+	DataControl byte // one of ReportNone, ReportNonDefault, ReportFull
+	System      byte
+	Channel     byte
+	Note        byte
+}
+
+// ReportAll requests every supported message type.
+var ReportAll = ReportRequest{DataControl: ReportFull, System: 0x07, Channel: 0x3F, Note: 0x1F}
+
+func (r *ReportRequest) append(dst []byte, reply bool) []byte {
+	if !reply {
+		dst = append(dst, r.DataControl)
+	}
+	return append(dst, r.System, 0, r.Channel, r.Note)
+}
+
+// MessageReport is the result of a MIDI Message Report inquiry.
+type MessageReport struct {
+	// The message types the responder agreed to report.
+	Reported ReportRequest
+
+	// The messages received between the reply and the End of MIDI Message
+	// Report.
+	Words []ump.Word
+}
+
+// ProcessCapabilities asks a remote device which Process Inquiry features
+// it supports, returning a bitmap of Process* values.
+func (a *Agent) ProcessCapabilities(ctx context.Context, remote MUID) (byte, error) {
+	reply, err := a.request(ctx, a.newMessage(SubProcessCapabilities, ToFunctionBlock, remote, nil), 0)
+	if err != nil {
+		return 0, err
+	}
+	if len(reply.Data) < 1 {
+		return 0, ErrMalformed
+	}
+	return reply.Data[0], nil
+}
+
+// RequestMessageReport asks a remote device to report its current state for
+// a channel (0-15), or for every channel when deviceID is ToGroup or
+// ToFunctionBlock. All non-SysEx messages received on the agent's group
+// while the report is in progress are collected into the result.
+//
+// Only one report may be in progress at a time.
+func (a *Agent) RequestMessageReport(ctx context.Context, remote MUID, deviceID byte, req *ReportRequest) (*MessageReport, error) {
+	// claim the report before registering the transaction, so a second
+	// call fails without superseding the first
+	a.mu.Lock()
+	if a.reportWords != nil {
+		a.mu.Unlock()
+		return nil, ErrReportInProgress
+	}
+	a.reportWords = []ump.Word{}
+	a.mu.Unlock()
+
+	defer func() {
+		a.mu.Lock()
+		a.reportWords = nil
+		a.mu.Unlock()
+	}()
+
+	tx, err := a.begin(SubMessageReport, remote, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer a.finish(tx)
+
+	if err := a.send(a.newMessage(SubMessageReport, deviceID, remote, req.append(nil, false))); err != nil {
+		return nil, err
+	}
+
+	replyCtx, cancel := a.deadline(ctx)
+	defer cancel()
+
+	reply, err := tx.wait(replyCtx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &MessageReport{}
+	r := reader{data: reply.Data}
+	out.Reported.DataControl = req.DataControl
+	out.Reported.System = r.byte()
+	r.byte()
+	out.Reported.Channel = r.byte()
+	out.Reported.Note = r.byte()
+	if r.err() != nil {
+		return nil, r.err()
+	}
+
+	// the report itself may take a while; restart the timeout
+	endCtx, cancelEnd := a.deadline(ctx)
+	defer cancelEnd()
+
+	for {
+		m, err := tx.wait(endCtx)
+		if err != nil {
+			return nil, err
+		}
+		if m.SubID == SubEndOfMessageReport {
+			break
+		}
+	}
+
+	a.mu.Lock()
+	out.Words = a.reportWords
+	a.mu.Unlock()
+
+	return out, nil
+}
+
+// collectReport records non-SysEx messages while a report is in progress.
+func (a *Agent) collectReport(msg []ump.Word) {
+	switch ump.MessageType(msg[0]) {
+	case ump.MsgTypeSystem, ump.MsgTypeMIDIv1, ump.MsgTypeMIDIv2:
+	default:
+		return
+	}
+	if ump.Group(msg[0]) != a.cfg.Group {
+		return
+	}
+
+	a.mu.Lock()
+	if a.reportWords != nil {
+		a.reportWords = append(a.reportWords, msg...)
+	}
+	a.mu.Unlock()
+}
+
+func (a *Agent) onProcessCapabilities(m *Message) {
+	var features byte
+	if a.cfg.State != nil {
+		features |= ProcessMessageReport
+	}
+	a.reply(m, SubProcessCapabilitiesReply, []byte{features})
+}
+
+func (a *Agent) onMessageReport(m *Message) {
+	if a.cfg.State == nil {
+		a.sendNAK(m, StatusMessageNotSupported, "")
+		return
+	}
+
+	r := reader{data: m.Data}
+	req := ReportRequest{DataControl: r.byte(), System: r.byte()}
+	r.byte()
+	req.Channel = r.byte()
+	req.Note = r.byte()
+	if r.err() != nil {
+		a.sendNAK(m, StatusMalformed, "")
+		return
+	}
+
+	// we can report everything that was asked for
+	a.reply(m, SubMessageReportReply, req.append(nil, true))
+
+	channel := -1
+	if m.DeviceID < 16 {
+		channel = int(m.DeviceID)
+	}
+	if req.DataControl != ReportNone {
+		words := a.cfg.State.Report(nil, channel, &req)
+		if len(words) > 0 {
+			a.driver.Send(time.Time{}, a.output, words)
+		}
+	}
+
+	a.reply(m, SubEndOfMessageReport, nil)
+}
+
+// MARK: Channel state
+
+type stateKind int
+
+// Report order: system, then per channel: program, controllers, pitch
+// bend, pressure, then notes and their per-note state.
+const (
+	stateSystem = stateKind(iota)
+	stateProgram
+	stateBankMSB
+	stateBankLSB
+	stateControl
+	stateRegistered
+	stateAssignable
+	statePitchBend
+	stateChannelPressure
+	stateNote
+	statePolyPressure
+	statePerNotePitchBend
+	stateRegisteredPerNote
+	stateAssignablePerNote
+)
+
+type stateKey struct {
+	channel int
+	kind    stateKind
+	index   int
+}
+
+// ChannelState records the current controller, program and note state of
+// a group's channels, as established by the messages an application sends.
+// It is used to answer MIDI Message Report inquiries; see
+// Config.State.
+//
+// Both MIDI 1.0 and MIDI 2.0 channel voice messages are tracked, and are
+// reported in the form they were sent.
+type ChannelState struct {
+	mu     sync.Mutex
+	group  uint8
+	values map[stateKey][]ump.Word
+}
+
+// NewChannelState returns a ChannelState that tracks messages on group.
+func NewChannelState(group uint8) *ChannelState {
+	return &ChannelState{group: group, values: map[stateKey][]ump.Word{}}
+}
+
+// Update records the state changes carried by words. Messages on other
+// groups are ignored.
+func (s *ChannelState) Update(words []ump.Word) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(words) > 0 {
+		msg, rest := ump.Next(words)
+		if msg == nil {
+			return
+		}
+		words = rest
+
+		if ump.Group(msg[0]) != s.group {
+			continue
+		}
+
+		switch ump.MessageType(msg[0]) {
+		case ump.MsgTypeSystem:
+			switch ump.Status(msg[0]) {
+			case 0xF1, 0xF2, 0xF3:
+				s.set(stateKey{-1, stateSystem, int(ump.Status(msg[0]))}, msg)
+			}
+		case ump.MsgTypeMIDIv1, ump.MsgTypeMIDIv2:
+			s.updateChannel(msg)
+		}
+	}
+}
+
+func (s *ChannelState) set(k stateKey, msg []ump.Word) {
+	s.values[k] = append(s.values[k][:0], msg...)
+}
+
+func (s *ChannelState) updateChannel(msg []ump.Word) {
+	ch := int(ump.Channel(msg[0]))
+	index := int(msg[0]>>8) & 0x7F
+	v1 := ump.MessageType(msg[0]) == ump.MsgTypeMIDIv1
+
+	switch ump.Opcode(msg[0]) {
+	case ump.OpNoteOn:
+		if v1 && msg[0]&0x7F == 0 {
+			s.noteOff(ch, index)
+		} else {
+			s.set(stateKey{ch, stateNote, index}, msg)
+		}
+	case ump.OpNoteOff:
+		s.noteOff(ch, index)
+	case ump.OpPolyPressure:
+		s.set(stateKey{ch, statePolyPressure, index}, msg)
+	case ump.OpControlChange:
+		switch {
+		case v1 && index == 0:
+			s.set(stateKey{ch, stateBankMSB, 0}, msg)
+		case v1 && index == 32:
+			s.set(stateKey{ch, stateBankLSB, 0}, msg)
+		case index == 120 || index == 123:
+			// all sound/notes off
+			for k := range s.values {
+				if k.channel == ch && k.kind >= stateNote {
+					delete(s.values, k)
+				}
+			}
+			s.set(stateKey{ch, stateControl, index}, msg)
+		default:
+			s.set(stateKey{ch, stateControl, index}, msg)
+		}
+	case ump.OpProgramChange:
+		s.set(stateKey{ch, stateProgram, 0}, msg)
+	case ump.OpChannelPressure:
+		s.set(stateKey{ch, stateChannelPressure, 0}, msg)
+	case ump.OpPitchBend:
+		s.set(stateKey{ch, statePitchBend, 0}, msg)
+	}
+
+	if v1 {
+		return
+	}
+
+	full := int(msg[0]) & 0x3FFF // bank/index or note/index
+	switch ump.Opcode(msg[0]) {
+	case ump.OpRegisteredController:
+		s.set(stateKey{ch, stateRegistered, full}, msg)
+	case ump.OpAssignableController:
+		s.set(stateKey{ch, stateAssignable, full}, msg)
+	case ump.OpPerNotePitchBend:
+		s.set(stateKey{ch, statePerNotePitchBend, index}, msg)
+	case ump.OpRegisteredPerNoteController:
+		s.set(stateKey{ch, stateRegisteredPerNote, int(msg[0]) & 0x7FFF}, msg)
+	case ump.OpAssignablePerNoteController:
+		s.set(stateKey{ch, stateAssignablePerNote, int(msg[0]) & 0x7FFF}, msg)
+	}
+}
+
+func (s *ChannelState) noteOff(ch int, note int) {
+	delete(s.values, stateKey{ch, stateNote, note})
+	delete(s.values, stateKey{ch, statePolyPressure, note})
+	delete(s.values, stateKey{ch, statePerNotePitchBend, note})
+	for k := range s.values {
+		if k.channel == ch && (k.kind == stateRegisteredPerNote || k.kind == stateAssignablePerNote) && k.index>>8 == note {
+			delete(s.values, k)
+		}
+	}
+}
+
+// Report appends the recorded messages selected by req to dst. channel
+// selects a single channel, or every channel if negative.
+//
+// When req.DataControl is ReportNonDefault, controllers, pressures and
+// pitch bends at their default values (zero, or centre for pitch bend)
+// are omitted.
+func (s *ChannelState) Report(dst []ump.Word, channel int, req *ReportRequest) []ump.Word {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := make([]stateKey, 0, len(s.values))
+	for k := range s.values {
+		if k.channel >= 0 && channel >= 0 && k.channel != channel {
+			continue
+		}
+		if !req.wants(k) {
+			continue
+		}
+		if req.DataControl == ReportNonDefault && isDefault(k.kind, s.values[k]) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.channel != b.channel {
+			return a.channel < b.channel
+		}
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		return a.index < b.index
+	})
+
+	for _, k := range keys {
+		dst = append(dst, s.values[k]...)
+	}
+	return dst
+}
+
+func (r *ReportRequest) wants(k stateKey) bool {
+	switch k.kind {
+	case stateSystem:
+		switch k.index {
+		case 0xF1:
+			return r.System&ReportMTCQuarterFrame != 0
+		case 0xF2:
+			return r.System&ReportSongPosition != 0
+		case 0xF3:
+			return r.System&ReportSongSelect != 0
+		}
+	case stateProgram, stateBankMSB, stateBankLSB:
+		return r.Channel&ReportProgramChange != 0
+	case stateControl:
+		return r.Channel&ReportControlChange != 0
+	case stateRegistered:
+		return r.Channel&ReportRegisteredController != 0
+	case stateAssignable:
+		return r.Channel&ReportAssignableController != 0
+	case statePitchBend:
+		return r.Channel&ReportPitchBend != 0
+	case stateChannelPressure:
+		return r.Channel&ReportChannelPressure != 0
+	case stateNote:
+		return r.Note&ReportNotes != 0
+	case statePolyPressure:
+		return r.Note&ReportPolyPressure != 0
+	case statePerNotePitchBend:
+		return r.Note&ReportPerNotePitchBend != 0
+	case stateRegisteredPerNote:
+		return r.Note&ReportRegisteredPerNoteController != 0
+	case stateAssignablePerNote:
+		return r.Note&ReportAssignablePerNoteController != 0
+	}
+	return false
+}
+
+func isDefault(kind stateKind, msg []ump.Word) bool {
+	v1 := ump.MessageType(msg[0]) == ump.MsgTypeMIDIv1
+	switch kind {
+	case statePitchBend, statePerNotePitchBend:
+		if v1 {
+			return msg[0]&0x7F7F == 0x0040
+		}
+		return msg[1] == 0x80000000
+	case stateControl, stateRegistered, stateAssignable, stateChannelPressure, statePolyPressure,
+		stateRegisteredPerNote, stateAssignablePerNote:
+		if v1 {
+			if kind == stateChannelPressure {
+				return msg[0]&0x7F00 == 0
+			}
+			return msg[0]&0x7F == 0
+		}
+		return msg[1] == 0
+	}
+	return false
+}
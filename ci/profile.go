@@ -0,0 +1,393 @@
+package ci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ProfileID is a 5-byte MIDI-CI profile identifier. Standard profiles start
+// with 0x7E followed by bank, number, version and level; manufacturer
+// specific profiles start with the manufacturer's SysEx ID.
+type ProfileID [5]byte
+
+func (p ProfileID) String() string {
+	return fmt.Sprintf("%02X %02X %02X %02X %02X", p[0], p[1], p[2], p[3], p[4])
+}
+
+// tag packs the profile ID and device ID into a transaction tag.
+func (p ProfileID) tag(deviceID byte) uint64 {
+	return uint64(deviceID)<<40 | uint64(p[0])<<32 | uint64(p[1])<<24 | uint64(p[2])<<16 | uint64(p[3])<<8 | uint64(p[4])
+}
+
+var (
+	ProfileDrawbarOrgan = ProfileID{0x7E, 0x01, 0x01, 0x01, 0x01}
+	ProfileMPE          = ProfileID{0x7E, 0x31, 0x00, 0x01, 0x01}
+)
+
+var (
+	ErrProfileExists   = errors.New("profile already registered")
+	ErrUnknownProfile  = errors.New("profile not registered")
+	ErrProfileRejected = errors.New("profile state change rejected")
+)
+
+// ProfileEventKind identifies the notification carried by a ProfileEvent.
+type ProfileEventKind int
+
+const (
+	ProfileEnabled = ProfileEventKind(1 + iota)
+	ProfileDisabled
+	ProfileAdded
+	ProfileRemoved
+	ProfileData
+)
+
+// ProfileEvent is a profile notification received from a remote device.
+type ProfileEvent struct {
+	Kind     ProfileEventKind
+	Source   MUID
+	DeviceID byte
+	ID       ProfileID
+	Channels uint16 // ProfileEnabled/ProfileDisabled only
+	Data     []byte // ProfileData only
+}
+
+// LocalProfile declares a profile supported by the local device on a given
+// channel (0-15), group (ToGroup) or function block (ToFunctionBlock).
+type LocalProfile struct {
+	ID       ProfileID
+	DeviceID byte
+	Enabled  bool
+	Channels uint16
+
+	// Called when a remote device asks to enable or disable the profile.
+	// Returning an error refuses the request. If nil, all requests are
+	// accepted.
+	OnSetEnabled func(enabled bool, channels uint16) error
+
+	// Called when Profile Specific Data is received for the profile.
+	OnData func(source MUID, data []byte)
+
+	// Returns the reply data for a Profile Details Inquiry with the given
+	// inquiry target, or false if the target is not supported.
+	Details func(target byte) ([]byte, bool)
+}
+
+type profileKey struct {
+	deviceID byte
+	id       ProfileID
+}
+
+// ProfileReply lists the profiles a remote device reported for one
+// channel, group or function block.
+type ProfileReply struct {
+	DeviceID byte
+	Enabled  []ProfileID
+	Disabled []ProfileID
+}
+
+func appendProfileList(dst []byte, ids []ProfileID) []byte {
+	dst = put14(dst, uint16(len(ids)))
+	for _, id := range ids {
+		dst = append(dst, id[:]...)
+	}
+	return dst
+}
+
+func readProfileList(r *reader) []ProfileID {
+	n := int(r.u14())
+	out := make([]ProfileID, 0, n)
+	for i := 0; i < n && !r.bad; i++ {
+		var id ProfileID
+		copy(id[:], r.bytes(5))
+		out = append(out, id)
+	}
+	return out
+}
+
+func readProfileID(r *reader) ProfileID {
+	var id ProfileID
+	copy(id[:], r.bytes(5))
+	return id
+}
+
+// MARK: Initiator
+
+// ProfileInquiry asks a remote device which profiles it supports. When
+// deviceID is ToFunctionBlock the device replies once for each channel,
+// group and function block that has profiles, and replies are collected
+// until the agent's timeout; otherwise the first reply is returned.
+func (a *Agent) ProfileInquiry(ctx context.Context, remote MUID, deviceID byte) ([]*ProfileReply, error) {
+	tx, err := a.begin(SubProfileInquiry, remote, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer a.finish(tx)
+
+	if err := a.send(a.newMessage(SubProfileInquiry, deviceID, remote, nil)); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := a.deadline(ctx)
+	defer cancel()
+
+	var out []*ProfileReply
+	for {
+		m, err := tx.wait(ctx)
+		if errors.Is(err, ErrTimeout) && len(out) > 0 {
+			return out, nil
+		} else if err != nil {
+			return out, err
+		}
+
+		r := reader{data: m.Data}
+		reply := &ProfileReply{DeviceID: m.DeviceID}
+		reply.Enabled = readProfileList(&r)
+		reply.Disabled = readProfileList(&r)
+		if r.err() != nil {
+			return out, r.err()
+		}
+		out = append(out, reply)
+
+		if deviceID != ToFunctionBlock {
+			return out, nil
+		}
+	}
+}
+
+// SetProfileOn asks a remote device to enable a profile and waits for the
+// Profile Enabled Report confirming it. channels is the number of channels
+// requested for multi-channel profiles and is otherwise zero.
+func (a *Agent) SetProfileOn(ctx context.Context, remote MUID, deviceID byte, id ProfileID, channels uint16) error {
+	data := put14(append([]byte(nil), id[:]...), channels)
+	_, err := a.request(ctx, a.newMessage(SubSetProfileOn, deviceID, remote, data), id.tag(deviceID))
+	return err
+}
+
+// SetProfileOff asks a remote device to disable a profile and waits for the
+// Profile Disabled Report confirming it.
+func (a *Agent) SetProfileOff(ctx context.Context, remote MUID, deviceID byte, id ProfileID) error {
+	data := put14(append([]byte(nil), id[:]...), 0)
+	_, err := a.request(ctx, a.newMessage(SubSetProfileOff, deviceID, remote, data), id.tag(deviceID))
+	return err
+}
+
+// ProfileDetails sends a Profile Details Inquiry and returns the reply
+// data.
+func (a *Agent) ProfileDetails(ctx context.Context, remote MUID, deviceID byte, id ProfileID, target byte) ([]byte, error) {
+	data := append(append([]byte(nil), id[:]...), target)
+	m, err := a.request(ctx, a.newMessage(SubProfileDetailsInquiry, deviceID, remote, data), id.tag(deviceID))
+	if err != nil {
+		return nil, err
+	}
+	r := reader{data: m.Data}
+	readProfileID(&r)
+	r.byte()
+	out := r.bytes(int(r.u14()))
+	return out, r.err()
+}
+
+// SendProfileData sends Profile Specific Data for a profile to a remote
+// device. Use Broadcast to address every device.
+func (a *Agent) SendProfileData(remote MUID, deviceID byte, id ProfileID, data []byte) error {
+	body := put28(append([]byte(nil), id[:]...), uint32(len(data)))
+	return a.send(a.newMessage(SubProfileSpecificData, deviceID, remote, append(body, data...)))
+}
+
+// MARK: Responder
+
+// AddProfile registers a profile supported by the local device and
+// broadcasts a Profile Added Report.
+func (a *Agent) AddProfile(p *LocalProfile) error {
+	key := profileKey{p.DeviceID, p.ID}
+
+	a.mu.Lock()
+	if _, ok := a.profiles[key]; ok {
+		a.mu.Unlock()
+		return ErrProfileExists
+	}
+	a.profiles[key] = p
+	a.mu.Unlock()
+
+	return a.send(a.newMessage(SubProfileAdded, p.DeviceID, Broadcast, p.ID[:]))
+}
+
+// RemoveProfile unregisters a profile and broadcasts a Profile Removed
+// Report.
+func (a *Agent) RemoveProfile(deviceID byte, id ProfileID) error {
+	key := profileKey{deviceID, id}
+
+	a.mu.Lock()
+	if _, ok := a.profiles[key]; !ok {
+		a.mu.Unlock()
+		return ErrUnknownProfile
+	}
+	delete(a.profiles, key)
+	a.mu.Unlock()
+
+	return a.send(a.newMessage(SubProfileRemoved, deviceID, Broadcast, id[:]))
+}
+
+// SetProfileEnabled changes the state of a local profile and broadcasts
+// the corresponding Profile Enabled or Disabled Report.
+func (a *Agent) SetProfileEnabled(deviceID byte, id ProfileID, enabled bool, channels uint16) error {
+	a.mu.Lock()
+	p, ok := a.profiles[profileKey{deviceID, id}]
+	if ok {
+		p.Enabled = enabled
+		p.Channels = channels
+	}
+	a.mu.Unlock()
+
+	if !ok {
+		return ErrUnknownProfile
+	}
+
+	return a.reportProfileState(deviceID, id, enabled, channels)
+}
+
+func (a *Agent) reportProfileState(deviceID byte, id ProfileID, enabled bool, channels uint16) error {
+	sub := byte(SubProfileDisabled)
+	if enabled {
+		sub = SubProfileEnabled
+	}
+	data := put14(append([]byte(nil), id[:]...), channels)
+	return a.send(a.newMessage(sub, deviceID, Broadcast, data))
+}
+
+func (a *Agent) localProfile(deviceID byte, id ProfileID) *LocalProfile {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.profiles[profileKey{deviceID, id}]
+}
+
+func (a *Agent) onProfileInquiry(m *Message) {
+	replies := map[byte]*ProfileReply{}
+
+	a.mu.Lock()
+	for k, p := range a.profiles {
+		if m.DeviceID != ToFunctionBlock && k.deviceID != m.DeviceID {
+			continue
+		}
+		r := replies[k.deviceID]
+		if r == nil {
+			r = &ProfileReply{DeviceID: k.deviceID}
+			replies[k.deviceID] = r
+		}
+		if p.Enabled {
+			r.Enabled = append(r.Enabled, p.ID)
+		} else {
+			r.Disabled = append(r.Disabled, p.ID)
+		}
+	}
+	a.mu.Unlock()
+
+	if len(replies) == 0 {
+		replies[m.DeviceID] = &ProfileReply{DeviceID: m.DeviceID}
+	}
+
+	ids := make([]int, 0, len(replies))
+	for d := range replies {
+		ids = append(ids, int(d))
+	}
+	sort.Ints(ids)
+
+	for _, d := range ids {
+		r := replies[byte(d)]
+		data := appendProfileList(nil, r.Enabled)
+		data = appendProfileList(data, r.Disabled)
+		a.send(a.newMessage(SubProfileInquiryReply, r.DeviceID, m.Source, data))
+	}
+}
+
+func (a *Agent) onSetProfile(m *Message) {
+	r := reader{data: m.Data}
+	id := readProfileID(&r)
+	var channels uint16
+	if r.more() {
+		channels = r.u14()
+	}
+	if r.err() != nil {
+		a.sendNAK(m, StatusMalformed, "")
+		return
+	}
+
+	p := a.localProfile(m.DeviceID, id)
+	if p == nil {
+		a.sendNAK(m, StatusProfileNotSupported, "")
+		return
+	}
+
+	enabled := m.SubID == SubSetProfileOn
+	if p.OnSetEnabled != nil {
+		if err := p.OnSetEnabled(enabled, channels); err != nil {
+			a.sendNAK(m, StatusNAK, err.Error())
+			return
+		}
+	}
+
+	a.SetProfileEnabled(m.DeviceID, id, enabled, channels)
+}
+
+func (a *Agent) onProfileDetails(m *Message) {
+	r := reader{data: m.Data}
+	id := readProfileID(&r)
+	target := r.byte()
+	if r.err() != nil {
+		a.sendNAK(m, StatusMalformed, "")
+		return
+	}
+
+	p := a.localProfile(m.DeviceID, id)
+	if p == nil {
+		a.sendNAK(m, StatusProfileNotSupported, "")
+		return
+	}
+
+	var details []byte
+	ok := false
+	if p.Details != nil {
+		details, ok = p.Details(target)
+	}
+	if !ok {
+		a.sendNAK(m, StatusMessageNotSupported, "")
+		return
+	}
+
+	data := append(append([]byte(nil), id[:]...), target)
+	data = put14(data, uint16(len(details)))
+	a.reply(m, SubProfileDetailsReply, append(data, details...))
+}
+
+// onProfileNotification handles reports from remote devices, and Profile
+// Specific Data addressed to local profiles.
+func (a *Agent) onProfileNotification(m *Message) {
+	r := reader{data: m.Data}
+	evt := &ProfileEvent{Source: m.Source, DeviceID: m.DeviceID, ID: readProfileID(&r)}
+
+	switch m.SubID {
+	case SubProfileEnabled, SubProfileDisabled:
+		evt.Kind = ProfileDisabled
+		if m.SubID == SubProfileEnabled {
+			evt.Kind = ProfileEnabled
+		}
+		if r.more() {
+			evt.Channels = r.u14()
+		}
+	case SubProfileAdded:
+		evt.Kind = ProfileAdded
+	case SubProfileRemoved:
+		evt.Kind = ProfileRemoved
+	case SubProfileSpecificData:
+		evt.Kind = ProfileData
+		evt.Data = append([]byte(nil), r.bytes(int(r.u28()))...)
+		if p := a.localProfile(m.DeviceID, evt.ID); p != nil && p.OnData != nil && r.err() == nil {
+			p.OnData(m.Source, evt.Data)
+		}
+	}
+
+	if r.err() == nil && a.cfg.OnProfile != nil {
+		a.cfg.OnProfile(evt)
+	}
+}
@@ -0,0 +1,196 @@
+package ci
+
+import (
+	"context"
+	"errors"
+)
+
+// txKey identifies an outstanding request. Replies are matched on the
+// Sub-ID#2 of the original request, the remote MUID (Broadcast for requests
+// that collect replies from every device) and a tag that distinguishes
+// concurrent requests of the same kind, such as a Property Exchange
+// request ID.
+type txKey struct {
+	sub    byte
+	remote MUID
+	tag    uint64
+}
+
+type transaction struct {
+	key     txKey
+	replies chan *Message
+	done    chan struct{}
+	err     error
+}
+
+// abort fails the transaction with err. The caller must hold a.mu.
+func (tx *transaction) abort(err error) {
+	tx.err = err
+	close(tx.done)
+}
+
+// replyTo maps each reply's Sub-ID#2 to that of the request it answers.
+var replyTo = map[byte]byte{
+	SubDiscoveryReply:      SubDiscovery,
+	SubEndpointInfoReply:   SubEndpointInfo,
+	SubProfileInquiryReply: SubProfileInquiry,
+	SubProfileEnabled:      SubSetProfileOn,
+	SubProfileDisabled:     SubSetProfileOff,
+	SubProfileDetailsReply: SubProfileDetailsInquiry,
+	SubPECapabilitiesReply: SubPECapabilities,
+
+	SubProcessCapabilitiesReply: SubProcessCapabilities,
+	SubMessageReportReply:       SubMessageReport,
+	SubEndOfMessageReport:       SubMessageReport,
+}
+
+// replyTag extracts the transaction tag from a reply. Most replies have no
+// tag.
+func replyTag(m *Message) uint64 {
+	switch m.SubID {
+	case SubProfileEnabled, SubProfileDisabled, SubProfileDetailsReply:
+		if len(m.Data) >= 5 {
+			var id ProfileID
+			copy(id[:], m.Data)
+			return id.tag(m.DeviceID)
+		}
+	}
+	return 0
+}
+
+// begin registers a transaction. It must be called before the request is
+// sent so that a fast reply is not missed.
+func (a *Agent) begin(sub byte, remote MUID, tag uint64) (*transaction, error) {
+	tx := &transaction{
+		key:     txKey{sub: sub, remote: remote, tag: tag},
+		replies: make(chan *Message, 64),
+		done:    make(chan struct{}),
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil, ErrClosed
+	}
+	if prev, ok := a.pending[tx.key]; ok {
+		// a newer identical request supersedes the old one
+		prev.abort(ErrSuperseded)
+	}
+	a.pending[tx.key] = tx
+	return tx, nil
+}
+
+func (a *Agent) finish(tx *transaction) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.pending[tx.key] == tx {
+		delete(a.pending, tx.key)
+	}
+}
+
+// complete delivers m to the matching transaction, if any, and reports
+// whether one was found.
+func (a *Agent) complete(m *Message) bool {
+	var sub byte
+	anyTag := false
+	var tag uint64
+
+	switch m.SubID {
+	case SubACK, SubNAK:
+		n, err := ParseNAK(m.Data)
+		if err != nil {
+			return false
+		}
+		sub = n.SubID
+		anyTag = true
+	default:
+		var ok bool
+		if sub, ok = replyTo[m.SubID]; !ok {
+			return false
+		}
+		tag = replyTag(m)
+	}
+
+	return a.deliver(sub, tag, anyTag, m)
+}
+
+// deliver passes m to the transaction for the request with Sub-ID#2 sub
+// and the given tag, if one is outstanding. If anyTag is true the tag is
+// ignored.
+func (a *Agent) deliver(sub byte, tag uint64, anyTag bool, m *Message) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var tx *transaction
+	for _, remote := range []MUID{m.Source, Broadcast} {
+		if anyTag {
+			for k, t := range a.pending {
+				if k.sub == sub && k.remote == remote {
+					tx = t
+					break
+				}
+			}
+		} else {
+			tx = a.pending[txKey{sub: sub, remote: remote, tag: tag}]
+		}
+		if tx != nil {
+			break
+		}
+	}
+
+	if tx == nil {
+		return false
+	}
+
+	select {
+	case tx.replies <- m:
+	default:
+	}
+
+	return true
+}
+
+// wait blocks until a reply arrives, ctx is done, or the agent is closed.
+// A NAK reply is returned as a *NAKError. ACKs, such as a MIDI-CI 1.2
+// device asking for more time, are not replies and are skipped.
+func (tx *transaction) wait(ctx context.Context) (*Message, error) {
+	for {
+		select {
+		case m := <-tx.replies:
+			switch m.SubID {
+			case SubACK:
+				continue
+			case SubNAK:
+				n, _ := ParseNAK(m.Data)
+				return nil, &NAKError{*n}
+			}
+			return m, nil
+		case <-tx.done:
+			return nil, tx.err
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return nil, ErrTimeout
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// request sends m and waits for the matching reply, subject to the agent's
+// timeout.
+func (a *Agent) request(ctx context.Context, m *Message, tag uint64) (*Message, error) {
+	tx, err := a.begin(m.SubID, m.Destination, tag)
+	if err != nil {
+		return nil, err
+	}
+	defer a.finish(tx)
+
+	if err := a.send(m); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := a.deadline(ctx)
+	defer cancel()
+
+	return tx.wait(ctx)
+}
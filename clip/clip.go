@@ -0,0 +1,184 @@
+// Package clip reads and writes MIDI Clip Files (SMF2CLIP), which store a
+// sequence of UMP messages separated by Delta Clockstamps.
+package clip
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/jaz303/midi/ump"
+)
+
+const (
+	magic = "SMF2CLIP"
+
+	DefaultTicksPerQuarter = 480
+)
+
+var ErrInvalidFile = errors.New("invalid clip file")
+
+// Event is a group of UMP messages positioned in ticks from the start of
+// the clip.
+type Event struct {
+	Tick  uint32
+	Words []ump.Word
+}
+
+// Clip is the contents of a MIDI Clip File.
+//
+// The Delta Clockstamp Ticks Per Quarter Note message, Delta Clockstamps and
+// the Start/End of Clip messages are implied by the structure and are not
+// included in Header or Events.
+type Clip struct {
+	// Delta Clockstamp resolution; DefaultTicksPerQuarter if zero.
+	TicksPerQuarter uint16
+
+	// Messages appearing in the clip header, before Start of Clip, e.g.
+	// initial tempo and time signature.
+	Header []ump.Word
+
+	// Clip sequence data. Events must be sorted by tick.
+	Events []Event
+}
+
+// Write encodes c as a clip file and writes it to w.
+func Write(w io.Writer, c *Clip) error {
+	tpq := c.TicksPerQuarter
+	if tpq == 0 {
+		tpq = DefaultTicksPerQuarter
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(magic)
+
+	put := func(words ...ump.Word) {
+		for _, w := range words {
+			binary.Write(bw, binary.BigEndian, uint32(w))
+		}
+	}
+
+	putDelta := func(delta uint32) {
+		for delta > ump.MaxDeltaClockstamp {
+			put(ump.DeltaClockstamp(ump.MaxDeltaClockstamp))
+			delta -= ump.MaxDeltaClockstamp
+		}
+		put(ump.DeltaClockstamp(delta))
+	}
+
+	put(ump.DeltaClockstamp(0), ump.DeltaClockstampTPQ(tpq))
+	for words := c.Header; len(words) > 0; {
+		msg, rest := ump.Next(words)
+		if msg == nil {
+			return fmt.Errorf("%w: truncated header message", ErrInvalidFile)
+		}
+		put(ump.DeltaClockstamp(0))
+		put(msg...)
+		words = rest
+	}
+
+	put(ump.DeltaClockstamp(0))
+	put(ump.StartOfClip[:]...)
+
+	var last uint32
+	for _, evt := range c.Events {
+		if evt.Tick < last {
+			return fmt.Errorf("%w: events are not sorted", ErrInvalidFile)
+		}
+		for words := evt.Words; len(words) > 0; {
+			msg, rest := ump.Next(words)
+			if msg == nil {
+				return fmt.Errorf("%w: truncated message at tick %d", ErrInvalidFile, evt.Tick)
+			}
+			putDelta(evt.Tick - last)
+			put(msg...)
+			last = evt.Tick
+			words = rest
+		}
+	}
+
+	put(ump.DeltaClockstamp(0))
+	put(ump.EndOfClip[:]...)
+
+	return bw.Flush()
+}
+
+// Read parses a clip file. Consecutive messages at the same tick are
+// collected into a single Event.
+func Read(r io.Reader) (*Clip, error) {
+	br := bufio.NewReader(r)
+
+	var head [len(magic)]byte
+	if _, err := io.ReadFull(br, head[:]); err != nil || string(head[:]) != magic {
+		return nil, fmt.Errorf("%w: missing %s header", ErrInvalidFile, magic)
+	}
+
+	next := func() ([]ump.Word, error) {
+		var w0 uint32
+		if err := binary.Read(br, binary.BigEndian, &w0); err != nil {
+			if err == io.EOF {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: truncated message", ErrInvalidFile)
+		}
+		msg := make([]ump.Word, ump.Size(ump.Word(w0)))
+		msg[0] = ump.Word(w0)
+		for i := 1; i < len(msg); i++ {
+			var w uint32
+			if err := binary.Read(br, binary.BigEndian, &w); err != nil {
+				return nil, fmt.Errorf("%w: truncated message", ErrInvalidFile)
+			}
+			msg[i] = ump.Word(w)
+		}
+		return msg, nil
+	}
+
+	c := &Clip{}
+	inSequence := false
+	var tick uint32
+
+	for {
+		msg, err := next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: missing End of Clip", ErrInvalidFile)
+		} else if err != nil {
+			return nil, err
+		}
+
+		if ump.MessageType(msg[0]) == ump.MsgTypeUtility {
+			switch ump.UtilityStatus(msg[0]) {
+			case ump.UtilityDeltaClockstampTPQ:
+				c.TicksPerQuarter = uint16(msg[0])
+				continue
+			case ump.UtilityDeltaClockstamp:
+				if inSequence {
+					tick += ump.DeltaClockstampTicks(msg[0])
+				}
+				continue
+			}
+		}
+
+		if ump.MessageType(msg[0]) == ump.MsgTypeStream {
+			switch ump.StreamStatus(msg[0]) {
+			case ump.StreamStartOfClip:
+				inSequence = true
+				continue
+			case ump.StreamEndOfClip:
+				if c.TicksPerQuarter == 0 {
+					return nil, fmt.Errorf("%w: missing Delta Clockstamp Ticks Per Quarter Note", ErrInvalidFile)
+				}
+				return c, nil
+			}
+		}
+
+		if !inSequence {
+			c.Header = append(c.Header, msg...)
+		} else if n := len(c.Events); n > 0 && c.Events[n-1].Tick == tick {
+			c.Events[n-1].Words = append(c.Events[n-1].Words, msg...)
+		} else {
+			c.Events = append(c.Events, Event{Tick: tick, Words: msg})
+		}
+	}
+}
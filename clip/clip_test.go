@@ -0,0 +1,183 @@
+package clip
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jaz303/midi/smf"
+	"github.com/jaz303/midi/ump"
+)
+
+func TestWriteRead(t *testing.T) {
+	tempo := ump.SetTempo(0, 50_000_000)
+	noteOn := []ump.Word{0x40903C00, 0x80000000} // MIDI 2.0 note on
+
+	tests := []struct {
+		name string
+		clip Clip
+		want Clip // if different from clip
+	}{
+		{"empty", Clip{TicksPerQuarter: 96}, Clip{}},
+		{"default resolution", Clip{}, Clip{TicksPerQuarter: DefaultTicksPerQuarter}},
+		{
+			"header and events",
+			Clip{
+				TicksPerQuarter: 960,
+				Header:          tempo[:],
+				Events: []Event{
+					{Tick: 0, Words: []ump.Word{ump.NoteOn(0, 60, 100), ump.NoteOn(0, 64, 100)}},
+					{Tick: 480, Words: noteOn[:]},
+					{Tick: 960, Words: ump.AppendSysEx7(nil, 0, []byte{1, 2, 3, 4, 5, 6, 7, 8})},
+				},
+			},
+			Clip{},
+		},
+		{
+			"long delta",
+			Clip{
+				TicksPerQuarter: 480,
+				Events: []Event{
+					{Tick: 10, Words: []ump.Word{ump.NoteOn(0, 60, 100)}},
+					{Tick: 10 + 2*ump.MaxDeltaClockstamp + 5, Words: []ump.Word{ump.NoteOff(0, 60, 0)}},
+				},
+			},
+			Clip{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.want
+			if want.TicksPerQuarter == 0 {
+				want = tt.clip
+			}
+
+			var buf bytes.Buffer
+			if err := Write(&buf, &tt.clip); err != nil {
+				t.Fatal(err)
+			}
+			got, err := Read(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, &want) {
+				t.Errorf("got %+v\nwant %+v", got, &want)
+			}
+		})
+	}
+}
+
+func TestWriteInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		clip Clip
+	}{
+		{"unsorted", Clip{Events: []Event{
+			{Tick: 10, Words: []ump.Word{ump.Clock}},
+			{Tick: 5, Words: []ump.Word{ump.Clock}},
+		}}},
+		{"truncated event", Clip{Events: []Event{{Tick: 0, Words: []ump.Word{0x40903c00}}}}},
+		{"truncated header", Clip{Header: []ump.Word{0xD0100000}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Write(&bytes.Buffer{}, &tt.clip); !errors.Is(err, ErrInvalidFile) {
+				t.Errorf("Write = %v, want %v", err, ErrInvalidFile)
+			}
+		})
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	encode := func(words ...ump.Word) []byte {
+		out := []byte(magic)
+		for _, w := range words {
+			out = append(out, byte(w>>24), byte(w>>16), byte(w>>8), byte(w))
+		}
+		return out
+	}
+	start, end := ump.StartOfClip, ump.EndOfClip
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"bad magic", []byte("SMF1CLIP")},
+		{"missing end", encode(ump.DeltaClockstampTPQ(480), start[0], start[1], start[2], start[3])},
+		{"truncated message", encode(ump.DeltaClockstampTPQ(480))[:len(magic)+2]},
+		{"truncated long message", encode(start[0], start[1])},
+		{"missing resolution", encode(start[0], start[1], start[2], start[3], end[0], end[1], end[2], end[3])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(bytes.NewReader(tt.data)); !errors.Is(err, ErrInvalidFile) {
+				t.Errorf("Read = %v, want %v", err, ErrInvalidFile)
+			}
+		})
+	}
+}
+
+func TestSMFConversion(t *testing.T) {
+	f := &smf.File{
+		Format: smf.Format1,
+		PPQN:   480,
+		Tracks: [][]smf.Message{
+			{
+				{Tick: 0, Data: smf.Tempo(500_000)},
+				{Tick: 0, Data: smf.TimeSig(3, 2, 24, 8)},
+				{Tick: 0, Data: smf.TrackName("Conductor")},
+			},
+			{
+				{Tick: 0, Data: []byte{0x90, 60, 100}},
+				{Tick: 240, Data: []byte{0xF0, 0x7E, 0x7F, 0x09, 0x01, 0xF7}},
+				{Tick: 480, Data: []byte{0x80, 60, 0}},
+				{Tick: 480, Data: []byte{0xF7, 0xF3, 0x01}},
+			},
+		},
+	}
+
+	c, report := FromSMF(f)
+	if c.TicksPerQuarter != 480 {
+		t.Errorf("TicksPerQuarter = %d, want 480", c.TicksPerQuarter)
+	}
+	if len(report.Dropped) != 2 {
+		t.Errorf("FromSMF dropped %+v, want the track name and escaped event", report.Dropped)
+	}
+
+	back, report := ToSMF(c)
+	if len(report.Dropped) != 0 {
+		t.Errorf("ToSMF dropped %+v", report.Dropped)
+	}
+	want := []smf.Message{
+		{Tick: 0, Data: smf.Tempo(500_000)},
+		{Tick: 0, Data: smf.TimeSig(3, 2, 24, 8)},
+		{Tick: 0, Data: []byte{0x90, 60, 100}},
+		{Tick: 240, Data: []byte{0xF0, 0x7E, 0x7F, 0x09, 0x01, 0xF7}},
+		{Tick: 480, Data: []byte{0x80, 60, 0}},
+	}
+	if back.Format != smf.Format0 || len(back.Tracks) != 1 {
+		t.Fatalf("ToSMF = format %d with %d tracks, want format 0 with 1", back.Format, len(back.Tracks))
+	}
+	if !reflect.DeepEqual(back.Tracks[0], want) {
+		t.Errorf("track:\n got %v\nwant %v", back.Tracks[0], want)
+	}
+}
+
+func TestToSMFDropped(t *testing.T) {
+	c := &Clip{Events: []Event{
+		{Tick: 0, Words: []ump.Word{ump.DeltaClockstamp(1)}},
+		{Tick: 0, Words: []ump.Word{ump.NoOp, ump.Clock}},
+		{Tick: 1, Words: []ump.Word{0x40903c00}},
+	}}
+	_, report := ToSMF(c)
+
+	var ticks []uint32
+	for _, d := range report.Dropped {
+		ticks = append(ticks, d.Tick)
+	}
+	if !reflect.DeepEqual(ticks, []uint32{0, 0, 1}) {
+		t.Errorf("dropped at ticks %v, want [0 0 1]", ticks)
+	}
+}
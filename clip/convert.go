@@ -0,0 +1,184 @@
+package clip
+
+import (
+	"sort"
+
+	"github.com/jaz303/midi/smf"
+	"github.com/jaz303/midi/ump"
+)
+
+// Dropped describes a message that was omitted during conversion. Exactly
+// one of Words (for UMP input) and Data (for SMF input) is set.
+type Dropped struct {
+	Tick   uint32
+	Words  []ump.Word
+	Data   []byte
+	Reason string
+}
+
+// Report lists the messages that were dropped during conversion.
+type Report struct {
+	Dropped []Dropped
+}
+
+const (
+	ReasonNoUMP = "no UMP equivalent"
+	ReasonNoSMF = "no SMF equivalent"
+)
+
+// FromSMF converts f to a clip. All tracks are merged and placed on group 0;
+// channel messages and sysex are converted to MIDI 1.0 UMP, tempo and time
+// signature meta events to Flex Data. Other meta events and escaped (F7)
+// events are dropped.
+func FromSMF(f *smf.File) (*Clip, *Report) {
+	c := &Clip{TicksPerQuarter: f.PPQN}
+	report := &Report{}
+
+	var merged []smf.Message
+	for _, t := range f.Tracks {
+		merged = append(merged, t...)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Tick < merged[j].Tick
+	})
+
+	drop := func(m smf.Message, reason string) {
+		report.Dropped = append(report.Dropped, Dropped{Tick: m.Tick, Data: m.Data, Reason: reason})
+	}
+
+	for _, m := range merged {
+		if len(m.Data) == 0 {
+			continue
+		}
+
+		var words []ump.Word
+		switch m.Data[0] {
+		case 0xF0:
+			words = ump.AppendSysEx7(nil, 0, m.Data)
+		case 0xF7:
+			drop(m, ReasonNoUMP)
+			continue
+		case 0xFF:
+			typ, payload, _ := m.Meta()
+			switch {
+			case typ == smf.MetaTempo && len(payload) == 3:
+				us := uint32(payload[0])<<16 | uint32(payload[1])<<8 | uint32(payload[2])
+				msg := ump.SetTempo(0, us*100)
+				words = msg[:]
+			case typ == smf.MetaTimeSignature && len(payload) == 4:
+				msg := ump.SetTimeSignature(0, payload[0], payload[1], payload[3])
+				words = msg[:]
+			default:
+				drop(m, ReasonNoUMP)
+				continue
+			}
+		default:
+			w, ok := ump.FromMIDI1Bytes(0, m.Data)
+			if !ok {
+				drop(m, ReasonNoUMP)
+				continue
+			}
+			words = []ump.Word{w}
+		}
+
+		if n := len(c.Events); n > 0 && c.Events[n-1].Tick == m.Tick {
+			c.Events[n-1].Words = append(c.Events[n-1].Words, words...)
+		} else {
+			c.Events = append(c.Events, Event{Tick: m.Tick, Words: words})
+		}
+	}
+
+	return c, report
+}
+
+// ToSMF converts c to a format 0 Standard MIDI File. Header messages are
+// placed at tick zero. MIDI 2.0 channel voice messages are downconverted to
+// MIDI 1.0 where possible, and Flex Data tempo and time signature messages
+// become meta events. Group information is discarded.
+func ToSMF(c *Clip) (*smf.File, *Report) {
+	tpq := c.TicksPerQuarter
+	if tpq == 0 {
+		tpq = DefaultTicksPerQuarter
+	}
+
+	f := &smf.File{Format: smf.Format0, PPQN: tpq}
+	report := &Report{}
+
+	var track []smf.Message
+	var syx ump.SysEx7Assembler
+	var midi1 []ump.Word
+
+	drop := func(tick uint32, msg []ump.Word, reason string) {
+		report.Dropped = append(report.Dropped, Dropped{
+			Tick:   tick,
+			Words:  append([]ump.Word(nil), msg...),
+			Reason: reason,
+		})
+	}
+
+	convert := func(tick uint32, words []ump.Word) {
+		for len(words) > 0 {
+			msg, rest := ump.Next(words)
+			if msg == nil {
+				drop(tick, words, ReasonNoSMF)
+				return
+			}
+			words = rest
+
+			switch ump.MessageType(msg[0]) {
+			case ump.MsgTypeUtility:
+				if msg[0] != ump.NoOp {
+					drop(tick, msg, ReasonNoSMF)
+				}
+			case ump.MsgTypeMIDIv1:
+				if data, ok := ump.AppendMIDI1Bytes(nil, msg); ok {
+					track = append(track, smf.Message{Tick: tick, Data: data})
+				} else {
+					drop(tick, msg, ReasonNoSMF)
+				}
+			case ump.MsgTypeMIDIv2:
+				var ok bool
+				if midi1, ok = ump.ToMIDI1(midi1[:0], msg); !ok {
+					drop(tick, msg, ReasonNoSMF)
+				}
+				for _, w := range midi1 {
+					data, _ := ump.AppendMIDI1Bytes(nil, []ump.Word{w})
+					track = append(track, smf.Message{Tick: tick, Data: data})
+				}
+			case ump.MsgTypeData:
+				if data, ok := syx.Push(msg); ok {
+					track = append(track, smf.Message{Tick: tick, Data: append([]byte(nil), data...)})
+				}
+			case ump.MsgTypeFlexData:
+				if data := flexToMeta(msg); data != nil {
+					track = append(track, smf.Message{Tick: tick, Data: data})
+				} else {
+					drop(tick, msg, ReasonNoSMF)
+				}
+			default:
+				drop(tick, msg, ReasonNoSMF)
+			}
+		}
+	}
+
+	convert(0, c.Header)
+	for _, evt := range c.Events {
+		convert(evt.Tick, evt.Words)
+	}
+
+	f.Tracks = append(f.Tracks, track)
+	return f, report
+}
+
+func flexToMeta(msg []ump.Word) []byte {
+	if ump.FlexStatusBank(msg[0]) != 0 {
+		return nil
+	}
+	switch ump.FlexStatus(msg[0]) {
+	case ump.FlexSetTempo:
+		return smf.Tempo(uint32(msg[1]) / 100)
+	case ump.FlexSetTimeSignature:
+		return smf.TimeSig(byte(msg[1]>>24), byte(msg[1]>>16), 24, byte(msg[1]>>8))
+	}
+	return nil
+}
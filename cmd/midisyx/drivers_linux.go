@@ -0,0 +1,3 @@
+package main
+
+import _ "github.com/jaz303/midi/alsaseq"
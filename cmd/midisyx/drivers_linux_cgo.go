@@ -0,0 +1,5 @@
+//go:build linux && cgo
+
+package main
+
+import _ "github.com/jaz303/midi/alsa"
@@ -0,0 +1,274 @@
+// Command midisyx captures, inspects, splits and replays System Exclusive
+// dumps stored in .syx files.
+//
+//	midisyx ports
+//	midisyx capture -in NAME [-split] FILE.syx
+//	midisyx info FILE.syx...
+//	midisyx split FILE.syx
+//	midisyx send -out NAME [-in NAME -wait] [-delay D] FILE.syx...
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/sysex"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("midisyx: ")
+
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "ports":
+		ports(args)
+	case "capture":
+		capture(args)
+	case "info":
+		info(args)
+	case "split":
+		split(args)
+	case "send":
+		send(args)
+	default:
+		usage()
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage:
+  midisyx ports
+  midisyx capture -in NAME [-split] FILE.syx
+  midisyx info FILE.syx...
+  midisyx split FILE.syx
+  midisyx send -out NAME [-in NAME -wait] [-delay D] FILE.syx...`)
+	os.Exit(2)
+}
+
+// MARK: Commands
+
+func ports(args []string) {
+	fs := flag.NewFlagSet("ports", flag.ExitOnError)
+	driverName := fs.String("driver", "", "MIDI driver; the best available if empty")
+	fs.Parse(args)
+
+	d := openDriver(*driverName)
+	defer d.Close()
+
+	root, err := d.Enumerate()
+	if err != nil {
+		log.Fatal(err)
+	}
+	root.Print()
+}
+
+func capture(args []string) {
+	fs := flag.NewFlagSet("capture", flag.ExitOnError)
+	driverName := fs.String("driver", "", "MIDI driver; the best available if empty")
+	inputs := fs.String("in", "", "comma-separated input name substrings; all inputs if empty")
+	splitFiles := fs.Bool("split", false, "write each message to its own numbered file")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	d := openDriver(*driverName)
+	defer d.Close()
+
+	root, err := d.Enumerate()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var entities []midi.Entity
+	for _, n := range findPorts(root, midi.Input, *inputs) {
+		if err := d.OpenInput(n.Entity); err != nil {
+			log.Fatalf("open %s: %s", n.Name, err)
+		}
+		log.Printf("capturing from %s", n.Name)
+		entities = append(entities, n.Entity)
+	}
+
+	rec := sysex.NewRecorder(entities...)
+	count := 0
+	rec.OnMessage = func(c sysex.Captured) {
+		count++
+		log.Printf("%s", describe(count, c.Data))
+	}
+	d.SetReceiveHandler(rec.Handler(nil))
+
+	log.Printf("press Ctrl-C to stop")
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	<-ctx.Done()
+	stop()
+
+	msgs := rec.Data()
+	if *splitFiles {
+		writeSplit(fs.Arg(0), msgs)
+	} else if err := sysex.WriteFile(fs.Arg(0), msgs); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("wrote %d messages", len(msgs))
+}
+
+func info(args []string) {
+	if len(args) == 0 {
+		usage()
+	}
+	for _, name := range args {
+		msgs, err := sysex.ReadFile(name)
+		if err != nil {
+			log.Fatalf("%s: %s", name, err)
+		}
+		fmt.Printf("%s: %d messages\n", name, len(msgs))
+		for i, m := range msgs {
+			fmt.Printf("  %s\n", describe(i+1, m))
+		}
+	}
+}
+
+func split(args []string) {
+	if len(args) != 1 {
+		usage()
+	}
+	msgs, err := sysex.ReadFile(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	writeSplit(args[0], msgs)
+}
+
+func send(args []string) {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	driverName := fs.String("driver", "", "MIDI driver; the best available if empty")
+	output := fs.String("out", "", "output name substring")
+	input := fs.String("in", "", "input name substring, for -wait")
+	wait := fs.Bool("wait", false, "wait for a reply after each message")
+	delay := fs.Duration("delay", 50*time.Millisecond, "delay between messages")
+	timeout := fs.Duration("timeout", sysex.DefaultTimeout, "reply timeout for -wait")
+	fs.Parse(args)
+	if fs.NArg() == 0 || *output == "" || (*wait && *input == "") {
+		usage()
+	}
+
+	var msgs [][]byte
+	for _, name := range fs.Args() {
+		m, err := sysex.ReadFile(name)
+		if err != nil {
+			log.Fatalf("%s: %s", name, err)
+		}
+		msgs = append(msgs, m...)
+	}
+
+	d := openDriver(*driverName)
+	defer d.Close()
+
+	root, err := d.Enumerate()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	out := findPorts(root, midi.Output, *output)[0]
+	if err := d.OpenOutput(out.Entity); err != nil {
+		log.Fatalf("open %s: %s", out.Name, err)
+	}
+	session := sysex.NewSession(d, out.Entity, 0, *timeout)
+
+	if *wait {
+		in := findPorts(root, midi.Input, *input)[0]
+		if err := d.OpenInput(in.Entity); err != nil {
+			log.Fatalf("open %s: %s", in.Name, err)
+		}
+		d.SetReceiveHandler(session.Handler(in.Entity, nil))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err = sysex.Replay(ctx, session, msgs, sysex.ReplayOptions{
+		Delay:     *delay,
+		WaitReply: *wait,
+		OnSent: func(i int, reply []byte) {
+			log.Printf("sent %s", describe(i+1, msgs[i]))
+			if *wait && reply == nil {
+				log.Printf("  no reply")
+			}
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// MARK: Helpers
+
+func openDriver(name string) midi.Driver {
+	var d midi.Driver
+	var err error
+	if name == "" {
+		d, err = midi.NewDefaultDriver("midisyx")
+	} else {
+		d, err = midi.NewDriverByName(name, "midisyx")
+	}
+	if err != nil {
+		log.Fatalf("create driver: %s", err)
+	}
+	return d
+}
+
+// findPorts returns the ports of type t whose names contain any of the
+// comma-separated substrings in names, or every port of that type if names
+// is empty. It exits if there are none.
+func findPorts(root *midi.Node, t midi.NodeType, names string) []*midi.Node {
+	out := root.Collect(func(n *midi.Node) bool {
+		if n.Type != t {
+			return false
+		}
+		if names == "" {
+			return true
+		}
+		for _, s := range strings.Split(names, ",") {
+			if strings.Contains(n.Name, strings.TrimSpace(s)) {
+				return true
+			}
+		}
+		return false
+	})
+	if len(out) == 0 {
+		log.Fatalf("no %s matching %q", t, names)
+	}
+	return out
+}
+
+func writeSplit(name string, msgs [][]byte) {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if ext == "" {
+		ext = ".syx"
+	}
+	for i, m := range msgs {
+		out := fmt.Sprintf("%s-%03d%s", base, i+1, ext)
+		if err := sysex.WriteFile(out, [][]byte{m}); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(out)
+	}
+}
+
+func describe(i int, msg []byte) string {
+	head := msg[:min(len(msg), 8)]
+	return fmt.Sprintf("#%d %d bytes, manufacturer % X: % X...", i, len(msg), sysex.Manufacturer(msg), head)
+}
@@ -1,3 +1,5 @@
+//go:build darwin && cgo
+
 #include <CoreMIDI/MIDIServices.h>
 #include <CoreServices/CoreServices.h>
 #include <mach/mach_time.h>
@@ -47,7 +49,9 @@ int init(struct client *c) {
 
 void shutdown(struct client *c) {
     if (c->wasInit) {
-
+        MIDIPortDispose(c->inputPort);
+        MIDIPortDispose(c->outputPort);
+        MIDIClientDispose(c->client);
     }
     free(c);
 }
@@ -57,6 +61,10 @@ int openInput(struct client *c, MIDIEndpointRef source) {
     return status;
 }
 
+int closeInput(struct client *c, MIDIEndpointRef source) {
+    return MIDIPortDisconnectSource(c->inputPort, source);
+}
+
 OSStatus send(struct client *c, MIDIEndpointRef destination, uint64_t timestamp, uint32_t *words, uint32_t wordCount) {
     MIDIEventList lst;
     MIDIEventPacket *pkt = MIDIEventListInit(&lst, kMIDIProtocol_1_0);
@@ -14,5 +14,6 @@ struct client* allocateClient();
 int init(struct client *c);
 void shutdown(struct client *c);
 int openInput(struct client *c, MIDIEndpointRef source);
+int closeInput(struct client *c, MIDIEndpointRef source);
 OSStatus send(struct client *c, MIDIEndpointRef destination, uint64_t timestamp, uint32_t *words, uint32_t wordCount);
 OSStatus sendSysEx(struct client *c, MIDIEndpointRef destination, uint8_t *data, uint32_t len);
\ No newline at end of file
@@ -1,4 +1,4 @@
-//go:build darwin
+//go:build darwin && cgo
 
 package darwin
 
@@ -27,7 +27,12 @@ func init() {
 	midi.Register(&midi.Stub{
 		Name:      "Core MIDI",
 		Available: true,
-		CreateDriver: func() (midi.Driver, error) {
+		Priority:  20,
+		Capabilities: midi.Capabilities{
+			NativeScheduling: true,
+			NativeUMP:        true,
+		},
+		CreateDriver: func(string) (midi.Driver, error) {
 			d := new(driver)
 			d.client = C.allocateClient()         // allocate C struct for client
 			d.pinner.Pin(d)                       // pin driver so client C struct can reference it safely
@@ -52,6 +57,8 @@ type driver struct {
 	client    *C.struct_client
 	pinner    runtime.Pinner
 	onReceive midi.ReceiveEventHandler
+	onNotify  midi.NotificationHandler
+	closed    bool
 }
 
 //export OnReceive
@@ -62,6 +69,10 @@ func OnReceive(driverPointer unsafe.Pointer, timestamp uint64, source unsafe.Poi
 }
 
 func (d *driver) Close() error {
+	if d.closed {
+		return nil
+	}
+	d.closed = true
 	d.onReceive = midi.NopHandler
 	C.shutdown(d.client)
 	d.pinner.Unpin()
@@ -75,7 +86,19 @@ func (d *driver) SetReceiveHandler(hnd midi.ReceiveEventHandler) {
 	d.onReceive = hnd
 }
 
+func (d *driver) SetNotificationHandler(hnd midi.NotificationHandler) {
+	// TODO: relay MIDINotifyProc messages
+	if hnd == nil {
+		hnd = midi.NopNotificationHandler
+	}
+	d.onNotify = hnd
+}
+
 func (d *driver) OpenInput(p midi.Entity) error {
+	if d.closed {
+		return midi.ErrClosed
+	}
+
 	result := C.openInput(d.client, C.uint(p))
 	if result != 0 {
 		return fmt.Errorf("(cgo) open input failed with error %d", result)
@@ -84,12 +107,38 @@ func (d *driver) OpenInput(p midi.Entity) error {
 	return nil
 }
 
+func (d *driver) CloseInput(p midi.Entity) error {
+	if d.closed {
+		return midi.ErrClosed
+	}
+
+	result := C.closeInput(d.client, C.uint(p))
+	if result != 0 {
+		return fmt.Errorf("(cgo) close input failed with error %d", result)
+	}
+
+	return nil
+}
+
 func (d *driver) OpenOutput(p midi.Entity) error {
 	// no-op, there's no need to open an output on Core MIDI
+	if d.closed {
+		return midi.ErrClosed
+	}
+	return nil
+}
+
+func (d *driver) CloseOutput(p midi.Entity) error {
+	if d.closed {
+		return midi.ErrClosed
+	}
 	return nil
 }
 
 func (d *driver) Send(ts time.Time, dest midi.Entity, words []midi.Word) error {
+	if d.closed {
+		return midi.ErrClosed
+	}
 	if len(words) == 0 {
 		return nil
 	}
@@ -117,6 +166,29 @@ func (d *driver) SendSysExV1(dest midi.Entity, data []byte) error {
 	return d.Send(immediately, dest, midi.SysExV1ToUMP(nil, data))
 }
 
+func (d *driver) CreateVirtualInput(name string) (midi.Entity, error) {
+	// TODO: MIDIDestinationCreate
+	return 0, midi.ErrNotImplemeneted
+}
+
+func (d *driver) CreateVirtualOutput(name string) (midi.Entity, error) {
+	// TODO: MIDISourceCreate
+	return 0, midi.ErrNotImplemeneted
+}
+
+func (d *driver) Connect(src, dst midi.Entity) error {
+	// TODO: MIDIThruConnectionCreate
+	return midi.ErrNotImplemeneted
+}
+
+func (d *driver) Disconnect(src, dst midi.Entity) error {
+	return midi.ErrNotImplemeneted
+}
+
+func (d *driver) Connections() ([]midi.Connection, error) {
+	return nil, midi.ErrNotImplemeneted
+}
+
 func (d *driver) Enumerate() (*midi.Node, error) {
 	root := &midi.Node{
 		Type: midi.Root,
@@ -1,4 +1,4 @@
-//go:build !darwin
+//go:build !darwin || !cgo
 
 package darwin
 
@@ -10,7 +10,7 @@ func init() {
 	midi.Register(&midi.Stub{
 		Name:      "Core MIDI",
 		Available: false,
-		CreateDriver: func() (midi.Driver, error) {
+		CreateDriver: func(string) (midi.Driver, error) {
 			return nil, midi.ErrDriverNotAvailable
 		},
 	})
@@ -23,16 +23,100 @@ func NopHandler(time time.Time, entity Entity, words []ump.Word) {}
 
 type Entity uintptr
 
+type NotificationType int
+
+const (
+	DeviceAdded = NotificationType(1 + iota)
+	DeviceRemoved
+	DeviceChanged
+	PortAdded
+	PortRemoved
+	PortChanged
+)
+
+var notificationTypeNames = []string{
+	"(unknown)",
+	"deviceAdded",
+	"deviceRemoved",
+	"deviceChanged",
+	"portAdded",
+	"portRemoved",
+	"portChanged",
+}
+
+func (nt NotificationType) String() string {
+	if nt < 0 || int(nt) >= len(notificationTypeNames) {
+		return notificationTypeNames[0]
+	}
+	return notificationTypeNames[nt]
+}
+
+// Notification reports a change to the system's MIDI topology. Entity is
+// the device or port that changed, as it appears in Enumerate.
+type Notification struct {
+	Type   NotificationType
+	Entity Entity
+}
+
+// Connection is a route from one port to another that the OS maintains
+// itself, so the data does not pass through the driver.
+type Connection struct {
+	Source Entity
+	Dest   Entity
+}
+
+// NotificationHandler receives topology change notifications. Like a
+// ReceiveEventHandler it can be invoked from any thread.
+type NotificationHandler func(Notification)
+
+func NopNotificationHandler(Notification) {}
+
 type Driver interface {
 	Name() string
+
+	// Close releases every resource held by the driver, including open
+	// inputs and outputs. Calling Close more than once has no effect;
+	// other methods return ErrClosed once the driver is closed.
 	Close() error
+
 	SetReceiveHandler(ReceiveEventHandler)
 	OpenInput(Entity) error
 	OpenOutput(Entity) error
+	CloseInput(Entity) error
+	CloseOutput(Entity) error
 	Send(time.Time, Entity, []ump.Word) error
 	SendSysEx(Entity, []ump.Word) error
 	SendSysExV1(Entity, []byte) error
 	Enumerate() (*Node, error)
+
+	// CreateVirtualInput creates a named port that other applications can
+	// send to. Data arriving on the port is passed to the receive handler
+	// with the returned Entity.
+	CreateVirtualInput(name string) (Entity, error)
+
+	// CreateVirtualOutput creates a named port that other applications can
+	// receive from. Data sent to the returned Entity goes to every
+	// application connected to the port.
+	CreateVirtualOutput(name string) (Entity, error)
+
+	// SetNotificationHandler sets the handler that is told when devices
+	// and ports appear, disappear or change.
+	SetNotificationHandler(NotificationHandler)
+
+	// Connect routes the output of src directly to dst. src and dst are
+	// ports as found in Enumerate, typically of other applications or
+	// hardware.
+	Connect(src, dst Entity) error
+
+	// Disconnect removes a connection made with Connect, or by another
+	// application.
+	Disconnect(src, dst Entity) error
+
+	// Connections lists every connection between ports in the system.
+	Connections() ([]Connection, error)
 }
 
-var ErrDriverNotAvailable = errors.New("driver not available")
+var (
+	ErrDriverNotAvailable = errors.New("driver not available")
+	ErrClosed             = errors.New("driver closed")
+)
@@ -1,7 +1,9 @@
 package midi
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
 )
 
@@ -10,12 +12,73 @@ var (
 	drivers    = map[string]*Stub{}
 )
 
+var ErrUnknownDriver = errors.New("unknown driver")
+
+// Capabilities describes what a driver does natively, as opposed to
+// emulating or not supporting at all.
+type Capabilities struct {
+	// NativeScheduling is set if the OS delivers events sent with a future
+	// timestamp, so no goroutine sleeps until they are due.
+	NativeScheduling bool
+
+	// NativeUMP is set if the OS can carry UMP end to end; otherwise the
+	// driver converts to and from MIDI 1.0 byte streams.
+	NativeUMP bool
+
+	// VirtualPorts is set if CreateVirtualInput and CreateVirtualOutput
+	// are supported.
+	VirtualPorts bool
+
+	// Hotplug is set if the notification handler is told about devices and
+	// ports as they come and go.
+	Hotplug bool
+
+	// SysExStreaming is set if a SysEx message can be sent in pieces over
+	// several SendSysEx calls.
+	SysExStreaming bool
+}
+
 type Stub struct {
-	Name         string
-	Available    bool
+	Name string
+
+	// Available is set if the driver was built for this platform.
+	Available bool
+
+	// Probe, if set, reports whether the driver can be used on this
+	// machine right now, e.g. that the device it needs exists. It is only
+	// called if Available is set.
+	Probe func() bool
+
+	// Priority orders drivers for NewDefaultDriver; the highest available
+	// one is chosen.
+	Priority int
+
+	// Capabilities describes what the driver does natively wherever it
+	// runs.
+	Capabilities Capabilities
+
+	// ProbeCapabilities, if set, returns the driver's capabilities on this
+	// machine, for drivers where they depend on the OS version. It
+	// replaces Capabilities and is only called if the driver is available.
+	ProbeCapabilities func() Capabilities
+
 	CreateDriver func(name string) (Driver, error)
 }
 
+// IsAvailable reports whether the driver is built for this platform and,
+// if it has a probe, whether the probe succeeds.
+func (s *Stub) IsAvailable() bool {
+	return s.Available && (s.Probe == nil || s.Probe())
+}
+
+// Describe returns the driver's capabilities on this machine.
+func (s *Stub) Describe() Capabilities {
+	if s.ProbeCapabilities != nil && s.IsAvailable() {
+		return s.ProbeCapabilities()
+	}
+	return s.Capabilities
+}
+
 func Register(d *Stub) {
 	driverLock.Lock()
 	defer driverLock.Unlock()
@@ -28,14 +91,73 @@ func Register(d *Stub) {
 	drivers[d.Name] = d
 }
 
-func NewDriverByName(driverName string, clientName string) (Driver, error) {
+// unregister removes the named driver, so tests can clean up after
+// themselves.
+func unregister(name string) {
+	driverLock.Lock()
+	defer driverLock.Unlock()
+
+	delete(drivers, name)
+}
+
+// Drivers returns every registered driver, available or not, highest
+// priority first.
+func Drivers() []*Stub {
+	driverLock.RLock()
+	defer driverLock.RUnlock()
+
+	out := make([]*Stub, 0, len(drivers))
+	for _, d := range drivers {
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Priority != out[j].Priority {
+			return out[i].Priority > out[j].Priority
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// LookupDriver returns the driver registered as name.
+func LookupDriver(name string) (*Stub, bool) {
 	driverLock.RLock()
 	defer driverLock.RUnlock()
 
-	drv, ok := drivers[driverName]
+	d, ok := drivers[name]
+	return d, ok
+}
+
+func NewDriverByName(driverName string, clientName string) (Driver, error) {
+	drv, ok := LookupDriver(driverName)
 	if !ok {
-		panic(fmt.Sprintf("unknown driver '%s'", driverName))
+		return nil, fmt.Errorf("%w '%s'", ErrUnknownDriver, driverName)
+	}
+	if !drv.IsAvailable() {
+		return nil, fmt.Errorf("%s: %w", driverName, ErrDriverNotAvailable)
 	}
 
 	return drv.CreateDriver(clientName)
 }
+
+// NewDefaultDriver creates the highest priority available driver. If it
+// fails, the next one is tried; the errors from every attempt are returned
+// if none succeed.
+func NewDefaultDriver(clientName string) (Driver, error) {
+	var errs []error
+	for _, drv := range Drivers() {
+		if !drv.IsAvailable() {
+			continue
+		}
+		d, err := drv.CreateDriver(clientName)
+		if err == nil {
+			return d, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", drv.Name, err))
+	}
+
+	if len(errs) == 0 {
+		return nil, ErrDriverNotAvailable
+	}
+	return nil, errors.Join(errs...)
+}
@@ -0,0 +1,165 @@
+// Package gm provides the instrument and drum names of the General MIDI
+// family of sound sets (GM1, GM2, Roland GS and Yamaha XG), with the bank
+// select and program change messages needed to choose each patch.
+//
+// Program numbers are zero-based on the wire; names follow the published
+// one-based program lists. The XG tables are partial: they cover the
+// GM-compatible bank 0, the piano variations of programs 1-8 and the drum
+// and SFX kits. Other XG variation banks and the SFX voice bank (MSB 64)
+// are not included, so Find reports them as unknown.
+package gm
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+// Standard identifies a sound set.
+type Standard int
+
+const (
+	GM1 = Standard(iota)
+	GM2
+	GS
+	XG
+)
+
+func (s Standard) String() string {
+	switch s {
+	case GM1:
+		return "GM1"
+	case GM2:
+		return "GM2"
+	case GS:
+		return "GS"
+	case XG:
+		return "XG"
+	}
+	return "unknown"
+}
+
+// DrumChannel is the channel (10, zero-based 9) that plays drums in every
+// standard.
+const DrumChannel = 9
+
+// Bank select controllers
+const (
+	BankSelectMSB = 0
+	BankSelectLSB = 32
+)
+
+// Bank MSBs used by GM2 and XG
+const (
+	GM2MelodyBank = 0x79
+	GM2DrumBank   = 0x78
+	XGSFXKitBank  = 0x7E
+	XGDrumBank    = 0x7F
+)
+
+// Patch is an instrument or drum kit.
+type Patch struct {
+	Standard Standard
+	Name     string
+	Program  uint8 // 0-127
+	BankMSB  uint8
+	BankLSB  uint8
+
+	// Drums is set for drum kits, which are played on DrumChannel
+	Drums bool
+}
+
+// Drum is a note of a drum map.
+type Drum struct {
+	Note uint8
+	Name string
+}
+
+// Instruments returns the melodic patches of a standard, ordered by
+// program and then bank.
+func Instruments(s Standard) []Patch {
+	return tables[s].instruments
+}
+
+// DrumKits returns the drum kits of a standard, ordered by program.
+func DrumKits(s Standard) []Patch {
+	return tables[s].kits
+}
+
+// DrumMap returns the drum notes of a standard's default kit, in note
+// order.
+func DrumMap(s Standard) []Drum {
+	return tables[s].drums
+}
+
+// Lookup finds a patch by name, ignoring case. Drum kits are searched after
+// instruments.
+func Lookup(s Standard, name string) (Patch, bool) {
+	for _, list := range [][]Patch{Instruments(s), DrumKits(s)} {
+		for _, p := range list {
+			if strings.EqualFold(p.Name, name) {
+				return p, true
+			}
+		}
+	}
+	return Patch{}, false
+}
+
+// Find finds a patch by bank and program. Set drums to search the drum
+// kits.
+func Find(s Standard, msb, lsb, program uint8, drums bool) (Patch, bool) {
+	list := Instruments(s)
+	if drums {
+		list = DrumKits(s)
+	}
+	for _, p := range list {
+		if p.Program == program && p.BankMSB == msb && p.BankLSB == lsb {
+			return p, true
+		}
+	}
+	return Patch{}, false
+}
+
+// DrumName returns the name of a note in a standard's drum map.
+func DrumName(s Standard, note uint8) (string, bool) {
+	for _, d := range DrumMap(s) {
+		if d.Note == note {
+			return d.Name, true
+		}
+	}
+	return "", false
+}
+
+// DrumNote finds a note in a standard's drum map by name, ignoring case.
+func DrumNote(s Standard, name string) (uint8, bool) {
+	for _, d := range DrumMap(s) {
+		if strings.EqualFold(d.Name, name) {
+			return d.Note, true
+		}
+	}
+	return 0, false
+}
+
+// Append appends the messages that select the patch on channel to dst:
+// bank select MSB and LSB followed by program change. GM1 has no banks, so
+// only the program change is sent for GM1 patches.
+func (p Patch) Append(dst []ump.Word, group, channel uint8) []ump.Word {
+	g := ump.Word(group&0x0F) << 24
+	if p.Standard != GM1 {
+		dst = append(dst,
+			g|ump.ControlChange(channel, BankSelectMSB, int8(p.BankMSB&0x7F)),
+			g|ump.ControlChange(channel, BankSelectLSB, int8(p.BankLSB&0x7F)))
+	}
+	return append(dst, g|ump.ProgramChange(channel, int8(p.Program&0x7F)))
+}
+
+// Send selects a patch on a channel of entity. Drum kits are always sent
+// to DrumChannel.
+func Send(driver midi.Driver, t time.Time, entity midi.Entity, group, channel uint8, p Patch) error {
+	if p.Drums {
+		channel = DrumChannel
+	}
+	return driver.Send(t, entity, p.Append(nil, group, channel))
+}
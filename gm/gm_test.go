@@ -0,0 +1,191 @@
+package gm
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+var standards = []Standard{GM1, GM2, GS, XG}
+
+func TestTables(t *testing.T) {
+	tests := []struct {
+		s           Standard
+		kits        int
+		first, last uint8 // drum map
+	}{
+		{GM1, 1, 35, 81},
+		{GM2, 9, 27, 87},
+		{GS, 10, 27, 87},
+		{XG, 11, 13, 84},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s.String(), func(t *testing.T) {
+			// GM1 has only the capital tones; the others add variations
+			if n := len(Instruments(tt.s)); n < 128 || (tt.s == GM1) != (n == 128) {
+				t.Errorf("%d instruments", n)
+			}
+			if n := len(DrumKits(tt.s)); n != tt.kits {
+				t.Errorf("%d drum kits, want %d", n, tt.kits)
+			}
+			drums := DrumMap(tt.s)
+			if len(drums) != int(tt.last-tt.first)+1 || drums[0].Note != tt.first || drums[len(drums)-1].Note != tt.last {
+				t.Errorf("drum map covers %d-%d", drums[0].Note, drums[len(drums)-1].Note)
+			}
+
+			// every patch is found again by its bank and program
+			for _, list := range [][]Patch{Instruments(tt.s), DrumKits(tt.s)} {
+				seen := map[[3]uint8]bool{}
+				for _, p := range list {
+					key := [3]uint8{p.BankMSB, p.BankLSB, p.Program}
+					if seen[key] {
+						t.Errorf("%q shares bank %d/%d program %d with another patch", p.Name, p.BankMSB, p.BankLSB, p.Program)
+					}
+					seen[key] = true
+					if p.Standard != tt.s || p.Program > 127 {
+						t.Errorf("patch %+v", p)
+					}
+					if got, ok := Find(tt.s, p.BankMSB, p.BankLSB, p.Program, p.Drums); !ok || got != p {
+						t.Errorf("Find(%q) = %+v, %v", p.Name, got, ok)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		s                 Standard
+		msb, lsb, program uint8
+		drums             bool
+		want              string // empty if none
+	}{
+		{GM1, 0, 0, 0, false, "Acoustic Grand Piano"},
+		{GM1, 0, 0, 127, false, "Gunshot"},
+		{GM1, 0, 0, 0, true, "Standard Kit"},
+		{GM1, 0, 1, 0, false, ""},
+		{GM2, GM2MelodyBank, 2, 0, false, "Acoustic Grand Piano (dark)"},
+		{GM2, GM2DrumBank, 0, 8, true, "Room Set"},
+		{GM2, 0, 0, 0, false, ""},
+		{GS, 0, 0, 0, false, "Piano 1"},
+		{GS, 16, 0, 0, false, "Piano 1d"},
+		{GS, 0, 0, 25, true, "TR-808"},
+		{XG, 0, 0, 0, false, "Acoustic Grand Piano"},
+		{XG, 0, 41, 0, false, "Dream"},
+		{XG, XGDrumBank, 0, 48, true, "Classic Kit"},
+		{XG, XGSFXKitBank, 0, 1, true, "SFX Kit 2"},
+		{XG, 64, 0, 0, false, ""}, // SFX voices are not listed
+		{XG, 0, 1, 8, false, ""},  // nor variations past program 8
+	}
+	for _, tt := range tests {
+		p, ok := Find(tt.s, tt.msb, tt.lsb, tt.program, tt.drums)
+		if ok != (tt.want != "") || p.Name != tt.want {
+			t.Errorf("Find(%v, %d, %d, %d, %v) = %q, %v; want %q", tt.s, tt.msb, tt.lsb, tt.program, tt.drums, p.Name, ok, tt.want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		s       Standard
+		name    string
+		program uint8
+		drums   bool
+		ok      bool
+	}{
+		{GM1, "acoustic grand piano", 0, false, true},
+		{GM1, "Standard Kit", 0, true, true},
+		{GS, "cm-64/cm-32l", 127, true, true},
+		{XG, "DX Hard", 5, false, true},
+		{GM1, "Piano 1", 0, false, false},
+	}
+	for _, tt := range tests {
+		p, ok := Lookup(tt.s, tt.name)
+		if ok != tt.ok || (ok && (p.Program != tt.program || p.Drums != tt.drums)) {
+			t.Errorf("Lookup(%v, %q) = %+v, %v", tt.s, tt.name, p, ok)
+		}
+	}
+}
+
+func TestDrums(t *testing.T) {
+	tests := []struct {
+		s    Standard
+		note uint8
+		name string
+	}{
+		{GM1, 35, "Acoustic Bass Drum"},
+		{GM1, 81, "Open Triangle"},
+		{GM2, 27, "High Q"},
+		{GM2, 87, "Open Surdo"},
+		{GS, 38, "Acoustic Snare"},
+		{XG, 13, "Surdo Mute"},
+		{XG, 36, "Bass Drum H"},
+	}
+	for _, tt := range tests {
+		if name, ok := DrumName(tt.s, tt.note); !ok || name != tt.name {
+			t.Errorf("DrumName(%v, %d) = %q, %v; want %q", tt.s, tt.note, name, ok, tt.name)
+		}
+		if note, ok := DrumNote(tt.s, tt.name); !ok || note != tt.note {
+			t.Errorf("DrumNote(%v, %q) = %d, %v; want %d", tt.s, tt.name, note, ok, tt.note)
+		}
+	}
+	for _, s := range standards {
+		if _, ok := DrumName(s, 12); ok {
+			t.Errorf("%v names note 12", s)
+		}
+	}
+}
+
+// recorder is a driver that records the words sent to it.
+type recorder struct {
+	midi.Driver
+	entity midi.Entity
+	sent   []ump.Word
+}
+
+func (r *recorder) Send(_ time.Time, entity midi.Entity, words []ump.Word) error {
+	r.entity = entity
+	r.sent = append(r.sent, words...)
+	return nil
+}
+
+func TestSend(t *testing.T) {
+	g := func(w ump.Word) ump.Word { return 2<<24 | w }
+	tests := []struct {
+		s       Standard
+		name    string
+		channel uint8
+		want    []ump.Word
+	}{
+		{GM1, "Violin", 0, []ump.Word{g(ump.ProgramChange(0, 40))}},
+		{GS, "Piano 1w", 3, []ump.Word{
+			g(ump.ControlChange(3, 0, 8)),
+			g(ump.ControlChange(3, 32, 0)),
+			g(ump.ProgramChange(3, 0)),
+		}},
+		{XG, "Jazz Kit", 0, []ump.Word{
+			g(ump.ControlChange(9, 0, 127)),
+			g(ump.ControlChange(9, 32, 0)),
+			g(ump.ProgramChange(9, 32)),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, ok := Lookup(tt.s, tt.name)
+			if !ok {
+				t.Fatalf("%q not found", tt.name)
+			}
+			d := &recorder{}
+			if err := Send(d, time.Time{}, 1, 2, tt.channel, p); err != nil {
+				t.Fatal(err)
+			}
+			if d.entity != 1 || !reflect.DeepEqual(d.sent, tt.want) {
+				t.Errorf("sent %08X to %d, want %08X to 1", d.sent, d.entity, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,423 @@
+package gm
+
+var gmNames = [128]string{
+	// Piano
+	"Acoustic Grand Piano", "Bright Acoustic Piano", "Electric Grand Piano", "Honky-tonk Piano",
+	"Electric Piano 1", "Electric Piano 2", "Harpsichord", "Clavi",
+	// Chromatic Percussion
+	"Celesta", "Glockenspiel", "Music Box", "Vibraphone",
+	"Marimba", "Xylophone", "Tubular Bells", "Dulcimer",
+	// Organ
+	"Drawbar Organ", "Percussive Organ", "Rock Organ", "Church Organ",
+	"Reed Organ", "Accordion", "Harmonica", "Tango Accordion",
+	// Guitar
+	"Acoustic Guitar (nylon)", "Acoustic Guitar (steel)", "Electric Guitar (jazz)", "Electric Guitar (clean)",
+	"Electric Guitar (muted)", "Overdriven Guitar", "Distortion Guitar", "Guitar Harmonics",
+	// Bass
+	"Acoustic Bass", "Electric Bass (finger)", "Electric Bass (pick)", "Fretless Bass",
+	"Slap Bass 1", "Slap Bass 2", "Synth Bass 1", "Synth Bass 2",
+	// Strings
+	"Violin", "Viola", "Cello", "Contrabass",
+	"Tremolo Strings", "Pizzicato Strings", "Orchestral Harp", "Timpani",
+	// Ensemble
+	"String Ensemble 1", "String Ensemble 2", "Synth Strings 1", "Synth Strings 2",
+	"Choir Aahs", "Voice Oohs", "Synth Voice", "Orchestra Hit",
+	// Brass
+	"Trumpet", "Trombone", "Tuba", "Muted Trumpet",
+	"French Horn", "Brass Section", "Synth Brass 1", "Synth Brass 2",
+	// Reed
+	"Soprano Sax", "Alto Sax", "Tenor Sax", "Baritone Sax",
+	"Oboe", "English Horn", "Bassoon", "Clarinet",
+	// Pipe
+	"Piccolo", "Flute", "Recorder", "Pan Flute",
+	"Blown Bottle", "Shakuhachi", "Whistle", "Ocarina",
+	// Synth Lead
+	"Lead 1 (square)", "Lead 2 (sawtooth)", "Lead 3 (calliope)", "Lead 4 (chiff)",
+	"Lead 5 (charang)", "Lead 6 (voice)", "Lead 7 (fifths)", "Lead 8 (bass + lead)",
+	// Synth Pad
+	"Pad 1 (new age)", "Pad 2 (warm)", "Pad 3 (polysynth)", "Pad 4 (choir)",
+	"Pad 5 (bowed)", "Pad 6 (metallic)", "Pad 7 (halo)", "Pad 8 (sweep)",
+	// Synth Effects
+	"FX 1 (rain)", "FX 2 (soundtrack)", "FX 3 (crystal)", "FX 4 (atmosphere)",
+	"FX 5 (brightness)", "FX 6 (goblins)", "FX 7 (echoes)", "FX 8 (sci-fi)",
+	// Ethnic
+	"Sitar", "Banjo", "Shamisen", "Koto",
+	"Kalimba", "Bag pipe", "Fiddle", "Shanai",
+	// Percussive
+	"Tinkle Bell", "Agogo", "Steel Drums", "Woodblock",
+	"Taiko Drum", "Melodic Tom", "Synth Drum", "Reverse Cymbal",
+	// Sound Effects
+	"Guitar Fret Noise", "Breath Noise", "Seashore", "Bird Tweet",
+	"Telephone Ring", "Helicopter", "Applause", "Gunshot",
+}
+
+// GM2 variations, selected by bank LSB with MSB GM2MelodyBank
+var gm2Variations = []variation{
+	{1, 1, "Acoustic Grand Piano (wide)"},
+	{1, 2, "Acoustic Grand Piano (dark)"},
+	{2, 1, "Bright Acoustic Piano (wide)"},
+	{3, 1, "Electric Grand Piano (wide)"},
+	{4, 1, "Honky-tonk Piano (wide)"},
+	{5, 1, "Detuned Electric Piano 1"},
+	{5, 2, "Electric Piano 1 (velocity mix)"},
+	{5, 3, "60's Electric Piano"},
+	{6, 1, "Detuned Electric Piano 2"},
+	{6, 2, "Electric Piano 2 (velocity mix)"},
+	{6, 3, "EP Legend"},
+	{6, 4, "EP Phase"},
+	{7, 1, "Harpsichord (octave mix)"},
+	{7, 2, "Harpsichord (wide)"},
+	{7, 3, "Harpsichord (with key off)"},
+	{8, 1, "Pulse Clavi"},
+	{12, 1, "Vibraphone (wide)"},
+	{13, 1, "Marimba (wide)"},
+	{15, 1, "Church Bell"},
+	{15, 2, "Carillon"},
+	{17, 1, "Detuned Drawbar Organ"},
+	{17, 2, "Italian 60's Organ"},
+	{17, 3, "Drawbar Organ 2"},
+	{18, 1, "Detuned Percussive Organ"},
+	{18, 2, "Percussive Organ 2"},
+	{20, 1, "Church Organ (octave mix)"},
+	{20, 2, "Detuned Church Organ"},
+	{21, 1, "Puff Organ"},
+	{22, 1, "Accordion 2"},
+	{25, 1, "Ukulele"},
+	{25, 2, "Acoustic Guitar (nylon + key off)"},
+	{25, 3, "Acoustic Guitar (nylon 2)"},
+	{26, 1, "12-Strings Guitar"},
+	{26, 2, "Mandolin"},
+	{26, 3, "Steel Guitar with Body Sound"},
+	{27, 1, "Electric Guitar (pedal steel)"},
+	{28, 1, "Electric Guitar (detuned clean)"},
+	{28, 2, "Mid Tone Guitar"},
+	{29, 1, "Electric Guitar (funky cutting)"},
+	{29, 2, "Electric Guitar (muted velo-sw)"},
+	{29, 3, "Jazz Man"},
+	{30, 1, "Guitar Pinch"},
+	{31, 1, "Distortion Guitar (with feedback)"},
+	{31, 2, "Distorted Rhythm Guitar"},
+	{32, 1, "Guitar Feedback"},
+	{34, 1, "Finger Slap Bass"},
+	{39, 1, "Synth Bass (warm)"},
+	{39, 2, "Synth Bass 3 (resonance)"},
+	{39, 3, "Clavi Bass"},
+	{39, 4, "Hammer"},
+	{40, 1, "Synth Bass 4 (attack)"},
+	{40, 2, "Synth Bass (rubber)"},
+	{40, 3, "Attack Pulse"},
+	{41, 1, "Violin (slow attack)"},
+	{47, 1, "Yang Chin"},
+	{49, 1, "Strings and Brass"},
+	{49, 2, "60s Strings"},
+	{51, 1, "Synth Strings 3"},
+	{53, 1, "Choir Aahs 2"},
+	{54, 1, "Humming"},
+	{55, 1, "Analog Voice"},
+	{56, 1, "Bass Hit Plus"},
+	{56, 2, "6th Hit"},
+	{56, 3, "Euro Hit"},
+	{57, 1, "Dark Trumpet Soft"},
+	{58, 1, "Trombone 2"},
+	{58, 2, "Bright Trombone"},
+	{60, 1, "Muted Trumpet 2"},
+	{61, 1, "French Horn 2 (warm)"},
+	{62, 1, "Brass Section 2 (octave mix)"},
+	{63, 1, "Synth Brass 3"},
+	{63, 2, "Analog Synth Brass 1"},
+	{63, 3, "Jump Brass"},
+	{64, 1, "Synth Brass 4"},
+	{64, 2, "Analog Synth Brass 2"},
+	{81, 1, "Lead 1a (square 2)"},
+	{81, 2, "Lead 1b (sine)"},
+	{82, 1, "Lead 2a (sawtooth 2)"},
+	{82, 2, "Lead 2b (saw + pulse)"},
+	{82, 3, "Lead 2c (double sawtooth)"},
+	{82, 4, "Lead 2d (sequenced analog)"},
+	{85, 1, "Lead 5a (wire lead)"},
+	{88, 1, "Lead 8a (soft wrl)"},
+	{90, 1, "Pad 2a (sine pad)"},
+	{92, 1, "Pad 4a (itopia)"},
+	{99, 1, "FX 3a (synth mallet)"},
+	{103, 1, "FX 7a (echo bell)"},
+	{103, 2, "FX 7b (echo pan)"},
+	{105, 1, "Sitar 2 (bend)"},
+	{108, 1, "Taisho Koto"},
+	{116, 1, "Castanets"},
+	{117, 1, "Concert Bass Drum"},
+	{118, 1, "Melodic Tom 2 (power)"},
+	{119, 1, "Rhythm Box Tom"},
+	{119, 2, "Electric Drum"},
+	{121, 1, "Guitar Cutting Noise"},
+	{121, 2, "Acoustic Bass String Slap"},
+	{122, 1, "Flute Key Click"},
+	{123, 1, "Rain"},
+	{123, 2, "Thunder"},
+	{123, 3, "Wind"},
+	{123, 4, "Stream"},
+	{123, 5, "Bubble"},
+	{124, 1, "Dog"},
+	{124, 2, "Horse Gallop"},
+	{124, 3, "Bird Tweet 2"},
+	{125, 1, "Telephone Ring 2"},
+	{125, 2, "Door Creaking"},
+	{125, 3, "Door"},
+	{125, 4, "Scratch"},
+	{125, 5, "Wind Chime"},
+	{126, 1, "Car Engine"},
+	{126, 2, "Car Stop"},
+	{126, 3, "Car Pass"},
+	{126, 4, "Car Crash"},
+	{126, 5, "Siren"},
+	{126, 6, "Train"},
+	{126, 7, "Jetplane"},
+	{126, 8, "Starship"},
+	{126, 9, "Burst Noise"},
+	{127, 1, "Laughing"},
+	{127, 2, "Screaming"},
+	{127, 3, "Punch"},
+	{127, 4, "Heart Beat"},
+	{127, 5, "Footsteps"},
+	{128, 1, "Machine Gun"},
+	{128, 2, "Lasergun"},
+	{128, 3, "Explosion"},
+}
+
+var gm2Kits = []variation{
+	{1, 0, "Standard Set"},
+	{9, 0, "Room Set"},
+	{17, 0, "Power Set"},
+	{25, 0, "Electronic Set"},
+	{26, 0, "Analog Set"},
+	{33, 0, "Jazz Set"},
+	{41, 0, "Brush Set"},
+	{49, 0, "Orchestra Set"},
+	{57, 0, "SFX Set"},
+}
+
+// GS capital tones (Sound Canvas names), selected with bank MSB 0
+var gsNames = [128]string{
+	"Piano 1", "Piano 2", "Piano 3", "Honky-tonk", "E.Piano 1", "E.Piano 2", "Harpsichord", "Clav.",
+	"Celesta", "Glockenspiel", "Music Box", "Vibraphone", "Marimba", "Xylophone", "Tubular-bell", "Santur",
+	"Organ 1", "Organ 2", "Organ 3", "Church Org.1", "Reed Organ", "Accordion Fr", "Harmonica", "Bandneon",
+	"Nylon-str.Gt", "Steel-str.Gt", "Jazz Gt.", "Clean Gt.", "Muted Gt.", "Overdrive Gt", "DistortionGt", "Gt.Harmonics",
+	"Acoustic Bs.", "Fingered Bs.", "Picked Bs.", "Fretless Bs.", "Slap Bass 1", "Slap Bass 2", "Synth Bass 1", "Synth Bass 2",
+	"Violin", "Viola", "Cello", "Contrabass", "Tremolo Str", "PizzicatoStr", "Harp", "Timpani",
+	"Strings", "Slow Strings", "Syn.Strings1", "Syn.Strings2", "Choir Aahs", "Voice Oohs", "SynVox", "OrchestraHit",
+	"Trumpet", "Trombone", "Tuba", "MutedTrumpet", "French Horn", "Brass 1", "Synth Brass1", "Synth Brass2",
+	"Soprano Sax", "Alto Sax", "Tenor Sax", "Baritone Sax", "Oboe", "English Horn", "Bassoon", "Clarinet",
+	"Piccolo", "Flute", "Recorder", "Pan Flute", "Bottle Blow", "Shakuhachi", "Whistle", "Ocarina",
+	"Square Wave", "Saw Wave", "Syn.Calliope", "Chiffer Lead", "Charang", "Solo Vox", "5th Saw Wave", "Bass & Lead",
+	"Fantasia", "Warm Pad", "Polysynth", "Space Voice", "Bowed Glass", "Metal Pad", "Halo Pad", "Sweep Pad",
+	"Ice Rain", "Soundtrack", "Crystal", "Atmosphere", "Brightness", "Goblin", "Echo Drops", "Star Theme",
+	"Sitar", "Banjo", "Shamisen", "Koto", "Kalimba", "Bag Pipe", "Fiddle", "Shanai",
+	"Tinkle Bell", "Agogo", "Steel Drums", "Woodblock", "Taiko", "Melo. Tom 1", "Synth Drum", "Reverse Cym.",
+	"Gt.FretNoise", "Breath Noise", "Seashore", "Bird", "Telephone 1", "Helicopter", "Applause", "Gun Shot",
+}
+
+// GS variation tones, selected by bank MSB
+var gsVariations = []variation{
+	{1, 8, "Piano 1w"},
+	{1, 16, "Piano 1d"},
+	{2, 8, "Piano 2w"},
+	{3, 8, "Piano 3w"},
+	{4, 8, "Honky-tonk w"},
+	{5, 8, "Detuned EP 1"},
+	{5, 16, "E.Piano 1w"},
+	{5, 24, "60's E.Piano"},
+	{6, 8, "Detuned EP 2"},
+	{6, 16, "E.Piano 2w"},
+	{7, 8, "Coupled Hps."},
+	{7, 16, "Harpsi.w"},
+	{7, 24, "Harpsi.o"},
+	{12, 8, "Vib.w"},
+	{13, 8, "Marimba w"},
+	{15, 8, "Church Bell"},
+	{15, 9, "Carillon"},
+	{17, 8, "Detuned Or.1"},
+	{17, 16, "60's Organ 1"},
+	{17, 32, "Organ 4"},
+	{18, 8, "Detuned Or.2"},
+	{18, 32, "Organ 5"},
+	{20, 8, "Church Org.2"},
+	{20, 16, "Church Org.3"},
+	{22, 8, "Accordion It"},
+	{25, 8, "Ukulele"},
+	{25, 16, "Nylon Gt.o"},
+	{25, 32, "Nylon Gt.2"},
+	{26, 8, "12-str.Gt"},
+	{26, 16, "Mandolin"},
+	{27, 8, "Hawaiian Gt."},
+	{28, 8, "Chorus Gt."},
+	{29, 8, "Funk Gt."},
+	{31, 8, "Feedback Gt."},
+	{32, 8, "Gt. Feedback"},
+	{39, 8, "Synth Bass 3"},
+	{40, 8, "Synth Bass 4"},
+	{49, 8, "Orchestra"},
+	{51, 8, "Syn.Strings3"},
+	{53, 32, "Choir Aahs 2"},
+	{62, 8, "Brass 2"},
+	{63, 8, "Synth Brass3"},
+	{63, 16, "AnalogBrass1"},
+	{64, 8, "Synth Brass4"},
+	{64, 16, "AnalogBrass2"},
+	{81, 1, "Square"},
+	{81, 8, "Sine Wave"},
+	{82, 1, "Saw"},
+	{82, 8, "Doctor Solo"},
+	{99, 1, "Syn Mallet"},
+	{103, 1, "Echo Bell"},
+	{103, 2, "Echo Pan"},
+	{105, 1, "Sitar 2"},
+	{108, 8, "Taisho Koto"},
+	{116, 8, "Castanets"},
+	{117, 8, "Concert BD"},
+	{118, 8, "Melo. Tom 2"},
+	{119, 8, "808 Tom"},
+	{121, 1, "Gt.Cut Noise"},
+	{121, 2, "String Slap"},
+	{122, 1, "Fl.Key Click"},
+	{123, 1, "Rain"},
+	{123, 2, "Thunder"},
+	{123, 3, "Wind"},
+	{123, 4, "Stream"},
+	{123, 5, "Bubble"},
+	{124, 1, "Dog"},
+	{124, 2, "Horse-Gallop"},
+	{124, 3, "Bird 2"},
+	{125, 1, "Telephone 2"},
+	{125, 2, "DoorCreaking"},
+	{125, 3, "Door"},
+	{125, 4, "Scratch"},
+	{125, 5, "Wind Chimes"},
+	{126, 1, "Car-Engine"},
+	{126, 2, "Car-Stop"},
+	{126, 3, "Car-Pass"},
+	{126, 4, "Car-Crash"},
+	{126, 5, "Siren"},
+	{126, 6, "Train"},
+	{126, 7, "Jetplane"},
+	{126, 8, "Starship"},
+	{126, 9, "Burst Noise"},
+	{127, 1, "Laughing"},
+	{127, 2, "Screaming"},
+	{127, 3, "Punch"},
+	{127, 4, "Heart Beat"},
+	{127, 5, "Footsteps"},
+	{128, 1, "Machine Gun"},
+	{128, 2, "Lasergun"},
+	{128, 3, "Explosion"},
+}
+
+var gsKits = []variation{
+	{1, 0, "STANDARD"},
+	{9, 0, "ROOM"},
+	{17, 0, "POWER"},
+	{25, 0, "ELECTRONIC"},
+	{26, 0, "TR-808"},
+	{33, 0, "JAZZ"},
+	{41, 0, "BRUSH"},
+	{49, 0, "ORCHESTRA"},
+	{57, 0, "SFX"},
+	{128, 0, "CM-64/CM-32L"},
+}
+
+// XG piano variations for programs 1-8, selected by bank LSB with MSB 0.
+// Bank 0 uses the GM names. Variations of other programs are not listed.
+var xgVariations = []variation{
+	{1, 1, "GrndPnoK"},
+	{1, 18, "MelloGrP"},
+	{1, 40, "PianoStr"},
+	{1, 41, "Dream"},
+	{2, 1, "BritPnoK"},
+	{3, 1, "ElGrPnoK"},
+	{3, 32, "Det.CP80"},
+	{3, 40, "LayerCP1"},
+	{3, 41, "LayerCP2"},
+	{4, 1, "HnkyTnkK"},
+	{5, 1, "El.Pno1K"},
+	{5, 18, "MelloEP1"},
+	{5, 32, "Chor.EP1"},
+	{5, 40, "HardEl.P"},
+	{5, 45, "VX El.P1"},
+	{5, 64, "60sEl.P"},
+	{6, 1, "El.Pno2K"},
+	{6, 32, "Chor.EP2"},
+	{6, 33, "DX Hard"},
+	{6, 34, "DXLegend"},
+	{6, 40, "DX Phase"},
+	{6, 41, "DX+Analg"},
+	{6, 42, "DXKotoEP"},
+	{6, 45, "VX El.P2"},
+	{7, 1, "Harpsi.K"},
+	{7, 25, "Harpsi.2"},
+	{7, 35, "Harpsi.3"},
+	{8, 1, "Clavi. K"},
+	{8, 27, "ClaviWah"},
+	{8, 64, "PulseClv"},
+	{8, 65, "PierceCl"},
+}
+
+var xgKits = []variation{
+	{1, 0, "Standard Kit"},
+	{2, 0, "Standard2 Kit"},
+	{9, 0, "Room Kit"},
+	{17, 0, "Rock Kit"},
+	{25, 0, "Electro Kit"},
+	{26, 0, "Analog Kit"},
+	{33, 0, "Jazz Kit"},
+	{41, 0, "Brush Kit"},
+	{49, 0, "Classic Kit"},
+}
+
+var xgSFXKits = []variation{
+	{1, 0, "SFX Kit 1"},
+	{2, 0, "SFX Kit 2"},
+}
+
+// notes 35-81
+var gm1Drums = []string{
+	"Acoustic Bass Drum", "Bass Drum 1", "Side Stick", "Acoustic Snare",
+	"Hand Clap", "Electric Snare", "Low Floor Tom", "Closed Hi Hat",
+	"High Floor Tom", "Pedal Hi-Hat", "Low Tom", "Open Hi-Hat",
+	"Low-Mid Tom", "Hi-Mid Tom", "Crash Cymbal 1", "High Tom",
+	"Ride Cymbal 1", "Chinese Cymbal", "Ride Bell", "Tambourine",
+	"Splash Cymbal", "Cowbell", "Crash Cymbal 2", "Vibraslap",
+	"Ride Cymbal 2", "Hi Bongo", "Low Bongo", "Mute Hi Conga",
+	"Open Hi Conga", "Low Conga", "High Timbale", "Low Timbale",
+	"High Agogo", "Low Agogo", "Cabasa", "Maracas",
+	"Short Whistle", "Long Whistle", "Short Guiro", "Long Guiro",
+	"Claves", "Hi Wood Block", "Low Wood Block", "Mute Cuica",
+	"Open Cuica", "Mute Triangle", "Open Triangle",
+}
+
+// notes 27-87; the GM1 map extended at both ends
+var gm2Drums = append(append([]string{
+	"High Q", "Slap", "Scratch Push", "Scratch Pull",
+	"Sticks", "Square Click", "Metronome Click", "Metronome Bell",
+}, gm1Drums...),
+	"Shaker", "Jingle Bell", "Belltree", "Castanets", "Mute Surdo", "Open Surdo",
+)
+
+// notes 13-84, Standard Kit
+var xgDrums = []string{
+	"Surdo Mute", "Surdo Open", "Hi Q", "Whip Slap",
+	"Scratch Push", "Scratch Pull", "Finger Snap", "Click Noise",
+	"Metronome Click", "Metronome Bell", "Seq Click L", "Seq Click H",
+	"Brush Tap", "Brush Swirl L", "Brush Slap", "Brush Swirl H",
+	"Snare Roll", "Castanet", "Snare L", "Sticks",
+	"Bass Drum L", "Open Rim Shot", "Bass Drum M", "Bass Drum H",
+	"Side Stick", "Snare M", "Hand Clap", "Snare H",
+	"Floor Tom L", "Hi-Hat Closed", "Floor Tom H", "Hi-Hat Pedal",
+	"Low Tom", "Hi-Hat Open", "Mid Tom L", "Mid Tom H",
+	"Crash Cymbal 1", "High Tom", "Ride Cymbal 1", "Chinese Cymbal",
+	"Ride Cymbal Cup", "Tambourine", "Splash Cymbal", "Cowbell",
+	"Crash Cymbal 2", "Vibraslap", "Ride Cymbal 2", "Bongo H",
+	"Bongo L", "Conga H Mute", "Conga H Open", "Conga L",
+	"Timbale H", "Timbale L", "Agogo H", "Agogo L",
+	"Cabasa", "Maracas", "Samba Whistle H", "Samba Whistle L",
+	"Guiro Short", "Guiro Long", "Claves", "Wood Block H",
+	"Wood Block L", "Cuica Mute", "Cuica Open", "Triangle Mute",
+	"Triangle Open", "Shaker", "Jingle Bell", "Bell Tree",
+}
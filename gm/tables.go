@@ -0,0 +1,82 @@
+package gm
+
+type table struct {
+	instruments []Patch
+	kits        []Patch
+	drums       []Drum
+}
+
+// variation is a bank variation of a one-based program.
+type variation struct {
+	program int
+	bank    uint8
+	name    string
+}
+
+var tables [4]table
+
+func init() {
+	tables[GM1] = table{
+		instruments: build(GM1, nil, nil, 0, false),
+		kits:        kits(GM1, []variation{{1, 0, "Standard Kit"}}, 0),
+		drums:       drumMap(gm1Drums, 35, 81),
+	}
+	tables[GM2] = table{
+		instruments: build(GM2, nil, gm2Variations, GM2MelodyBank, true),
+		kits:        kits(GM2, gm2Kits, GM2DrumBank),
+		drums:       drumMap(gm2Drums, 27, 87),
+	}
+	tables[GS] = table{
+		instruments: build(GS, gsNames[:], gsVariations, 0, false),
+		kits:        kits(GS, gsKits, 0),
+		drums:       drumMap(gm2Drums, 27, 87),
+	}
+	tables[XG] = table{
+		instruments: build(XG, nil, xgVariations, 0, true),
+		kits:        append(kits(XG, xgKits, XGDrumBank), kits(XG, xgSFXKits, XGSFXKitBank)...),
+		drums:       drumMap(xgDrums, 13, 84),
+	}
+}
+
+// build lists the 128 capital patches, named from names or gmNames if names
+// is empty, each followed by its variations. Variations select their bank
+// with the LSB if lsb is set, otherwise the MSB; msb is the bank MSB of
+// every patch in LSB mode.
+func build(s Standard, names []string, variations []variation, msb uint8, lsb bool) []Patch {
+	if len(names) == 0 {
+		names = gmNames[:]
+	}
+	var out []Patch
+	v := 0
+	for i, name := range names {
+		out = append(out, Patch{Standard: s, Name: name, Program: uint8(i), BankMSB: msb})
+		for ; v < len(variations) && variations[v].program == i+1; v++ {
+			p := Patch{Standard: s, Name: variations[v].name, Program: uint8(i), BankMSB: msb}
+			if lsb {
+				p.BankLSB = variations[v].bank
+			} else {
+				p.BankMSB = variations[v].bank
+			}
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// kits lists drum kits, which share a single bank and are selected by
+// program change alone.
+func kits(s Standard, list []variation, msb uint8) []Patch {
+	out := make([]Patch, len(list))
+	for i, k := range list {
+		out[i] = Patch{Standard: s, Name: k.name, Program: uint8(k.program - 1), BankMSB: msb, Drums: true}
+	}
+	return out
+}
+
+func drumMap(names []string, first, last uint8) []Drum {
+	out := make([]Drum, 0, int(last-first)+1)
+	for i, name := range names[:int(last-first)+1] {
+		out = append(out, Drum{Note: first + uint8(i), Name: name})
+	}
+	return out
+}
@@ -0,0 +1,127 @@
+package loopback
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is the driver's source of time. Scheduled sends are delivered when
+// the clock says they are due.
+type Clock interface {
+	Now() time.Time
+
+	// AfterFunc calls f once d has elapsed on the clock.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a pending AfterFunc call. Stop reports whether it prevented the
+// call.
+type Timer interface {
+	Stop() bool
+}
+
+// SystemClock is the wall clock.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time { return time.Now() }
+
+func (SystemClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+// ManualClock only moves when told to, so tests can step through scheduled
+// deliveries deterministically. Due callbacks run in the goroutine calling
+// Advance or Set, in time order, before it returns.
+type ManualClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	seq    uint64
+	timers []*manualTimer
+}
+
+type manualTimer struct {
+	clock *ManualClock
+	at    time.Time
+	seq   uint64
+	f     func()
+}
+
+func NewManualClock(start time.Time) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.seq++
+	t := &manualTimer{clock: c, at: c.now.Add(d), seq: c.seq, f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d.
+func (c *ManualClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock to t, running every callback due on the way. The
+// clock reads each callback's due time while it runs. Set never moves the
+// clock backwards.
+func (c *ManualClock) Set(t time.Time) {
+	for {
+		c.lock.Lock()
+		next := c.next(t)
+		if next == nil {
+			if t.After(c.now) {
+				c.now = t
+			}
+			c.lock.Unlock()
+			return
+		}
+		if next.at.After(c.now) {
+			c.now = next.at
+		}
+		c.lock.Unlock()
+
+		next.f()
+	}
+}
+
+// next removes and returns the earliest timer due at or before t.
+func (c *ManualClock) next(t time.Time) *manualTimer {
+	if len(c.timers) == 0 {
+		return nil
+	}
+	sort.Slice(c.timers, func(i, j int) bool {
+		if c.timers[i].at.Equal(c.timers[j].at) {
+			return c.timers[i].seq < c.timers[j].seq
+		}
+		return c.timers[i].at.Before(c.timers[j].at)
+	})
+	first := c.timers[0]
+	if first.at.After(t) {
+		return nil
+	}
+	c.timers = c.timers[1:]
+	return first
+}
+
+func (t *manualTimer) Stop() bool {
+	c := t.clock
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for i, other := range c.timers {
+		if other == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,552 @@
+// Package loopback provides an in-memory driver for tests and for passing
+// MIDI between goroutines. No hardware or OS support is needed.
+//
+// The driver's topology is given by a Config. Each port is a loopback
+// cable: it has an input and an output, and whatever is sent to the output
+// arrives at the input. Further routes between outputs and inputs can be
+// made with Connect. Sends are delivered when the driver's Clock reaches
+// their timestamp; with a ManualClock a test decides when that is.
+package loopback
+
+import (
+	"container/heap"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+const driverName = "loopback"
+
+var (
+	ErrUnknownEntity = errors.New("unknown entity")
+	ErrOutputNotOpen = errors.New("output not open")
+	ErrNotConnected  = errors.New("ports not connected")
+)
+
+// Config describes the devices a driver starts with.
+type Config struct {
+	Devices []Device
+
+	// Clock defaults to SystemClock.
+	Clock Clock
+}
+
+type Device struct {
+	Name         string
+	Manufacturer string
+	Model        string
+
+	// Ports are the names of the device's loopback ports.
+	Ports []string
+}
+
+type device struct {
+	name         string
+	manufacturer string
+	model        string
+	entity       midi.Entity
+	group        midi.Entity
+	ports        []*port
+}
+
+// port is an input, an output, or a loopback pair of both. Virtual ports
+// have one side only; the other is 0.
+type port struct {
+	name   string
+	input  midi.Entity
+	output midi.Entity
+}
+
+type input struct {
+	open    bool
+	virtual bool
+}
+
+type output struct {
+	open  bool
+	dests []midi.Entity
+}
+
+type driver struct {
+	clock Clock
+
+	lock      sync.Mutex
+	onReceive midi.ReceiveEventHandler
+	onNotify  midi.NotificationHandler
+	closed    bool
+	next      midi.Entity
+	devices   []*device
+	inputs    map[midi.Entity]*input
+	outputs   map[midi.Entity]*output
+
+	queue   sendQueue
+	seq     uint64
+	timer   Timer
+	timerAt time.Time
+
+	// sends due for delivery, in order, and whether a goroutine is
+	// delivering them
+	ready      []delivery
+	delivering bool
+}
+
+type delivery struct {
+	t     time.Time
+	dests []midi.Entity
+	words []ump.Word
+}
+
+// New creates a driver with the topology in cfg.
+func New(cfg Config) midi.Driver {
+	d := &driver{
+		clock:     cfg.Clock,
+		onReceive: midi.NopHandler,
+		onNotify:  midi.NopNotificationHandler,
+		inputs:    map[midi.Entity]*input{},
+		outputs:   map[midi.Entity]*output{},
+	}
+	if d.clock == nil {
+		d.clock = SystemClock{}
+	}
+
+	for _, dev := range cfg.Devices {
+		nd := &device{
+			name:         dev.Name,
+			manufacturer: dev.Manufacturer,
+			model:        dev.Model,
+			entity:       d.allocate(),
+			group:        d.allocate(),
+		}
+		for _, name := range dev.Ports {
+			p := &port{name: name, input: d.allocate(), output: d.allocate()}
+			d.inputs[p.input] = &input{}
+			d.outputs[p.output] = &output{dests: []midi.Entity{p.input}}
+			nd.ports = append(nd.ports, p)
+		}
+		d.devices = append(d.devices, nd)
+	}
+
+	return d
+}
+
+func (d *driver) allocate() midi.Entity {
+	d.next++
+	return d.next
+}
+
+func (d *driver) Name() string {
+	return driverName
+}
+
+// Close discards any sends that have not been delivered yet.
+func (d *driver) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.queue = nil
+	d.ready = nil
+	return nil
+}
+
+func (d *driver) SetReceiveHandler(handler midi.ReceiveEventHandler) {
+	if handler == nil {
+		handler = midi.NopHandler
+	}
+	d.lock.Lock()
+	d.onReceive = handler
+	d.lock.Unlock()
+}
+
+func (d *driver) SetNotificationHandler(handler midi.NotificationHandler) {
+	if handler == nil {
+		handler = midi.NopNotificationHandler
+	}
+	d.lock.Lock()
+	d.onNotify = handler
+	d.lock.Unlock()
+}
+
+// MARK: Ports
+
+func (d *driver) OpenInput(ent midi.Entity) error {
+	return d.setInputOpen(ent, true)
+}
+
+func (d *driver) CloseInput(ent midi.Entity) error {
+	return d.setInputOpen(ent, false)
+}
+
+func (d *driver) setInputOpen(ent midi.Entity, open bool) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.closed {
+		return midi.ErrClosed
+	}
+	in, ok := d.inputs[ent]
+	if !ok {
+		return ErrUnknownEntity
+	}
+	in.open = open
+	return nil
+}
+
+func (d *driver) OpenOutput(ent midi.Entity) error {
+	return d.setOutputOpen(ent, true)
+}
+
+func (d *driver) CloseOutput(ent midi.Entity) error {
+	return d.setOutputOpen(ent, false)
+}
+
+func (d *driver) setOutputOpen(ent midi.Entity, open bool) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.closed {
+		return midi.ErrClosed
+	}
+	out, ok := d.outputs[ent]
+	if !ok {
+		return ErrUnknownEntity
+	}
+	out.open = open
+	return nil
+}
+
+// CreateVirtualInput adds a device with a single input. Nothing arrives at
+// it until an output is connected to it with Connect.
+func (d *driver) CreateVirtualInput(name string) (midi.Entity, error) {
+	return d.createVirtual(name, true)
+}
+
+// CreateVirtualOutput adds a device with a single output, which can be
+// sent to without opening it. Sends go nowhere until it is connected to an
+// input with Connect.
+func (d *driver) CreateVirtualOutput(name string) (midi.Entity, error) {
+	return d.createVirtual(name, false)
+}
+
+func (d *driver) createVirtual(name string, isInput bool) (midi.Entity, error) {
+	d.lock.Lock()
+
+	if d.closed {
+		d.lock.Unlock()
+		return 0, midi.ErrClosed
+	}
+
+	dev := &device{name: name, entity: d.allocate(), group: d.allocate()}
+	ent := d.allocate()
+	p := &port{name: name}
+	if isInput {
+		p.input = ent
+		d.inputs[ent] = &input{virtual: true}
+	} else {
+		p.output = ent
+		d.outputs[ent] = &output{open: true}
+	}
+	dev.ports = []*port{p}
+	d.devices = append(d.devices, dev)
+	onNotify := d.onNotify
+	d.lock.Unlock()
+
+	onNotify(midi.Notification{Type: midi.DeviceAdded, Entity: dev.entity})
+	onNotify(midi.Notification{Type: midi.PortAdded, Entity: ent})
+
+	return ent, nil
+}
+
+// MARK: Connections
+
+// Connect routes the output src to the input dst, in addition to any
+// routes it already has.
+func (d *driver) Connect(src, dst midi.Entity) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	out, err := d.route(src, dst)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(out.dests, dst) {
+		out.dests = append(out.dests, dst)
+	}
+	return nil
+}
+
+// Disconnect removes a route, including the one between the two sides of
+// a loopback port.
+func (d *driver) Disconnect(src, dst midi.Entity) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	out, err := d.route(src, dst)
+	if err != nil {
+		return err
+	}
+	i := slices.Index(out.dests, dst)
+	if i < 0 {
+		return ErrNotConnected
+	}
+	out.dests = slices.Delete(out.dests, i, i+1)
+	return nil
+}
+
+func (d *driver) route(src, dst midi.Entity) (*output, error) {
+	if d.closed {
+		return nil, midi.ErrClosed
+	}
+	out, ok := d.outputs[src]
+	if !ok {
+		return nil, ErrUnknownEntity
+	}
+	if _, ok := d.inputs[dst]; !ok {
+		return nil, ErrUnknownEntity
+	}
+	return out, nil
+}
+
+func (d *driver) Connections() ([]midi.Connection, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.closed {
+		return nil, midi.ErrClosed
+	}
+
+	var conns []midi.Connection
+	for _, dev := range d.devices {
+		for _, p := range dev.ports {
+			if p.output == 0 {
+				continue
+			}
+			for _, dst := range d.outputs[p.output].dests {
+				conns = append(conns, midi.Connection{Source: p.output, Dest: dst})
+			}
+		}
+	}
+	return conns, nil
+}
+
+// MARK: Enumerate
+
+func (d *driver) Enumerate() (*midi.Node, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.closed {
+		return nil, midi.ErrClosed
+	}
+
+	root := &midi.Node{Type: midi.Root}
+	for _, dev := range d.devices {
+		group := &midi.Node{
+			Type:   midi.PortGroup,
+			Name:   dev.name,
+			Driver: d,
+			Entity: dev.group,
+		}
+		for _, p := range dev.ports {
+			if p.input != 0 {
+				group.Children = append(group.Children, &midi.Node{
+					Type:   midi.Input,
+					Name:   p.name,
+					Driver: d,
+					Entity: p.input,
+				})
+			}
+			if p.output != 0 {
+				group.Children = append(group.Children, &midi.Node{
+					Type:   midi.Output,
+					Name:   p.name,
+					Driver: d,
+					Entity: p.output,
+				})
+			}
+		}
+		root.Children = append(root.Children, &midi.Node{
+			Type:         midi.Device,
+			Manufacturer: dev.manufacturer,
+			Model:        dev.model,
+			Name:         dev.name,
+			Driver:       d,
+			Entity:       dev.entity,
+			Children:     []*midi.Node{group},
+		})
+	}
+	return root, nil
+}
+
+// MARK: Send
+
+// Send delivers words to every open input routed from ent once the clock
+// reaches t, or straight away if t is the zero time or has passed. words
+// is copied, so the caller may reuse it.
+//
+// Deliveries are made one at a time, in order. If the receive handler, or
+// another goroutine, is already delivering, Send returns at once and words
+// are delivered after the sends ahead of them.
+func (d *driver) Send(t time.Time, ent midi.Entity, words []ump.Word) error {
+	d.lock.Lock()
+
+	if d.closed {
+		d.lock.Unlock()
+		return midi.ErrClosed
+	}
+	out, ok := d.outputs[ent]
+	if !ok {
+		d.lock.Unlock()
+		return ErrUnknownEntity
+	}
+	if !out.open {
+		d.lock.Unlock()
+		return ErrOutputNotOpen
+	}
+	if len(words) == 0 {
+		d.lock.Unlock()
+		return nil
+	}
+
+	words = slices.Clone(words)
+	now := d.clock.Now()
+
+	// deliver straight away, after any queued sends that are also due
+	if !t.After(now) {
+		d.popDue(now)
+		d.ready = append(d.ready, delivery{now, d.destinations(out), words})
+		d.flush()
+		return nil
+	}
+
+	// queued sends are delivered in time order, and in call order at equal
+	// times
+	d.seq++
+	heap.Push(&d.queue, &pendingSend{t: t, seq: d.seq, output: out, words: words})
+	d.arm(now)
+	d.lock.Unlock()
+
+	return nil
+}
+
+func (d *driver) SendSysEx(ent midi.Entity, words []ump.Word) error {
+	return d.Send(time.Time{}, ent, words)
+}
+
+func (d *driver) SendSysExV1(ent midi.Entity, data []byte) error {
+	return d.Send(time.Time{}, ent, ump.AppendSysEx7(nil, 0, data))
+}
+
+// destinations returns the open inputs routed from out. Virtual inputs
+// are always open. d.lock must be held.
+func (d *driver) destinations(out *output) []midi.Entity {
+	var dests []midi.Entity
+	for _, ent := range out.dests {
+		if in := d.inputs[ent]; in.open || in.virtual {
+			dests = append(dests, ent)
+		}
+	}
+	return dests
+}
+
+// popDue moves every queued send that has fallen due to the ready list,
+// timestamped with the time it was due. d.lock must be held.
+func (d *driver) popDue(now time.Time) {
+	for len(d.queue) > 0 && !d.queue[0].t.After(now) {
+		s := heap.Pop(&d.queue).(*pendingSend)
+		d.ready = append(d.ready, delivery{s.t, d.destinations(s.output), s.words})
+	}
+}
+
+// flush delivers the ready list in order. Only one goroutine delivers at a
+// time; any other, including a receive handler that sends, leaves its
+// sends on the list for that one. d.lock must be held and is released.
+func (d *driver) flush() {
+	if d.delivering {
+		d.lock.Unlock()
+		return
+	}
+	d.delivering = true
+	for len(d.ready) > 0 {
+		r := d.ready[0]
+		d.ready = d.ready[1:]
+		onReceive := d.onReceive
+		d.lock.Unlock()
+		for _, ent := range r.dests {
+			onReceive(r.t, ent, r.words)
+		}
+		d.lock.Lock()
+	}
+	d.delivering = false
+	d.lock.Unlock()
+}
+
+// arm sets the timer for the earliest queued send. d.lock must be held.
+func (d *driver) arm(now time.Time) {
+	if len(d.queue) == 0 {
+		return
+	}
+	at := d.queue[0].t
+	if d.timer != nil {
+		if d.timerAt.Equal(at) {
+			return
+		}
+		d.timer.Stop()
+	}
+	d.timer = d.clock.AfterFunc(at.Sub(now), d.fire)
+	d.timerAt = at
+}
+
+// fire delivers every send that has fallen due.
+func (d *driver) fire() {
+	d.lock.Lock()
+	if d.closed {
+		d.lock.Unlock()
+		return
+	}
+	now := d.clock.Now()
+	d.popDue(now)
+	d.timer = nil
+	d.arm(now)
+	d.flush()
+}
+
+type pendingSend struct {
+	t      time.Time
+	seq    uint64
+	output *output
+	words  []ump.Word
+}
+
+type sendQueue []*pendingSend
+
+func (q sendQueue) Len() int { return len(q) }
+
+func (q sendQueue) Less(i, j int) bool {
+	if q[i].t.Equal(q[j].t) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].t.Before(q[j].t)
+}
+
+func (q sendQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *sendQueue) Push(x any) { *q = append(*q, x.(*pendingSend)) }
+
+func (q *sendQueue) Pop() any {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
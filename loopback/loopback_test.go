@@ -0,0 +1,237 @@
+package loopback
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type received struct {
+	t     time.Time
+	ent   midi.Entity
+	words []ump.Word
+}
+
+// setup returns a driver with one loopback port, opened at both ends, and
+// the entities of its input and output.
+func setup(t *testing.T, clock Clock) (*driver, midi.Entity, midi.Entity) {
+	t.Helper()
+
+	d := New(Config{
+		Devices: []Device{{Name: "Loop", Ports: []string{"Port 1"}}},
+		Clock:   clock,
+	}).(*driver)
+	p := d.devices[0].ports[0]
+	if err := d.OpenInput(p.input); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.OpenOutput(p.output); err != nil {
+		t.Fatal(err)
+	}
+	return d, p.input, p.output
+}
+
+func record(d *driver) *[]received {
+	var got []received
+	d.SetReceiveHandler(func(t time.Time, ent midi.Entity, words []ump.Word) {
+		got = append(got, received{t, ent, words})
+	})
+	return &got
+}
+
+func words(got []received) []ump.Word {
+	var out []ump.Word
+	for _, r := range got {
+		out = append(out, r.words...)
+	}
+	return out
+}
+
+func assertWords(t *testing.T, got []ump.Word, want ...ump.Word) {
+	t.Helper()
+	if !slices.Equal(got, want) {
+		t.Errorf("got %08X, want %08X", got, want)
+	}
+}
+
+func TestScheduledOrder(t *testing.T) {
+	clock := NewManualClock(epoch)
+	d, in, out := setup(t, clock)
+	got := record(d)
+
+	at := func(ms int) time.Time { return epoch.Add(time.Duration(ms) * time.Millisecond) }
+	sends := []struct {
+		t time.Time
+		w ump.Word
+	}{
+		{at(20), ump.NoteOn(0, 1, 1)},
+		{at(10), ump.NoteOn(0, 2, 1)},
+		{at(10), ump.NoteOn(0, 3, 1)},
+		{time.Time{}, ump.NoteOn(0, 4, 1)},
+		{at(15), ump.NoteOn(0, 5, 1)},
+	}
+	for _, s := range sends {
+		if err := d.Send(s.t, out, []ump.Word{s.w}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	steps := []struct {
+		advance time.Duration
+		want    []ump.Word
+		times   []time.Time
+	}{
+		{0, []ump.Word{ump.NoteOn(0, 4, 1)}, []time.Time{epoch}},
+		{5 * time.Millisecond, nil, nil},
+		{
+			5 * time.Millisecond,
+			[]ump.Word{ump.NoteOn(0, 2, 1), ump.NoteOn(0, 3, 1)},
+			[]time.Time{at(10), at(10)},
+		},
+		{
+			time.Second,
+			[]ump.Word{ump.NoteOn(0, 5, 1), ump.NoteOn(0, 1, 1)},
+			[]time.Time{at(15), at(20)},
+		},
+	}
+	for i, step := range steps {
+		clock.Advance(step.advance)
+		assertWords(t, words(*got), step.want...)
+		for j, r := range *got {
+			if r.ent != in {
+				t.Errorf("step %d: delivered to %d, want %d", i, r.ent, in)
+			}
+			if j < len(step.times) && !r.t.Equal(step.times[j]) {
+				t.Errorf("step %d: delivery %d at %v, want %v", i, j, r.t, step.times[j])
+			}
+		}
+		*got = nil
+	}
+}
+
+func TestHandlerSendsAfterDueSends(t *testing.T) {
+	clock := NewManualClock(epoch)
+	d, _, out := setup(t, clock)
+
+	// the handler answers each note on with a note off, sent straight away
+	// from inside the delivery
+	var got []ump.Word
+	d.SetReceiveHandler(func(_ time.Time, _ midi.Entity, words []ump.Word) {
+		got = append(got, words...)
+		if ump.Opcode(words[0]) == ump.OpNoteOn {
+			note := int8(words[0] >> 8 & 0x7F)
+			if err := d.Send(time.Time{}, out, []ump.Word{ump.NoteOff(0, note, 0)}); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+
+	due := epoch.Add(time.Millisecond)
+	d.Send(due, out, []ump.Word{ump.NoteOn(0, 60, 100)})
+	d.Send(due, out, []ump.Word{ump.NoteOn(0, 62, 100)})
+	clock.Advance(time.Millisecond)
+
+	assertWords(t, got,
+		ump.NoteOn(0, 60, 100),
+		ump.NoteOn(0, 62, 100),
+		ump.NoteOff(0, 60, 0),
+		ump.NoteOff(0, 62, 0))
+}
+
+func TestImmediateSendAfterOverdueSends(t *testing.T) {
+	clock := NewManualClock(epoch)
+	d, _, out := setup(t, clock)
+	got := record(d)
+
+	d.Send(epoch.Add(time.Millisecond), out, []ump.Word{ump.NoteOn(0, 1, 1)})
+
+	// move the clock without running the timer, as a late timer would
+	clock.lock.Lock()
+	clock.now = epoch.Add(2 * time.Millisecond)
+	clock.lock.Unlock()
+
+	d.Send(time.Time{}, out, []ump.Word{ump.NoteOn(0, 2, 1)})
+	assertWords(t, words(*got),
+		ump.NoteOn(0, 1, 1),
+		ump.NoteOn(0, 2, 1))
+}
+
+func TestClose(t *testing.T) {
+	clock := NewManualClock(epoch)
+	d, _, out := setup(t, clock)
+	got := record(d)
+
+	d.Send(epoch.Add(time.Millisecond), out, []ump.Word{ump.Clock})
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Second)
+	if len(*got) != 0 {
+		t.Errorf("delivered after Close: %v", *got)
+	}
+	if err := d.Send(time.Time{}, out, []ump.Word{ump.Clock}); !errors.Is(err, midi.ErrClosed) {
+		t.Errorf("Send after Close = %v, want %v", err, midi.ErrClosed)
+	}
+	if err := d.Close(); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+}
+
+func TestRouting(t *testing.T) {
+	d, in, out := setup(t, NewManualClock(epoch))
+	got := record(d)
+
+	virt, err := d.CreateVirtualInput("Virtual")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Connect(out, virt); err != nil {
+		t.Fatal(err)
+	}
+	d.Send(time.Time{}, out, []ump.Word{ump.Start})
+	if len(*got) != 2 || (*got)[0].ent != in || (*got)[1].ent != virt {
+		t.Errorf("deliveries = %v, want %d then %d", *got, in, virt)
+	}
+
+	*got = nil
+	d.CloseInput(in)
+	if err := d.Disconnect(out, virt); err != nil {
+		t.Fatal(err)
+	}
+	d.Send(time.Time{}, out, []ump.Word{ump.Stop})
+	if len(*got) != 0 {
+		t.Errorf("delivered with no open destinations: %v", *got)
+	}
+	if err := d.Disconnect(out, virt); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("second Disconnect = %v, want %v", err, ErrNotConnected)
+	}
+
+	d.CloseOutput(out)
+	if err := d.Send(time.Time{}, out, []ump.Word{ump.Stop}); !errors.Is(err, ErrOutputNotOpen) {
+		t.Errorf("Send to closed output = %v, want %v", err, ErrOutputNotOpen)
+	}
+	if err := d.Send(time.Time{}, in, []ump.Word{ump.Stop}); !errors.Is(err, ErrUnknownEntity) {
+		t.Errorf("Send to input = %v, want %v", err, ErrUnknownEntity)
+	}
+}
+
+func TestSetHandlerWhileDelivering(t *testing.T) {
+	d, _, out := setup(t, SystemClock{})
+
+	// the sends are delivered from the timer's goroutine
+	at := time.Now().Add(time.Millisecond)
+	for i := 0; i < 10; i++ {
+		d.Send(at, out, []ump.Word{ump.Clock})
+	}
+	deadline := time.Now().Add(20 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		d.SetReceiveHandler(func(time.Time, midi.Entity, []ump.Word) {})
+	}
+	d.Close()
+}
@@ -0,0 +1,125 @@
+package midi
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSysExV1ToUMP(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []Word
+	}{
+		{"empty", []byte{0xF0, 0xF7}, nil},
+		{"one byte", []byte{0xF0, 0x7E, 0xF7}, []Word{0x30017E00, 0}},
+		{"one packet", []byte{0xF0, 1, 2, 3, 4, 5, 6, 0xF7}, []Word{0x30060102, 0x03040506}},
+		{"two packets", []byte{0xF0, 1, 2, 3, 4, 5, 6, 7, 0xF7}, []Word{
+			0x30160102, 0x03040506,
+			0x30310700, 0,
+		}},
+		{"three packets", []byte{0xF0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 0xF7}, []Word{
+			0x30160102, 0x03040506,
+			0x30260708, 0x090A0B0C,
+			0x30310D00, 0,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SysExV1ToUMP(nil, tt.data); !slices.Equal(got, tt.want) {
+				t.Errorf("got %08X, want %08X", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNodeCollect(t *testing.T) {
+	in := &Node{Type: Input, Name: "in"}
+	out1 := &Node{Type: Output, Name: "out 1"}
+	out2 := &Node{Type: Output, Name: "out 2"}
+	root := &Node{Type: Root, Children: []*Node{
+		{Type: Device, Children: []*Node{
+			{Type: PortGroup, Children: []*Node{in, out1}},
+		}},
+		{Type: Device, Children: []*Node{out2}},
+	}}
+
+	if got := root.Inputs(); !slices.Equal(got, []*Node{in}) {
+		t.Errorf("Inputs() = %v", got)
+	}
+	if got := root.Outputs(); !slices.Equal(got, []*Node{out1, out2}) {
+		t.Errorf("Outputs() = %v", got)
+	}
+	if got := root.Collect(func(n *Node) bool { return n.Type == Device }); len(got) != 2 {
+		t.Errorf("Collect(Device) = %v", got)
+	}
+	if got := out2.String(); got != "  out 2 (output)" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestDrivers(t *testing.T) {
+	probed := false
+	stubs := []*Stub{
+		{Name: "test-low", Available: true, Priority: -100, CreateDriver: func(string) (Driver, error) { return &NopDriver{}, nil }},
+		{Name: "test-high", Available: true, Priority: 100, CreateDriver: func(string) (Driver, error) { return nil, ErrNotImplemeneted }},
+		{Name: "test-missing", Priority: 200},
+		{Name: "test-unplugged", Available: true, Priority: 300, Probe: func() bool { probed = true; return false }},
+	}
+	for _, s := range stubs {
+		name := s.Name
+		Register(s)
+		t.Cleanup(func() { unregister(name) })
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("registering a driver twice did not panic")
+			}
+		}()
+		Register(&Stub{Name: "test-low"})
+	}()
+
+	// other drivers may be registered; only the order of these matters
+	var names []string
+	for _, d := range Drivers() {
+		if strings.HasPrefix(d.Name, "test-") {
+			names = append(names, d.Name)
+		}
+	}
+	if want := []string{"test-unplugged", "test-missing", "test-high", "test-low"}; !slices.Equal(names, want) {
+		t.Errorf("Drivers() = %v, want %v", names, want)
+	}
+
+	if d, ok := LookupDriver("test-high"); !ok || d != stubs[1] {
+		t.Errorf("LookupDriver(test-high) = %v, %v", d, ok)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"test-low", nil},
+		{"test-high", ErrNotImplemeneted},
+		{"test-missing", ErrDriverNotAvailable},
+		{"test-unplugged", ErrDriverNotAvailable},
+		{"test-unknown", ErrUnknownDriver},
+	}
+	for _, tt := range tests {
+		if _, err := NewDriverByName(tt.name, "client"); !errors.Is(err, tt.err) {
+			t.Errorf("NewDriverByName(%s) = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+	if !probed {
+		t.Error("probe not called")
+	}
+
+	// the highest priority driver fails, so the next one is used
+	d, err := NewDefaultDriver("client")
+	if _, ok := d.(*NopDriver); !ok || err != nil {
+		t.Errorf("NewDefaultDriver() = %T, %v", d, err)
+	}
+}
@@ -0,0 +1,76 @@
+package miditest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+// AssertWords fails t unless got disassembles to want, one ump.Format
+// line per message. Runs of whitespace in want are not significant.
+func AssertWords(t testing.TB, got []ump.Word, want ...string) {
+	t.Helper()
+
+	var gotLines []string
+	if len(got) > 0 {
+		gotLines = strings.Split(ump.Disassemble(got), "\n")
+	}
+	wantLines := make([]string, len(want))
+	for i, w := range want {
+		wantLines[i] = strings.Join(strings.Fields(w), " ")
+	}
+
+	if diff := diffLines(gotLines, wantLines); diff != "" {
+		t.Errorf("messages differ (-got +want):\n%s", diff)
+	}
+}
+
+// AssertSent fails t unless the messages sent to ent so far, across every
+// send, disassemble to want.
+func (d *Driver) AssertSent(t testing.TB, ent midi.Entity, want ...string) {
+	t.Helper()
+
+	var words []ump.Word
+	for _, s := range d.SentTo(ent) {
+		words = append(words, s.Words...)
+	}
+	AssertWords(t, words, want...)
+}
+
+// AssertNothingSent fails t if anything has been sent to any entity.
+func (d *Driver) AssertNothingSent(t testing.TB) {
+	t.Helper()
+
+	for _, s := range d.Sent() {
+		t.Errorf("unexpected send to %d: %s", s.Entity, ump.Disassemble(s.Words))
+	}
+}
+
+// diffLines returns a line-by-line comparison of got and want, or "" if
+// they are equal. Lines are compared by position only.
+func diffLines(got, want []string) string {
+	var b strings.Builder
+	differ := false
+	for i := 0; i < max(len(got), len(want)); i++ {
+		switch {
+		case i >= len(want):
+			fmt.Fprintf(&b, "- %s\n", got[i])
+			differ = true
+		case i >= len(got):
+			fmt.Fprintf(&b, "+ %s\n", want[i])
+			differ = true
+		case got[i] != want[i]:
+			fmt.Fprintf(&b, "- %s\n+ %s\n", got[i], want[i])
+			differ = true
+		default:
+			fmt.Fprintf(&b, "  %s\n", got[i])
+		}
+	}
+	if !differ {
+		return ""
+	}
+	return b.String()
+}
@@ -0,0 +1,409 @@
+// Package miditest provides a recording midi.Driver for unit testing code
+// that uses the midi package.
+//
+// Driver records everything sent through it, delivers received messages
+// that the test injects, returns a scripted topology from Enumerate and can
+// be told to fail any method. Sent messages are compared with their
+// ump.Format text form, so expectations read like
+//
+//	d.AssertSent(t, out, "note-on g=0 ch=0 note=60 vel=100")
+package miditest
+
+import (
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+const driverName = "miditest"
+
+// Entities returned by CreateVirtualInput and CreateVirtualOutput are
+// numbered upwards from FirstVirtualEntity, clear of the entities a
+// scripted topology is likely to use.
+const FirstVirtualEntity = midi.Entity(0x10000)
+
+var (
+	ErrInputNotOpen  = errors.New("input not open")
+	ErrOutputNotOpen = errors.New("output not open")
+	ErrNotConnected  = errors.New("ports not connected")
+)
+
+// Sent is a recorded Send, SendSysEx or SendSysExV1 call. SendSysEx and
+// SendSysExV1 have the zero Time; SendSysExV1 data is recorded as SysEx7
+// messages on group 0.
+type Sent struct {
+	Time   time.Time
+	Entity midi.Entity
+	Words  []ump.Word
+	SysEx  bool
+}
+
+// Driver is a midi.Driver that records calls instead of talking to
+// hardware. The zero value is not usable; create one with NewDriver.
+//
+// Inputs and outputs must be opened before use, as with a real driver;
+// any entity can be opened unless a failure is set for OpenInput or
+// OpenOutput.
+type Driver struct {
+	lock sync.Mutex
+
+	onReceive midi.ReceiveEventHandler
+	onNotify  midi.NotificationHandler
+
+	closed        bool
+	topology      *midi.Node
+	inputs        map[midi.Entity]bool
+	outputs       map[midi.Entity]bool
+	virtualInputs map[midi.Entity]string
+	virtualOuts   map[midi.Entity]string
+	nextVirtual   midi.Entity
+	connections   []midi.Connection
+	sent          []Sent
+
+	failures map[string]failure
+}
+
+type failure struct {
+	err  error
+	once bool
+}
+
+func NewDriver() *Driver {
+	return &Driver{
+		onReceive:     midi.NopHandler,
+		onNotify:      midi.NopNotificationHandler,
+		topology:      &midi.Node{Type: midi.Root},
+		inputs:        map[midi.Entity]bool{},
+		outputs:       map[midi.Entity]bool{},
+		virtualInputs: map[midi.Entity]string{},
+		virtualOuts:   map[midi.Entity]string{},
+		nextVirtual:   FirstVirtualEntity,
+		failures:      map[string]failure{},
+	}
+}
+
+// MARK: Scripting
+
+// SetTopology sets the tree returned by Enumerate. Nodes without a Driver
+// are given d. Virtual ports are not added to it.
+func (d *Driver) SetTopology(root *midi.Node) {
+	var rec func(n *midi.Node)
+	rec = func(n *midi.Node) {
+		if n.Driver == nil {
+			n.Driver = d
+		}
+		for _, c := range n.Children {
+			rec(c)
+		}
+	}
+	rec(root)
+
+	d.lock.Lock()
+	d.topology = root
+	d.lock.Unlock()
+}
+
+// Fail makes every call to the named Driver method, e.g. "Send", return
+// err until Fail is called again for it with a nil err. Failed calls are
+// not recorded.
+func (d *Driver) Fail(method string, err error) {
+	d.setFailure(method, failure{err: err})
+}
+
+// FailNext makes the next call to the named Driver method return err.
+func (d *Driver) FailNext(method string, err error) {
+	d.setFailure(method, failure{err: err, once: true})
+}
+
+func (d *Driver) setFailure(method string, f failure) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if f.err == nil {
+		delete(d.failures, method)
+	} else {
+		d.failures[method] = f
+	}
+}
+
+// check returns the error method should fail with, if any. d.lock must be
+// held.
+func (d *Driver) check(method string) error {
+	if d.closed {
+		return midi.ErrClosed
+	}
+	f, ok := d.failures[method]
+	if !ok {
+		return nil
+	}
+	if f.once {
+		delete(d.failures, method)
+	}
+	return f.err
+}
+
+// Receive passes words to the receive handler as if they had arrived at
+// ent at time t. It fails if the driver is closed or ent is neither an
+// open input nor a virtual input.
+func (d *Driver) Receive(t time.Time, ent midi.Entity, words ...ump.Word) error {
+	d.lock.Lock()
+	if d.closed {
+		d.lock.Unlock()
+		return midi.ErrClosed
+	}
+	_, virtual := d.virtualInputs[ent]
+	if !d.inputs[ent] && !virtual {
+		d.lock.Unlock()
+		return ErrInputNotOpen
+	}
+	handler := d.onReceive
+	d.lock.Unlock()
+
+	handler(t, ent, words)
+	return nil
+}
+
+// Notify passes n to the notification handler.
+func (d *Driver) Notify(n midi.Notification) {
+	d.lock.Lock()
+	handler := d.onNotify
+	d.lock.Unlock()
+
+	handler(n)
+}
+
+// MARK: Inspection
+
+// Sent returns every recorded send, in call order.
+func (d *Driver) Sent() []Sent {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return slices.Clone(d.sent)
+}
+
+// SentTo returns the recorded sends to ent, in call order.
+func (d *Driver) SentTo(ent midi.Entity) []Sent {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	var out []Sent
+	for _, s := range d.sent {
+		if s.Entity == ent {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Reset forgets the recorded sends.
+func (d *Driver) Reset() {
+	d.lock.Lock()
+	d.sent = nil
+	d.lock.Unlock()
+}
+
+func (d *Driver) IsInputOpen(ent midi.Entity) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.inputs[ent]
+}
+
+func (d *Driver) IsOutputOpen(ent midi.Entity) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.outputs[ent]
+}
+
+// VirtualPort returns the name a virtual port was created with.
+func (d *Driver) VirtualPort(ent midi.Entity) (string, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if name, ok := d.virtualInputs[ent]; ok {
+		return name, true
+	}
+	name, ok := d.virtualOuts[ent]
+	return name, ok
+}
+
+func (d *Driver) IsClosed() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.closed
+}
+
+// MARK: midi.Driver
+
+func (d *Driver) Name() string {
+	return driverName
+}
+
+func (d *Driver) Close() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.closed {
+		return nil
+	}
+	if err := d.check("Close"); err != nil {
+		return err
+	}
+	d.closed = true
+	clear(d.inputs)
+	clear(d.outputs)
+	return nil
+}
+
+func (d *Driver) SetReceiveHandler(handler midi.ReceiveEventHandler) {
+	if handler == nil {
+		handler = midi.NopHandler
+	}
+	d.lock.Lock()
+	d.onReceive = handler
+	d.lock.Unlock()
+}
+
+func (d *Driver) SetNotificationHandler(handler midi.NotificationHandler) {
+	if handler == nil {
+		handler = midi.NopNotificationHandler
+	}
+	d.lock.Lock()
+	d.onNotify = handler
+	d.lock.Unlock()
+}
+
+func (d *Driver) OpenInput(ent midi.Entity) error {
+	return d.setOpen("OpenInput", d.inputs, ent, true)
+}
+
+func (d *Driver) CloseInput(ent midi.Entity) error {
+	return d.setOpen("CloseInput", d.inputs, ent, false)
+}
+
+func (d *Driver) OpenOutput(ent midi.Entity) error {
+	return d.setOpen("OpenOutput", d.outputs, ent, true)
+}
+
+func (d *Driver) CloseOutput(ent midi.Entity) error {
+	return d.setOpen("CloseOutput", d.outputs, ent, false)
+}
+
+func (d *Driver) setOpen(method string, set map[midi.Entity]bool, ent midi.Entity, open bool) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if err := d.check(method); err != nil {
+		return err
+	}
+	if open {
+		set[ent] = true
+	} else {
+		delete(set, ent)
+	}
+	return nil
+}
+
+// Send records words; they are copied, so the caller may reuse the slice.
+// ent must be an open output or a virtual output.
+func (d *Driver) Send(t time.Time, ent midi.Entity, words []ump.Word) error {
+	return d.record("Send", Sent{Time: t, Entity: ent, Words: slices.Clone(words)})
+}
+
+func (d *Driver) SendSysEx(ent midi.Entity, words []ump.Word) error {
+	return d.record("SendSysEx", Sent{Entity: ent, Words: slices.Clone(words), SysEx: true})
+}
+
+func (d *Driver) SendSysExV1(ent midi.Entity, data []byte) error {
+	return d.record("SendSysExV1", Sent{Entity: ent, Words: ump.AppendSysEx7(nil, 0, data), SysEx: true})
+}
+
+func (d *Driver) record(method string, s Sent) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if err := d.check(method); err != nil {
+		return err
+	}
+	if _, virtual := d.virtualOuts[s.Entity]; !d.outputs[s.Entity] && !virtual {
+		return ErrOutputNotOpen
+	}
+	d.sent = append(d.sent, s)
+	return nil
+}
+
+func (d *Driver) Enumerate() (*midi.Node, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if err := d.check("Enumerate"); err != nil {
+		return nil, err
+	}
+	return d.topology, nil
+}
+
+func (d *Driver) CreateVirtualInput(name string) (midi.Entity, error) {
+	return d.createVirtual("CreateVirtualInput", d.virtualInputs, name)
+}
+
+func (d *Driver) CreateVirtualOutput(name string) (midi.Entity, error) {
+	return d.createVirtual("CreateVirtualOutput", d.virtualOuts, name)
+}
+
+func (d *Driver) createVirtual(method string, set map[midi.Entity]string, name string) (midi.Entity, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if err := d.check(method); err != nil {
+		return 0, err
+	}
+	ent := d.nextVirtual
+	d.nextVirtual++
+	set[ent] = name
+	return ent, nil
+}
+
+// Connect records a connection; any two entities can be connected.
+func (d *Driver) Connect(src, dst midi.Entity) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if err := d.check("Connect"); err != nil {
+		return err
+	}
+	c := midi.Connection{Source: src, Dest: dst}
+	if !slices.Contains(d.connections, c) {
+		d.connections = append(d.connections, c)
+	}
+	return nil
+}
+
+func (d *Driver) Disconnect(src, dst midi.Entity) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if err := d.check("Disconnect"); err != nil {
+		return err
+	}
+	i := slices.Index(d.connections, midi.Connection{Source: src, Dest: dst})
+	if i < 0 {
+		return ErrNotConnected
+	}
+	d.connections = slices.Delete(d.connections, i, i+1)
+	return nil
+}
+
+// Connections returns the connections made with Connect, in the order
+// they were made.
+func (d *Driver) Connections() ([]midi.Connection, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if err := d.check("Connections"); err != nil {
+		return nil, err
+	}
+	return slices.Clone(d.connections), nil
+}
@@ -0,0 +1,210 @@
+package miditest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+// recorder is a testing.TB that records failures instead of reporting
+// them, so the assertions themselves can be tested.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertWords(t *testing.T) {
+	noteOn := ump.NoteOn(0, 60, 100)
+	noteOff := ump.NoteOff(0, 60, 0)
+
+	tests := []struct {
+		name string
+		got  []ump.Word
+		want []string
+		diff string // "" if the assertion should pass
+	}{
+		{"both empty", nil, nil, ""},
+		{"equal", []ump.Word{noteOn, noteOff}, []string{"note-on g=0 ch=0 note=60 vel=100", "note-off g=0 ch=0 note=60 vel=0"}, ""},
+		{"whitespace", []ump.Word{noteOn}, []string{"  note-on  g=0 ch=0\tnote=60 vel=100 "}, ""},
+		{
+			"different",
+			[]ump.Word{noteOn},
+			[]string{"note-on g=0 ch=0 note=61 vel=100"},
+			"- note-on g=0 ch=0 note=60 vel=100\n+ note-on g=0 ch=0 note=61 vel=100\n",
+		},
+		{
+			"extra",
+			[]ump.Word{noteOn, noteOff},
+			[]string{"note-on g=0 ch=0 note=60 vel=100"},
+			"  note-on g=0 ch=0 note=60 vel=100\n- note-off g=0 ch=0 note=60 vel=0\n",
+		},
+		{
+			"missing",
+			[]ump.Word{noteOn},
+			[]string{"note-on g=0 ch=0 note=60 vel=100", "clock g=0"},
+			"  note-on g=0 ch=0 note=60 vel=100\n+ clock g=0\n",
+		},
+		{"nothing sent", nil, []string{"clock g=0"}, "+ clock g=0\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{TB: t}
+			AssertWords(r, tt.got, tt.want...)
+
+			switch {
+			case tt.diff == "" && len(r.errors) != 0:
+				t.Errorf("unexpected failure: %v", r.errors)
+			case tt.diff != "" && len(r.errors) != 1:
+				t.Errorf("got %d failures, want 1: %v", len(r.errors), r.errors)
+			case tt.diff != "":
+				if want := "messages differ (-got +want):\n" + tt.diff; r.errors[0] != want {
+					t.Errorf("failure = %q, want %q", r.errors[0], want)
+				}
+			}
+		})
+	}
+}
+
+func TestAssertSent(t *testing.T) {
+	d := NewDriver()
+	d.OpenOutput(1)
+	d.OpenOutput(2)
+	d.Send(time.Time{}, 1, []ump.Word{ump.NoteOn(0, 60, 100)})
+	d.Send(time.Time{}, 2, []ump.Word{ump.Clock})
+	d.Send(time.Time{}, 1, []ump.Word{ump.NoteOff(0, 60, 0)})
+
+	r := &recorder{TB: t}
+	d.AssertSent(r, 1, "note-on g=0 ch=0 note=60 vel=100", "note-off g=0 ch=0 note=60 vel=0")
+	d.AssertSent(r, 2, "clock g=0")
+	if len(r.errors) != 0 {
+		t.Errorf("unexpected failures: %v", r.errors)
+	}
+
+	d.AssertSent(r, 2, "stop g=0")
+	d.AssertNothingSent(r)
+	if len(r.errors) != 4 {
+		t.Errorf("got %d failures, want 4 (one diff, three unexpected sends): %v", len(r.errors), r.errors)
+	}
+
+	d.Reset()
+	r = &recorder{TB: t}
+	d.AssertNothingSent(r)
+	d.AssertSent(r, 1)
+	if len(r.errors) != 0 {
+		t.Errorf("unexpected failures after Reset: %v", r.errors)
+	}
+}
+
+func TestSendRequiresOpenOutput(t *testing.T) {
+	d := NewDriver()
+	if err := d.Send(time.Time{}, 1, []ump.Word{ump.Clock}); !errors.Is(err, ErrOutputNotOpen) {
+		t.Errorf("Send to closed output = %v, want %v", err, ErrOutputNotOpen)
+	}
+
+	virt, err := d.CreateVirtualOutput("out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if virt != FirstVirtualEntity {
+		t.Errorf("virtual output = %d, want %d", virt, FirstVirtualEntity)
+	}
+	if err := d.SendSysExV1(virt, []byte{0xF0, 0x7E, 0x7F, 0x09, 0x01, 0xF7}); err != nil {
+		t.Fatal(err)
+	}
+	d.AssertSent(t, virt, "sysex7 g=0 7e 7f 09 01")
+	if s := d.Sent(); len(s) != 1 || !s[0].SysEx {
+		t.Errorf("Sent = %+v, want one SysEx send", s)
+	}
+}
+
+func TestSendCopiesWords(t *testing.T) {
+	d := NewDriver()
+	d.OpenOutput(1)
+
+	words := []ump.Word{ump.NoteOn(0, 60, 100)}
+	d.Send(time.Time{}, 1, words)
+	words[0] = ump.Clock
+	d.AssertSent(t, 1, "note-on g=0 ch=0 note=60 vel=100")
+}
+
+func TestFail(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	tests := []struct {
+		name  string
+		setup func(d *Driver)
+		want  []error
+	}{
+		{"none", func(d *Driver) {}, []error{nil, nil, nil}},
+		{"always", func(d *Driver) { d.Fail("Send", errBoom) }, []error{errBoom, errBoom, errBoom}},
+		{"next", func(d *Driver) { d.FailNext("Send", errBoom) }, []error{errBoom, nil, nil}},
+		{"cleared", func(d *Driver) { d.Fail("Send", errBoom); d.Fail("Send", nil) }, []error{nil, nil, nil}},
+		{"other method", func(d *Driver) { d.Fail("SendSysEx", errBoom) }, []error{nil, nil, nil}},
+		{"closed", func(d *Driver) { d.Close() }, []error{midi.ErrClosed, midi.ErrClosed, midi.ErrClosed}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDriver()
+			d.OpenOutput(1)
+			tt.setup(d)
+
+			recorded := 0
+			for i, want := range tt.want {
+				err := d.Send(time.Time{}, 1, []ump.Word{ump.Clock})
+				if !errors.Is(err, want) {
+					t.Errorf("Send #%d = %v, want %v", i, err, want)
+				}
+				if err == nil {
+					recorded++
+				}
+			}
+			if n := len(d.Sent()); n != recorded {
+				t.Errorf("recorded %d sends, want %d", n, recorded)
+			}
+		})
+	}
+}
+
+func TestReceive(t *testing.T) {
+	d := NewDriver()
+
+	var got []ump.Word
+	var gotEnt midi.Entity
+	d.SetReceiveHandler(func(_ time.Time, ent midi.Entity, words []ump.Word) {
+		gotEnt = ent
+		got = append(got, words...)
+	})
+
+	if err := d.Receive(time.Time{}, 3, ump.Clock); !errors.Is(err, ErrInputNotOpen) {
+		t.Errorf("Receive on closed input = %v, want %v", err, ErrInputNotOpen)
+	}
+
+	d.OpenInput(3)
+	if err := d.Receive(time.Time{}, 3, ump.Clock, ump.Start); err != nil {
+		t.Fatal(err)
+	}
+	if gotEnt != 3 {
+		t.Errorf("entity = %d, want 3", gotEnt)
+	}
+	AssertWords(t, got, "clock g=0", "start g=0")
+
+	d.CloseInput(3)
+	if err := d.Receive(time.Time{}, 3, ump.Clock); !errors.Is(err, ErrInputNotOpen) {
+		t.Errorf("Receive after CloseInput = %v, want %v", err, ErrInputNotOpen)
+	}
+
+	d.Close()
+	if err := d.Receive(time.Time{}, 3, ump.Clock); !errors.Is(err, midi.ErrClosed) {
+		t.Errorf("Receive after Close = %v, want %v", err, midi.ErrClosed)
+	}
+}
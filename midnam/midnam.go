@@ -0,0 +1,397 @@
+// Package midnam parses MIDI Name Documents (MIDNAM), the XML files in
+// which manufacturers publish the patch, note and controller names of
+// their instruments.
+//
+// Parsed documents are resolved into a model in which every patch knows
+// its bank and the messages that select it, and names can be looked up for
+// a device mode and channel. Channels are zero-based in the model and
+// one-based in the XML.
+package midnam
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+var ErrInvalidDocument = errors.New("invalid MIDNAM document")
+
+// Document is a parsed MIDI Name Document.
+type Document struct {
+	Author  string
+	Devices []*Device
+}
+
+// Device holds the names for a set of models from one manufacturer.
+type Device struct {
+	Manufacturer string
+	Models       []string
+	Modes        []*Mode
+	NameSets     []*NameSet
+
+	NoteLists    map[string]*NoteList
+	ControlLists map[string]*ControlList
+}
+
+// Mode is a custom device mode, assigning a name set to each channel.
+type Mode struct {
+	Name     string
+	NameSets [16]*NameSet // by channel; nil if unassigned
+}
+
+// NameSet is a channel name set: the patch banks, notes and controllers
+// available on the channels it is assigned to.
+type NameSet struct {
+	Name     string
+	Channels []uint8 // channels the set is available on
+	Banks    []*Bank
+
+	Notes    *NoteList    // may be nil
+	Controls *ControlList // may be nil
+}
+
+// Bank is a patch bank.
+type Bank struct {
+	Name     string
+	ROM      bool
+	Controls []ControlChange // bank select messages
+	Patches  []*Patch
+}
+
+// ControlChange is a control change sent to select a bank or patch.
+type ControlChange struct {
+	Control uint8
+	Value   uint8
+}
+
+// Patch is a single patch of a bank.
+type Patch struct {
+	Number  string // as displayed by the device, e.g. "A-01"
+	Name    string
+	Program uint8
+	Bank    *Bank
+
+	// Extra control changes sent after the bank's, before the program
+	// change
+	Controls []ControlChange
+
+	Notes *NoteList // overrides the name set's notes if not nil
+}
+
+// NoteList names notes, e.g. the sounds of a drum kit.
+type NoteList struct {
+	Name   string
+	Names  map[uint8]string
+	Groups map[string][]uint8 // note numbers by group name
+}
+
+// ControlList names controllers.
+type ControlList struct {
+	Name     string
+	Controls []Control
+}
+
+// Control is a named controller. Type is "7bit", "14bit", "RPN" or "NRPN".
+type Control struct {
+	Type   string
+	Number uint16
+	Name   string
+}
+
+// Parse reads and resolves a MIDI Name Document.
+func Parse(r io.Reader) (*Document, error) {
+	var x xmlDocument
+	if err := xml.NewDecoder(r).Decode(&x); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidDocument, err)
+	}
+
+	doc := &Document{Author: strings.TrimSpace(x.Author)}
+	for i := range x.Devices {
+		d, err := resolve(&x.Devices[i])
+		if err != nil {
+			return nil, err
+		}
+		doc.Devices = append(doc.Devices, d)
+	}
+	return doc, nil
+}
+
+// ParseFile reads and resolves a MIDI Name Document from a file.
+func ParseFile(name string) (*Document, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Device finds the device describing a model, ignoring case.
+func (doc *Document) Device(model string) (*Device, bool) {
+	for _, d := range doc.Devices {
+		for _, m := range d.Models {
+			if strings.EqualFold(m, model) {
+				return d, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func resolve(x *xmlMasterDevices) (*Device, error) {
+	d := &Device{
+		Manufacturer: strings.TrimSpace(x.Manufacturer),
+		NoteLists:    map[string]*NoteList{},
+		ControlLists: map[string]*ControlList{},
+	}
+	for _, m := range x.Models {
+		d.Models = append(d.Models, strings.TrimSpace(m))
+	}
+
+	for _, l := range x.NoteLists {
+		d.NoteLists[l.Name] = noteList(&l)
+	}
+	for _, l := range x.ControlLists {
+		cl := &ControlList{Name: l.Name}
+		for _, c := range l.Controls {
+			t := c.Type
+			if t == "" {
+				t = "7bit"
+			}
+			cl.Controls = append(cl.Controls, Control{Type: t, Number: uint16(c.Number), Name: c.Name})
+		}
+		d.ControlLists[l.Name] = cl
+	}
+
+	patchLists := map[string]*xmlPatchNameList{}
+	for i := range x.PatchLists {
+		patchLists[x.PatchLists[i].Name] = &x.PatchLists[i]
+	}
+
+	sets := map[string]*NameSet{}
+	for _, xs := range x.NameSets {
+		ns := &NameSet{Name: xs.Name}
+		for _, a := range xs.Available {
+			if a.Available != "false" && a.Channel >= 1 && a.Channel <= 16 {
+				ns.Channels = append(ns.Channels, uint8(a.Channel-1))
+			}
+		}
+		var err error
+		if ns.Notes, err = d.noteList(xs.NoteList.Name); err != nil {
+			return nil, err
+		}
+		if xs.ControlList.Name != "" {
+			if ns.Controls = d.ControlLists[xs.ControlList.Name]; ns.Controls == nil {
+				return nil, fmt.Errorf("%w: unknown control name list %q", ErrInvalidDocument, xs.ControlList.Name)
+			}
+		}
+
+		for _, xb := range xs.Banks {
+			b := &Bank{Name: xb.Name, ROM: xb.ROM == "true", Controls: controls(xb.Commands)}
+			list := xb.PatchList
+			if list == nil && xb.UsesList.Name != "" {
+				if list = patchLists[xb.UsesList.Name]; list == nil {
+					return nil, fmt.Errorf("%w: unknown patch name list %q", ErrInvalidDocument, xb.UsesList.Name)
+				}
+			}
+			if list != nil {
+				for i, xp := range list.Patches {
+					p := &Patch{Number: xp.Number, Name: xp.Name, Program: uint8(i), Bank: b, Controls: controls(xp.Commands)}
+					if xp.ProgramChange != nil {
+						p.Program = uint8(*xp.ProgramChange)
+					} else if len(xp.Commands.Programs) > 0 {
+						p.Program = uint8(xp.Commands.Programs[0].Number)
+					}
+					if p.Notes, err = d.noteList(xp.NoteList.Name); err != nil {
+						return nil, err
+					}
+					b.Patches = append(b.Patches, p)
+				}
+			}
+			ns.Banks = append(ns.Banks, b)
+		}
+
+		sets[ns.Name] = ns
+		d.NameSets = append(d.NameSets, ns)
+	}
+
+	for _, xm := range x.Modes {
+		m := &Mode{Name: xm.Name}
+		for _, a := range xm.Assignments {
+			if a.Channel < 1 || a.Channel > 16 {
+				return nil, fmt.Errorf("%w: channel %d in mode %q", ErrInvalidDocument, a.Channel, xm.Name)
+			}
+			if m.NameSets[a.Channel-1] = sets[a.NameSet]; m.NameSets[a.Channel-1] == nil {
+				return nil, fmt.Errorf("%w: unknown channel name set %q", ErrInvalidDocument, a.NameSet)
+			}
+		}
+		d.Modes = append(d.Modes, m)
+	}
+
+	return d, nil
+}
+
+func (d *Device) noteList(name string) (*NoteList, error) {
+	if name == "" {
+		return nil, nil
+	}
+	l, ok := d.NoteLists[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown note name list %q", ErrInvalidDocument, name)
+	}
+	return l, nil
+}
+
+func noteList(x *xmlNoteNameList) *NoteList {
+	l := &NoteList{Name: x.Name, Names: map[uint8]string{}, Groups: map[string][]uint8{}}
+	for _, n := range x.Notes {
+		l.Names[uint8(n.Number)] = n.Name
+	}
+	for _, g := range x.Groups {
+		for _, n := range g.Notes {
+			l.Names[uint8(n.Number)] = n.Name
+			l.Groups[g.Name] = append(l.Groups[g.Name], uint8(n.Number))
+		}
+	}
+	return l
+}
+
+func controls(x xmlMIDICommands) []ControlChange {
+	var out []ControlChange
+	for _, c := range x.Controls {
+		out = append(out, ControlChange{Control: uint8(c.Control), Value: uint8(c.Value)})
+	}
+	return out
+}
+
+// MARK: Queries
+
+// Mode finds a device mode by name. If name is empty the first mode is
+// returned.
+func (d *Device) Mode(name string) (*Mode, bool) {
+	for _, m := range d.Modes {
+		if name == "" || m.Name == name {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// NameSet returns the name set in use on a channel in a mode. Devices
+// without modes use the first name set available on the channel.
+func (d *Device) NameSet(mode string, channel uint8) (*NameSet, bool) {
+	if len(d.Modes) > 0 {
+		m, ok := d.Mode(mode)
+		if !ok || m.NameSets[channel&0x0F] == nil {
+			return nil, false
+		}
+		return m.NameSets[channel&0x0F], true
+	}
+	for _, ns := range d.NameSets {
+		for _, ch := range ns.Channels {
+			if ch == channel {
+				return ns, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Patches returns every patch of every bank.
+func (ns *NameSet) Patches() []*Patch {
+	var out []*Patch
+	for _, b := range ns.Banks {
+		out = append(out, b.Patches...)
+	}
+	return out
+}
+
+// Patch finds a patch by name, ignoring case.
+func (ns *NameSet) Patch(name string) (*Patch, bool) {
+	for _, p := range ns.Patches() {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// PatchFor finds the patch selected by a bank select and program change.
+func (ns *NameSet) PatchFor(msb, lsb, program uint8) (*Patch, bool) {
+	for _, b := range ns.Banks {
+		if !b.selects(msb, lsb) {
+			continue
+		}
+		for _, p := range b.Patches {
+			if p.Program == program {
+				return p, true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (b *Bank) selects(msb, lsb uint8) bool {
+	for _, c := range b.Controls {
+		if (c.Control == 0 && c.Value != msb) || (c.Control == 32 && c.Value != lsb) {
+			return false
+		}
+	}
+	return true
+}
+
+// NoteName names a note played with patch p on the name set, or with no
+// particular patch if p is nil.
+func (ns *NameSet) NoteName(p *Patch, note uint8) (string, bool) {
+	l := ns.Notes
+	if p != nil && p.Notes != nil {
+		l = p.Notes
+	}
+	if l == nil {
+		return "", false
+	}
+	name, ok := l.Names[note]
+	return name, ok
+}
+
+// ControlName names a 7-bit or 14-bit controller.
+func (ns *NameSet) ControlName(cc uint8) (string, bool) {
+	if ns.Controls == nil {
+		return "", false
+	}
+	for _, c := range ns.Controls.Controls {
+		if (c.Type == "7bit" || c.Type == "14bit") && c.Number == uint16(cc) {
+			return c.Name, true
+		}
+	}
+	return "", false
+}
+
+// MARK: Selection
+
+// Append appends the messages that select the patch on channel to dst:
+// the bank's control changes, the patch's own control changes and a
+// program change.
+func (p *Patch) Append(dst []ump.Word, group, channel uint8) []ump.Word {
+	g := ump.Word(group&0x0F) << 24
+	var ccs []ControlChange
+	if p.Bank != nil {
+		ccs = p.Bank.Controls
+	}
+	for _, c := range append(ccs[:len(ccs):len(ccs)], p.Controls...) {
+		dst = append(dst, g|ump.ControlChange(channel, int8(c.Control&0x7F), int8(c.Value&0x7F)))
+	}
+	return append(dst, g|ump.ProgramChange(channel, int8(p.Program&0x7F)))
+}
+
+// Send selects a patch on a channel of entity.
+func Send(driver midi.Driver, t time.Time, entity midi.Entity, group, channel uint8, p *Patch) error {
+	return driver.Send(t, entity, p.Append(nil, group, channel))
+}
@@ -0,0 +1,328 @@
+package midnam
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jaz303/midi/ump"
+)
+
+const document = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE MIDINameDocument PUBLIC "-//MIDI Manufacturers Association//DTD MIDINameDocument 1.0//EN" "http://www.midi.org/dtds/MIDINameDocument10.dtd">
+<MIDINameDocument>
+  <Author> Test </Author>
+  <MasterDeviceNames>
+    <Manufacturer>Acme</Manufacturer>
+    <Model>Synth 1</Model>
+    <Model>Synth 1 Rack</Model>
+    <CustomDeviceMode Name="Multi">
+      <ChannelNameSetAssignments>
+        <ChannelNameSetAssign Channel="1" NameSet="Voices"/>
+        <ChannelNameSetAssign Channel="10" NameSet="Drums"/>
+      </ChannelNameSetAssignments>
+    </CustomDeviceMode>
+    <ChannelNameSet Name="Voices">
+      <AvailableForChannels>
+        <AvailableChannel Channel="1" Available="true"/>
+        <AvailableChannel Channel="2" Available="false"/>
+        <AvailableChannel Channel="3" Available="true"/>
+      </AvailableForChannels>
+      <UsesControlNameList Name="Controls"/>
+      <PatchBank Name="Preset" ROM="true">
+        <MIDICommands>
+          <ControlChange Control="0" Value="0"/>
+          <ControlChange Control="32" Value="1"/>
+        </MIDICommands>
+        <UsesPatchNameList Name="Presets"/>
+      </PatchBank>
+      <PatchBank Name="User">
+        <MIDICommands>
+          <ControlChange Control="0" Value="80"/>
+          <ControlChange Control="32" Value="0"/>
+        </MIDICommands>
+        <PatchNameList Name="User Patches">
+          <Patch Number="U-01" Name="My Pad" ProgramChange="10"/>
+          <Patch Number="U-02" Name="My Kit">
+            <UsesNoteNameList Name="Kit"/>
+            <PatchMIDICommands>
+              <ControlChange Control="12" Value="3"/>
+              <ProgramChange Number="20"/>
+            </PatchMIDICommands>
+          </Patch>
+        </PatchNameList>
+      </PatchBank>
+    </ChannelNameSet>
+    <ChannelNameSet Name="Drums">
+      <AvailableForChannels>
+        <AvailableChannel Channel="10" Available="true"/>
+      </AvailableForChannels>
+      <UsesNoteNameList Name="GM Drums"/>
+      <PatchBank Name="Kits">
+        <UsesPatchNameList Name="Presets"/>
+      </PatchBank>
+    </ChannelNameSet>
+    <PatchNameList Name="Presets">
+      <Patch Number="001" Name="Grand Piano"/>
+      <Patch Number="002" Name="Strings"/>
+    </PatchNameList>
+    <NoteNameList Name="GM Drums">
+      <Note Number="36" Name="Kick"/>
+      <NoteGroup Name="Snares">
+        <Note Number="38" Name="Snare"/>
+        <Note Number="40" Name="Rim"/>
+      </NoteGroup>
+    </NoteNameList>
+    <NoteNameList Name="Kit">
+      <Note Number="36" Name="Boom"/>
+    </NoteNameList>
+    <ControlNameList Name="Controls">
+      <Control Number="1" Name="Mod Wheel"/>
+      <Control Type="14bit" Number="7" Name="Volume"/>
+      <Control Type="NRPN" Number="300" Name="Cutoff"/>
+    </ControlNameList>
+  </MasterDeviceNames>
+</MIDINameDocument>`
+
+func parse(t *testing.T, doc string) *Device {
+	t.Helper()
+	d, err := Parse(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev, ok := d.Device("synth 1 rack")
+	if !ok {
+		t.Fatal("device not found")
+	}
+	return dev
+}
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(strings.NewReader(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Author != "Test" || len(doc.Devices) != 1 {
+		t.Fatalf("document = %+v", doc)
+	}
+	if _, ok := doc.Device("Synth 2"); ok {
+		t.Error("found an undescribed model")
+	}
+
+	d := doc.Devices[0]
+	if d.Manufacturer != "Acme" || !reflect.DeepEqual(d.Models, []string{"Synth 1", "Synth 1 Rack"}) {
+		t.Errorf("device %q %q", d.Manufacturer, d.Models)
+	}
+
+	voices := d.NameSets[0]
+	if !reflect.DeepEqual(voices.Channels, []uint8{0, 2}) {
+		t.Errorf("Voices channels = %v, want [0 2]", voices.Channels)
+	}
+	var patches []string
+	for _, p := range voices.Patches() {
+		patches = append(patches, p.Bank.Name+"/"+p.Number+" "+p.Name)
+	}
+	want := []string{"Preset/001 Grand Piano", "Preset/002 Strings", "User/U-01 My Pad", "User/U-02 My Kit"}
+	if !reflect.DeepEqual(patches, want) {
+		t.Errorf("patches = %q, want %q", patches, want)
+	}
+	if !voices.Banks[0].ROM || voices.Banks[1].ROM {
+		t.Error("ROM flags not read")
+	}
+
+	drums := d.NoteLists["GM Drums"]
+	if !reflect.DeepEqual(drums.Groups, map[string][]uint8{"Snares": {38, 40}}) || drums.Names[40] != "Rim" {
+		t.Errorf("GM Drums = %+v", drums)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+	}{
+		{"not XML", "<MIDINameDocument>", "<MIDINameDocument"},
+		{"unknown patch list", `<UsesPatchNameList Name="Presets"/>`, `<UsesPatchNameList Name="Missing"/>`},
+		{"unknown note list", `<UsesNoteNameList Name="Kit"/>`, `<UsesNoteNameList Name="Missing"/>`},
+		{"unknown control list", `<UsesControlNameList Name="Controls"/>`, `<UsesControlNameList Name="Missing"/>`},
+		{"unknown name set", `NameSet="Drums"`, `NameSet="Missing"`},
+		{"channel out of range", `Channel="10" NameSet`, `Channel="17" NameSet`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := strings.Replace(document, tt.from, tt.to, 1)
+			if doc == document {
+				t.Fatalf("%q not in document", tt.from)
+			}
+			if _, err := Parse(strings.NewReader(doc)); !errors.Is(err, ErrInvalidDocument) {
+				t.Errorf("Parse = %v, want %v", err, ErrInvalidDocument)
+			}
+		})
+	}
+}
+
+func TestNameSet(t *testing.T) {
+	withModes := parse(t, document)
+	withoutModes := parse(t, document)
+	withoutModes.Modes = nil
+
+	tests := []struct {
+		name    string
+		device  *Device
+		mode    string
+		channel uint8
+		want    string // empty if none
+	}{
+		{"first mode", withModes, "", 0, "Voices"},
+		{"named mode", withModes, "Multi", 9, "Drums"},
+		{"unassigned channel", withModes, "Multi", 2, ""},
+		{"unknown mode", withModes, "Single", 0, ""},
+		{"available channel", withoutModes, "", 2, "Voices"},
+		{"unavailable channel", withoutModes, "", 1, ""},
+		{"drum channel", withoutModes, "", 9, "Drums"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ns, ok := tt.device.NameSet(tt.mode, tt.channel)
+			if ok != (tt.want != "") || (ok && ns.Name != tt.want) {
+				t.Errorf("NameSet(%q, %d) = %v, %v; want %q", tt.mode, tt.channel, ns, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	d := parse(t, document)
+	voices, _ := d.NameSet("", 0)
+	drums, _ := d.NameSet("", 9)
+
+	patchTests := []struct {
+		msb, lsb, program uint8
+		want              string // empty if none
+	}{
+		{0, 1, 0, "Grand Piano"},
+		{0, 1, 1, "Strings"},
+		{0, 0, 1, ""},
+		{80, 0, 10, "My Pad"},
+		{80, 0, 20, "My Kit"},
+		{80, 0, 1, ""},
+	}
+	for _, tt := range patchTests {
+		p, ok := voices.PatchFor(tt.msb, tt.lsb, tt.program)
+		if ok != (tt.want != "") || (ok && p.Name != tt.want) {
+			t.Errorf("PatchFor(%d, %d, %d) = %v, %v; want %q", tt.msb, tt.lsb, tt.program, p, ok, tt.want)
+		}
+	}
+
+	kit, ok := voices.Patch("my kit")
+	if !ok {
+		t.Fatal("patch My Kit not found")
+	}
+	noteTests := []struct {
+		ns    *NameSet
+		patch *Patch
+		note  uint8
+		want  string
+	}{
+		{drums, nil, 36, "Kick"},
+		{drums, nil, 38, "Snare"},
+		{drums, nil, 37, ""},
+		{voices, nil, 36, ""},
+		{voices, kit, 36, "Boom"},
+	}
+	for _, tt := range noteTests {
+		if name, ok := tt.ns.NoteName(tt.patch, tt.note); ok != (tt.want != "") || name != tt.want {
+			t.Errorf("%s NoteName(%d) = %q, %v; want %q", tt.ns.Name, tt.note, name, ok, tt.want)
+		}
+	}
+
+	controlTests := []struct {
+		ns   *NameSet
+		cc   uint8
+		want string
+	}{
+		{voices, 1, "Mod Wheel"},
+		{voices, 7, "Volume"},
+		{voices, 44, ""}, // the NRPN's number is not a controller
+		{drums, 1, ""},
+	}
+	for _, tt := range controlTests {
+		if name, ok := tt.ns.ControlName(tt.cc); ok != (tt.want != "") || name != tt.want {
+			t.Errorf("%s ControlName(%d) = %q, %v; want %q", tt.ns.Name, tt.cc, name, ok, tt.want)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	d := parse(t, document)
+	voices, _ := d.NameSet("", 0)
+
+	g := func(w ump.Word) ump.Word { return 1<<24 | w }
+	tests := []struct {
+		patch string
+		want  []ump.Word
+	}{
+		{"Grand Piano", []ump.Word{
+			g(ump.ControlChange(2, 0, 0)),
+			g(ump.ControlChange(2, 32, 1)),
+			g(ump.ProgramChange(2, 0)),
+		}},
+		{"My Kit", []ump.Word{
+			g(ump.ControlChange(2, 0, 80)),
+			g(ump.ControlChange(2, 32, 0)),
+			g(ump.ControlChange(2, 12, 3)),
+			g(ump.ProgramChange(2, 20)),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.patch, func(t *testing.T) {
+			p, _ := voices.Patch(tt.patch)
+			if got := p.Append(nil, 1, 2); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Append = %08X, want %08X", got, tt.want)
+			}
+
+			// appending must not change the bank's commands
+			if len(p.Bank.Controls) != 2 {
+				t.Errorf("bank controls = %v", p.Bank.Controls)
+			}
+		})
+	}
+}
+
+func TestTracker(t *testing.T) {
+	d := parse(t, document)
+	tr := NewTracker(d, "Multi", 0)
+
+	tr.Handle([]ump.Word{
+		ump.ControlChange(0, 0, 80),
+		ump.ControlChange(0, 32, 0),
+		ump.ProgramChange(0, 20),
+		1<<24 | ump.ProgramChange(9, 0), // another group
+	})
+	if p, ok := tr.Patch(0); !ok || p.Name != "My Kit" {
+		t.Errorf("channel 1 patch = %v, %v; want My Kit", p, ok)
+	}
+	if name, _ := tr.NoteName(0, 36); name != "Boom" {
+		t.Errorf("channel 1 note 36 = %q, want Boom", name)
+	}
+	if name, _ := tr.ControlName(0, 1); name != "Mod Wheel" {
+		t.Errorf("channel 1 cc 1 = %q, want Mod Wheel", name)
+	}
+	if _, ok := tr.Patch(9); ok {
+		t.Error("program change on another group tracked")
+	}
+	if name, _ := tr.NoteName(9, 36); name != "Kick" {
+		t.Errorf("channel 10 note 36 = %q, want Kick", name)
+	}
+
+	// a program with no patch in the selected bank clears the patch
+	tr.Handle([]ump.Word{ump.ProgramChange(0, 99)})
+	if p, ok := tr.Patch(0); ok {
+		t.Errorf("channel 1 patch = %v after unknown program", p)
+	}
+	if _, ok := tr.NoteName(1, 36); ok {
+		t.Error("named a note on an unassigned channel")
+	}
+}
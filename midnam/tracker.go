@@ -0,0 +1,94 @@
+package midnam
+
+import (
+	"sync"
+
+	"github.com/jaz303/midi/ump"
+)
+
+// Tracker follows the bank select and program change messages on a group
+// so that incoming notes and controllers can be named for the patch
+// selected on each channel.
+//
+// Tracker is safe for concurrent use.
+type Tracker struct {
+	device *Device
+	mode   string
+	group  uint8
+
+	mu       sync.Mutex
+	channels [16]trackedChannel
+}
+
+type trackedChannel struct {
+	msb, lsb uint8
+	patch    *Patch
+}
+
+// NewTracker returns a Tracker naming messages on group with device in the
+// given mode.
+func NewTracker(device *Device, mode string, group uint8) *Tracker {
+	return &Tracker{device: device, mode: mode, group: group}
+}
+
+// Handle processes MIDI 1.0 channel voice messages.
+func (t *Tracker) Handle(words []ump.Word) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for len(words) > 0 {
+		msg, rest := ump.Next(words)
+		if msg == nil {
+			return
+		}
+		words = rest
+
+		w := msg[0]
+		if ump.MessageType(w) != ump.MsgTypeMIDIv1 || ump.Group(w) != t.group {
+			continue
+		}
+		ch := &t.channels[ump.Channel(w)]
+		d1, d2 := uint8(w>>8)&0x7F, uint8(w)&0x7F
+		switch ump.Opcode(w) {
+		case ump.OpControlChange:
+			switch d1 {
+			case 0:
+				ch.msb = d2
+			case 32:
+				ch.lsb = d2
+			}
+		case ump.OpProgramChange:
+			ch.patch = nil
+			if ns, ok := t.device.NameSet(t.mode, ump.Channel(w)); ok {
+				ch.patch, _ = ns.PatchFor(ch.msb, ch.lsb, d1)
+			}
+		}
+	}
+}
+
+// Patch returns the patch last selected on a channel.
+func (t *Tracker) Patch(channel uint8) (*Patch, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := t.channels[channel&0x0F].patch
+	return p, p != nil
+}
+
+// NoteName names a note on a channel for the channel's current patch.
+func (t *Tracker) NoteName(channel, note uint8) (string, bool) {
+	ns, ok := t.device.NameSet(t.mode, channel)
+	if !ok {
+		return "", false
+	}
+	p, _ := t.Patch(channel)
+	return ns.NoteName(p, note)
+}
+
+// ControlName names a controller on a channel.
+func (t *Tracker) ControlName(channel, cc uint8) (string, bool) {
+	ns, ok := t.device.NameSet(t.mode, channel)
+	if !ok {
+		return "", false
+	}
+	return ns.ControlName(cc)
+}
@@ -0,0 +1,111 @@
+package midnam
+
+import "encoding/xml"
+
+// The raw XML form of a MIDI Name Document. Only the elements used by the
+// model are declared; everything else is ignored by encoding/xml.
+
+type xmlDocument struct {
+	XMLName xml.Name           `xml:"MIDINameDocument"`
+	Author  string             `xml:"Author"`
+	Devices []xmlMasterDevices `xml:"MasterDeviceNames"`
+}
+
+type xmlMasterDevices struct {
+	Manufacturer string              `xml:"Manufacturer"`
+	Models       []string            `xml:"Model"`
+	Modes        []xmlCustomMode     `xml:"CustomDeviceMode"`
+	NameSets     []xmlChannelNameSet `xml:"ChannelNameSet"`
+	PatchLists   []xmlPatchNameList  `xml:"PatchNameList"`
+	NoteLists    []xmlNoteNameList   `xml:"NoteNameList"`
+	ControlLists []xmlControlList    `xml:"ControlNameList"`
+}
+
+type xmlCustomMode struct {
+	Name        string             `xml:"Name,attr"`
+	Assignments []xmlNameSetAssign `xml:"ChannelNameSetAssignments>ChannelNameSetAssign"`
+}
+
+type xmlNameSetAssign struct {
+	Channel int    `xml:"Channel,attr"`
+	NameSet string `xml:"NameSet,attr"`
+}
+
+type xmlChannelNameSet struct {
+	Name        string                `xml:"Name,attr"`
+	Available   []xmlAvailableChannel `xml:"AvailableForChannels>AvailableChannel"`
+	NoteList    xmlUses               `xml:"UsesNoteNameList"`
+	ControlList xmlUses               `xml:"UsesControlNameList"`
+	Banks       []xmlPatchBank        `xml:"PatchBank"`
+}
+
+type xmlAvailableChannel struct {
+	Channel   int    `xml:"Channel,attr"`
+	Available string `xml:"Available,attr"`
+}
+
+type xmlUses struct {
+	Name string `xml:"Name,attr"`
+}
+
+type xmlPatchBank struct {
+	Name      string            `xml:"Name,attr"`
+	ROM       string            `xml:"ROM,attr"`
+	Commands  xmlMIDICommands   `xml:"MIDICommands"`
+	UsesList  xmlUses           `xml:"UsesPatchNameList"`
+	PatchList *xmlPatchNameList `xml:"PatchNameList"`
+}
+
+type xmlMIDICommands struct {
+	Controls []xmlControlChange `xml:"ControlChange"`
+	Programs []xmlProgramChange `xml:"ProgramChange"`
+}
+
+type xmlControlChange struct {
+	Control int `xml:"Control,attr"`
+	Value   int `xml:"Value,attr"`
+}
+
+type xmlProgramChange struct {
+	Number int `xml:"Number,attr"`
+}
+
+type xmlPatchNameList struct {
+	Name    string     `xml:"Name,attr"`
+	Patches []xmlPatch `xml:"Patch"`
+}
+
+type xmlPatch struct {
+	Number        string          `xml:"Number,attr"`
+	Name          string          `xml:"Name,attr"`
+	ProgramChange *int            `xml:"ProgramChange,attr"`
+	NoteList      xmlUses         `xml:"UsesNoteNameList"`
+	Commands      xmlMIDICommands `xml:"PatchMIDICommands"`
+}
+
+type xmlNoteNameList struct {
+	Name   string         `xml:"Name,attr"`
+	Notes  []xmlNote      `xml:"Note"`
+	Groups []xmlNoteGroup `xml:"NoteGroup"`
+}
+
+type xmlNoteGroup struct {
+	Name  string    `xml:"Name,attr"`
+	Notes []xmlNote `xml:"Note"`
+}
+
+type xmlNote struct {
+	Number int    `xml:"Number,attr"`
+	Name   string `xml:"Name,attr"`
+}
+
+type xmlControlList struct {
+	Name     string       `xml:"Name,attr"`
+	Controls []xmlControl `xml:"Control"`
+}
+
+type xmlControl struct {
+	Type   string `xml:"Type,attr"`
+	Number int    `xml:"Number,attr"`
+	Name   string `xml:"Name,attr"`
+}
@@ -0,0 +1,283 @@
+package mpe
+
+import (
+	"sync"
+
+	"github.com/jaz303/midi/ump"
+)
+
+// NoteState is the expression state of a single sounding note.
+type NoteState struct {
+	Channel  uint8
+	Note     uint8
+	Velocity uint8
+
+	// Set when the note ends
+	ReleaseVelocity uint8
+
+	Bend     uint16 // 14-bit; 0x2000 is centre
+	Pressure uint8
+	Timbre   uint8
+
+	// Pitch bend in semitones, scaled by the channel's bend range
+	BendSemitones float64
+}
+
+// EventKind identifies the change reported by an Event.
+type EventKind int
+
+const (
+	NoteStarted = EventKind(1 + iota)
+	NoteChanged
+	NoteEnded
+	ZoneChanged
+)
+
+// Event describes a change in per-note state. For ZoneChanged events, Note
+// is nil and Zone holds the new configuration.
+type Event struct {
+	Kind EventKind
+	Note *NoteState
+	Zone *Zone
+}
+
+type inChannel struct {
+	// expression received with no note sounding becomes the initial
+	// state of the next note
+	bend     uint16
+	pressure uint8
+	timbre   uint8
+
+	bendRange uint8
+	rpn       [2]uint8
+	notes     []*NoteState
+}
+
+// Input collects per-channel pitch bend, pressure and timbre from an MPE
+// stream into per-note expression state.
+//
+// Zones are configured by MPE Configuration Messages received on the
+// stream, or explicitly with SetZone. Messages outside a zone's member
+// channels are ignored, except for manager-channel configuration.
+//
+// Input is safe for concurrent use. OnEvent, if set, is called with the
+// lock held and must not call back into the Input.
+type Input struct {
+	group uint8
+
+	mu       sync.Mutex
+	lower    Zone
+	upper    Zone
+	channels [16]inChannel
+
+	OnEvent func(evt *Event)
+}
+
+// NewInput returns an Input that tracks messages on group. No zones are
+// active until configured.
+func NewInput(group uint8) *Input {
+	in := &Input{group: group, upper: Zone{Upper: true}}
+	for i := range in.channels {
+		in.channels[i] = inChannel{bend: 0x2000, timbre: 64, rpn: [2]uint8{rpnNull, rpnNull}}
+	}
+	return in
+}
+
+// SetZone configures a zone as if an MPE Configuration Message had been
+// received.
+func (in *Input) SetZone(z Zone) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.setZone(z)
+}
+
+func (in *Input) setZone(z Zone) {
+	z.Members = min(z.Members, maxZoneMembers)
+	if z.Upper {
+		in.upper = z
+		// lower zone shrinks to make room
+		in.lower.Members = min(in.lower.Members, 14-z.Members)
+	} else {
+		in.lower = z
+		in.upper.Members = min(in.upper.Members, 14-z.Members)
+	}
+	if in.lower.Members < 0 {
+		in.lower.Members = 0
+	}
+	if in.upper.Members < 0 {
+		in.upper.Members = 0
+	}
+	for _, zone := range []*Zone{&in.lower, &in.upper} {
+		for _, ch := range zone.MemberChannels() {
+			in.channels[ch].bendRange = zone.memberBendRange()
+		}
+	}
+	in.emit(&Event{Kind: ZoneChanged, Zone: &z})
+}
+
+// Zones returns the current lower and upper zones.
+func (in *Input) Zones() (lower, upper Zone) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.lower, in.upper
+}
+
+// Notes returns a copy of the state of every sounding note.
+func (in *Input) Notes() []NoteState {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	var out []NoteState
+	for i := range in.channels {
+		for _, n := range in.channels[i].notes {
+			out = append(out, *n)
+		}
+	}
+	return out
+}
+
+// Handle processes received messages. Only MIDI 1.0 channel voice
+// messages on the Input's group are considered.
+func (in *Input) Handle(words []ump.Word) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+
+	for len(words) > 0 {
+		msg, rest := ump.Next(words)
+		if msg == nil {
+			return
+		}
+		words = rest
+
+		if ump.MessageType(msg[0]) == ump.MsgTypeMIDIv1 && ump.Group(msg[0]) == in.group {
+			in.handle(msg[0])
+		}
+	}
+}
+
+func (in *Input) member(channel uint8) bool {
+	return in.lower.Contains(channel) || in.upper.Contains(channel)
+}
+
+func (in *Input) handle(w ump.Word) {
+	channel := ump.Channel(w)
+	ch := &in.channels[channel]
+	d1, d2 := uint8(w>>8)&0x7F, uint8(w)&0x7F
+
+	if ump.Opcode(w) == ump.OpControlChange {
+		switch d1 {
+		case rpnMSB:
+			ch.rpn[0] = d2
+			return
+		case rpnLSB:
+			ch.rpn[1] = d2
+			return
+		case dataEntryMSB:
+			in.dataEntry(channel, d2)
+			return
+		}
+	}
+
+	if !in.member(channel) {
+		return
+	}
+
+	switch ump.Opcode(w) {
+	case ump.OpNoteOn:
+		if d2 == 0 {
+			in.noteOff(ch, d1, 64)
+			return
+		}
+		n := &NoteState{
+			Channel:  channel,
+			Note:     d1,
+			Velocity: d2,
+			Bend:     ch.bend,
+			Pressure: ch.pressure,
+			Timbre:   ch.timbre,
+		}
+		n.BendSemitones = bendSemitones(n.Bend, ch.bendRange)
+		ch.notes = append(ch.notes, n)
+		in.emit(&Event{Kind: NoteStarted, Note: n})
+	case ump.OpNoteOff:
+		in.noteOff(ch, d1, d2)
+	case ump.OpPitchBend:
+		ch.bend = uint16(d1) | uint16(d2)<<7
+		in.update(ch, func(n *NoteState) {
+			n.Bend = ch.bend
+			n.BendSemitones = bendSemitones(n.Bend, ch.bendRange)
+		})
+	case ump.OpChannelPressure:
+		ch.pressure = d1
+		in.update(ch, func(n *NoteState) { n.Pressure = d1 })
+	case ump.OpControlChange:
+		if d1 == Timbre {
+			ch.timbre = d2
+			in.update(ch, func(n *NoteState) { n.Timbre = d2 })
+		}
+	}
+}
+
+func (in *Input) dataEntry(channel uint8, value uint8) {
+	ch := &in.channels[channel]
+	if ch.rpn[0] != 0 {
+		return
+	}
+
+	switch ch.rpn[1] {
+	case rpnMCM:
+		switch channel {
+		case 0:
+			z := in.lower
+			z.Members = int(value)
+			in.setZone(z)
+		case 15:
+			z := in.upper
+			z.Members = int(value)
+			in.setZone(z)
+		}
+	case rpnPitchBend:
+		ch.bendRange = value
+		// bend range sent to a member channel applies to the whole zone
+		for _, zone := range []*Zone{&in.lower, &in.upper} {
+			if zone.Contains(channel) {
+				zone.MemberBendRange = value
+				for _, m := range zone.MemberChannels() {
+					in.channels[m].bendRange = value
+				}
+			} else if zone.Members > 0 && channel == zone.Manager() {
+				zone.ManagerBendRange = value
+			}
+		}
+	}
+}
+
+func (in *Input) noteOff(ch *inChannel, note uint8, velocity uint8) {
+	for i, n := range ch.notes {
+		if n.Note == note {
+			n.ReleaseVelocity = velocity
+			ch.notes = append(ch.notes[:i], ch.notes[i+1:]...)
+			in.emit(&Event{Kind: NoteEnded, Note: n})
+			return
+		}
+	}
+}
+
+func (in *Input) update(ch *inChannel, fn func(*NoteState)) {
+	for _, n := range ch.notes {
+		fn(n)
+		in.emit(&Event{Kind: NoteChanged, Note: n})
+	}
+}
+
+func (in *Input) emit(evt *Event) {
+	if in.OnEvent != nil {
+		in.OnEvent(evt)
+	}
+}
+
+func bendSemitones(bend uint16, bendRange uint8) float64 {
+	if bendRange == 0 {
+		bendRange = DefaultMemberBendRange
+	}
+	return float64(int(bend)-0x2000) / 8192 * float64(bendRange)
+}
@@ -0,0 +1,133 @@
+// Package mpe implements MIDI Polyphonic Expression zone configuration,
+// per-note channel allocation for output and per-note expression tracking
+// for input, using MIDI 1.0 (type 2) UMP messages.
+package mpe
+
+import (
+	"errors"
+
+	"github.com/jaz303/midi/ump"
+)
+
+const (
+	// Timbre is the controller carrying MPE's third dimension of expression
+	Timbre = 74
+
+	DefaultMemberBendRange  = 48
+	DefaultManagerBendRange = 2
+
+	rpnMSB         = 101
+	rpnLSB         = 100
+	dataEntryMSB   = 6
+	dataEntryLSB   = 38
+	rpnPitchBend   = 0
+	rpnMCM         = 6
+	rpnNull        = 127
+	nrpnMSB        = 99
+	nrpnLSB        = 98
+	maxZoneMembers = 15
+)
+
+var (
+	ErrNoChannel   = errors.New("no member channel available")
+	ErrNoZone      = errors.New("zone has no member channels")
+	ErrUnknownNote = errors.New("unknown note")
+)
+
+// Zone describes an MPE zone. The lower zone is managed by channel 1 (0)
+// and its members count up from channel 2; the upper zone is managed by
+// channel 16 (15) and its members count down from channel 15.
+type Zone struct {
+	Upper   bool
+	Members int // 0-15; 0 disables the zone
+
+	// Pitch bend ranges in semitones; DefaultMemberBendRange and
+	// DefaultManagerBendRange if zero.
+	MemberBendRange  uint8
+	ManagerBendRange uint8
+}
+
+var (
+	// LowerZone uses every channel other than the manager as a member.
+	LowerZone = Zone{Members: maxZoneMembers}
+
+	// UpperZone uses every channel other than the manager as a member.
+	UpperZone = Zone{Upper: true, Members: maxZoneMembers}
+)
+
+// Manager returns the zone's manager channel (0 or 15).
+func (z *Zone) Manager() uint8 {
+	if z.Upper {
+		return 15
+	}
+	return 0
+}
+
+// MemberChannels returns the zone's member channels, starting nearest the
+// manager channel.
+func (z *Zone) MemberChannels() []uint8 {
+	out := make([]uint8, 0, z.Members)
+	for i := 1; i <= min(z.Members, maxZoneMembers); i++ {
+		if z.Upper {
+			out = append(out, uint8(15-i))
+		} else {
+			out = append(out, uint8(i))
+		}
+	}
+	return out
+}
+
+// Contains reports whether channel is a member channel of the zone.
+func (z *Zone) Contains(channel uint8) bool {
+	if z.Members == 0 {
+		return false
+	}
+	if z.Upper {
+		return channel < 15 && int(15-channel) <= z.Members
+	}
+	return channel > 0 && int(channel) <= z.Members
+}
+
+func (z *Zone) memberBendRange() uint8 {
+	if z.MemberBendRange == 0 {
+		return DefaultMemberBendRange
+	}
+	return z.MemberBendRange
+}
+
+func (z *Zone) managerBendRange() uint8 {
+	if z.ManagerBendRange == 0 {
+		return DefaultManagerBendRange
+	}
+	return z.ManagerBendRange
+}
+
+// Configure appends the messages that set up the zone on a receiver to dst:
+// the MPE Configuration Message (RPN 6) on the manager channel, followed by
+// pitch bend sensitivity (RPN 0) for the manager and every member channel.
+func (z *Zone) Configure(dst []ump.Word, group uint8) []ump.Word {
+	dst = appendRPN(dst, group, z.Manager(), rpnMCM, uint8(min(z.Members, maxZoneMembers)))
+	if z.Members == 0 {
+		return dst
+	}
+	dst = appendRPN(dst, group, z.Manager(), rpnPitchBend, z.managerBendRange())
+	for _, ch := range z.MemberChannels() {
+		dst = appendRPN(dst, group, ch, rpnPitchBend, z.memberBendRange())
+	}
+	return dst
+}
+
+func withGroup(group uint8, w ump.Word) ump.Word {
+	return w | ump.Word(group&0x0F)<<24
+}
+
+func appendRPN(dst []ump.Word, group uint8, channel uint8, rpn uint8, value uint8) []ump.Word {
+	return append(dst,
+		withGroup(group, ump.ControlChange(channel, rpnMSB, 0)),
+		withGroup(group, ump.ControlChange(channel, rpnLSB, int8(rpn))),
+		withGroup(group, ump.ControlChange(channel, dataEntryMSB, int8(value))),
+		withGroup(group, ump.ControlChange(channel, dataEntryLSB, 0)),
+		withGroup(group, ump.ControlChange(channel, rpnMSB, rpnNull)),
+		withGroup(group, ump.ControlChange(channel, rpnLSB, rpnNull)),
+	)
+}
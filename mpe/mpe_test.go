@@ -0,0 +1,395 @@
+package mpe
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+// recorder is a driver that records the words sent to it.
+type recorder struct {
+	midi.Driver
+	sent []ump.Word
+}
+
+func (r *recorder) Send(_ time.Time, _ midi.Entity, words []ump.Word) error {
+	r.sent = append(r.sent, words...)
+	return nil
+}
+
+func assertWords(t *testing.T, got []ump.Word, want ...ump.Word) {
+	t.Helper()
+	if len(got) != len(want) || (len(got) > 0 && !reflect.DeepEqual(got, want)) {
+		t.Errorf("got  %08X\nwant %08X", got, want)
+	}
+}
+
+// rpn returns the messages that set an RPN, as written by appendRPN.
+func rpn(group, channel, number, value uint8) []ump.Word {
+	cc := func(index, value uint8) ump.Word {
+		return withGroup(group, ump.ControlChange(channel, int8(index), int8(value)))
+	}
+	return []ump.Word{
+		cc(rpnMSB, 0), cc(rpnLSB, number), cc(dataEntryMSB, value), cc(dataEntryLSB, 0),
+		cc(rpnMSB, rpnNull), cc(rpnLSB, rpnNull),
+	}
+}
+
+// v2 flattens MIDI 2.0 messages into one list of words.
+func v2(msgs ...[2]ump.Word) []ump.Word {
+	var out []ump.Word
+	for _, m := range msgs {
+		out = append(out, m[:]...)
+	}
+	return out
+}
+
+func concat(lists ...[]ump.Word) []ump.Word {
+	var out []ump.Word
+	for _, l := range lists {
+		out = append(out, l...)
+	}
+	return out
+}
+
+func TestZone(t *testing.T) {
+	tests := []struct {
+		name    string
+		zone    Zone
+		manager uint8
+		members []uint8
+	}{
+		{"disabled", Zone{}, 0, []uint8{}},
+		{"lower", Zone{Members: 3}, 0, []uint8{1, 2, 3}},
+		{"upper", Zone{Upper: true, Members: 3}, 15, []uint8{14, 13, 12}},
+		{"whole lower", LowerZone, 0, []uint8{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}},
+		{"too many members", Zone{Upper: true, Members: 20}, 15, []uint8{14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 3, 2, 1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if m := tt.zone.Manager(); m != tt.manager {
+				t.Errorf("Manager = %d, want %d", m, tt.manager)
+			}
+			members := tt.zone.MemberChannels()
+			if !reflect.DeepEqual(members, tt.members) {
+				t.Errorf("MemberChannels = %v, want %v", members, tt.members)
+			}
+			for ch := uint8(0); ch < 16; ch++ {
+				want := false
+				for _, m := range members {
+					want = want || m == ch
+				}
+				if got := tt.zone.Contains(ch); got != want {
+					t.Errorf("Contains(%d) = %v, want %v", ch, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	tests := []struct {
+		name string
+		zone Zone
+		want []ump.Word
+	}{
+		{"disabled", Zone{Upper: true}, rpn(1, 15, rpnMCM, 0)},
+		{
+			"default ranges",
+			Zone{Members: 2},
+			concat(rpn(1, 0, rpnMCM, 2), rpn(1, 0, rpnPitchBend, 2), rpn(1, 1, rpnPitchBend, 48), rpn(1, 2, rpnPitchBend, 48)),
+		},
+		{
+			"custom ranges",
+			Zone{Upper: true, Members: 1, MemberBendRange: 12, ManagerBendRange: 7},
+			concat(rpn(1, 15, rpnMCM, 1), rpn(1, 15, rpnPitchBend, 7), rpn(1, 14, rpnPitchBend, 12)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertWords(t, tt.zone.Configure(nil, 1), tt.want...)
+		})
+	}
+}
+
+func TestInput(t *testing.T) {
+	in := NewInput(0)
+	var events []EventKind
+	var last NoteState
+	in.OnEvent = func(evt *Event) {
+		events = append(events, evt.Kind)
+		if evt.Note != nil {
+			last = *evt.Note
+		}
+	}
+
+	// the zone is configured from the stream
+	zone := Zone{Members: 3}
+	in.Handle(zone.Configure(nil, 0))
+	lower, upper := in.Zones()
+	if lower.Members != 3 || upper.Members != 0 || lower.ManagerBendRange != 2 {
+		t.Errorf("zones = %+v, %+v", lower, upper)
+	}
+
+	in.Handle([]ump.Word{
+		ump.PitchBend(1, 0x3000), // before the note: its initial bend
+		ump.NoteOn(1, 60, 100),
+		ump.NoteOn(5, 62, 100),         // not a member channel
+		1<<24 | ump.NoteOn(2, 64, 100), // another group
+	})
+	notes := in.Notes()
+	if len(notes) != 1 || notes[0].Channel != 1 || notes[0].Bend != 0x3000 || notes[0].BendSemitones != 24 {
+		t.Fatalf("notes = %+v", notes)
+	}
+
+	in.Handle([]ump.Word{
+		ump.ChannelPressure(1, 50),
+		ump.ControlChange(1, Timbre, 10),
+		ump.ChannelPressure(2, 90), // no note on the channel
+	})
+	if last.Pressure != 50 || last.Timbre != 10 {
+		t.Errorf("note after expression = %+v", last)
+	}
+
+	// a bend range sent to one member applies to the whole zone
+	in.Handle(concat(
+		appendRPN(nil, 0, 2, rpnPitchBend, 12),
+		[]ump.Word{ump.PitchBend(1, 0x3000)},
+	))
+	if lower, _ := in.Zones(); lower.MemberBendRange != 12 || last.BendSemitones != 6 {
+		t.Errorf("member bend range %d, note bend %v semitones", lower.MemberBendRange, last.BendSemitones)
+	}
+
+	in.Handle([]ump.Word{ump.NoteOn(1, 60, 0)})
+	if len(in.Notes()) != 0 || last.ReleaseVelocity != 64 {
+		t.Errorf("after note on with velocity 0: notes %v, release %d", in.Notes(), last.ReleaseVelocity)
+	}
+
+	want := []EventKind{ZoneChanged, NoteStarted, NoteChanged, NoteChanged, NoteChanged, NoteEnded}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
+
+func TestInputZones(t *testing.T) {
+	tests := []struct {
+		name         string
+		zones        []Zone
+		lower, upper int
+	}{
+		{"lower", []Zone{{Members: 7}}, 7, 0},
+		{"both", []Zone{{Members: 7}, {Upper: true, Members: 7}}, 7, 7},
+		{"upper shrinks lower", []Zone{{Members: 10}, {Upper: true, Members: 7}}, 7, 7},
+		{"lower shrinks upper", []Zone{{Upper: true, Members: 10}, {Members: 14}}, 14, 0},
+		{"whole", []Zone{UpperZone, LowerZone}, 15, 0},
+		{"disable", []Zone{LowerZone, {}}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := NewInput(0)
+			for _, z := range tt.zones {
+				in.SetZone(z)
+			}
+			lower, upper := in.Zones()
+			if lower.Members != tt.lower || upper.Members != tt.upper {
+				t.Errorf("members = %d, %d; want %d, %d", lower.Members, upper.Members, tt.lower, tt.upper)
+			}
+		})
+	}
+}
+
+func TestOutputSteal(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy StealPolicy
+		err    error
+		stolen int // index of the note stolen by the third
+		want   []ump.Word
+	}{
+		{"oldest", StealOldest, nil, 0, []ump.Word{ump.NoteOff(1, 60, 0), ump.NoteOn(1, 64, 80)}},
+		{"quietest", StealQuietest, nil, 1, []ump.Word{ump.NoteOff(2, 62, 0), ump.NoteOn(2, 64, 80)}},
+		{"none", StealNone, ErrNoChannel, -1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &recorder{}
+			o := NewOutput(d, 1, 0, Zone{Members: 2}, tt.policy)
+
+			a, _ := o.NoteOn(time.Time{}, 60, 100)
+			b, _ := o.NoteOn(time.Time{}, 62, 50)
+			d.sent = nil
+
+			c, err := o.NoteOn(time.Time{}, 64, 80)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("NoteOn = %v, want %v", err, tt.err)
+			}
+			assertWords(t, d.sent, tt.want...)
+			if tt.stolen < 0 {
+				return
+			}
+
+			stolen := []NoteID{a, b}[tt.stolen]
+			if _, ok := o.Channel(stolen); ok {
+				t.Error("stolen note still has a channel")
+			}
+			if ch, _ := o.Channel(c); ch != uint8(tt.stolen+1) {
+				t.Errorf("new note on channel %d", ch)
+			}
+
+			// ending the stolen note sends nothing
+			d.sent = nil
+			if err := o.NoteOff(time.Time{}, stolen, 0); err != nil {
+				t.Fatal(err)
+			}
+			assertWords(t, d.sent)
+		})
+	}
+}
+
+func TestOutput(t *testing.T) {
+	d := &recorder{}
+	o := NewOutput(d, 1, 3, Zone{Upper: true, Members: 2}, StealOldest)
+	now := time.Time{}
+
+	a, _ := o.NoteOn(now, 60, 100)
+	b, _ := o.NoteOn(now, 62, 100)
+	o.PitchBend(now, a, 0x3000)
+	o.SetTimbre(now, a, 10)
+	o.Pressure(now, b, 40)
+	o.Manager(now, []ump.Word{ump.ControlChange(4, 7, 100)})
+	o.NoteOff(now, a, 20)
+	o.NoteOff(now, b, 20)
+
+	// the channel released first is reused, and reset before the note
+	o.NoteOn(now, 64, 100)
+
+	g := func(w ump.Word) ump.Word { return withGroup(3, w) }
+	assertWords(t, d.sent,
+		g(ump.NoteOn(14, 60, 100)),
+		g(ump.NoteOn(13, 62, 100)),
+		g(ump.PitchBend(14, 0x3000)),
+		g(ump.ControlChange(14, Timbre, 10)),
+		g(ump.ChannelPressure(13, 40)),
+		g(ump.ControlChange(15, 7, 100)),
+		g(ump.NoteOff(14, 60, 20)),
+		g(ump.NoteOff(13, 62, 20)),
+		g(ump.PitchBend(14, 0x2000)),
+		g(ump.ControlChange(14, Timbre, 64)),
+		g(ump.NoteOn(14, 64, 100)),
+	)
+
+	if err := o.Pressure(now, a, 1); !errors.Is(err, ErrUnknownNote) {
+		t.Errorf("Pressure of ended note = %v, want %v", err, ErrUnknownNote)
+	}
+	none := NewOutput(d, 1, 0, Zone{}, StealOldest)
+	if _, err := none.NoteOn(now, 60, 100); !errors.Is(err, ErrNoZone) {
+		t.Errorf("NoteOn with no members = %v, want %v", err, ErrNoZone)
+	}
+}
+
+func TestToMIDI2(t *testing.T) {
+	steps := []struct {
+		words []ump.Word
+		want  []ump.Word
+	}{
+		{
+			[]ump.Word{ump.PitchBend(1, 0x3000), ump.NoteOn(1, 60, 64)},
+			v2(
+				ump.PerNoteManagement(0, 0, 60, 1),
+				ump.NoteOnV2(0, 0, 60, 32768),
+				ump.PerNotePitchBend(0, 0, 60, 0xC0000000),
+			),
+		},
+		{
+			[]ump.Word{ump.ChannelPressure(1, 64), ump.ControlChange(1, Timbre, 32)},
+			v2(
+				ump.PolyPressureV2(0, 0, 60, 0x80000000),
+				ump.RegisteredPerNoteController(0, 0, 60, RegisteredTimbre, 0x40000000),
+			),
+		},
+		{
+			// the same note number on another member ends the first
+			[]ump.Word{ump.NoteOn(2, 60, 64)},
+			v2(
+				ump.NoteOffV2(0, 0, 60, 0),
+				ump.PerNoteManagement(0, 0, 60, 1),
+				ump.NoteOnV2(0, 0, 60, 32768),
+			),
+		},
+		{[]ump.Word{ump.ChannelPressure(1, 100), ump.NoteOff(1, 60, 0)}, nil},
+		{[]ump.Word{ump.NoteOff(2, 60, 64)}, v2(ump.NoteOffV2(0, 0, 60, 32768))},
+		{
+			append(appendRPN(nil, 0, 0, rpnPitchBend, 12), ump.ControlChange(0, 7, 127), ump.ProgramChange(0, 5)),
+			v2(ump.ControlChangeV2(0, 0, 7, 0xFFFFFFFF), ump.ProgramChangeV2(0, 0, 5)),
+		},
+		{[]ump.Word{1<<24 | ump.NoteOn(1, 60, 64), ump.Clock}, nil},
+	}
+
+	tr := NewToMIDI2(0, LowerZone, 0)
+	for i, step := range steps {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			assertWords(t, tr.Translate(nil, step.words), step.want...)
+		})
+	}
+}
+
+func TestFromMIDI2(t *testing.T) {
+	steps := []struct {
+		words []ump.Word
+		want  []ump.Word
+	}{
+		{
+			v2(
+				ump.NoteOnV2(0, 0, 60, 32768),
+				ump.PerNotePitchBend(0, 0, 60, 0xC0000000),
+				ump.PolyPressureV2(0, 0, 60, 2147483648),
+				ump.RegisteredPerNoteController(0, 0, 60, RegisteredTimbre, 1073741824),
+				ump.RegisteredPerNoteController(0, 0, 60, 1, 1073741824),
+			),
+			[]ump.Word{
+				ump.NoteOn(1, 60, 64),
+				ump.PitchBend(1, 0x3000),
+				ump.ChannelPressure(1, 64),
+				ump.ControlChange(1, Timbre, 32),
+			},
+		},
+		{
+			// a repeated note number ends the sounding note first
+			v2(ump.NoteOnV2(0, 0, 60, 0), ump.NoteOffV2(0, 0, 60, 0)),
+			[]ump.Word{ump.NoteOff(1, 60, 0), ump.NoteOn(2, 60, 1), ump.NoteOff(2, 60, 0)},
+		},
+		{
+			v2(ump.NoteOffV2(0, 0, 60, 0), ump.PolyPressureV2(0, 0, 60, 1)),
+			nil,
+		},
+		{
+			v2(ump.ControlChangeV2(0, 0, 7, 0xFFFFFFFF), ump.NoteOnV2(0, 1, 60, 32768), ump.NoteOnV2(1, 0, 60, 32768)),
+			[]ump.Word{ump.ControlChange(0, 7, 127)},
+		},
+		{
+			// the reused channel is reset first
+			v2(ump.NoteOnV2(0, 0, 62, 32768)),
+			[]ump.Word{
+				ump.PitchBend(1, 0x2000),
+				ump.ControlChange(1, Timbre, 64),
+				ump.ChannelPressure(1, 0),
+				ump.NoteOn(1, 62, 64),
+			},
+		},
+	}
+
+	f := NewFromMIDI2(0, 0, Zone{Members: 2}, StealOldest)
+	assertWords(t, f.Configure(nil), concat(
+		rpn(0, 0, rpnMCM, 2), rpn(0, 0, rpnPitchBend, 2), rpn(0, 1, rpnPitchBend, 48), rpn(0, 2, rpnPitchBend, 48),
+	)...)
+	for i, step := range steps {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			assertWords(t, f.Translate(nil, step.words), step.want...)
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package mpe
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+// StealPolicy determines what happens when a note is started and every
+// member channel is in use.
+type StealPolicy int
+
+const (
+	// StealOldest ends the longest-sounding note and reuses its channel.
+	StealOldest = StealPolicy(iota)
+
+	// StealQuietest ends the note with the lowest velocity, preferring
+	// the oldest among equals.
+	StealQuietest
+
+	// StealNone refuses the new note with ErrNoChannel.
+	StealNone
+)
+
+// NoteID identifies a note started by an Output. IDs are never reused.
+type NoteID uint64
+
+type outChannel struct {
+	channel  uint8
+	note     NoteID // 0 if free
+	key      uint8
+	velocity uint8
+	started  uint64 // allocation sequence number
+	released uint64 // release sequence number, for round-robin reuse
+
+	// last expression values sent on the channel
+	bend     uint16
+	pressure uint8
+	timbre   uint8
+}
+
+// allocator assigns member channels to notes and builds the messages that
+// play them. It is shared by Output and FromMIDI2.
+type allocator struct {
+	group  uint8
+	zone   Zone
+	policy StealPolicy
+
+	channels []*outChannel
+	notes    map[NoteID]*outChannel
+	seq      uint64
+	nextID   NoteID
+}
+
+func newAllocator(group uint8, zone Zone, policy StealPolicy) allocator {
+	a := allocator{
+		group:  group,
+		zone:   zone,
+		policy: policy,
+		notes:  map[NoteID]*outChannel{},
+	}
+	for _, ch := range zone.MemberChannels() {
+		a.channels = append(a.channels, &outChannel{channel: ch, bend: 0x2000, timbre: 64})
+	}
+	return a
+}
+
+// Output allocates a member channel to each note played into an MPE zone
+// and sends the resulting messages through a driver.
+//
+// Output is safe for concurrent use.
+type Output struct {
+	driver midi.Driver
+	entity midi.Entity
+
+	mu sync.Mutex
+	allocator
+}
+
+// NewOutput creates an Output that sends to entity on the given group.
+func NewOutput(driver midi.Driver, entity midi.Entity, group uint8, zone Zone, policy StealPolicy) *Output {
+	return &Output{
+		driver:    driver,
+		entity:    entity,
+		allocator: newAllocator(group, zone, policy),
+	}
+}
+
+// Zone returns the zone being played.
+func (o *Output) Zone() Zone {
+	return o.zone
+}
+
+// Configure sends the zone configuration to the receiver.
+func (o *Output) Configure(t time.Time) error {
+	return o.driver.Send(t, o.entity, o.zone.Configure(nil, o.group))
+}
+
+// NoteOn allocates a member channel and starts a note on it. Before the note
+// on, the channel's pitch bend, pressure and timbre are reset to centre,
+// zero and 64 if they were left elsewhere by a previous note. If a note has
+// to be stolen it is ended first.
+func (o *Output) NoteOn(t time.Time, note, velocity uint8) (NoteID, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	words, id, err := o.noteOn(nil, note, velocity)
+	if err != nil {
+		return 0, err
+	}
+	return id, o.driver.Send(t, o.entity, words)
+}
+
+func (a *allocator) noteOn(dst []ump.Word, note, velocity uint8) ([]ump.Word, NoteID, error) {
+	if len(a.channels) == 0 {
+		return dst, 0, ErrNoZone
+	}
+
+	ch := a.allocate()
+	if ch == nil {
+		return dst, 0, ErrNoChannel
+	}
+
+	if ch.note != 0 {
+		dst = append(dst, a.word(ump.NoteOff(ch.channel, int8(ch.key), 0)))
+		delete(a.notes, ch.note)
+	}
+	if ch.bend != 0x2000 {
+		ch.bend = 0x2000
+		dst = append(dst, a.word(ump.PitchBend(ch.channel, ch.bend)))
+	}
+	if ch.timbre != 64 {
+		ch.timbre = 64
+		dst = append(dst, a.word(ump.ControlChange(ch.channel, Timbre, 64)))
+	}
+	if ch.pressure != 0 {
+		ch.pressure = 0
+		dst = append(dst, a.word(ump.ChannelPressure(ch.channel, 0)))
+	}
+	dst = append(dst, a.word(ump.NoteOn(ch.channel, int8(note&0x7F), int8(velocity&0x7F))))
+
+	a.seq++
+	a.nextID++
+	ch.note = a.nextID
+	ch.key = note & 0x7F
+	ch.velocity = velocity
+	ch.started = a.seq
+	a.notes[ch.note] = ch
+
+	return dst, ch.note, nil
+}
+
+// allocate picks a channel for a new note: the free channel released
+// longest ago, or a channel to steal according to the policy.
+func (a *allocator) allocate() *outChannel {
+	var best *outChannel
+	for _, ch := range a.channels {
+		if ch.note == 0 && (best == nil || ch.released < best.released) {
+			best = ch
+		}
+	}
+	if best != nil {
+		return best
+	}
+
+	for _, ch := range a.channels {
+		switch a.policy {
+		case StealOldest:
+			if best == nil || ch.started < best.started {
+				best = ch
+			}
+		case StealQuietest:
+			if best == nil || ch.velocity < best.velocity || (ch.velocity == best.velocity && ch.started < best.started) {
+				best = ch
+			}
+		}
+	}
+	return best
+}
+
+// NoteOff ends a note. It is not an error to end a note that has already
+// been stolen; nothing is sent.
+func (o *Output) NoteOff(t time.Time, id NoteID, velocity uint8) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	words := o.noteOff(nil, id, velocity)
+	if len(words) == 0 {
+		return nil
+	}
+	return o.driver.Send(t, o.entity, words)
+}
+
+func (a *allocator) noteOff(dst []ump.Word, id NoteID, velocity uint8) []ump.Word {
+	ch, ok := a.notes[id]
+	if !ok {
+		return dst
+	}
+	delete(a.notes, id)
+
+	a.seq++
+	ch.note = 0
+	ch.released = a.seq
+
+	return append(dst, a.word(ump.NoteOff(ch.channel, int8(ch.key), int8(velocity&0x7F))))
+}
+
+// PitchBend sends a 14-bit pitch bend (0x2000 is centre) for a note.
+func (o *Output) PitchBend(t time.Time, id NoteID, value uint16) error {
+	return o.expression(t, id, func(ch *outChannel) ump.Word {
+		ch.bend = value & 0x3FFF
+		return ump.PitchBend(ch.channel, ch.bend)
+	})
+}
+
+// Pressure sends channel pressure for a note.
+func (o *Output) Pressure(t time.Time, id NoteID, value uint8) error {
+	return o.expression(t, id, func(ch *outChannel) ump.Word {
+		ch.pressure = value & 0x7F
+		return ump.ChannelPressure(ch.channel, int8(ch.pressure))
+	})
+}
+
+// SetTimbre sends the timbre controller (CC74) for a note.
+func (o *Output) SetTimbre(t time.Time, id NoteID, value uint8) error {
+	return o.expression(t, id, func(ch *outChannel) ump.Word {
+		ch.timbre = value & 0x7F
+		return ump.ControlChange(ch.channel, Timbre, int8(ch.timbre))
+	})
+}
+
+func (o *Output) expression(t time.Time, id NoteID, fn func(*outChannel) ump.Word) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	ch, ok := o.notes[id]
+	if !ok {
+		return ErrUnknownNote
+	}
+	return o.driver.Send(t, o.entity, []ump.Word{o.word(fn(ch))})
+}
+
+// manager rewrites the channel of a channel voice message to the zone's
+// manager channel.
+func (a *allocator) manager(w ump.Word) ump.Word {
+	return a.word(w&^(0x0F<<24|0x0F<<16) | ump.Word(a.zone.Manager())<<16)
+}
+
+// Manager sends messages on the zone's manager channel, which apply to
+// every note in the zone. Each word's channel and group are replaced.
+func (o *Output) Manager(t time.Time, words []ump.Word) error {
+	out := make([]ump.Word, len(words))
+	for i, w := range words {
+		out[i] = o.manager(w)
+	}
+	return o.driver.Send(t, o.entity, out)
+}
+
+// Channel returns the member channel currently playing a note.
+func (o *Output) Channel(id NoteID) (uint8, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if ch, ok := o.notes[id]; ok {
+		return ch.channel, true
+	}
+	return 0, false
+}
+
+func (a *allocator) word(w ump.Word) ump.Word {
+	return withGroup(a.group, w)
+}
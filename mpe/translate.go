@@ -0,0 +1,313 @@
+package mpe
+
+import (
+	"math"
+
+	"github.com/jaz303/midi/ump"
+)
+
+const (
+	// DefaultPerNoteBendRange is the per-note pitch bend range, in
+	// semitones, assumed for MIDI 2.0 per-note pitch bend.
+	DefaultPerNoteBendRange = 48
+
+	// RegisteredTimbre is the registered per-note controller carrying
+	// timbre in MIDI 2.0 (sound controller 5, matching CC74).
+	RegisteredTimbre = 74
+
+	bendCentre32 = 0x80000000
+)
+
+// ToMIDI2 translates an MPE stream into MIDI 2.0 (type 4) messages on a
+// single channel: member-channel pitch bend, pressure and timbre become
+// per-note pitch bend, poly pressure and registered per-note controller 74,
+// and manager-channel messages become channel-wide messages.
+//
+// Each note keeps its identity from note on to note off. MIDI 2.0 addresses
+// notes by number, so if two member channels sound the same note number at
+// once the older note is ended when the newer one starts, and any further
+// expression for it is dropped.
+//
+// RPN and NRPN sequences on the manager channel are consumed rather than
+// translated. ToMIDI2 is not safe for concurrent use.
+type ToMIDI2 struct {
+	// Per-note pitch bend range of the receiver in semitones;
+	// DefaultPerNoteBendRange if zero.
+	BendRange uint8
+
+	group   uint8
+	channel uint8
+	input   *Input
+	out     []ump.Word
+
+	// output note number of each sounding note
+	notes map[*NoteState]*toMIDI2Note
+	keys  [128]*NoteState
+}
+
+type toMIDI2Note struct {
+	key      uint8
+	bend     uint32
+	pressure uint8
+	timbre   uint8
+}
+
+// NewToMIDI2 returns a ToMIDI2 that reads MPE on group, with zone as the
+// initial zone configuration, and writes to channel on the same group.
+// MPE Configuration Messages in the stream update the zones.
+func NewToMIDI2(group uint8, zone Zone, channel uint8) *ToMIDI2 {
+	t := &ToMIDI2{
+		group:   group,
+		channel: channel & 0x0F,
+		input:   NewInput(group),
+		notes:   map[*NoteState]*toMIDI2Note{},
+	}
+	t.input.SetZone(zone)
+	t.input.OnEvent = t.event
+	return t
+}
+
+// Translate appends the translation of words to dst. Messages on other
+// groups, and messages outside any zone, are dropped.
+func (t *ToMIDI2) Translate(dst []ump.Word, words []ump.Word) []ump.Word {
+	t.out = dst
+	for len(words) > 0 {
+		msg, rest := ump.Next(words)
+		if msg == nil {
+			break
+		}
+		words = rest
+
+		if ump.MessageType(msg[0]) != ump.MsgTypeMIDIv1 || ump.Group(msg[0]) != t.group {
+			continue
+		}
+		if t.isManager(ump.Channel(msg[0])) {
+			t.manager(msg[0])
+		}
+		t.input.Handle(msg)
+	}
+	dst, t.out = t.out, nil
+	return dst
+}
+
+func (t *ToMIDI2) isManager(channel uint8) bool {
+	lower, upper := t.input.Zones()
+	return (lower.Members > 0 && channel == lower.Manager()) ||
+		(upper.Members > 0 && channel == upper.Manager())
+}
+
+func (t *ToMIDI2) manager(w ump.Word) {
+	d1, d2 := uint32(w>>8)&0x7F, uint32(w)&0x7F
+	var msg [2]ump.Word
+	switch ump.Opcode(w) {
+	case ump.OpControlChange:
+		switch d1 {
+		case rpnMSB, rpnLSB, dataEntryMSB, dataEntryLSB, nrpnMSB, nrpnLSB:
+			return
+		}
+		msg = ump.ControlChangeV2(t.group, t.channel, uint8(d1), ump.ScaleUp(d2, 7, 32))
+	case ump.OpChannelPressure:
+		msg = ump.ChannelPressureV2(t.group, t.channel, ump.ScaleUp(d1, 7, 32))
+	case ump.OpPitchBend:
+		msg = ump.PitchBendV2(t.group, t.channel, ump.ScaleUp(d1|d2<<7, 14, 32))
+	case ump.OpProgramChange:
+		msg = ump.ProgramChangeV2(t.group, t.channel, uint8(d1))
+	default:
+		return
+	}
+	t.out = append(t.out, msg[:]...)
+}
+
+func (t *ToMIDI2) event(evt *Event) {
+	switch evt.Kind {
+	case NoteStarted:
+		n := evt.Note
+		if old := t.keys[n.Note]; old != nil {
+			t.out = append(t.out, t.noteOff(old, 0)...)
+		}
+		s := &toMIDI2Note{key: n.Note, bend: bendCentre32, timbre: 64}
+		t.notes[n] = s
+		t.keys[n.Note] = n
+
+		// clear whatever a previous note with this number left behind
+		m := ump.PerNoteManagement(t.group, t.channel, n.Note, ump.PerNoteReset)
+		t.out = append(t.out, m[:]...)
+		on := ump.NoteOnV2(t.group, t.channel, n.Note, uint16(ump.ScaleUp(uint32(n.Velocity), 7, 16)))
+		t.out = append(t.out, on[:]...)
+		t.expression(n, s)
+	case NoteChanged:
+		if s, ok := t.notes[evt.Note]; ok {
+			t.expression(evt.Note, s)
+		}
+	case NoteEnded:
+		if _, ok := t.notes[evt.Note]; ok {
+			t.out = append(t.out, t.noteOff(evt.Note, evt.Note.ReleaseVelocity)...)
+		}
+	}
+}
+
+func (t *ToMIDI2) noteOff(n *NoteState, velocity uint8) []ump.Word {
+	s := t.notes[n]
+	delete(t.notes, n)
+	t.keys[s.key] = nil
+	off := ump.NoteOffV2(t.group, t.channel, s.key, uint16(ump.ScaleUp(uint32(velocity), 7, 16)))
+	return off[:]
+}
+
+// expression sends whichever of a note's dimensions differ from what was
+// last sent for it.
+func (t *ToMIDI2) expression(n *NoteState, s *toMIDI2Note) {
+	if bend := t.bend(n.BendSemitones); bend != s.bend {
+		s.bend = bend
+		m := ump.PerNotePitchBend(t.group, t.channel, s.key, bend)
+		t.out = append(t.out, m[:]...)
+	}
+	if n.Pressure != s.pressure {
+		s.pressure = n.Pressure
+		m := ump.PolyPressureV2(t.group, t.channel, s.key, ump.ScaleUp(uint32(n.Pressure), 7, 32))
+		t.out = append(t.out, m[:]...)
+	}
+	if n.Timbre != s.timbre {
+		s.timbre = n.Timbre
+		m := ump.RegisteredPerNoteController(t.group, t.channel, s.key, RegisteredTimbre, ump.ScaleUp(uint32(n.Timbre), 7, 32))
+		t.out = append(t.out, m[:]...)
+	}
+}
+
+func (t *ToMIDI2) bend(semitones float64) uint32 {
+	bendRange := t.BendRange
+	if bendRange == 0 {
+		bendRange = DefaultPerNoteBendRange
+	}
+	v := bendCentre32 + math.Round(semitones/float64(bendRange)*bendCentre32)
+	return uint32(max(0, min(v, math.MaxUint32)))
+}
+
+// FromMIDI2 translates MIDI 2.0 (type 4) per-note messages on a single
+// channel into an MPE stream for receivers that only understand MIDI 1.0.
+// Each note is given a member channel of the zone for its whole lifetime;
+// per-note pitch bend, poly pressure and registered per-note controller 74
+// become pitch bend, channel pressure and CC74 on that channel, and other
+// channel voice messages are sent on the manager channel.
+//
+// A note on for a note number that is already sounding ends the earlier
+// note first. Other per-note controllers and per-note management messages
+// are dropped. FromMIDI2 is not safe for concurrent use.
+type FromMIDI2 struct {
+	// Per-note pitch bend range of the sender in semitones;
+	// DefaultPerNoteBendRange if zero.
+	BendRange uint8
+
+	channel uint8
+	alloc   allocator
+	keys    [128]NoteID
+}
+
+// NewFromMIDI2 returns a FromMIDI2 that reads channel on group and writes
+// to zone on the same group, stealing channels according to policy.
+func NewFromMIDI2(group uint8, channel uint8, zone Zone, policy StealPolicy) *FromMIDI2 {
+	return &FromMIDI2{
+		channel: channel & 0x0F,
+		alloc:   newAllocator(group, zone, policy),
+	}
+}
+
+// Configure appends the zone configuration messages to dst.
+func (f *FromMIDI2) Configure(dst []ump.Word) []ump.Word {
+	return f.alloc.zone.Configure(dst, f.alloc.group)
+}
+
+// Translate appends the translation of words to dst. Messages on other
+// groups or channels are dropped, as are notes for which no member channel
+// could be allocated.
+func (f *FromMIDI2) Translate(dst []ump.Word, words []ump.Word) []ump.Word {
+	for len(words) > 0 {
+		msg, rest := ump.Next(words)
+		if msg == nil {
+			break
+		}
+		words = rest
+
+		if ump.MessageType(msg[0]) != ump.MsgTypeMIDIv2 ||
+			ump.Group(msg[0]) != f.alloc.group ||
+			ump.Channel(msg[0]) != f.channel {
+			continue
+		}
+		dst = f.translate(dst, msg)
+	}
+	return dst
+}
+
+func (f *FromMIDI2) translate(dst []ump.Word, msg []ump.Word) []ump.Word {
+	key := uint8(msg[0]>>8) & 0x7F
+	index := uint8(msg[0])
+	value := uint32(msg[1])
+
+	switch ump.Opcode(msg[0]) {
+	case ump.OpNoteOn:
+		if id := f.keys[key]; id != 0 {
+			dst = f.alloc.noteOff(dst, id, 0)
+		}
+		// MIDI 1.0 velocity 0 would be a note off
+		velocity := max(1, uint8(ump.ScaleDown(value>>16, 16, 7)))
+		var id NoteID
+		var err error
+		dst, id, err = f.alloc.noteOn(dst, key, velocity)
+		if err != nil {
+			id = 0
+		}
+		f.keys[key] = id
+	case ump.OpNoteOff:
+		if id := f.keys[key]; id != 0 {
+			f.keys[key] = 0
+			dst = f.alloc.noteOff(dst, id, uint8(ump.ScaleDown(value>>16, 16, 7)))
+		}
+	case ump.OpPerNotePitchBend:
+		dst = f.expression(dst, key, func(ch *outChannel) ump.Word {
+			ch.bend = f.bend(value)
+			return ump.PitchBend(ch.channel, ch.bend)
+		})
+	case ump.OpPolyPressure:
+		dst = f.expression(dst, key, func(ch *outChannel) ump.Word {
+			ch.pressure = uint8(ump.ScaleDown(value, 32, 7))
+			return ump.ChannelPressure(ch.channel, int8(ch.pressure))
+		})
+	case ump.OpRegisteredPerNoteController:
+		if index == RegisteredTimbre {
+			dst = f.expression(dst, key, func(ch *outChannel) ump.Word {
+				ch.timbre = uint8(ump.ScaleDown(value, 32, 7))
+				return ump.ControlChange(ch.channel, Timbre, int8(ch.timbre))
+			})
+		}
+	case ump.OpAssignablePerNoteController, ump.OpPerNoteManagement:
+	default:
+		var buf [8]ump.Word
+		out, ok := ump.ToMIDI1(buf[:0], msg)
+		if !ok {
+			break
+		}
+		for _, w := range out {
+			dst = append(dst, f.alloc.manager(w))
+		}
+	}
+	return dst
+}
+
+func (f *FromMIDI2) expression(dst []ump.Word, key uint8, fn func(*outChannel) ump.Word) []ump.Word {
+	ch, ok := f.alloc.notes[f.keys[key]]
+	if !ok {
+		return dst
+	}
+	return append(dst, f.alloc.word(fn(ch)))
+}
+
+// bend converts a per-note pitch bend to the member channels' bend range.
+func (f *FromMIDI2) bend(value uint32) uint16 {
+	bendRange := f.BendRange
+	if bendRange == 0 {
+		bendRange = DefaultPerNoteBendRange
+	}
+	semitones := (float64(value) - bendCentre32) / bendCentre32 * float64(bendRange)
+	v := 0x2000 + math.Round(semitones/float64(f.alloc.zone.memberBendRange())*0x2000)
+	return uint16(max(0, min(v, 0x3FFF)))
+}
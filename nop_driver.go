@@ -3,17 +3,30 @@ package midi
 import (
 	"errors"
 	"time"
+
+	"github.com/jaz303/midi/ump"
 )
 
 var ErrNotImplemeneted = errors.New("not implemented")
 
 type NopDriver struct{}
 
-func (d *NopDriver) Close() error                          { return nil }
-func (d *NopDriver) SetReceiveHandler(ReceiveEventHandler) {}
-func (d *NopDriver) OpenInput(Entity) error                { return ErrNotImplemeneted }
-func (d *NopDriver) OpenOutput(Entity) error               { return ErrNotImplemeneted }
-func (d *NopDriver) Send(time.Time, Entity, []Word) error  { return ErrNotImplemeneted }
-func (d *NopDriver) SendSysEx(Entity, []Word) error        { return ErrNotImplemeneted }
-func (d *NopDriver) SendSysExV1(Entity, []byte) error      { return ErrNotImplemeneted }
-func (d *NopDriver) Enumerate() (*Node, error)             { return nil, ErrNotImplemeneted }
+var _ Driver = (*NopDriver)(nil)
+
+func (d *NopDriver) Name() string                               { return "nop" }
+func (d *NopDriver) Close() error                               { return nil }
+func (d *NopDriver) SetReceiveHandler(ReceiveEventHandler)      {}
+func (d *NopDriver) SetNotificationHandler(NotificationHandler) {}
+func (d *NopDriver) OpenInput(Entity) error                     { return ErrNotImplemeneted }
+func (d *NopDriver) OpenOutput(Entity) error                    { return ErrNotImplemeneted }
+func (d *NopDriver) CloseInput(Entity) error                    { return ErrNotImplemeneted }
+func (d *NopDriver) CloseOutput(Entity) error                   { return ErrNotImplemeneted }
+func (d *NopDriver) Send(time.Time, Entity, []ump.Word) error   { return ErrNotImplemeneted }
+func (d *NopDriver) SendSysEx(Entity, []ump.Word) error         { return ErrNotImplemeneted }
+func (d *NopDriver) SendSysExV1(Entity, []byte) error           { return ErrNotImplemeneted }
+func (d *NopDriver) Enumerate() (*Node, error)                  { return nil, ErrNotImplemeneted }
+func (d *NopDriver) CreateVirtualInput(string) (Entity, error)  { return 0, ErrNotImplemeneted }
+func (d *NopDriver) CreateVirtualOutput(string) (Entity, error) { return 0, ErrNotImplemeneted }
+func (d *NopDriver) Connect(src, dst Entity) error              { return ErrNotImplemeneted }
+func (d *NopDriver) Disconnect(src, dst Entity) error           { return ErrNotImplemeneted }
+func (d *NopDriver) Connections() ([]Connection, error)         { return nil, ErrNotImplemeneted }
@@ -0,0 +1,218 @@
+package smf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/jaz303/midi/ump"
+)
+
+// Read parses a Standard MIDI File. Chunks other than MThd and MTrk are
+// skipped. SMPTE-based divisions are not supported.
+func Read(r io.Reader) (*File, error) {
+	br := bufio.NewReader(r)
+
+	id, body, err := readChunk(br)
+	if err != nil {
+		return nil, err
+	}
+	if id != "MThd" || len(body) < 6 {
+		return nil, fmt.Errorf("%w: missing header chunk", ErrInvalidFile)
+	}
+
+	f := &File{
+		Format: Format(binary.BigEndian.Uint16(body[0:])),
+		PPQN:   binary.BigEndian.Uint16(body[4:]),
+	}
+	if f.PPQN&0x8000 != 0 {
+		return nil, fmt.Errorf("%w: SMPTE time division is not supported", ErrInvalidFile)
+	}
+
+	trackCount := int(binary.BigEndian.Uint16(body[2:]))
+	for len(f.Tracks) < trackCount {
+		id, body, err := readChunk(br)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if id != "MTrk" {
+			continue
+		}
+		track, err := parseTrack(body)
+		if err != nil {
+			return nil, fmt.Errorf("track %d: %w", len(f.Tracks), err)
+		}
+		f.Tracks = append(f.Tracks, track)
+	}
+
+	return f, nil
+}
+
+func readChunk(r io.Reader) (string, []byte, error) {
+	var head [8]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("%w: truncated chunk header", ErrInvalidFile)
+		}
+		return "", nil, err
+	}
+	// the length is not trusted for allocation; the body grows as it is read
+	var body bytes.Buffer
+	if _, err := io.CopyN(&body, r, int64(binary.BigEndian.Uint32(head[4:]))); err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("%w: truncated chunk", ErrInvalidFile)
+		}
+		return "", nil, err
+	}
+	return string(head[:4]), body.Bytes(), nil
+}
+
+func parseTrack(data []byte) ([]Message, error) {
+	var out []Message
+	var tick uint32
+	var running byte
+
+	for len(data) > 0 {
+		delta, n := readVLQ(data)
+		if n == 0 {
+			return nil, fmt.Errorf("%w: bad delta time", ErrInvalidFile)
+		}
+		tick += delta
+		data = data[n:]
+		if len(data) == 0 {
+			return nil, fmt.Errorf("%w: truncated event", ErrInvalidFile)
+		}
+
+		status := data[0]
+		switch {
+		case status == 0xFF:
+			if len(data) < 2 {
+				return nil, fmt.Errorf("%w: truncated meta event", ErrInvalidFile)
+			}
+			length, n := readVLQ(data[2:])
+			end := 2 + n + int(length)
+			if n == 0 || end > len(data) {
+				return nil, fmt.Errorf("%w: truncated meta event", ErrInvalidFile)
+			}
+			running = 0
+			if data[1] == 0x2F {
+				return out, nil
+			}
+			out = append(out, Message{Tick: tick, Data: data[:end:end]})
+			data = data[end:]
+		case status == 0xF0 || status == 0xF7:
+			length, n := readVLQ(data[1:])
+			end := 1 + n + int(length)
+			if n == 0 || end > len(data) {
+				return nil, fmt.Errorf("%w: truncated sysex event", ErrInvalidFile)
+			}
+			running = 0
+			msg := append([]byte{status}, data[1+n:end]...)
+			out = append(out, Message{Tick: tick, Data: msg})
+			data = data[end:]
+		default:
+			if status&0x80 != 0 {
+				running = status
+				data = data[1:]
+			} else if running == 0 {
+				return nil, fmt.Errorf("%w: data byte without running status", ErrInvalidFile)
+			}
+			length := ump.MIDI1DataLength(running)
+			if length < 0 || len(data) < length {
+				return nil, fmt.Errorf("%w: bad channel message", ErrInvalidFile)
+			}
+			msg := append([]byte{running}, data[:length]...)
+			out = append(out, Message{Tick: tick, Data: msg})
+			data = data[length:]
+			if running >= 0xF0 {
+				// system messages don't establish running status
+				running = 0
+			}
+		}
+	}
+
+	return out, nil
+}
+
+// WriteTo encodes f as a Standard MIDI File, using running status for
+// channel messages, and writes it to w. Tracks must be sorted by tick.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	buf.WriteString("MThd")
+	binary.Write(&buf, binary.BigEndian, uint32(6))
+	binary.Write(&buf, binary.BigEndian, uint16(f.Format))
+	binary.Write(&buf, binary.BigEndian, uint16(len(f.Tracks)))
+	binary.Write(&buf, binary.BigEndian, f.PPQN)
+	for _, track := range f.Tracks {
+		chunk := encodeTrack(track)
+		buf.WriteString("MTrk")
+		binary.Write(&buf, binary.BigEndian, uint32(len(chunk)))
+		buf.Write(chunk)
+	}
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+func encodeTrack(track []Message) []byte {
+	var out []byte
+	var last uint32
+	var running byte
+
+	for _, m := range track {
+		if len(m.Data) == 0 {
+			continue
+		}
+
+		out = appendVLQ(out, m.Tick-last)
+		last = m.Tick
+
+		switch status := m.Data[0]; {
+		case status == 0xF0 || status == 0xF7:
+			running = 0
+			out = append(out, status)
+			out = appendVLQ(out, uint32(len(m.Data)-1))
+			out = append(out, m.Data[1:]...)
+		case status == 0xFF:
+			running = 0
+			out = append(out, m.Data...)
+		case status == running:
+			out = append(out, m.Data[1:]...)
+		default:
+			running = status
+			out = append(out, m.Data...)
+		}
+	}
+
+	out = appendVLQ(out, 0)
+	return append(out, 0xFF, 0x2F, 0x00)
+}
+
+func appendVLQ(dst []byte, v uint32) []byte {
+	var tmp [5]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(v & 0x7F)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		tmp[i] = byte(v&0x7F) | 0x80
+	}
+	return append(dst, tmp[i:]...)
+}
+
+// readVLQ decodes a variable-length quantity from the start of data,
+// returning the value and the number of bytes consumed, or 0 bytes if data
+// does not begin with a valid VLQ.
+func readVLQ(data []byte) (uint32, int) {
+	var v uint32
+	for i := 0; i < len(data) && i < 4; i++ {
+		v = v<<7 | uint32(data[i]&0x7F)
+		if data[i]&0x80 == 0 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
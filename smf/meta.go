@@ -0,0 +1,56 @@
+package smf
+
+// Meta event types
+const (
+	MetaSequenceNumber = 0x00
+	MetaText           = 0x01
+	MetaCopyright      = 0x02
+	MetaTrackName      = 0x03
+	MetaInstrumentName = 0x04
+	MetaLyric          = 0x05
+	MetaMarker         = 0x06
+	MetaCuePoint       = 0x07
+	MetaChannelPrefix  = 0x20
+	MetaEndOfTrack     = 0x2F
+	MetaTempo          = 0x51
+	MetaSMPTEOffset    = 0x54
+	MetaTimeSignature  = 0x58
+	MetaKeySignature   = 0x59
+	MetaSequencer      = 0x7F
+)
+
+// Meta returns the encoded form of a meta event with the given type and
+// payload, suitable for use as Message.Data.
+func Meta(typ byte, payload []byte) []byte {
+	out := appendVLQ([]byte{0xFF, typ}, uint32(len(payload)))
+	return append(out, payload...)
+}
+
+// Tempo returns a tempo meta event. usPerQuarter is truncated to 24 bits.
+func Tempo(usPerQuarter uint32) []byte {
+	return Meta(MetaTempo, []byte{byte(usPerQuarter >> 16), byte(usPerQuarter >> 8), byte(usPerQuarter)})
+}
+
+// TimeSig returns a time signature meta event. denominator is expressed as
+// a power of 2, e.g. 2 for a crotchet.
+func TimeSig(numerator, denominator, clocksPerClick, thirtySecondsPerQuarter uint8) []byte {
+	return Meta(MetaTimeSignature, []byte{numerator, denominator, clocksPerClick, thirtySecondsPerQuarter})
+}
+
+// TrackName returns a track name meta event.
+func TrackName(name string) []byte {
+	return Meta(MetaTrackName, []byte(name))
+}
+
+// Meta decodes m as a meta event, returning its type and payload. ok is
+// false if m is not a meta event.
+func (m Message) Meta() (typ byte, payload []byte, ok bool) {
+	if len(m.Data) < 3 || m.Data[0] != 0xFF {
+		return 0, nil, false
+	}
+	length, n := readVLQ(m.Data[2:])
+	if n == 0 || 2+n+int(length) > len(m.Data) {
+		return 0, nil, false
+	}
+	return m.Data[1], m.Data[2+n : 2+n+int(length)], true
+}
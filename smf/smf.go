@@ -0,0 +1,122 @@
+// Package smf reads and writes Standard MIDI Files.
+//
+// File and Message give a tick-based view of a file's contents. Write
+// converts timestamped UMP events, as collected by a
+// midi.ReceiveEventHandler, into a file.
+package smf
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jaz303/midi/ump"
+)
+
+// Format is the SMF file format stored in the header chunk.
+type Format uint16
+
+const (
+	// Format0 files contain a single track; all events are merged into it.
+	Format0 = Format(0)
+
+	// Format1 files contain a conductor track holding tempo and time
+	// signature, followed by one track per input track.
+	Format1 = Format(1)
+)
+
+const (
+	DefaultPPQN  = 480
+	DefaultTempo = 120.0
+)
+
+var (
+	ErrInvalidFormat = errors.New("invalid SMF format")
+	ErrInvalidFile   = errors.New("invalid SMF file")
+)
+
+// Message is a single event within a track, positioned in ticks from the
+// start of the track.
+//
+// Data holds the complete message: for channel messages, the status byte
+// and data bytes; for sysex, 0xF0 followed by the message body (without the
+// SMF length prefix) up to and including 0xF7; for meta events, 0xFF
+// followed by the type, a VLQ length, and the payload. Escaped (0xF7)
+// events are stored in the same way as sysex.
+type Message struct {
+	Tick uint32
+	Data []byte
+}
+
+// File is the tick-based contents of a Standard MIDI File. Tracks do not
+// include their terminating End of Track meta event; it is added on write.
+type File struct {
+	Format Format
+	PPQN   uint16
+	Tracks [][]Message
+}
+
+// Event is a timestamped group of UMP words, in the same shape as the
+// arguments received by a midi.ReceiveEventHandler.
+type Event struct {
+	Time  time.Time
+	Words []ump.Word
+}
+
+// Track is a named list of events. Events need not be sorted.
+type Track struct {
+	Name   string
+	Events []Event
+}
+
+// TimeSignature describes a time signature meta event.
+type TimeSignature struct {
+	Numerator   uint8
+	Denominator uint8 // e.g. 4 for crotchet, 8 for quaver; must be a power of 2
+
+	// MIDI clocks per metronome click; 24 if zero.
+	ClocksPerClick uint8
+
+	// Notated 32nd notes per MIDI quarter note; 8 if zero.
+	ThirtySecondsPerQuarter uint8
+}
+
+// Config controls conversion of real time to ticks, and the meta events
+// written to the file.
+type Config struct {
+	Format Format
+
+	// Ticks per quarter note; DefaultPPQN if zero.
+	PPQN uint16
+
+	// Tempo in beats per minute; DefaultTempo if zero.
+	Tempo float64
+
+	// Time signature; 4/4 if Numerator is zero.
+	TimeSignature TimeSignature
+
+	// Time corresponding to tick zero. If zero, the time of the earliest
+	// event in any track is used. Events occurring before Start are placed
+	// at tick zero.
+	Start time.Time
+}
+
+// Dropped describes a message that could not be written to the file.
+type Dropped struct {
+	Track  int
+	Time   time.Time
+	Words  []ump.Word
+	Reason string
+}
+
+// Report lists the messages that were dropped during conversion.
+type Report struct {
+	Dropped []Dropped
+}
+
+const (
+	ReasonSystem        = "system messages cannot be stored in SMF"
+	ReasonUtility       = "utility messages cannot be stored in SMF"
+	ReasonNoMIDI1       = "no MIDI 1.0 equivalent"
+	ReasonTruncated     = "truncated message"
+	ReasonIncompleteSyx = "incomplete system exclusive message"
+)
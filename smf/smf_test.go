@@ -0,0 +1,335 @@
+package smf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jaz303/midi/ump"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// at returns the time ms milliseconds after epoch. At the default tempo
+// and PPQN, 500ms is one quarter note of 480 ticks.
+func at(ms int) time.Time {
+	return epoch.Add(time.Duration(ms) * time.Millisecond)
+}
+
+func event(ms int, words ...ump.Word) Event {
+	return Event{Time: at(ms), Words: words}
+}
+
+var testTracks = []Track{
+	{
+		Name: "Piano",
+		Events: []Event{
+			event(500, ump.NoteOff(0, 60, 0)),
+			event(0, ump.NoteOn(0, 60, 100)),
+		},
+	},
+	{
+		Name: "Strings",
+		Events: []Event{
+			event(250, ump.ControlChange(1, 7, 90)),
+			event(1000, ump.AppendSysEx7(nil, 0, []byte{0x7E, 0x7F, 0x09, 0x01})...),
+		},
+	},
+}
+
+// Track events as written, each preceded by its delta time.
+var (
+	endOfTrack = "\x00\xFF\x2F\x00"
+	tempo120   = "\x00\xFF\x51\x03\x07\xA1\x20"
+	timeSig    = "\x00\xFF\x58\x04\x04\x02\x18\x08"
+)
+
+// chunks splits an SMF into the body of its header and those of its
+// tracks.
+func chunks(t *testing.T, data []byte) (header []byte, tracks []string) {
+	t.Helper()
+	for len(data) > 0 {
+		if len(data) < 8 {
+			t.Fatalf("truncated chunk % x", data)
+		}
+		n := binary.BigEndian.Uint32(data[4:])
+		body := data[8 : 8+n]
+		switch string(data[:4]) {
+		case "MThd":
+			header = body
+		case "MTrk":
+			tracks = append(tracks, string(body))
+		default:
+			t.Fatalf("unexpected chunk %q", data[:4])
+		}
+		data = data[8+n:]
+	}
+	return header, tracks
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		want   []string
+	}{
+		{
+			"format 0",
+			Format0,
+			[]string{tempo120 + timeSig + "\x00\xFF\x03\x05Piano" +
+				"\x00\x90\x3C\x64" +
+				"\x81\x70\xB1\x07\x5A" +
+				"\x81\x70\x80\x3C\x00" +
+				"\x83\x60\xF0\x05\x7E\x7F\x09\x01\xF7" +
+				endOfTrack},
+		},
+		{
+			"format 1",
+			Format1,
+			[]string{
+				tempo120 + timeSig + endOfTrack,
+				"\x00\xFF\x03\x05Piano\x00\x90\x3C\x64\x83\x60\x80\x3C\x00" + endOfTrack,
+				"\x00\xFF\x03\x07Strings\x81\x70\xB1\x07\x5A\x85\x50\xF0\x05\x7E\x7F\x09\x01\xF7" + endOfTrack,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			report, err := Write(&buf, &Config{Format: tt.format}, testTracks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Dropped) != 0 {
+				t.Errorf("dropped %+v", report.Dropped)
+			}
+
+			header, tracks := chunks(t, buf.Bytes())
+			want := []byte{0, byte(tt.format), 0, byte(len(tt.want)), DefaultPPQN >> 8, DefaultPPQN & 0xFF}
+			if !bytes.Equal(header, want) {
+				t.Errorf("header = % x, want % x", header, want)
+			}
+			if !reflect.DeepEqual(tracks, tt.want) {
+				t.Errorf("tracks:\n got %q\nwant %q", tracks, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteConfig(t *testing.T) {
+	cfg := &Config{
+		Format:        Format1,
+		PPQN:          96,
+		Tempo:         60,
+		TimeSignature: TimeSignature{Numerator: 6, Denominator: 8},
+		Start:         at(-1000),
+	}
+	tracks := []Track{{Events: []Event{
+		event(0, ump.NoteOn(0, 60, 100)),
+		event(0, ump.NoteOn(0, 64, 100)),
+		event(-2000, ump.NoteOn(0, 67, 100)),
+	}}}
+
+	var buf bytes.Buffer
+	if _, err := Write(&buf, cfg, tracks); err != nil {
+		t.Fatal(err)
+	}
+	header, got := chunks(t, buf.Bytes())
+	if !bytes.Equal(header, []byte{0, 1, 0, 2, 0, 96}) {
+		t.Errorf("header = % x", header)
+	}
+
+	// events before Start are moved to tick zero, and the second note on
+	// at the same time as the first is written with running status
+	want := []string{
+		"\x00\xFF\x51\x03\x0F\x42\x40\x00\xFF\x58\x04\x06\x03\x18\x08" + endOfTrack,
+		"\x00\x90\x43\x64\x60\x3C\x64\x00\x40\x64" + endOfTrack,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tracks:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestWriteDropped(t *testing.T) {
+	start := ump.AppendSysEx7(nil, 0, make([]byte, 8))[:2]
+	tracks := []Track{{Events: []Event{
+		event(0, ump.Clock),
+		event(0, 0x0040000A), // delta clockstamp
+		event(0, 0),          // NOOP
+		event(0, 0x40903C00),
+		event(0, start...),
+		event(0, 0x40903C00, 0x80000000),
+	}}}
+
+	var buf bytes.Buffer
+	report, err := Write(&buf, &Config{Format: Format1}, tracks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reasons []string
+	for _, d := range report.Dropped {
+		reasons = append(reasons, d.Reason)
+	}
+	want := []string{ReasonSystem, ReasonUtility, ReasonTruncated, ReasonIncompleteSyx}
+	if !reflect.DeepEqual(reasons, want) {
+		t.Errorf("dropped reasons = %q, want %q", reasons, want)
+	}
+
+	// the MIDI 2.0 note on is downconverted
+	if _, got := chunks(t, buf.Bytes()); got[1] != "\x00\x90\x3C\x40"+endOfTrack {
+		t.Errorf("track = % x, want one MIDI 1.0 note on", got[1])
+	}
+}
+
+func TestWriteInvalidFormat(t *testing.T) {
+	if _, err := Write(&bytes.Buffer{}, &Config{Format: 2}, nil); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Write format 2 = %v, want %v", err, ErrInvalidFormat)
+	}
+	if _, _, err := Convert(&Config{Format: 2}, nil); !errors.Is(err, ErrInvalidFormat) {
+		t.Errorf("Convert format 2 = %v, want %v", err, ErrInvalidFormat)
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	var (
+		tempo   = Message{Data: Tempo(500_000)}
+		timeSig = Message{Data: TimeSig(4, 2, 24, 8)}
+		noteOn  = Message{Tick: 0, Data: []byte{0x90, 60, 100}}
+		noteOff = Message{Tick: 480, Data: []byte{0x80, 60, 0}}
+		volume  = Message{Tick: 240, Data: []byte{0xB1, 7, 90}}
+		gmOn    = Message{Tick: 960, Data: []byte{0xF0, 0x7E, 0x7F, 0x09, 0x01, 0xF7}}
+	)
+	tests := []struct {
+		name   string
+		format Format
+		want   [][]Message
+	}{
+		{
+			"format 0",
+			Format0,
+			[][]Message{{tempo, timeSig, {Data: TrackName("Piano")}, noteOn, volume, noteOff, gmOn}},
+		},
+		{
+			"format 1",
+			Format1,
+			[][]Message{
+				{tempo, timeSig},
+				{{Data: TrackName("Piano")}, noteOn, noteOff},
+				{{Data: TrackName("Strings")}, volume, gmOn},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if _, err := Write(&buf, &Config{Format: tt.format}, testTracks); err != nil {
+				t.Fatal(err)
+			}
+			f, err := Read(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if f.Format != tt.format || f.PPQN != DefaultPPQN {
+				t.Errorf("header = format %d, PPQN %d; want %d, %d", f.Format, f.PPQN, tt.format, DefaultPPQN)
+			}
+			if !reflect.DeepEqual(f.Tracks, tt.want) {
+				t.Errorf("tracks:\n got %v\nwant %v", f.Tracks, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteToRoundTrip(t *testing.T) {
+	f := &File{
+		Format: Format1,
+		PPQN:   96,
+		Tracks: [][]Message{
+			{
+				{Tick: 0, Data: []byte{0x90, 60, 100}},
+				{Tick: 0, Data: []byte{0x90, 64, 100}}, // running status
+				{Tick: 96, Data: Meta(MetaMarker, []byte("verse"))},
+				{Tick: 96, Data: []byte{0x90, 60, 0}}, // status repeated after meta
+				{Tick: 200, Data: []byte{0xF7, 0xF3, 0x01}},
+				{Tick: 20000, Data: []byte{0xC3, 5}},
+			},
+			nil,
+		},
+	}
+
+	var buf bytes.Buffer
+	if _, err := f.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Tracks, [][]Message{f.Tracks[0], nil}) {
+		t.Errorf("tracks:\n got %v\nwant %v", got.Tracks, f.Tracks)
+	}
+
+	// the second note on is written without its status byte
+	if !bytes.Contains(buf.Bytes(), []byte{0x00, 0x90, 60, 100, 0x00, 64, 100}) {
+		t.Errorf("running status not used: % x", buf.Bytes())
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	header := []byte("MThd\x00\x00\x00\x06\x00\x01\x00\x01\x00\x60")
+	track := func(body string) []byte {
+		out := append([]byte(nil), header...)
+		out = append(out, "MTrk\x00\x00\x00"...)
+		out = append(out, byte(len(body)))
+		return append(out, body...)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"no header", []byte("MTrk\x00\x00\x00\x00")},
+		{"short header", []byte("MThd\x00\x00\x00\x02\x00\x01")},
+		{"truncated chunk", []byte("MThd\x00\x00\x00\x06\x00")},
+		{"bogus chunk length", []byte("MThd\x80\x00\x00\x06\x00\x01\x00\x01\x00\x60")},
+		{"smpte", []byte("MThd\x00\x00\x00\x06\x00\x01\x00\x01\xE7\x28")},
+		{"bad delta", track("\xFF\xFF\xFF\xFF\xFF")},
+		{"no running status", track("\x00\x3C\x40")},
+		{"truncated channel message", track("\x00\x90\x3C")},
+		{"truncated meta", track("\x00\xFF\x03\x05ab")},
+		{"truncated sysex", track("\x00\xF0\x05\x7E")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(bytes.NewReader(tt.data)); !errors.Is(err, ErrInvalidFile) {
+				t.Errorf("Read = %v, want %v", err, ErrInvalidFile)
+			}
+		})
+	}
+}
+
+func TestVLQ(t *testing.T) {
+	tests := []struct {
+		v   uint32
+		enc []byte
+	}{
+		{0, []byte{0x00}},
+		{0x7F, []byte{0x7F}},
+		{0x80, []byte{0x81, 0x00}},
+		{0x2000, []byte{0xC0, 0x00}},
+		{0x3FFF, []byte{0xFF, 0x7F}},
+		{0x4000, []byte{0x81, 0x80, 0x00}},
+		{0x0FFFFFFF, []byte{0xFF, 0xFF, 0xFF, 0x7F}},
+	}
+	for _, tt := range tests {
+		if got := appendVLQ(nil, tt.v); !bytes.Equal(got, tt.enc) {
+			t.Errorf("appendVLQ(%#x) = % x, want % x", tt.v, got, tt.enc)
+		}
+		if v, n := readVLQ(tt.enc); v != tt.v || n != len(tt.enc) {
+			t.Errorf("readVLQ(% x) = %#x, %d; want %#x, %d", tt.enc, v, n, tt.v, len(tt.enc))
+		}
+	}
+}
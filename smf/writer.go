@@ -0,0 +1,221 @@
+package smf
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"time"
+
+	"github.com/jaz303/midi/ump"
+)
+
+// Write encodes tracks as a Standard MIDI File and writes it to w. Messages
+// that cannot be represented in SMF are omitted from the output and listed in
+// the returned Report.
+//
+// MIDI 2.0 channel voice messages are downconverted to MIDI 1.0 where
+// possible. SysEx7 messages are reassembled and written as F0 events.
+func Write(w io.Writer, cfg *Config, tracks []Track) (*Report, error) {
+	f, report, err := Convert(cfg, tracks)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.WriteTo(w); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// Convert is like Write but returns the converted File instead of encoding
+// it.
+func Convert(cfg *Config, tracks []Track) (*File, *Report, error) {
+	c := *cfg
+	if c.Format != Format0 && c.Format != Format1 {
+		return nil, nil, fmt.Errorf("%w: %d", ErrInvalidFormat, c.Format)
+	}
+	if c.PPQN == 0 {
+		c.PPQN = DefaultPPQN
+	}
+	if c.Tempo <= 0 {
+		c.Tempo = DefaultTempo
+	}
+	if c.TimeSignature.Numerator == 0 {
+		c.TimeSignature = TimeSignature{Numerator: 4, Denominator: 4}
+	}
+	if c.Start.IsZero() {
+		c.Start = earliest(tracks)
+	}
+
+	usPerQuarter := uint32(math.Round(60_000_000 / c.Tempo))
+	if usPerQuarter > 0xFFFFFF {
+		usPerQuarter = 0xFFFFFF
+	}
+
+	enc := &encoder{
+		start:      c.Start,
+		ticksPerUs: float64(c.PPQN) / float64(usPerQuarter),
+		report:     &Report{},
+	}
+
+	conductor := []Message{
+		{Data: Tempo(usPerQuarter)},
+		{Data: timeSignature(&c.TimeSignature)},
+	}
+
+	f := &File{Format: c.Format, PPQN: c.PPQN}
+	switch c.Format {
+	case Format0:
+		var track []Message
+		for i, t := range tracks {
+			if t.Name != "" && len(track) == 0 {
+				track = append(track, Message{Data: TrackName(t.Name)})
+			}
+			track = enc.convert(track, i, t.Events)
+		}
+		sort.SliceStable(track, func(i, j int) bool {
+			return track[i].Tick < track[j].Tick
+		})
+		f.Tracks = append(f.Tracks, append(conductor, track...))
+	case Format1:
+		f.Tracks = append(f.Tracks, conductor)
+		for i, t := range tracks {
+			var track []Message
+			if t.Name != "" {
+				track = append(track, Message{Data: TrackName(t.Name)})
+			}
+			track = enc.convert(track, i, t.Events)
+			sort.SliceStable(track, func(i, j int) bool {
+				return track[i].Tick < track[j].Tick
+			})
+			f.Tracks = append(f.Tracks, track)
+		}
+	}
+
+	return f, enc.report, nil
+}
+
+func earliest(tracks []Track) time.Time {
+	var out time.Time
+	for _, t := range tracks {
+		for _, e := range t.Events {
+			if out.IsZero() || e.Time.Before(out) {
+				out = e.Time
+			}
+		}
+	}
+	return out
+}
+
+func timeSignature(ts *TimeSignature) []byte {
+	clocks, thirtySeconds := ts.ClocksPerClick, ts.ThirtySecondsPerQuarter
+	if clocks == 0 {
+		clocks = 24
+	}
+	if thirtySeconds == 0 {
+		thirtySeconds = 8
+	}
+	denom := uint8(2)
+	if ts.Denominator != 0 {
+		denom = uint8(bits.TrailingZeros8(ts.Denominator))
+	}
+	return TimeSig(ts.Numerator, denom, clocks, thirtySeconds)
+}
+
+type encoder struct {
+	start      time.Time
+	ticksPerUs float64
+	report     *Report
+}
+
+func (e *encoder) tick(t time.Time) uint32 {
+	d := t.Sub(e.start)
+	if d < 0 {
+		return 0
+	}
+	return uint32(math.Round(float64(d.Microseconds()) * e.ticksPerUs))
+}
+
+func (e *encoder) drop(track int, t time.Time, words []ump.Word, reason string) {
+	e.report.Dropped = append(e.report.Dropped, Dropped{
+		Track:  track,
+		Time:   t,
+		Words:  append([]ump.Word(nil), words...),
+		Reason: reason,
+	})
+}
+
+// convert translates a track's events into messages, appending them to dst.
+// The output is not sorted.
+func (e *encoder) convert(dst []Message, track int, events []Event) []Message {
+	var syx ump.SysEx7Assembler
+	var pending [16][]ump.Word
+	var pendingTime [16]time.Time
+	var midi1 []ump.Word
+
+	for _, evt := range events {
+		tick := e.tick(evt.Time)
+		words := evt.Words
+		for len(words) > 0 {
+			msg, rest := ump.Next(words)
+			if msg == nil {
+				e.drop(track, evt.Time, words, ReasonTruncated)
+				break
+			}
+			words = rest
+
+			switch ump.MessageType(msg[0]) {
+			case ump.MsgTypeUtility:
+				if msg[0] != ump.NoOp {
+					e.drop(track, evt.Time, msg, ReasonUtility)
+				}
+			case ump.MsgTypeSystem:
+				e.drop(track, evt.Time, msg, ReasonSystem)
+			case ump.MsgTypeMIDIv1:
+				dst = appendChannel(dst, tick, msg[0])
+			case ump.MsgTypeMIDIv2:
+				var ok bool
+				midi1, ok = ump.ToMIDI1(midi1[:0], msg)
+				if !ok {
+					e.drop(track, evt.Time, msg, ReasonNoMIDI1)
+				}
+				for _, w := range midi1 {
+					dst = appendChannel(dst, tick, w)
+				}
+			case ump.MsgTypeData:
+				g := ump.Group(msg[0])
+				if st := ump.SysEx7Status(msg[0]); st == ump.SysEx7Start || st == ump.SysEx7Complete {
+					if len(pending[g]) > 0 {
+						e.drop(track, pendingTime[g], pending[g], ReasonIncompleteSyx)
+					}
+					pending[g] = pending[g][:0]
+					pendingTime[g] = evt.Time
+				}
+				pending[g] = append(pending[g], msg...)
+				if data, ok := syx.Push(msg); ok {
+					dst = append(dst, Message{Tick: tick, Data: append([]byte(nil), data...)})
+					pending[g] = pending[g][:0]
+				}
+			default:
+				e.drop(track, evt.Time, msg, ReasonNoMIDI1)
+			}
+		}
+	}
+
+	for g := range pending {
+		if len(pending[g]) > 0 {
+			e.drop(track, pendingTime[g], pending[g], ReasonIncompleteSyx)
+		}
+	}
+
+	return dst
+}
+
+func appendChannel(dst []Message, tick uint32, w ump.Word) []Message {
+	data, ok := ump.AppendMIDI1Bytes(nil, []ump.Word{w})
+	if !ok {
+		return dst
+	}
+	return append(dst, Message{Tick: tick, Data: data})
+}
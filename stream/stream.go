@@ -0,0 +1,369 @@
+// Package stream provides a driver that exchanges MIDI 1.0 byte streams
+// over any io.ReadWriter: a serial port at 31250 baud, a PTY, a raw MIDI
+// device such as /dev/snd/midiC1D0, or a network connection. Configuring
+// the underlying device (baud rate, raw mode) is left to the caller.
+//
+// The stream appears as a single device with one input and one output,
+// both addressed by Port. Incoming bytes are parsed into UMP and outgoing
+// UMP is converted to MIDI 1.0; sends with a timestamp are held back and
+// written by a scheduling goroutine when they fall due.
+package stream
+
+import (
+	"container/heap"
+	"errors"
+	"io"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+const (
+	driverName = "stream"
+
+	// Port is the Entity of the stream's input and output.
+	Port = midi.Entity(1)
+
+	readBufferSize = 1024
+)
+
+var ErrUnknownEntity = errors.New("unknown entity")
+
+type driver struct {
+	name string
+	rw   io.ReadWriter
+
+	inputLock sync.Mutex // guards the handlers and inputOpen
+	onReceive midi.ReceiveEventHandler
+	onNotify  midi.NotificationHandler
+	inputOpen bool
+
+	writeLock sync.Mutex // serialises writes to rw
+
+	queueLock sync.Mutex
+	queue     sendQueue
+	seq       uint64
+	wake      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates a driver for the stream rw and starts reading from it. name
+// is the name of the device in Enumerate. If rw is an io.Closer it is
+// closed by the driver's Close.
+//
+// Otherwise Close cannot interrupt a Read in progress: the read loop exits
+// when the Read returns, discarding its data. Either way, a handler call
+// that is already under way may finish after Close returns.
+func New(name string, rw io.ReadWriter) midi.Driver {
+	d := &driver{
+		name:      name,
+		rw:        rw,
+		onReceive: midi.NopHandler,
+		onNotify:  midi.NopNotificationHandler,
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+
+	go d.readLoop()
+	go d.scheduleLoop()
+
+	return d
+}
+
+func (d *driver) Name() string {
+	return driverName
+}
+
+func (d *driver) Close() error {
+	var err error
+	d.closeOnce.Do(func() {
+		close(d.done)
+		d.inputLock.Lock()
+		d.inputOpen = false
+		d.inputLock.Unlock()
+		if c, ok := d.rw.(io.Closer); ok {
+			err = c.Close()
+		}
+	})
+	return err
+}
+
+func (d *driver) SetReceiveHandler(handler midi.ReceiveEventHandler) {
+	if handler == nil {
+		handler = midi.NopHandler
+	}
+	d.inputLock.Lock()
+	d.onReceive = handler
+	d.inputLock.Unlock()
+}
+
+// SetNotificationHandler is accepted for completeness; a stream's topology
+// never changes.
+func (d *driver) SetNotificationHandler(handler midi.NotificationHandler) {
+	if handler == nil {
+		handler = midi.NopNotificationHandler
+	}
+	d.inputLock.Lock()
+	d.onNotify = handler
+	d.inputLock.Unlock()
+}
+
+func (d *driver) check(ent midi.Entity) error {
+	select {
+	case <-d.done:
+		return midi.ErrClosed
+	default:
+	}
+	if ent != Port {
+		return ErrUnknownEntity
+	}
+	return nil
+}
+
+// OpenInput starts passing received messages to the receive handler.
+// Until then they are parsed and discarded.
+func (d *driver) OpenInput(ent midi.Entity) error {
+	return d.setInputOpen(ent, true)
+}
+
+// CloseInput stops passing received messages to the receive handler.
+func (d *driver) CloseInput(ent midi.Entity) error {
+	return d.setInputOpen(ent, false)
+}
+
+func (d *driver) setInputOpen(ent midi.Entity, open bool) error {
+	if err := d.check(ent); err != nil {
+		return err
+	}
+	d.inputLock.Lock()
+	d.inputOpen = open
+	d.inputLock.Unlock()
+	return nil
+}
+
+func (d *driver) OpenOutput(ent midi.Entity) error {
+	return d.check(ent)
+}
+
+func (d *driver) CloseOutput(ent midi.Entity) error {
+	return d.check(ent)
+}
+
+func (d *driver) CreateVirtualInput(string) (midi.Entity, error) {
+	return 0, midi.ErrNotImplemeneted
+}
+
+func (d *driver) CreateVirtualOutput(string) (midi.Entity, error) {
+	return 0, midi.ErrNotImplemeneted
+}
+
+func (d *driver) Connect(src, dst midi.Entity) error {
+	return midi.ErrNotImplemeneted
+}
+
+func (d *driver) Disconnect(src, dst midi.Entity) error {
+	return midi.ErrNotImplemeneted
+}
+
+// Connections always returns an empty list; a stream has no other ports to
+// connect.
+func (d *driver) Connections() ([]midi.Connection, error) {
+	return nil, d.check(Port)
+}
+
+func (d *driver) Enumerate() (*midi.Node, error) {
+	if err := d.check(Port); err != nil {
+		return nil, err
+	}
+	return &midi.Node{
+		Type: midi.Root,
+		Children: []*midi.Node{{
+			Type:   midi.Device,
+			Name:   d.name,
+			Driver: d,
+			Entity: Port,
+			Children: []*midi.Node{{
+				Type:   midi.PortGroup,
+				Name:   d.name,
+				Driver: d,
+				Entity: Port,
+				Children: []*midi.Node{
+					{Type: midi.Input, Name: d.name + " input", Driver: d, Entity: Port},
+					{Type: midi.Output, Name: d.name + " output", Driver: d, Entity: Port},
+				},
+			}},
+		}},
+	}, nil
+}
+
+// MARK: Send
+
+// Send writes words to the stream at time t, or immediately if t is the
+// zero time or has passed.
+func (d *driver) Send(t time.Time, ent midi.Entity, words []ump.Word) error {
+	if err := d.check(ent); err != nil {
+		return err
+	}
+	return d.send(t, ump.AppendMIDI1Stream(nil, words))
+}
+
+func (d *driver) SendSysEx(ent midi.Entity, words []ump.Word) error {
+	return d.Send(time.Time{}, ent, words)
+}
+
+func (d *driver) SendSysExV1(ent midi.Entity, data []byte) error {
+	if err := d.check(ent); err != nil {
+		return err
+	}
+	return d.send(time.Time{}, data)
+}
+
+func (d *driver) send(t time.Time, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	d.queueLock.Lock()
+	if len(d.queue) == 0 && !t.After(time.Now()) {
+		// take the write lock first so a send the scheduler has just
+		// dequeued is written before this one
+		d.writeLock.Lock()
+		d.queueLock.Unlock()
+		return d.writeLocked(data)
+	}
+
+	// queued sends are written in time order, and in call order at equal
+	// times. data is copied, as the caller may reuse it before then.
+	d.seq++
+	heap.Push(&d.queue, &pendingSend{t: t, seq: d.seq, data: slices.Clone(data)})
+	d.queueLock.Unlock()
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// writeLocked writes data and releases writeLock, which the caller holds.
+func (d *driver) writeLocked(data []byte) error {
+	defer d.writeLock.Unlock()
+
+	_, err := d.rw.Write(data)
+	return err
+}
+
+func (d *driver) scheduleLoop() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		d.queueLock.Lock()
+		var next *pendingSend
+		if len(d.queue) > 0 {
+			next = d.queue[0]
+			if !next.t.After(time.Now()) {
+				heap.Pop(&d.queue)
+				d.writeLock.Lock()
+				d.queueLock.Unlock()
+				if err := d.writeLocked(next.data); err != nil {
+					log.Printf("%s: scheduled write failed: %s", driverName, err)
+				}
+				continue
+			}
+		}
+		d.queueLock.Unlock()
+
+		var due <-chan time.Time
+		if next != nil {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(time.Until(next.t))
+			due = timer.C
+		}
+
+		select {
+		case <-d.done:
+			return
+		case <-d.wake:
+		case <-due:
+		}
+	}
+}
+
+type pendingSend struct {
+	t    time.Time
+	seq  uint64
+	data []byte
+}
+
+type sendQueue []*pendingSend
+
+func (q sendQueue) Len() int { return len(q) }
+
+func (q sendQueue) Less(i, j int) bool {
+	if q[i].t.Equal(q[j].t) {
+		return q[i].seq < q[j].seq
+	}
+	return q[i].t.Before(q[j].t)
+}
+
+func (q sendQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *sendQueue) Push(x any) { *q = append(*q, x.(*pendingSend)) }
+
+func (q *sendQueue) Pop() any {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
+
+// MARK: Read Loop
+
+func (d *driver) readLoop() {
+	var parser ump.MIDI1Parser
+	var words []ump.Word
+	buf := make([]byte, readBufferSize)
+
+	for {
+		n, err := d.rw.Read(buf)
+		select {
+		case <-d.done:
+			return
+		default:
+		}
+		if n > 0 {
+			now := time.Now()
+			words = parser.Append(words[:0], buf[:n])
+
+			d.inputLock.Lock()
+			open, onReceive := d.inputOpen, d.onReceive
+			d.inputLock.Unlock()
+
+			if open && len(words) > 0 {
+				onReceive(now, Port, words)
+			}
+		}
+		if err != nil {
+			select {
+			case <-d.done:
+			default:
+				if err != io.EOF {
+					log.Printf("%s: read loop returned error %s, exiting", driverName, err)
+				}
+			}
+			return
+		}
+	}
+}
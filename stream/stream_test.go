@@ -0,0 +1,253 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+// port is an io.ReadWriteCloser whose reads come from a pipe fed by the
+// test and whose writes are recorded.
+type port struct {
+	in  *io.PipeReader
+	out *io.PipeWriter
+
+	lock    sync.Mutex
+	written bytes.Buffer
+	closed  bool
+}
+
+func newPort() *port {
+	r, w := io.Pipe()
+	return &port{in: r, out: w}
+}
+
+func (p *port) Read(b []byte) (int, error) { return p.in.Read(b) }
+
+func (p *port) Write(b []byte) (int, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.written.Write(b)
+}
+
+func (p *port) Close() error {
+	p.lock.Lock()
+	p.closed = true
+	p.lock.Unlock()
+	return p.in.Close()
+}
+
+// wait returns the bytes written once there are at least n of them, or
+// fails after a second.
+func (p *port) wait(t *testing.T, n int) []byte {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		p.lock.Lock()
+		got := bytes.Clone(p.written.Bytes())
+		p.lock.Unlock()
+		if len(got) >= n || time.Now().After(deadline) {
+			if len(got) < n {
+				t.Fatalf("wrote % X, want %d bytes", got, n)
+			}
+			return got
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func setup(t *testing.T) (midi.Driver, *port) {
+	t.Helper()
+	p := newPort()
+	d := New("Serial", p)
+	t.Cleanup(func() { d.Close() })
+	return d, p
+}
+
+func TestSend(t *testing.T) {
+	d, p := setup(t)
+	if err := d.OpenOutput(Port); err != nil {
+		t.Fatal(err)
+	}
+	v2 := ump.NoteOnV2(0, 1, 60, 0x8000)
+
+	d.Send(time.Time{}, Port, []ump.Word{ump.NoteOn(0, 60, 100), ump.Clock})
+	d.Send(time.Time{}, Port, v2[:])
+	d.Send(time.Time{}, Port, []ump.Word{ump.NoOp}) // nothing to write
+	d.SendSysExV1(Port, []byte{0xF0, 0x7E, 0x7F, 0x09, 0x01, 0xF7})
+	d.SendSysEx(Port, ump.AppendSysEx7(nil, 0, []byte{0x43, 0x10}))
+
+	want := []byte{
+		0x90, 60, 100, 0xF8,
+		0x91, 60, 64,
+		0xF0, 0x7E, 0x7F, 0x09, 0x01, 0xF7,
+		0xF0, 0x43, 0x10, 0xF7,
+	}
+	if got := p.wait(t, len(want)); !bytes.Equal(got, want) {
+		t.Errorf("wrote % X, want % X", got, want)
+	}
+}
+
+func TestScheduledSend(t *testing.T) {
+	d, p := setup(t)
+	now := time.Now()
+
+	sends := []struct {
+		t    time.Time
+		note int8
+	}{
+		{now.Add(40 * time.Millisecond), 1},
+		{now.Add(20 * time.Millisecond), 2},
+		{now.Add(20 * time.Millisecond), 3},
+		{time.Time{}, 4},
+		{now.Add(-time.Second), 5},
+	}
+	for _, s := range sends {
+		if err := d.Send(s.t, Port, []ump.Word{ump.NoteOn(0, s.note, 1)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// once sends are queued, sends due now are queued too, ahead of those
+	// not yet due
+	want := []byte{0x90, 4, 1, 0x90, 5, 1, 0x90, 2, 1, 0x90, 3, 1, 0x90, 1, 1}
+	got := p.wait(t, len(want))
+	if !bytes.Equal(got, want) {
+		t.Errorf("wrote % X, want % X", got, want)
+	}
+	if elapsed := time.Since(now); elapsed < 40*time.Millisecond {
+		t.Errorf("scheduled sends written after %v", elapsed)
+	}
+}
+
+func TestReceive(t *testing.T) {
+	d, p := setup(t)
+	got := make(chan []ump.Word, 10)
+	d.SetReceiveHandler(func(_ time.Time, ent midi.Entity, words []ump.Word) {
+		if ent != Port {
+			t.Errorf("received on %d", ent)
+		}
+		got <- append([]ump.Word(nil), words...)
+	})
+
+	// nothing is delivered until the input is opened. The pipe hands
+	// over one write per read, so once the start of a SysEx message has
+	// been taken the note on before it has been dealt with.
+	p.out.Write([]byte{0x90, 60, 100})
+	p.out.Write([]byte{0xF0})
+	if err := d.OpenInput(Port); err != nil {
+		t.Fatal(err)
+	}
+	p.out.Write([]byte{0x7E, 0xF7, 0x80, 60})
+	p.out.Write([]byte{0})
+
+	var words []ump.Word
+	timeout := time.After(time.Second)
+	for len(words) < 3 {
+		select {
+		case w := <-got:
+			words = append(words, w...)
+		case <-timeout:
+			t.Fatalf("received %v", words)
+		}
+	}
+	want := []ump.Word{0x30017E00, 0, ump.NoteOff(0, 60, 0)}
+	if !slices.Equal(words, want) {
+		t.Errorf("received %08X, want %08X", words, want)
+	}
+
+	if err := d.CloseInput(Port); err != nil {
+		t.Fatal(err)
+	}
+	p.out.Write([]byte{0x90, 60, 100})
+	p.out.Write([]byte{0xF0})
+	select {
+	case w := <-got:
+		t.Errorf("received %v after CloseInput", w)
+	default:
+	}
+}
+
+func TestClose(t *testing.T) {
+	d, p := setup(t)
+	d.Send(time.Now().Add(time.Hour), Port, []ump.Word{ump.Clock})
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !p.closed {
+		t.Error("stream not closed")
+	}
+
+	calls := []struct {
+		name string
+		fn   func() error
+	}{
+		{"Send", func() error { return d.Send(time.Time{}, Port, []ump.Word{ump.Clock}) }},
+		{"SendSysExV1", func() error { return d.SendSysExV1(Port, []byte{0xF0, 0xF7}) }},
+		{"OpenInput", func() error { return d.OpenInput(Port) }},
+		{"Enumerate", func() error { _, err := d.Enumerate(); return err }},
+	}
+	for _, c := range calls {
+		if err := c.fn(); !errors.Is(err, midi.ErrClosed) {
+			t.Errorf("%s after Close = %v, want %v", c.name, err, midi.ErrClosed)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+}
+
+func TestEntities(t *testing.T) {
+	d, _ := setup(t)
+	if err := d.OpenInput(2); !errors.Is(err, ErrUnknownEntity) {
+		t.Errorf("OpenInput(2) = %v, want %v", err, ErrUnknownEntity)
+	}
+	if err := d.Send(time.Time{}, 2, []ump.Word{ump.Clock}); !errors.Is(err, ErrUnknownEntity) {
+		t.Errorf("Send(2) = %v, want %v", err, ErrUnknownEntity)
+	}
+
+	root, err := d.Enumerate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	group := root.Children[0].Children[0]
+	if root.Children[0].Name != "Serial" || len(group.Children) != 2 ||
+		group.Children[0].Type != midi.Input || group.Children[1].Type != midi.Output {
+		t.Errorf("topology = %+v", root.Children[0])
+	}
+	for _, n := range group.Children {
+		if n.Entity != Port {
+			t.Errorf("%s has entity %d, want %d", n.Name, n.Entity, Port)
+		}
+	}
+}
+
+func TestSetHandlerWhileReceiving(t *testing.T) {
+	d, p := setup(t)
+	if err := d.OpenInput(Port); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			p.out.Write([]byte{0xF8})
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			d.SetReceiveHandler(func(time.Time, midi.Entity, []ump.Word) {})
+		}
+	}
+}
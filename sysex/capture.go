@@ -0,0 +1,123 @@
+package sysex
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+// Captured is a System Exclusive message received from an input.
+type Captured struct {
+	Time   time.Time
+	Entity midi.Entity
+	Group  uint8
+	Data   []byte // including 0xF0/0xF7 framing
+}
+
+// Recorder captures every complete System Exclusive message arriving on a
+// set of inputs. Messages are reassembled independently per input and
+// group.
+//
+// Recorder is safe for concurrent use.
+type Recorder struct {
+	inputs map[midi.Entity]bool
+
+	mu       sync.Mutex
+	asm      map[midi.Entity]*ump.SysEx7Assembler
+	messages []Captured
+
+	// OnMessage, if set, is called with each captured message, with the
+	// recorder's lock held.
+	OnMessage func(c Captured)
+}
+
+// NewRecorder creates a Recorder capturing from inputs, or from every
+// entity if none are given.
+func NewRecorder(inputs ...midi.Entity) *Recorder {
+	r := &Recorder{asm: map[midi.Entity]*ump.SysEx7Assembler{}}
+	if len(inputs) > 0 {
+		r.inputs = map[midi.Entity]bool{}
+		for _, e := range inputs {
+			r.inputs[e] = true
+		}
+	}
+	return r
+}
+
+// Handler returns a receive handler that records events before forwarding
+// every event to next.
+func (r *Recorder) Handler(next midi.ReceiveEventHandler) midi.ReceiveEventHandler {
+	if next == nil {
+		next = midi.NopHandler
+	}
+	return func(time time.Time, entity midi.Entity, words []ump.Word) {
+		r.Handle(time, entity, words)
+		next(time, entity, words)
+	}
+}
+
+// Handle records the SysEx7 data messages in words.
+func (r *Recorder) Handle(t time.Time, entity midi.Entity, words []ump.Word) {
+	if r.inputs != nil && !r.inputs[entity] {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	asm := r.asm[entity]
+	if asm == nil {
+		asm = &ump.SysEx7Assembler{}
+		r.asm[entity] = asm
+	}
+
+	for len(words) > 0 {
+		msg, rest := ump.Next(words)
+		if msg == nil {
+			return
+		}
+		words = rest
+
+		if data, ok := asm.Push(msg); ok {
+			c := Captured{
+				Time:   t,
+				Entity: entity,
+				Group:  ump.Group(msg[0]),
+				Data:   append([]byte(nil), data...),
+			}
+			r.messages = append(r.messages, c)
+			if r.OnMessage != nil {
+				r.OnMessage(c)
+			}
+		}
+	}
+}
+
+// Messages returns the messages captured so far.
+func (r *Recorder) Messages() []Captured {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Captured(nil), r.messages...)
+}
+
+// Data returns the bytes of the messages captured so far, ready to be
+// written with WriteFile.
+func (r *Recorder) Data() [][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([][]byte, len(r.messages))
+	for i, c := range r.messages {
+		out[i] = c.Data
+	}
+	return out
+}
+
+// Reset discards captured messages and partially assembled ones.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = nil
+	clear(r.asm)
+}
@@ -0,0 +1,56 @@
+package sysex
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ReplayOptions controls the pacing of Replay.
+type ReplayOptions struct {
+	// Delay between the end of one message and the start of the next.
+	Delay time.Duration
+
+	// If set, wait after each message until any message is received from
+	// the device, or the session's timeout passes, before continuing.
+	// Devices that acknowledge each block of a dump can then be fed as
+	// fast as they accept data.
+	WaitReply bool
+
+	// OnSent, if set, is called after each message is sent with its
+	// index and, if WaitReply is set, the reply or nil on timeout.
+	OnSent func(i int, reply []byte)
+}
+
+// Replay sends msgs through s in order, paced according to opts.
+func Replay(ctx context.Context, s *Session, msgs [][]byte, opts ReplayOptions) error {
+	for i, msg := range msgs {
+		if i > 0 && opts.Delay > 0 {
+			t := time.NewTimer(opts.Delay)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			}
+		}
+
+		var reply []byte
+		if opts.WaitReply {
+			replies, err := s.Request(ctx, msg, func([]byte) (bool, bool) { return true, true })
+			if err != nil && !errors.Is(err, ErrTimeout) {
+				return err
+			}
+			if len(replies) > 0 {
+				reply = replies[0]
+			}
+		} else if err := s.Send(msg); err != nil {
+			return err
+		}
+
+		if opts.OnSent != nil {
+			opts.OnSent(i, reply)
+		}
+	}
+	return nil
+}
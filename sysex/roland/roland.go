@@ -0,0 +1,184 @@
+// Package roland builds and parses Roland address-mapped System Exclusive
+// messages: Data Set 1 (DT1) and Data Request 1 (RQ1).
+//
+// Addresses and sizes are packed 7 bits per byte, most significant byte
+// first, exactly as they appear in Roland's parameter address maps; e.g.
+// the address written "01 00 02 00" is 0x01000200.
+package roland
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jaz303/midi/sysex"
+)
+
+const (
+	ManufacturerID = 0x41
+
+	CmdRQ1 = 0x11
+	CmdDT1 = 0x12
+
+	// BroadcastDevice addresses every device regardless of its ID.
+	BroadcastDevice = 0x7F
+)
+
+// Model describes how a device frames its messages.
+type Model struct {
+	// Model ID bytes, e.g. {0x6A} for the JV-1080 or {0x00, 0x00, 0x3B}
+	// for newer instruments.
+	ID []byte
+
+	// Bytes per address and size; 4 if zero.
+	AddressSize int
+}
+
+func (m *Model) addressSize() int {
+	if m.AddressSize == 0 {
+		return 4
+	}
+	return m.AddressSize
+}
+
+func (m *Model) header(dst []byte, device, cmd byte) []byte {
+	dst = append(dst, sysex.Start, ManufacturerID, device&0x7F)
+	dst = append(dst, m.ID...)
+	return append(dst, cmd)
+}
+
+// Message is a parsed DT1 or RQ1 message.
+type Message struct {
+	Device  byte
+	Command byte
+	Address uint32
+	Data    []byte // DT1 only
+	Size    int    // RQ1 only, in bytes
+}
+
+// DT1 returns a Data Set 1 message writing data at addr.
+func DT1(m *Model, device byte, addr uint32, data []byte) []byte {
+	out := m.header(nil, device, CmdDT1)
+	body := len(out)
+	out = appendPacked(out, addr, m.addressSize())
+	out = append(out, data...)
+	out = append(out, sysex.Checksum(out[body:]))
+	return append(out, sysex.End)
+}
+
+// RQ1 returns a Data Request 1 message for size bytes starting at addr.
+func RQ1(m *Model, device byte, addr uint32, size int) []byte {
+	out := m.header(nil, device, CmdRQ1)
+	body := len(out)
+	out = appendPacked(out, addr, m.addressSize())
+	out = appendPacked(out, pack(uint32(size)), m.addressSize())
+	out = append(out, sysex.Checksum(out[body:]))
+	return append(out, sysex.End)
+}
+
+// Parse parses a DT1 or RQ1 message for model m, verifying its checksum.
+// Data aliases msg.
+func Parse(m *Model, msg []byte) (*Message, error) {
+	n := m.addressSize()
+	hdr := 3 + len(m.ID) + 1
+	if len(msg) < hdr+n+2 || msg[0] != sysex.Start || msg[len(msg)-1] != sysex.End ||
+		msg[1] != ManufacturerID || string(msg[3:3+len(m.ID)]) != string(m.ID) {
+		return nil, sysex.ErrMalformed
+	}
+
+	body := msg[hdr : len(msg)-2]
+	if sysex.Checksum(body) != msg[len(msg)-2] {
+		return nil, sysex.ErrChecksum
+	}
+
+	out := &Message{
+		Device:  msg[2],
+		Command: msg[hdr-1],
+		Address: unpack(body[:n]),
+	}
+	switch out.Command {
+	case CmdDT1:
+		out.Data = body[n:]
+	case CmdRQ1:
+		if len(body) != 2*n {
+			return nil, sysex.ErrMalformed
+		}
+		out.Size = int(linear(unpack(body[n:])))
+	default:
+		return nil, fmt.Errorf("%w: unknown command %02X", sysex.ErrMalformed, out.Command)
+	}
+	return out, nil
+}
+
+// Offset adds n bytes to a packed address, carrying between 7-bit bytes.
+func Offset(addr uint32, n int) uint32 {
+	return pack(linear(addr) + uint32(n))
+}
+
+// Distance returns the number of bytes from packed address a to b.
+func Distance(a, b uint32) int {
+	return int(linear(b)) - int(linear(a))
+}
+
+func linear(v uint32) uint32 {
+	return v&0x7F | v>>8&0x7F<<7 | v>>16&0x7F<<14 | v>>24&0x7F<<21
+}
+
+func pack(v uint32) uint32 {
+	return v&0x7F | v>>7&0x7F<<8 | v>>14&0x7F<<16 | v>>21&0x7F<<24
+}
+
+func appendPacked(dst []byte, v uint32, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		dst = append(dst, byte(v>>(8*i))&0x7F)
+	}
+	return dst
+}
+
+func unpack(b []byte) uint32 {
+	var v uint32
+	for _, x := range b {
+		v = v<<8 | uint32(x&0x7F)
+	}
+	return v
+}
+
+// Device reads and writes the parameter memory of a device through a
+// sysex.Session.
+type Device struct {
+	Session *sysex.Session
+	Model   *Model
+	ID      byte
+}
+
+// Write sends a DT1 writing data at addr.
+func (d *Device) Write(addr uint32, data []byte) error {
+	return d.Session.Send(DT1(d.Model, d.ID, addr, data))
+}
+
+// Read sends an RQ1 for size bytes at addr and returns the data. Devices
+// may answer with several DT1 messages; they are combined in address
+// order, and the reply is complete once size bytes have arrived.
+func (d *Device) Read(ctx context.Context, addr uint32, size int) ([]byte, error) {
+	out := make([]byte, size)
+	got := 0
+	replies, err := d.Session.Request(ctx, RQ1(d.Model, d.ID, addr, size), func(msg []byte) (bool, bool) {
+		m, err := Parse(d.Model, msg)
+		if err != nil || m.Command != CmdDT1 {
+			return false, false
+		}
+		off := Distance(addr, m.Address)
+		if off < 0 || off+len(m.Data) > size {
+			return false, false
+		}
+		got += len(m.Data)
+		return true, got >= size
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range replies {
+		m, _ := Parse(d.Model, msg)
+		copy(out[Distance(addr, m.Address):], m.Data)
+	}
+	return out, nil
+}
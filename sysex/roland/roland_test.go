@@ -0,0 +1,206 @@
+package roland
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/sysex"
+	"github.com/jaz303/midi/ump"
+)
+
+var (
+	gs     = &Model{ID: []byte{0x42}, AddressSize: 3}
+	jv1080 = &Model{ID: []byte{0x6A}}
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  []byte
+		want []byte
+	}{
+		{
+			"GS reset",
+			DT1(gs, 0x10, 0x40007F, []byte{0x00}),
+			[]byte{0xF0, 0x41, 0x10, 0x42, 0x12, 0x40, 0x00, 0x7F, 0x00, 0x41, 0xF7},
+		},
+		{
+			"patch common request",
+			RQ1(jv1080, 0x10, 0x03000000, 72),
+			[]byte{0xF0, 0x41, 0x10, 0x6A, 0x11, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x48, 0x35, 0xF7},
+		},
+		{
+			"size carried into the next byte",
+			RQ1(gs, 0x7F, 0x000000, 200),
+			[]byte{0xF0, 0x41, 0x7F, 0x42, 0x11, 0x00, 0x00, 0x00, 0x00, 0x01, 0x48, 0x37, 0xF7},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !bytes.Equal(tt.msg, tt.want) {
+				t.Errorf("got % X, want % X", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		model *Model
+		msg   []byte
+		want  Message
+	}{
+		{
+			"DT1",
+			jv1080,
+			DT1(jv1080, 0x11, 0x0300000C, []byte{0x7F, 0x01}),
+			Message{Device: 0x11, Command: CmdDT1, Address: 0x0300000C, Data: []byte{0x7F, 0x01}},
+		},
+		{
+			"RQ1",
+			gs,
+			RQ1(gs, BroadcastDevice, 0x400100, 300),
+			Message{Device: BroadcastDevice, Command: CmdRQ1, Address: 0x400100, Size: 300},
+		},
+		{
+			"extended model ID",
+			&Model{ID: []byte{0x00, 0x00, 0x3B}},
+			DT1(&Model{ID: []byte{0x00, 0x00, 0x3B}}, 0x10, 0x18000000, nil),
+			Message{Device: 0x10, Command: CmdDT1, Address: 0x18000000, Data: []byte{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(tt.model, tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Device != tt.want.Device || m.Command != tt.want.Command || m.Address != tt.want.Address ||
+				m.Size != tt.want.Size || !bytes.Equal(m.Data, tt.want.Data) {
+				t.Errorf("Parse = %+v, want %+v", m, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	dt1 := DT1(jv1080, 0x10, 0x03000000, []byte{1, 2, 3})
+	corrupt := func(i int, b byte) []byte {
+		out := append([]byte(nil), dt1...)
+		out[i] = b
+		return out
+	}
+	badCommand := []byte{0xF0, 0x41, 0x10, 0x6A, 0x13, 0x03, 0x00, 0x00, 0x00, 0x7D, 0xF7}
+	shortRQ1 := []byte{0xF0, 0x41, 0x10, 0x6A, 0x11, 0x03, 0x00, 0x00, 0x00, 0x00, 0x7D, 0xF7}
+
+	tests := []struct {
+		name string
+		msg  []byte
+		want error
+	}{
+		{"empty", nil, sysex.ErrMalformed},
+		{"short", dt1[:8], sysex.ErrMalformed},
+		{"unterminated", dt1[:len(dt1)-1], sysex.ErrMalformed},
+		{"other manufacturer", corrupt(1, 0x43), sysex.ErrMalformed},
+		{"other model", corrupt(3, 0x6B), sysex.ErrMalformed},
+		{"bad checksum", corrupt(len(dt1)-2, 0), sysex.ErrChecksum},
+		{"corrupt data", corrupt(9, 4), sysex.ErrChecksum},
+		{"unknown command", badCommand, sysex.ErrMalformed},
+		{"RQ1 without size", shortRQ1, sysex.ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(jv1080, tt.msg); !errors.Is(err, tt.want) {
+				t.Errorf("Parse = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOffset(t *testing.T) {
+	tests := []struct {
+		addr uint32
+		n    int
+		want uint32
+	}{
+		{0x00000000, 0x7F, 0x0000007F},
+		{0x0000007F, 1, 0x00000100},
+		{0x01007F7F, 1, 0x01010000},
+		{0x03000000, 72, 0x03000048},
+		{0x03000048, 200, 0x03000210},
+	}
+	for _, tt := range tests {
+		if got := Offset(tt.addr, tt.n); got != tt.want {
+			t.Errorf("Offset(%08X, %d) = %08X, want %08X", tt.addr, tt.n, got, tt.want)
+		}
+		if got := Distance(tt.addr, tt.want); got != tt.n {
+			t.Errorf("Distance(%08X, %08X) = %d, want %d", tt.addr, tt.want, got, tt.n)
+		}
+	}
+}
+
+// device is a driver that records what is sent to it and answers every
+// RQ1 with DT1 messages for the requested range, split into chunks of the
+// given size and sent in reverse order.
+type device struct {
+	midi.Driver
+	session *sysex.Session
+	memory  func(addr uint32) byte
+	chunk   int
+	sent    [][]byte
+}
+
+func (d *device) SendSysExV1(_ midi.Entity, data []byte) error {
+	d.sent = append(d.sent, append([]byte(nil), data...))
+	m, err := Parse(jv1080, data)
+	if err != nil || m.Command != CmdRQ1 {
+		return nil
+	}
+	var replies [][]byte
+	for off := 0; off < m.Size; off += d.chunk {
+		addr := Offset(m.Address, off)
+		var block []byte
+		for i := 0; i < min(d.chunk, m.Size-off); i++ {
+			block = append(block, d.memory(Offset(addr, i)))
+		}
+		replies = append([][]byte{DT1(jv1080, m.Device, addr, block)}, replies...)
+	}
+	for _, r := range replies {
+		d.session.Handle(ump.AppendSysEx7(nil, 0, r))
+	}
+	return nil
+}
+
+func TestDeviceRead(t *testing.T) {
+	d := &device{
+		memory: func(addr uint32) byte { return byte(addr) & 0x7F },
+		chunk:  64,
+	}
+	d.session = sysex.NewSession(d, 1, 0, 0)
+	dev := &Device{Session: d.session, Model: jv1080, ID: 0x10}
+
+	addr := uint32(0x03000070)
+	got, err := dev.Read(context.Background(), addr, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, b := range got {
+		if want := byte(Offset(addr, i)) & 0x7F; b != want {
+			t.Fatalf("byte %d = %02X, want %02X", i, b, want)
+		}
+	}
+
+	d.sent = nil
+	if err := dev.Write(0x0300000C, []byte{0x64}); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]byte{{0xF0, 0x41, 0x10, 0x6A, 0x12, 0x03, 0x00, 0x00, 0x0C, 0x64, 0x0D, 0xF7}}
+	if !reflect.DeepEqual(d.sent, want) {
+		t.Errorf("Write sent % X, want % X", d.sent, want)
+	}
+}
@@ -0,0 +1,249 @@
+package schema
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jaz303/midi/sysex"
+	"github.com/jaz303/midi/sysex/roland"
+	"github.com/jaz303/midi/sysex/yamaha"
+)
+
+// Values holds stored parameter values by name.
+type Values map[string]int
+
+func bitsPerByte(packing string) int {
+	switch packing {
+	case Packing7Bit:
+		return 7
+	case PackingNibble, PackingNibbleLE:
+		return 4
+	}
+	return 0
+}
+
+func maxValue(p *Parameter) int {
+	bits := bitsPerByte(p.Packing) * p.Size
+	if bits >= 31 {
+		return 1<<31 - 1
+	}
+	return 1<<bits - 1
+}
+
+// Decode extracts a parameter's stored value from its block's data.
+func (p *Parameter) Decode(block []byte) int {
+	b := block[p.Offset.Bytes():][:p.Size]
+	bits := bitsPerByte(p.Packing)
+	mask := byte(1<<bits - 1)
+
+	v := 0
+	if p.Packing == PackingNibbleLE {
+		for i := len(b) - 1; i >= 0; i-- {
+			v = v<<bits | int(b[i]&mask)
+		}
+	} else {
+		for _, x := range b {
+			v = v<<bits | int(x&mask)
+		}
+	}
+	return v
+}
+
+// Encode returns the bytes that store v.
+func (p *Parameter) Encode(v int) ([]byte, error) {
+	if v < p.Min || v > p.Max {
+		return nil, fmt.Errorf("%w: %s %d not in %d-%d", ErrRange, p.Name, v, p.Min, p.Max)
+	}
+	bits := bitsPerByte(p.Packing)
+	mask := 1<<bits - 1
+
+	out := make([]byte, p.Size)
+	for i := range out {
+		x := byte(v >> (bits * i) & mask)
+		if p.Packing == PackingNibbleLE {
+			out[i] = x
+		} else {
+			out[len(out)-1-i] = x
+		}
+	}
+	return out, nil
+}
+
+// Format returns the display form of a stored value: its enum name, or the
+// value plus Bias.
+func (p *Parameter) Format(v int) string {
+	if i := v - p.Min; i >= 0 && i < len(p.Enum) {
+		return p.Enum[i]
+	}
+	return fmt.Sprint(v + p.Bias)
+}
+
+// Value returns the stored value for an enum name.
+func (p *Parameter) Value(name string) (int, bool) {
+	for i, e := range p.Enum {
+		if e == name {
+			return p.Min + i, true
+		}
+	}
+	return 0, false
+}
+
+// Decode extracts every parameter from a block's data.
+func (b *Block) Decode(data []byte) (Values, error) {
+	if len(data) < b.Size {
+		return nil, fmt.Errorf("%w: block %q needs %d bytes, got %d", sysex.ErrMalformed, b.Name, b.Size, len(data))
+	}
+	out := Values{}
+	for _, p := range b.Parameters {
+		out[p.Name] = p.Decode(data)
+	}
+	return out, nil
+}
+
+// Encode returns a block's data with values stored. Parameters missing
+// from values are stored as their minimum, and bytes not covered by any
+// parameter are zero.
+func (b *Block) Encode(values Values) ([]byte, error) {
+	out := make([]byte, b.Size)
+	for _, p := range b.Parameters {
+		v, ok := values[p.Name]
+		if !ok {
+			v = p.Min
+		}
+		enc, err := p.Encode(v)
+		if err != nil {
+			return nil, err
+		}
+		copy(out[p.Offset.Bytes():], enc)
+	}
+	return out, nil
+}
+
+// MARK: Messages
+
+func (s *Schema) rolandModel() *roland.Model {
+	return &roland.Model{ID: s.Model, AddressSize: s.AddressSize}
+}
+
+// SetParameter returns the message that writes v to a parameter: a DT1 or
+// a parameter change.
+func (s *Schema) SetParameter(b *Block, p *Parameter, v int) ([]byte, error) {
+	data, err := p.Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	addr := uint32(b.Address.Add(p.Offset.Bytes()))
+	if s.Format == FormatRoland {
+		return roland.DT1(s.rolandModel(), s.Device, addr, data), nil
+	}
+	return yamaha.ParameterChange(s.Model, s.Device, addr, data), nil
+}
+
+// WriteBlock returns the message that writes a whole block: a DT1 or a
+// bulk dump.
+func (s *Schema) WriteBlock(b *Block, values Values) ([]byte, error) {
+	data, err := b.Encode(values)
+	if err != nil {
+		return nil, err
+	}
+	if s.Format == FormatRoland {
+		return roland.DT1(s.rolandModel(), s.Device, uint32(b.Address), data), nil
+	}
+	return yamaha.BulkDump(s.Model, s.Device, uint32(b.Address), data), nil
+}
+
+// RequestBlock returns the message that asks the device for a block: an
+// RQ1 or a dump request.
+func (s *Schema) RequestBlock(b *Block) []byte {
+	if s.Format == FormatRoland {
+		return roland.RQ1(s.rolandModel(), s.Device, uint32(b.Address), b.Size)
+	}
+	return yamaha.DumpRequest(s.Model, s.Device, uint32(b.Address))
+}
+
+// DecodeDump decodes a DT1 or bulk dump holding a whole block, such as one
+// read from a .syx file, verifying its checksum.
+func (s *Schema) DecodeDump(msg []byte) (*Block, Values, error) {
+	var addr uint32
+	var data []byte
+	if s.Format == FormatRoland {
+		m, err := roland.Parse(s.rolandModel(), msg)
+		if err != nil {
+			return nil, nil, err
+		}
+		addr, data = m.Address, m.Data
+	} else {
+		m, err := yamaha.Parse(s.Model, msg)
+		if err != nil {
+			return nil, nil, err
+		}
+		addr, data = m.Address, m.Data
+	}
+
+	b, ok := s.BlockAt(Address(addr))
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: no block at address %08X", ErrUnknown, addr)
+	}
+	v, err := b.Decode(data)
+	return b, v, err
+}
+
+// MARK: Editor
+
+// Editor reads and writes a device's parameters by name through a
+// sysex.Session.
+type Editor struct {
+	Schema  *Schema
+	Session *sysex.Session
+}
+
+// ReadBlock requests a block from the device and decodes it.
+func (e *Editor) ReadBlock(ctx context.Context, block string) (Values, error) {
+	b, err := e.Schema.Block(block)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	if e.Schema.Format == FormatRoland {
+		d := &roland.Device{Session: e.Session, Model: e.Schema.rolandModel(), ID: e.Schema.Device}
+		data, err = d.Read(ctx, uint32(b.Address), b.Size)
+	} else {
+		d := &yamaha.Device{Session: e.Session, Model: e.Schema.Model, ID: e.Schema.Device}
+		data, err = d.ReadBulk(ctx, uint32(b.Address))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return b.Decode(data)
+}
+
+// WriteBlock sends a whole block to the device.
+func (e *Editor) WriteBlock(block string, values Values) error {
+	b, err := e.Schema.Block(block)
+	if err != nil {
+		return err
+	}
+	msg, err := e.Schema.WriteBlock(b, values)
+	if err != nil {
+		return err
+	}
+	return e.Session.Send(msg)
+}
+
+// Set writes a single parameter.
+func (e *Editor) Set(block, param string, v int) error {
+	b, err := e.Schema.Block(block)
+	if err != nil {
+		return err
+	}
+	p, err := b.Parameter(param)
+	if err != nil {
+		return err
+	}
+	msg, err := e.Schema.SetParameter(b, p, v)
+	if err != nil {
+		return err
+	}
+	return e.Session.Send(msg)
+}
@@ -0,0 +1,266 @@
+// Package schema describes the parameter map of a device in JSON and uses
+// the description to encode and decode its System Exclusive messages.
+//
+// A schema lists blocks of parameter memory. Each block has an address and
+// a size, and each parameter an offset within its block, a size in bytes,
+// a packing, a range and optionally enumerated value names:
+//
+//	{
+//	  "name": "JV-1080",
+//	  "format": "roland",
+//	  "model": "6A",
+//	  "device": 16,
+//	  "blocks": [{
+//	    "name": "Patch Common",
+//	    "address": "03 00 00 00",
+//	    "size": 72,
+//	    "parameters": [
+//	      {"name": "Level", "offset": "00 0C", "max": 127},
+//	      {"name": "Key Mode", "offset": 30, "max": 1, "enum": ["Poly", "Solo"]},
+//	      {"name": "Tempo", "offset": 40, "size": 2, "packing": "nibble", "min": 20, "max": 250}
+//	    ]
+//	  }]
+//	}
+//
+// Addresses and offsets are given either as strings of hex bytes, packed
+// 7 bits per byte as printed in manufacturers' address maps, or as plain
+// numbers of bytes. The format selects the message framing and checksum:
+// "roland" uses DT1/RQ1 and "yamaha" uses parameter change and bulk dump.
+package schema
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jaz303/midi/sysex/roland"
+)
+
+const (
+	FormatRoland = "roland"
+	FormatYamaha = "yamaha"
+
+	// Value packings
+	Packing7Bit     = "7bit"      // 7 bits per byte, most significant first
+	PackingNibble   = "nibble"    // 4 bits per byte, most significant first
+	PackingNibbleLE = "nibble-le" // 4 bits per byte, least significant first
+)
+
+var (
+	ErrInvalidSchema = errors.New("invalid schema")
+	ErrRange         = errors.New("value out of range")
+	ErrUnknown       = errors.New("unknown block or parameter")
+)
+
+const (
+	// Largest block size and address, as addresses and sizes are at most
+	// four bytes packed 7 bits per byte
+	maxAddressBytes = 1<<28 - 1
+
+	// Largest parameter value, in bits, so values fit an int everywhere
+	maxParameterBits = 31
+)
+
+// Schema is a device's parameter map.
+type Schema struct {
+	Name   string   `json:"name"`
+	Format string   `json:"format"`
+	Model  HexBytes `json:"model"`
+	Device byte     `json:"device"`
+
+	// Roland only: bytes per address; 4 if zero
+	AddressSize int `json:"addressSize,omitempty"`
+
+	Blocks []*Block `json:"blocks"`
+}
+
+// Block is a contiguous range of parameter memory, read and written as a
+// whole by bulk requests.
+type Block struct {
+	Name       string       `json:"name"`
+	Address    Address      `json:"address"`
+	Size       int          `json:"size"`
+	Parameters []*Parameter `json:"parameters"`
+}
+
+// Parameter is a single value within a block.
+type Parameter struct {
+	Name    string  `json:"name"`
+	Offset  Address `json:"offset"`
+	Size    int     `json:"size,omitempty"` // bytes; 1 if zero
+	Packing string  `json:"packing,omitempty"`
+	Min     int     `json:"min"`
+	Max     int     `json:"max"`
+
+	// Added to the stored value for display, e.g. -64 for a pan
+	// parameter stored as 0-127
+	Bias int `json:"bias,omitempty"`
+
+	// Names of the values from Min upwards
+	Enum []string `json:"enum,omitempty"`
+}
+
+// Address is a 7-bit packed address, e.g. 0x01000200 for "01 00 02 00".
+// In JSON it is either a string of hex bytes in packed form, or a number
+// of bytes which is packed on decoding.
+type Address uint32
+
+func (a *Address) UnmarshalJSON(data []byte) error {
+	var n int
+	if err := json.Unmarshal(data, &n); err == nil {
+		if n < 0 || n > maxAddressBytes {
+			return fmt.Errorf("%w: address %d out of range", ErrInvalidSchema, n)
+		}
+		*a = Address(roland.Offset(0, n))
+		return nil
+	}
+	var b HexBytes
+	if err := json.Unmarshal(data, &b); err != nil {
+		return err
+	}
+	if len(b) > 4 {
+		return fmt.Errorf("%w: address %q is longer than 4 bytes", ErrInvalidSchema, data)
+	}
+	var v uint32
+	for _, x := range b {
+		if x > 0x7F {
+			return fmt.Errorf("%w: address %q is not 7-bit packed", ErrInvalidSchema, data)
+		}
+		v = v<<8 | uint32(x)
+	}
+	*a = Address(v)
+	return nil
+}
+
+func (a Address) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%02X %02X %02X %02X", byte(a>>24), byte(a>>16), byte(a>>8), byte(a)))
+}
+
+// Add returns the address n bytes after a.
+func (a Address) Add(n int) Address {
+	return Address(roland.Offset(uint32(a), n))
+}
+
+// Bytes returns the number of bytes an offset of a represents.
+func (a Address) Bytes() int {
+	return roland.Distance(0, uint32(a))
+}
+
+// HexBytes is a byte string written in JSON as hex digits, optionally
+// separated by spaces.
+type HexBytes []byte
+
+func (h *HexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSchema, err)
+	}
+	*h = b
+	return nil
+}
+
+func (h HexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("% X", []byte(h)))
+}
+
+// Parse decodes and validates a schema.
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSchema, err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Load reads a schema from a file.
+func Load(name string) (*Schema, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+func (s *Schema) validate() error {
+	switch s.Format {
+	case FormatRoland, FormatYamaha:
+	default:
+		return fmt.Errorf("%w: unknown format %q", ErrInvalidSchema, s.Format)
+	}
+	for _, b := range s.Blocks {
+		if b.Size <= 0 {
+			return fmt.Errorf("%w: block %q has no size", ErrInvalidSchema, b.Name)
+		}
+		if b.Size > maxAddressBytes {
+			return fmt.Errorf("%w: block %q is too large", ErrInvalidSchema, b.Name)
+		}
+		for _, p := range b.Parameters {
+			if p.Size == 0 {
+				p.Size = 1
+			}
+			if p.Packing == "" {
+				p.Packing = Packing7Bit
+			}
+			bits := bitsPerByte(p.Packing)
+			if bits == 0 {
+				return fmt.Errorf("%w: parameter %q has unknown packing %q", ErrInvalidSchema, p.Name, p.Packing)
+			}
+			if p.Size < 0 || p.Size > maxParameterBits/bits {
+				return fmt.Errorf("%w: parameter %q has an invalid size %d", ErrInvalidSchema, p.Name, p.Size)
+			}
+			if p.Offset.Bytes()+p.Size > b.Size {
+				return fmt.Errorf("%w: parameter %q extends past the end of block %q", ErrInvalidSchema, p.Name, b.Name)
+			}
+			if p.Min < 0 || p.Max < p.Min {
+				return fmt.Errorf("%w: parameter %q has an invalid range", ErrInvalidSchema, p.Name)
+			}
+			if p.Max > maxValue(p) {
+				return fmt.Errorf("%w: parameter %q range does not fit its size", ErrInvalidSchema, p.Name)
+			}
+			if len(p.Enum) > 0 && len(p.Enum) != p.Max-p.Min+1 {
+				return fmt.Errorf("%w: parameter %q has %d enum names for %d values", ErrInvalidSchema, p.Name, len(p.Enum), p.Max-p.Min+1)
+			}
+		}
+	}
+	return nil
+}
+
+// Block finds a block by name.
+func (s *Schema) Block(name string) (*Block, error) {
+	for _, b := range s.Blocks {
+		if b.Name == name {
+			return b, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: block %q", ErrUnknown, name)
+}
+
+// BlockAt finds the block starting at addr.
+func (s *Schema) BlockAt(addr Address) (*Block, bool) {
+	for _, b := range s.Blocks {
+		if b.Address == addr {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// Parameter finds a parameter by name.
+func (b *Block) Parameter(name string) (*Parameter, error) {
+	for _, p := range b.Parameters {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: parameter %q in block %q", ErrUnknown, name, b.Name)
+}
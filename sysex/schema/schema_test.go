@@ -0,0 +1,357 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/jaz303/midi/sysex"
+	"github.com/jaz303/midi/sysex/roland"
+)
+
+const jv1080 = `{
+  "name": "JV-1080",
+  "format": "roland",
+  "model": "6A",
+  "device": 16,
+  "blocks": [{
+    "name": "Patch Common",
+    "address": "03 00 00 00",
+    "size": 72,
+    "parameters": [
+      {"name": "Level", "offset": "00 0C", "max": 127},
+      {"name": "Key Mode", "offset": 30, "max": 1, "enum": ["Poly", "Solo"]},
+      {"name": "Pan", "offset": 31, "max": 127, "bias": -64},
+      {"name": "Tempo", "offset": 40, "size": 2, "packing": "nibble", "min": 20, "max": 250}
+    ]
+  }, {
+    "name": "Patch Tone 1",
+    "address": "03 00 10 00",
+    "size": 200,
+    "parameters": [
+      {"name": "Wave", "offset": "01 00", "size": 4, "packing": "nibble-le", "max": 65535}
+    ]
+  }]
+}`
+
+const xg = `{
+  "name": "XG",
+  "format": "yamaha",
+  "model": "4C",
+  "blocks": [{
+    "name": "Multi Part 1",
+    "address": "08 00 00",
+    "size": 12,
+    "parameters": [
+      {"name": "Bank MSB", "offset": 1, "max": 127},
+      {"name": "Volume", "offset": 11, "max": 127}
+    ]
+  }]
+}`
+
+func mustParse(t *testing.T, data string) *Schema {
+	t.Helper()
+	s, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParse(t *testing.T) {
+	s := mustParse(t, jv1080)
+	if s.Name != "JV-1080" || s.Format != FormatRoland || !bytes.Equal(s.Model, []byte{0x6A}) || s.Device != 16 {
+		t.Errorf("schema = %+v", s)
+	}
+
+	b, err := s.Block("Patch Tone 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Address != 0x03001000 || b.Size != 200 {
+		t.Errorf("block at %08X, size %d", uint32(b.Address), b.Size)
+	}
+	if got, ok := s.BlockAt(0x03000000); !ok || got.Name != "Patch Common" {
+		t.Errorf("BlockAt(03 00 00 00) = %v, %v", got, ok)
+	}
+	if _, err := s.Block("Rhythm"); !errors.Is(err, ErrUnknown) {
+		t.Errorf("Block of unknown name = %v, want %v", err, ErrUnknown)
+	}
+
+	common := s.Blocks[0]
+	tests := []struct {
+		name    string
+		offset  int
+		size    int
+		packing string
+	}{
+		{"Level", 12, 1, Packing7Bit},
+		{"Key Mode", 30, 1, Packing7Bit},
+		{"Tempo", 40, 2, PackingNibble},
+	}
+	for _, tt := range tests {
+		p, err := common.Parameter(tt.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Offset.Bytes() != tt.offset || p.Size != tt.size || p.Packing != tt.packing {
+			t.Errorf("%s: offset %d, size %d, packing %q; want %d, %d, %q",
+				tt.name, p.Offset.Bytes(), p.Size, p.Packing, tt.offset, tt.size, tt.packing)
+		}
+	}
+	if _, err := common.Parameter("Wave"); !errors.Is(err, ErrUnknown) {
+		t.Errorf("Parameter of another block = %v, want %v", err, ErrUnknown)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	schema := func(block, param string) string {
+		return fmt.Sprintf(`{"format": "roland", "model": "6A", "blocks": [{"name": "B", %s, "parameters": [{"name": "P", %s}]}]}`, block, param)
+	}
+	ok := `"address": 0, "size": 16`
+
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"not JSON", `{"format": `},
+		{"unknown format", `{"format": "korg"}`},
+		{"bad model", `{"format": "roland", "model": "6G"}`},
+		{"no block size", schema(`"address": 0`, `"max": 1`)},
+		{"negative block size", schema(`"address": 0, "size": -1`, `"max": 1`)},
+		{"block too large", schema(`"address": 0, "size": 268435456`, `"max": 1`)},
+		{"negative address", schema(`"address": -1, "size": 16`, `"max": 1`)},
+		{"address too large", schema(`"address": 268435456, "size": 16`, `"max": 1`)},
+		{"address too long", schema(`"address": "00 00 00 00 00", "size": 16`, `"max": 1`)},
+		{"address not 7-bit", schema(`"address": "03 80 00 00", "size": 16`, `"max": 1`)},
+		{"negative offset", schema(ok, `"offset": -4, "max": 1`)},
+		{"offset past end", schema(ok, `"offset": 16, "max": 1`)},
+		{"value past end", schema(ok, `"offset": 15, "size": 2, "max": 1`)},
+		{"negative size", schema(ok, `"size": -2, "max": 1`)},
+		{"oversized 7-bit", schema(ok, `"size": 5, "max": 1`)},
+		{"oversized nibbles", schema(ok, `"size": 8, "packing": "nibble", "max": 1`)},
+		{"unknown packing", schema(ok, `"packing": "8bit", "max": 1`)},
+		{"negative min", schema(ok, `"min": -1, "max": 1`)},
+		{"max below min", schema(ok, `"min": 5, "max": 4`)},
+		{"range too wide", schema(ok, `"max": 128`)},
+		{"enum count", schema(ok, `"max": 2, "enum": ["A", "B"]`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.data)); !errors.Is(err, ErrInvalidSchema) {
+				t.Errorf("Parse = %v, want %v", err, ErrInvalidSchema)
+			}
+		})
+	}
+}
+
+func TestAddressJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		addr Address
+	}{
+		{`"03 00 10 00"`, 0x03001000},
+		{`"0C"`, 0x0C},
+		{`""`, 0},
+		{`127`, 0x7F},
+		{`128`, 0x0100},
+		{`268435455`, 0x7F7F7F7F},
+	}
+	for _, tt := range tests {
+		var a Address
+		if err := json.Unmarshal([]byte(tt.json), &a); err != nil {
+			t.Errorf("Unmarshal(%s) = %v", tt.json, err)
+			continue
+		}
+		if a != tt.addr {
+			t.Errorf("Unmarshal(%s) = %08X, want %08X", tt.json, uint32(a), uint32(tt.addr))
+		}
+		data, _ := json.Marshal(a)
+		var back Address
+		if err := json.Unmarshal(data, &back); err != nil || back != a {
+			t.Errorf("round trip of %08X through %s = %08X, %v", uint32(a), data, uint32(back), err)
+		}
+	}
+}
+
+func TestParameterCodec(t *testing.T) {
+	tests := []struct {
+		name  string
+		param Parameter
+		v     int
+		enc   []byte
+	}{
+		{"7-bit", Parameter{Size: 1, Packing: Packing7Bit, Max: 127}, 100, []byte{0x64}},
+		{"7-bit pair", Parameter{Size: 2, Packing: Packing7Bit, Max: 16383}, 300, []byte{0x02, 0x2C}},
+		{"nibbles", Parameter{Size: 2, Packing: PackingNibble, Max: 255}, 0xAB, []byte{0x0A, 0x0B}},
+		{"little-endian nibbles", Parameter{Size: 4, Packing: PackingNibbleLE, Max: 65535}, 0x1234, []byte{4, 3, 2, 1}},
+		{"widest", Parameter{Size: 4, Packing: Packing7Bit, Max: 1<<28 - 1}, 1<<28 - 1, []byte{0x7F, 0x7F, 0x7F, 0x7F}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := tt.param.Encode(tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(enc, tt.enc) {
+				t.Errorf("Encode(%d) = % X, want % X", tt.v, enc, tt.enc)
+			}
+			if v := tt.param.Decode(enc); v != tt.v {
+				t.Errorf("Decode(% X) = %d, want %d", enc, v, tt.v)
+			}
+			if _, err := tt.param.Encode(tt.param.Max + 1); !errors.Is(err, ErrRange) {
+				t.Errorf("Encode(max+1) = %v, want %v", err, ErrRange)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	s := mustParse(t, jv1080)
+	common := s.Blocks[0]
+	keyMode, _ := common.Parameter("Key Mode")
+	pan, _ := common.Parameter("Pan")
+
+	if got := keyMode.Format(1); got != "Solo" {
+		t.Errorf("Key Mode 1 = %q, want Solo", got)
+	}
+	if v, ok := keyMode.Value("Poly"); !ok || v != 0 {
+		t.Errorf("Value(Poly) = %d, %v", v, ok)
+	}
+	if _, ok := keyMode.Value("Mono"); ok {
+		t.Error("Value(Mono) found")
+	}
+	if got := pan.Format(0); got != "-64" {
+		t.Errorf("Pan 0 = %q, want -64", got)
+	}
+}
+
+func TestBlockCodec(t *testing.T) {
+	s := mustParse(t, jv1080)
+	common := s.Blocks[0]
+
+	data, err := common.Encode(Values{"Level": 100, "Key Mode": 1, "Tempo": 120})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 72 || data[12] != 100 || data[30] != 1 || data[40] != 0x07 || data[41] != 0x08 {
+		t.Errorf("Encode = % X", data)
+	}
+
+	got, err := common.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Values{"Level": 100, "Key Mode": 1, "Pan": 0, "Tempo": 120}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode = %v, want %v", got, want)
+	}
+
+	// missing values are stored as their minimum
+	data, _ = common.Encode(nil)
+	if got, _ := common.Decode(data); got["Tempo"] != 20 {
+		t.Errorf("default Tempo = %d, want 20", got["Tempo"])
+	}
+
+	if _, err := common.Encode(Values{"Level": 128}); !errors.Is(err, ErrRange) {
+		t.Errorf("Encode out of range = %v, want %v", err, ErrRange)
+	}
+	if _, err := common.Decode(data[:71]); !errors.Is(err, sysex.ErrMalformed) {
+		t.Errorf("Decode of short data = %v, want %v", err, sysex.ErrMalformed)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		block  string
+		values Values
+		set    string
+		v      int
+		msg    []byte
+	}{
+		{
+			"roland",
+			jv1080,
+			"Patch Tone 1",
+			Values{"Wave": 0x1234},
+			"Wave",
+			0x0102,
+			[]byte{0xF0, 0x41, 0x10, 0x6A, 0x12, 0x03, 0x00, 0x11, 0x00, 0x02, 0x00, 0x01, 0x00, 0x69, 0xF7},
+		},
+		{
+			"yamaha",
+			xg,
+			"Multi Part 1",
+			Values{"Bank MSB": 0x7F, "Volume": 90},
+			"Volume",
+			100,
+			[]byte{0xF0, 0x43, 0x10, 0x4C, 0x08, 0x00, 0x0B, 0x64, 0xF7},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := mustParse(t, tt.schema)
+			b, _ := s.Block(tt.block)
+
+			dump, err := s.WriteBlock(b, tt.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, values, err := s.DecodeDump(dump)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != b || !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("DecodeDump = %s %v, want %s %v", got.Name, values, b.Name, tt.values)
+			}
+
+			p, _ := b.Parameter(tt.set)
+			msg, err := s.SetParameter(b, p, tt.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(msg, tt.msg) {
+				t.Errorf("SetParameter = % X, want % X", msg, tt.msg)
+			}
+			if len(s.RequestBlock(b)) == 0 {
+				t.Error("RequestBlock returned no message")
+			}
+		})
+	}
+}
+
+func TestDecodeDumpInvalid(t *testing.T) {
+	s := mustParse(t, jv1080)
+	dump, err := s.WriteBlock(s.Blocks[0], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	elsewhere := append([]byte(nil), dump...)
+	elsewhere[7] = 0x20
+	elsewhere[len(elsewhere)-2] = (elsewhere[len(elsewhere)-2] - 0x20) & 0x7F
+	corrupt := append([]byte(nil), dump...)
+	corrupt[20]++
+
+	tests := []struct {
+		name string
+		msg  []byte
+		want error
+	}{
+		{"no block at address", elsewhere, ErrUnknown},
+		{"bad checksum", corrupt, sysex.ErrChecksum},
+		{"short block", roland.DT1(s.rolandModel(), 16, 0x03000000, make([]byte, 10)), sysex.ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := s.DecodeDump(tt.msg); !errors.Is(err, tt.want) {
+				t.Errorf("DecodeDump = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
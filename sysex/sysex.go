@@ -0,0 +1,192 @@
+// Package sysex provides request/response exchanges of MIDI 1.0 System
+// Exclusive messages with a device, as used by parameter editors and
+// librarians, along with capture, .syx file storage and paced replay.
+// Manufacturer-specific formats live in subpackages.
+package sysex
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+const (
+	Start = 0xF0
+	End   = 0xF7
+
+	// DefaultTimeout is the reply timeout used when none is configured.
+	DefaultTimeout = 2 * time.Second
+)
+
+var (
+	ErrMalformed = errors.New("malformed SysEx message")
+	ErrChecksum  = errors.New("SysEx checksum mismatch")
+	ErrTimeout   = errors.New("timed out waiting for SysEx reply")
+)
+
+// Checksum returns the 7-bit checksum used by Roland and Yamaha: the value
+// which, added to the sum of data, gives zero in the low seven bits.
+func Checksum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return (0x80 - sum&0x7F) & 0x7F
+}
+
+// Matcher is consulted for every message received while a request is
+// pending. It reports whether msg is part of the reply and whether the
+// reply is now complete.
+type Matcher func(msg []byte) (match, done bool)
+
+type request struct {
+	match   Matcher
+	replies [][]byte
+	done    chan struct{}
+}
+
+// Session exchanges System Exclusive messages with a single device. Requests
+// are sent with the driver's SendSysExV1; replies arrive through Handle or
+// the handler returned by Handler, reassembled from SysEx7 data messages on
+// the session's group.
+//
+// Session is safe for concurrent use, except that Handle must not be called
+// concurrently with itself.
+type Session struct {
+	driver  midi.Driver
+	output  midi.Entity
+	group   uint8
+	timeout time.Duration
+
+	asm ump.SysEx7Assembler
+
+	mu      sync.Mutex
+	pending []*request
+
+	// OnMessage, if set, receives every complete message that does not
+	// belong to a pending request. msg is only valid during the call.
+	OnMessage func(msg []byte)
+}
+
+// NewSession creates a Session that sends to output and accepts replies on
+// group. A zero timeout selects DefaultTimeout.
+func NewSession(driver midi.Driver, output midi.Entity, group uint8, timeout time.Duration) *Session {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	return &Session{
+		driver:  driver,
+		output:  output,
+		group:   group,
+		timeout: timeout,
+	}
+}
+
+// Handler returns a receive handler that passes events from input to
+// Handle before forwarding every event to next.
+func (s *Session) Handler(input midi.Entity, next midi.ReceiveEventHandler) midi.ReceiveEventHandler {
+	if next == nil {
+		next = midi.NopHandler
+	}
+	return func(time time.Time, entity midi.Entity, words []ump.Word) {
+		if entity == input {
+			s.Handle(words)
+		}
+		next(time, entity, words)
+	}
+}
+
+// Handle processes UMP data received from the device.
+func (s *Session) Handle(words []ump.Word) {
+	for len(words) > 0 {
+		msg, rest := ump.Next(words)
+		if msg == nil {
+			return
+		}
+		words = rest
+
+		if ump.MessageType(msg[0]) != ump.MsgTypeData || ump.Group(msg[0]) != s.group {
+			continue
+		}
+		if data, ok := s.asm.Push(msg); ok {
+			s.deliver(data)
+		}
+	}
+}
+
+// deliver hands a message to the oldest pending request that matches it.
+func (s *Session) deliver(data []byte) {
+	s.mu.Lock()
+	for i, r := range s.pending {
+		match, done := r.match(data)
+		if !match {
+			continue
+		}
+		r.replies = append(r.replies, append([]byte(nil), data...))
+		if done {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			close(r.done)
+		}
+		s.mu.Unlock()
+		return
+	}
+	s.mu.Unlock()
+
+	if s.OnMessage != nil {
+		s.OnMessage(data)
+	}
+}
+
+// Send sends a complete System Exclusive message, including its 0xF0/0xF7
+// framing.
+func (s *Session) Send(msg []byte) error {
+	if len(msg) < 2 || msg[0] != Start || msg[len(msg)-1] != End {
+		return ErrMalformed
+	}
+	return s.driver.SendSysExV1(s.output, msg)
+}
+
+// Request sends msg and collects the messages accepted by match until it
+// reports the reply complete. ErrTimeout is returned if the reply is not
+// complete within the session's timeout.
+func (s *Session) Request(ctx context.Context, msg []byte, match Matcher) ([][]byte, error) {
+	r := &request{match: match, done: make(chan struct{})}
+
+	s.mu.Lock()
+	s.pending = append(s.pending, r)
+	s.mu.Unlock()
+
+	if err := s.Send(msg); err != nil {
+		s.cancel(r)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	select {
+	case <-r.done:
+		return r.replies, nil
+	case <-ctx.Done():
+		s.cancel(r)
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, ErrTimeout
+		}
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Session) cancel(r *request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, p := range s.pending {
+		if p == r {
+			s.pending = append(s.pending[:i], s.pending[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package sysex
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/ump"
+)
+
+// responder is a driver that answers each message sent with SendSysExV1
+// by passing the messages returned by reply to the session's Handle.
+type responder struct {
+	midi.Driver
+	session *Session
+	reply   func(msg []byte) [][]byte
+}
+
+func (r *responder) SendSysExV1(_ midi.Entity, data []byte) error {
+	for _, msg := range r.reply(data) {
+		r.session.Handle(ump.AppendSysEx7(nil, r.session.group, msg))
+	}
+	return nil
+}
+
+func newSession(timeout time.Duration, reply func(msg []byte) [][]byte) *Session {
+	r := &responder{reply: reply}
+	r.session = NewSession(r, 1, 2, timeout)
+	return r.session
+}
+
+func TestChecksum(t *testing.T) {
+	tests := []struct {
+		data []byte
+		sum  byte
+	}{
+		{nil, 0x00},
+		{[]byte{0x40, 0x00, 0x7F, 0x00}, 0x41}, // GS reset
+		{[]byte{0x7F}, 0x01},
+		{[]byte{0x40, 0x40}, 0x00},
+		{[]byte{0x7F, 0x7F, 0x7F}, 0x03},
+	}
+	for _, tt := range tests {
+		sum := Checksum(tt.data)
+		if sum != tt.sum {
+			t.Errorf("Checksum(% X) = %02X, want %02X", tt.data, sum, tt.sum)
+		}
+		var total byte
+		for _, b := range tt.data {
+			total += b
+		}
+		if (total+sum)&0x7F != 0 {
+			t.Errorf("Checksum(% X) does not sum to zero", tt.data)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want [][]byte
+		err  bool
+	}{
+		{"empty", nil, nil, false},
+		{
+			"two messages",
+			[]byte{0xF0, 0x41, 0x10, 0xF7, 0xF0, 0x43, 0xF7},
+			[][]byte{{0xF0, 0x41, 0x10, 0xF7}, {0xF0, 0x43, 0xF7}},
+			false,
+		},
+		{
+			"bytes between messages",
+			[]byte{0x90, 0x3C, 0xF0, 0x7E, 0xF7, 0x01},
+			[][]byte{{0xF0, 0x7E, 0xF7}},
+			false,
+		},
+		{"real-time inside", []byte{0xF0, 0x7E, 0xF8, 0x01, 0xFE, 0xF7}, [][]byte{{0xF0, 0x7E, 0x01, 0xF7}}, false},
+		{"unterminated", []byte{0xF0, 0x7E, 0xF7, 0xF0, 0x01}, [][]byte{{0xF0, 0x7E, 0xF7}}, true},
+		{"interrupted by start", []byte{0xF0, 0x01, 0xF0, 0x02, 0xF7}, nil, true},
+		{"interrupted by status", []byte{0xF0, 0x01, 0x90, 0xF7}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Split(tt.data)
+			if tt.err != errors.Is(err, ErrMalformed) {
+				t.Errorf("Split error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split = % X, want % X", got, tt.want)
+			}
+			if !tt.err {
+				if again, _ := Split(Join(got)); !reflect.DeepEqual(again, got) {
+					t.Errorf("Split(Join) = % X", again)
+				}
+			}
+		})
+	}
+}
+
+func TestManufacturer(t *testing.T) {
+	tests := []struct {
+		msg  []byte
+		want []byte
+	}{
+		{[]byte{0xF0, 0x41, 0x10, 0xF7}, []byte{0x41}},
+		{[]byte{0xF0, 0x00, 0x20, 0x29, 0xF7}, []byte{0x00, 0x20, 0x29}},
+		{[]byte{0xF0, 0x00, 0x20}, nil},
+		{[]byte{0xF0}, nil},
+	}
+	for _, tt := range tests {
+		if got := Manufacturer(tt.msg); !bytes.Equal(got, tt.want) {
+			t.Errorf("Manufacturer(% X) = % X, want % X", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestFile(t *testing.T) {
+	name := t.TempDir() + "/dump.syx"
+	msgs := [][]byte{{0xF0, 0x41, 0x10, 0xF7}, {0xF0, 0x43, 0x10, 0x4C, 0xF7}}
+	if err := WriteFile(name, msgs); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, msgs) {
+		t.Errorf("ReadFile = % X, want % X", got, msgs)
+	}
+}
+
+func TestRequest(t *testing.T) {
+	req := []byte{0xF0, 0x7E, 0x7F, 0x06, 0x01, 0xF7}
+	id := []byte{0xF0, 0x7E, 0x10, 0x06, 0x02, 0x41, 0xF7}
+	other := []byte{0xF0, 0x43, 0x10, 0xF7}
+	isIdentity := func(msg []byte) (bool, bool) {
+		return len(msg) > 4 && msg[3] == 0x06 && msg[4] == 0x02, true
+	}
+
+	s := newSession(0, func([]byte) [][]byte { return [][]byte{other, id} })
+	var unmatched [][]byte
+	s.OnMessage = func(msg []byte) { unmatched = append(unmatched, append([]byte(nil), msg...)) }
+
+	replies, err := s.Request(context.Background(), req, isIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(replies, [][]byte{id}) {
+		t.Errorf("replies = % X, want % X", replies, id)
+	}
+	if !reflect.DeepEqual(unmatched, [][]byte{other}) {
+		t.Errorf("OnMessage got % X, want % X", unmatched, other)
+	}
+
+	// replies on other groups are ignored
+	s.Handle(ump.AppendSysEx7(nil, 3, other))
+	if len(unmatched) != 1 {
+		t.Errorf("message on another group delivered: % X", unmatched[1:])
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	silent := func([]byte) [][]byte { return nil }
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		msg  []byte
+		want error
+	}{
+		{"timeout", context.Background(), []byte{0xF0, 0x7E, 0xF7}, ErrTimeout},
+		{"canceled", canceled, []byte{0xF0, 0x7E, 0xF7}, context.Canceled},
+		{"unframed", context.Background(), []byte{0x7E, 0xF7}, ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSession(10*time.Millisecond, silent)
+			_, err := s.Request(tt.ctx, tt.msg, func([]byte) (bool, bool) { return true, true })
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Request = %v, want %v", err, tt.want)
+			}
+			if len(s.pending) != 0 {
+				t.Errorf("%d requests still pending", len(s.pending))
+			}
+		})
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder(1)
+	msg := []byte{0xF0, 0x41, 0x10, 0x42, 0x12, 0x40, 0x00, 0x7F, 0x00, 0x41, 0xF7}
+	words := ump.AppendSysEx7(nil, 0, msg)
+
+	r.Handle(time.Time{}, 1, words[:2])
+	r.Handle(time.Time{}, 2, words)
+	r.Handle(time.Time{}, 1, words[2:])
+	if got := r.Data(); !reflect.DeepEqual(got, [][]byte{msg}) {
+		t.Errorf("Data = % X, want % X", got, msg)
+	}
+
+	r.Reset()
+	r.Handle(time.Time{}, 1, words[2:])
+	if got := r.Messages(); len(got) != 0 {
+		t.Errorf("captured % X after Reset", got)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	msgs := [][]byte{{0xF0, 0x01, 0xF7}, {0xF0, 0x02, 0xF7}}
+	ack := []byte{0xF0, 0x7F, 0xF7}
+
+	var sent []int
+	var replies [][]byte
+	s := newSession(10*time.Millisecond, func(msg []byte) [][]byte {
+		if msg[1] == 0x01 {
+			return [][]byte{ack}
+		}
+		return nil
+	})
+	err := Replay(context.Background(), s, msgs, ReplayOptions{
+		Delay:     time.Millisecond,
+		WaitReply: true,
+		OnSent: func(i int, reply []byte) {
+			sent = append(sent, i)
+			replies = append(replies, reply)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sent, []int{0, 1}) || !reflect.DeepEqual(replies, [][]byte{ack, nil}) {
+		t.Errorf("OnSent calls %v with replies % X", sent, replies)
+	}
+}
@@ -0,0 +1,78 @@
+package sysex
+
+import (
+	"fmt"
+	"os"
+)
+
+// Split divides a byte stream, such as the contents of a .syx file, into
+// its System Exclusive messages. Bytes outside a message are skipped, as
+// are System Real-Time bytes within one; a message that is interrupted by
+// another status byte or by the end of data is an error.
+func Split(data []byte) ([][]byte, error) {
+	var out [][]byte
+	start := -1
+	var msg []byte
+	for i, b := range data {
+		switch {
+		case b == Start:
+			if start >= 0 {
+				return out, fmt.Errorf("%w: message at offset %d is unterminated", ErrMalformed, start)
+			}
+			start = i
+			msg = []byte{b}
+		case start < 0:
+		case b == End:
+			out = append(out, append(msg, b))
+			start = -1
+		case b >= 0xF8:
+		case b&0x80 != 0:
+			return out, fmt.Errorf("%w: message at offset %d is unterminated", ErrMalformed, start)
+		default:
+			msg = append(msg, b)
+		}
+	}
+	if start >= 0 {
+		return out, fmt.Errorf("%w: message at offset %d is unterminated", ErrMalformed, start)
+	}
+	return out, nil
+}
+
+// Join concatenates messages into a single byte stream.
+func Join(msgs [][]byte) []byte {
+	var out []byte
+	for _, m := range msgs {
+		out = append(out, m...)
+	}
+	return out
+}
+
+// ReadFile reads the messages in a .syx file.
+func ReadFile(name string) ([][]byte, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return Split(data)
+}
+
+// WriteFile writes messages to a .syx file.
+func WriteFile(name string, msgs [][]byte) error {
+	return os.WriteFile(name, Join(msgs), 0644)
+}
+
+// Manufacturer returns the manufacturer ID of a message: one byte, or
+// three bytes beginning with zero for extended IDs. Universal messages have
+// the IDs 0x7E (non-real time) and 0x7F (real time).
+func Manufacturer(msg []byte) []byte {
+	if len(msg) < 2 {
+		return nil
+	}
+	if msg[1] == 0 {
+		if len(msg) < 4 {
+			return nil
+		}
+		return msg[1:4]
+	}
+	return msg[1:2]
+}
@@ -0,0 +1,165 @@
+// Package yamaha builds and parses Yamaha parameter change, parameter
+// request, bulk dump and dump request System Exclusive messages, as used by
+// XG and most Yamaha instruments since.
+//
+// Addresses are three 7-bit bytes, high first, packed as 0xHHMMLL.
+package yamaha
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jaz303/midi/sysex"
+)
+
+const (
+	ManufacturerID = 0x43
+
+	// Command nibbles, combined with the device number (0-15)
+	CmdBulkDump         = 0x00
+	CmdParameterChange  = 0x10
+	CmdDumpRequest      = 0x20
+	CmdParameterRequest = 0x30
+)
+
+// ModelXG is the model ID of the XG parameter map.
+var ModelXG = []byte{0x4C}
+
+// Message is a parsed Yamaha message.
+type Message struct {
+	Device  byte // 0-15
+	Command byte
+	Address uint32
+	Data    []byte // parameter change and bulk dump only
+}
+
+func header(dst []byte, model []byte, device, cmd byte) []byte {
+	dst = append(dst, sysex.Start, ManufacturerID, cmd|device&0x0F)
+	return append(dst, model...)
+}
+
+func appendAddress(dst []byte, addr uint32) []byte {
+	return append(dst, byte(addr>>16)&0x7F, byte(addr>>8)&0x7F, byte(addr)&0x7F)
+}
+
+// ParameterChange returns a message writing data at addr. Parameter
+// changes carry no checksum.
+func ParameterChange(model []byte, device byte, addr uint32, data []byte) []byte {
+	out := header(nil, model, device, CmdParameterChange)
+	out = appendAddress(out, addr)
+	out = append(out, data...)
+	return append(out, sysex.End)
+}
+
+// ParameterRequest returns a message asking for the parameter at addr,
+// which the device answers with a parameter change.
+func ParameterRequest(model []byte, device byte, addr uint32) []byte {
+	out := header(nil, model, device, CmdParameterRequest)
+	out = appendAddress(out, addr)
+	return append(out, sysex.End)
+}
+
+// BulkDump returns a bulk dump of data starting at addr. The byte count and
+// checksum cover the address and data.
+func BulkDump(model []byte, device byte, addr uint32, data []byte) []byte {
+	out := header(nil, model, device, CmdBulkDump)
+	body := len(out)
+	out = append(out, byte(len(data)>>7)&0x7F, byte(len(data))&0x7F)
+	out = appendAddress(out, addr)
+	out = append(out, data...)
+	out = append(out, sysex.Checksum(out[body:]))
+	return append(out, sysex.End)
+}
+
+// DumpRequest returns a message asking for the block at addr, which the
+// device answers with a bulk dump.
+func DumpRequest(model []byte, device byte, addr uint32) []byte {
+	out := header(nil, model, device, CmdDumpRequest)
+	out = appendAddress(out, addr)
+	return append(out, sysex.End)
+}
+
+// Parse parses a message for model, verifying the byte count and checksum
+// of bulk dumps. Data aliases msg.
+func Parse(model []byte, msg []byte) (*Message, error) {
+	hdr := 3 + len(model)
+	if len(msg) < hdr+4 || msg[0] != sysex.Start || msg[len(msg)-1] != sysex.End ||
+		msg[1] != ManufacturerID || string(msg[3:hdr]) != string(model) {
+		return nil, sysex.ErrMalformed
+	}
+
+	out := &Message{Device: msg[2] & 0x0F, Command: msg[2] & 0x70}
+	body := msg[hdr : len(msg)-1]
+
+	switch out.Command {
+	case CmdBulkDump:
+		if len(body) < 6 {
+			return nil, sysex.ErrMalformed
+		}
+		count := int(body[0])<<7 | int(body[1])
+		if len(body) != count+6 {
+			return nil, fmt.Errorf("%w: byte count %d, got %d", sysex.ErrMalformed, count, len(body)-6)
+		}
+		if sysex.Checksum(body[:len(body)-1]) != body[len(body)-1] {
+			return nil, sysex.ErrChecksum
+		}
+		out.Address = address(body[2:])
+		out.Data = body[5 : len(body)-1]
+	case CmdParameterChange:
+		out.Address = address(body)
+		out.Data = body[3:]
+	case CmdDumpRequest, CmdParameterRequest:
+		if len(body) != 3 {
+			return nil, sysex.ErrMalformed
+		}
+		out.Address = address(body)
+	default:
+		return nil, fmt.Errorf("%w: unknown command %02X", sysex.ErrMalformed, out.Command)
+	}
+	return out, nil
+}
+
+func address(b []byte) uint32 {
+	return uint32(b[0]&0x7F)<<16 | uint32(b[1]&0x7F)<<8 | uint32(b[2]&0x7F)
+}
+
+// Device reads and writes the parameters of a device through a
+// sysex.Session.
+type Device struct {
+	Session *sysex.Session
+	Model   []byte
+	ID      byte // 0-15
+}
+
+// Write sends a parameter change writing data at addr.
+func (d *Device) Write(addr uint32, data []byte) error {
+	return d.Session.Send(ParameterChange(d.Model, d.ID, addr, data))
+}
+
+// WriteBulk sends a bulk dump of data at addr.
+func (d *Device) WriteBulk(addr uint32, data []byte) error {
+	return d.Session.Send(BulkDump(d.Model, d.ID, addr, data))
+}
+
+// Read requests the parameter at addr and returns its data.
+func (d *Device) Read(ctx context.Context, addr uint32) ([]byte, error) {
+	return d.request(ctx, ParameterRequest(d.Model, d.ID, addr), CmdParameterChange, addr)
+}
+
+// ReadBulk requests the block at addr and returns its data.
+func (d *Device) ReadBulk(ctx context.Context, addr uint32) ([]byte, error) {
+	return d.request(ctx, DumpRequest(d.Model, d.ID, addr), CmdBulkDump, addr)
+}
+
+func (d *Device) request(ctx context.Context, req []byte, cmd byte, addr uint32) ([]byte, error) {
+	var data []byte
+	_, err := d.Session.Request(ctx, req, func(msg []byte) (bool, bool) {
+		m, err := Parse(d.Model, msg)
+		if err != nil || m.Command != cmd || m.Address != addr {
+			return false, false
+		}
+		data = append([]byte(nil), m.Data...)
+		return true, true
+	})
+	return data, err
+}
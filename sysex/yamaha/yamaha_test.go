@@ -0,0 +1,183 @@
+package yamaha
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jaz303/midi"
+	"github.com/jaz303/midi/sysex"
+	"github.com/jaz303/midi/ump"
+)
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  []byte
+		want []byte
+	}{
+		{
+			"XG system on",
+			ParameterChange(ModelXG, 0, 0x00007E, []byte{0x00}),
+			[]byte{0xF0, 0x43, 0x10, 0x4C, 0x00, 0x00, 0x7E, 0x00, 0xF7},
+		},
+		{
+			"parameter request",
+			ParameterRequest(ModelXG, 3, 0x080107),
+			[]byte{0xF0, 0x43, 0x33, 0x4C, 0x08, 0x01, 0x07, 0xF7},
+		},
+		{
+			"bulk dump",
+			BulkDump(ModelXG, 0, 0x000000, []byte{1, 2, 3}),
+			[]byte{0xF0, 0x43, 0x00, 0x4C, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03, 0x77, 0xF7},
+		},
+		{
+			"dump request",
+			DumpRequest(ModelXG, 0, 0x020100),
+			[]byte{0xF0, 0x43, 0x20, 0x4C, 0x02, 0x01, 0x00, 0xF7},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !bytes.Equal(tt.msg, tt.want) {
+				t.Errorf("got % X, want % X", tt.msg, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	long := bytes.Repeat([]byte{0x55}, 200)
+
+	tests := []struct {
+		name string
+		msg  []byte
+		want Message
+	}{
+		{
+			"parameter change",
+			ParameterChange(ModelXG, 5, 0x080107, []byte{0x40}),
+			Message{Device: 5, Command: CmdParameterChange, Address: 0x080107, Data: []byte{0x40}},
+		},
+		{
+			"parameter request",
+			ParameterRequest(ModelXG, 0, 0x000004),
+			Message{Command: CmdParameterRequest, Address: 0x000004},
+		},
+		{
+			"bulk dump",
+			BulkDump(ModelXG, 15, 0x080000, long),
+			Message{Device: 15, Command: CmdBulkDump, Address: 0x080000, Data: long},
+		},
+		{
+			"dump request",
+			DumpRequest(ModelXG, 0, 0x020100),
+			Message{Command: CmdDumpRequest, Address: 0x020100},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(ModelXG, tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m.Device != tt.want.Device || m.Command != tt.want.Command || m.Address != tt.want.Address ||
+				!bytes.Equal(m.Data, tt.want.Data) {
+				t.Errorf("Parse = %+v, want %+v", m, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	dump := BulkDump(ModelXG, 0, 0x000000, []byte{1, 2, 3})
+	corrupt := func(msg []byte, i int, b byte) []byte {
+		out := append([]byte(nil), msg...)
+		out[i] = b
+		return out
+	}
+
+	tests := []struct {
+		name string
+		msg  []byte
+		want error
+	}{
+		{"empty", nil, sysex.ErrMalformed},
+		{"short", []byte{0xF0, 0x43, 0x10, 0x4C, 0xF7}, sysex.ErrMalformed},
+		{"other manufacturer", corrupt(dump, 1, 0x41), sysex.ErrMalformed},
+		{"other model", corrupt(dump, 3, 0x4B), sysex.ErrMalformed},
+		{"wrong byte count", corrupt(dump, 5, 0x04), sysex.ErrMalformed},
+		{"bad checksum", corrupt(dump, len(dump)-2, 0), sysex.ErrChecksum},
+		{"corrupt data", corrupt(dump, 9, 0x11), sysex.ErrChecksum},
+		{"long request", []byte{0xF0, 0x43, 0x20, 0x4C, 0x00, 0x00, 0x00, 0x00, 0xF7}, sysex.ErrMalformed},
+		{"unknown command", []byte{0xF0, 0x43, 0x40, 0x4C, 0x00, 0x00, 0x00, 0xF7}, sysex.ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(ModelXG, tt.msg); !errors.Is(err, tt.want) {
+				t.Errorf("Parse = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// device is a driver that answers parameter and dump requests from a
+// fixed set of blocks, first sending a reply for another address.
+type device struct {
+	midi.Driver
+	session *sysex.Session
+	blocks  map[uint32][]byte
+}
+
+func (d *device) SendSysExV1(_ midi.Entity, data []byte) error {
+	m, err := Parse(ModelXG, data)
+	if err != nil {
+		return nil
+	}
+	var replies [][]byte
+	switch m.Command {
+	case CmdParameterRequest:
+		replies = [][]byte{
+			ParameterChange(ModelXG, m.Device, m.Address+1, []byte{0x7F}),
+			ParameterChange(ModelXG, m.Device, m.Address, d.blocks[m.Address]),
+		}
+	case CmdDumpRequest:
+		replies = [][]byte{
+			ParameterChange(ModelXG, m.Device, m.Address, []byte{0x7F}),
+			BulkDump(ModelXG, m.Device, m.Address, d.blocks[m.Address]),
+		}
+	}
+	for _, r := range replies {
+		d.session.Handle(ump.AppendSysEx7(nil, 0, r))
+	}
+	return nil
+}
+
+func TestDevice(t *testing.T) {
+	d := &device{
+		blocks: map[uint32][]byte{
+			0x080107: {0x40},
+			0x080000: bytes.Repeat([]byte{0x12}, 100),
+		},
+	}
+	d.session = sysex.NewSession(d, 1, 0, 0)
+	dev := &Device{Session: d.session, Model: ModelXG, ID: 0}
+	ctx := context.Background()
+
+	got, err := dev.Read(ctx, 0x080107)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, d.blocks[0x080107]) {
+		t.Errorf("Read = % X, want % X", got, d.blocks[0x080107])
+	}
+
+	got, err = dev.ReadBulk(ctx, 0x080000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, d.blocks[0x080000]) {
+		t.Errorf("ReadBulk = % X, want % X", got, d.blocks[0x080000])
+	}
+}
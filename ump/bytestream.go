@@ -0,0 +1,223 @@
+package ump
+
+// MIDI1DataLength returns the number of data bytes that follow the given
+// MIDI 1.0 status byte, or -1 if status is not a channel voice, system
+// common or system real-time status (this includes 0xF0 and 0xF7).
+func MIDI1DataLength(status byte) int {
+	switch status >> 4 {
+	case 0x8, 0x9, 0xA, 0xB, 0xE:
+		return 2
+	case 0xC, 0xD:
+		return 1
+	case 0xF:
+		switch status {
+		case 0xF1, 0xF3:
+			return 1
+		case 0xF2:
+			return 2
+		case 0xF6, 0xF8, 0xFA, 0xFB, 0xFC, 0xFE, 0xFF:
+			return 0
+		}
+	}
+	return -1
+}
+
+// AppendMIDI1Bytes appends the MIDI 1.0 byte stream encoding of a MIDI 1.0
+// channel voice message or a system message to dst. ok is false, and dst is
+// returned unmodified, for any other message type.
+func AppendMIDI1Bytes(dst []byte, msg []Word) (out []byte, ok bool) {
+	if len(msg) == 0 {
+		return dst, false
+	}
+	switch MessageType(msg[0]) {
+	case MsgTypeSystem, MsgTypeMIDIv1:
+		status := Status(msg[0])
+		n := MIDI1DataLength(status)
+		if n < 0 {
+			return dst, false
+		}
+		dst = append(dst, status)
+		if n > 0 {
+			dst = append(dst, byte(msg[0]>>8)&0x7F)
+		}
+		if n > 1 {
+			dst = append(dst, byte(msg[0])&0x7F)
+		}
+		return dst, true
+	}
+	return dst, false
+}
+
+// FromMIDI1Bytes converts a complete MIDI 1.0 channel voice, system common
+// or system real-time message (status byte followed by data bytes) into a
+// single UMP word on the given group. ok is false if msg is not a
+// well-formed message of one of these types.
+func FromMIDI1Bytes(group uint8, msg []byte) (w Word, ok bool) {
+	if len(msg) == 0 {
+		return 0, false
+	}
+	n := MIDI1DataLength(msg[0])
+	if n < 0 || len(msg) != n+1 {
+		return 0, false
+	}
+
+	w = MsgTypeMIDIv1
+	if msg[0] >= 0xF0 {
+		w = MsgTypeSystem
+	}
+	w |= Word(group&0x0F)<<24 | Word(msg[0])<<16
+	if n > 0 {
+		w |= Word(msg[1]&0x7F) << 8
+	}
+	if n > 1 {
+		w |= Word(msg[2] & 0x7F)
+	}
+	return w, true
+}
+
+// AppendMIDI1Stream appends the MIDI 1.0 byte stream encoding of a UMP
+// stream to dst. MIDI 2.0 channel voice messages are translated with
+// ToMIDI1, and 64-bit data messages are framed with 0xF0/0xF7 according to
+// their packet status. Messages with no MIDI 1.0 equivalent are dropped.
+func AppendMIDI1Stream(dst []byte, words []Word) []byte {
+	var buf [8]Word
+	for len(words) > 0 {
+		msg, rest := Next(words)
+		if msg == nil {
+			break
+		}
+		words = rest
+
+		switch MessageType(msg[0]) {
+		case MsgTypeSystem, MsgTypeMIDIv1:
+			dst, _ = AppendMIDI1Bytes(dst, msg)
+		case MsgTypeMIDIv2:
+			out, _ := ToMIDI1(buf[:0], msg)
+			for _, w := range out {
+				dst, _ = AppendMIDI1Bytes(dst, []Word{w})
+			}
+		case MsgTypeData:
+			status := SysEx7Status(msg[0])
+			if status == SysEx7Complete || status == SysEx7Start {
+				dst = append(dst, 0xF0)
+			}
+			dst = AppendSysEx7Payload(dst, msg)
+			if status == SysEx7Complete || status == SysEx7End {
+				dst = append(dst, 0xF7)
+			}
+		}
+	}
+	return dst
+}
+
+// MIDI1Parser converts a MIDI 1.0 byte stream, as read from a serial port
+// or raw MIDI device, into UMP. It follows running status, passes real-time
+// messages interleaved with other messages straight through, and encodes
+// System Exclusive messages as 64-bit data messages as their bytes arrive.
+// Stray data bytes are discarded.
+//
+// The zero value is ready to use and produces messages on group 0.
+type MIDI1Parser struct {
+	Group uint8
+
+	status byte // running status, or 0xF0 within SysEx
+	data   [2]byte
+	n      int // data bytes received for status
+
+	sysex   [6]byte
+	sysexN  int
+	started bool // a SysEx start packet has been emitted
+}
+
+// Append parses data and appends the resulting messages to dst. Messages
+// may span calls.
+func (p *MIDI1Parser) Append(dst []Word, data []byte) []Word {
+	for _, b := range data {
+		switch {
+		case b >= 0xF8:
+			if w, ok := FromMIDI1Bytes(p.Group, []byte{b}); ok {
+				dst = append(dst, w)
+			}
+		case b == 0xF0:
+			dst = p.endSysEx(dst)
+			p.status, p.sysexN, p.started = 0xF0, 0, false
+		case b == 0xF7:
+			dst = p.endSysEx(dst)
+			p.status = 0
+		case b >= 0x80:
+			dst = p.endSysEx(dst)
+			p.status, p.n = b, 0
+			switch MIDI1DataLength(b) {
+			case 0:
+				dst = p.complete(dst)
+			case -1:
+				// undefined (0xF4, 0xF5): its data bytes are stray
+				p.status = 0
+			}
+		case p.status == 0xF0:
+			if p.sysexN == len(p.sysex) {
+				dst = p.appendSysEx(dst, false)
+			}
+			p.sysex[p.sysexN] = b
+			p.sysexN++
+		case p.status != 0:
+			p.data[p.n] = b
+			p.n++
+			if p.n == MIDI1DataLength(p.status) {
+				dst = p.complete(dst)
+			}
+		}
+	}
+	return dst
+}
+
+// Reset discards any partial message and running status.
+func (p *MIDI1Parser) Reset() {
+	p.status, p.n, p.sysexN, p.started = 0, 0, 0, false
+}
+
+func (p *MIDI1Parser) complete(dst []Word) []Word {
+	msg := [3]byte{p.status, p.data[0], p.data[1]}
+	if w, ok := FromMIDI1Bytes(p.Group, msg[:1+p.n]); ok {
+		dst = append(dst, w)
+	}
+	p.n = 0
+	if p.status >= 0xF0 {
+		p.status = 0 // system common messages cancel running status
+	}
+	return dst
+}
+
+func (p *MIDI1Parser) endSysEx(dst []Word) []Word {
+	if p.status != 0xF0 {
+		return dst
+	}
+	dst = p.appendSysEx(dst, true)
+	p.status = 0
+	return dst
+}
+
+// appendSysEx emits the buffered SysEx bytes as a single packet.
+func (p *MIDI1Parser) appendSysEx(dst []Word, last bool) []Word {
+	var status Word
+	switch {
+	case !p.started && last:
+		status = SysEx7Complete
+	case !p.started:
+		status = SysEx7Start
+	case last:
+		status = SysEx7End
+	default:
+		status = SysEx7Continue
+	}
+
+	var b [6]byte
+	copy(b[:], p.sysex[:p.sysexN])
+	dst = append(dst,
+		MsgTypeData|Word(p.Group&0x0F)<<24|status<<20|Word(p.sysexN)<<16|Word(b[0])<<8|Word(b[1]),
+		Word(b[2])<<24|Word(b[3])<<16|Word(b[4])<<8|Word(b[5]),
+	)
+
+	p.sysexN, p.started = 0, !last
+	return dst
+}
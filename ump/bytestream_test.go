@@ -0,0 +1,35 @@
+package ump
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMIDI1Parser(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []Word
+	}{
+		{"note on", []byte{0x90, 60, 100}, []Word{NoteOn(0, 60, 100)}},
+		{"running status", []byte{0x90, 60, 100, 62, 0}, []Word{NoteOn(0, 60, 100), NoteOn(0, 62, 0)}},
+		{"real-time within message", []byte{0x90, 60, 0xF8, 100}, []Word{Clock, NoteOn(0, 60, 100)}},
+		{"stray data", []byte{1, 2, 0xC0, 5}, []Word{ProgramChange(0, 5)}},
+		{"sysex", []byte{0xF0, 0x7E, 0xF7}, []Word{0x30017E00, 0}},
+		{"sysex ended by status", []byte{0xF0, 0x7E, 0x80, 60, 0}, []Word{0x30017E00, 0, NoteOff(0, 60, 0)}},
+		{"undefined F4", []byte{0xF4, 1, 2, 3}, nil},
+		{"undefined F5", []byte{0xF5, '0', '0', '0'}, nil},
+		{"undefined cancels running status", []byte{0x90, 60, 100, 0xF4, 62, 100, 0x80, 60, 0}, []Word{
+			NoteOn(0, 60, 100),
+			NoteOff(0, 60, 0),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p MIDI1Parser
+			if got := p.Append(nil, tt.data); !slices.Equal(got, tt.want) {
+				t.Errorf("got %08X, want %08X", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package ump
+
+// Flex Data address fields
+const (
+	FlexAddressChannel = 0
+	FlexAddressGroup   = 1
+)
+
+// Flex Data status bank 0x00 (setup and performance) statuses
+const (
+	FlexSetTempo         = 0x00
+	FlexSetTimeSignature = 0x01
+	FlexSetMetronome     = 0x02
+	FlexSetKeySignature  = 0x05
+	FlexSetChordName     = 0x06
+)
+
+// FlexStatusBank returns the status bank of a Flex Data message.
+func FlexStatusBank(w Word) uint8 {
+	return uint8(w >> 8)
+}
+
+// FlexStatus returns the status of a Flex Data message.
+func FlexStatus(w Word) uint8 {
+	return uint8(w)
+}
+
+func flexHeader(group uint8, address uint8, channel uint8, bank uint8, status uint8) Word {
+	// form is always 0 (complete in one message)
+	return MsgTypeFlexData |
+		Word(group&0x0F)<<24 |
+		Word(address&0x03)<<20 |
+		Word(channel&0x0F)<<16 |
+		Word(bank)<<8 |
+		Word(status)
+}
+
+// SetTempo returns a Flex Data Set Tempo message. tempo is expressed in
+// units of 10 nanoseconds per quarter note.
+func SetTempo(group uint8, tempo uint32) [4]Word {
+	return [4]Word{flexHeader(group, FlexAddressGroup, 0, 0, FlexSetTempo), Word(tempo), 0, 0}
+}
+
+// SetTimeSignature returns a Flex Data Set Time Signature message.
+// denominator is expressed as a power of 2 (e.g. 2 for a crotchet), as in
+// the Standard MIDI File time signature meta event.
+func SetTimeSignature(group uint8, numerator, denominator, thirtySecondsPerQuarter uint8) [4]Word {
+	return [4]Word{
+		flexHeader(group, FlexAddressGroup, 0, 0, FlexSetTimeSignature),
+		Word(numerator)<<24 | Word(denominator)<<16 | Word(thirtySecondsPerQuarter)<<8,
+		0,
+		0,
+	}
+}
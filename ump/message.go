@@ -0,0 +1,61 @@
+package ump
+
+// Words per message, indexed by message type.
+var messageSizes = [16]int{1, 1, 1, 2, 2, 4, 1, 1, 2, 2, 2, 3, 3, 4, 4, 4}
+
+// MessageType returns the message type of the UMP message whose first word
+// is w, shifted into the same position as the MsgType* constants.
+func MessageType(w Word) Word {
+	return w & msgTypeMask
+}
+
+// Size returns the number of words in the UMP message whose first word is w.
+func Size(w Word) int {
+	return messageSizes[w>>28]
+}
+
+// Group returns the group (0-15) of the message whose first word is w.
+func Group(w Word) uint8 {
+	return uint8(w>>24) & 0x0F
+}
+
+// Status returns the status byte of a system, MIDI 1.0 or MIDI 2.0 channel
+// voice message. For channel voice messages the channel is included in the
+// low nibble.
+func Status(w Word) uint8 {
+	return uint8(w >> 16)
+}
+
+// Channel returns the channel (0-15) of a channel voice message.
+func Channel(w Word) uint8 {
+	return uint8(w>>channelShift) & 0x0F
+}
+
+// Next splits the first complete message from words, returning the message
+// and the remaining words. If words ends with a truncated message, msg is nil
+// and rest contains the incomplete tail.
+func Next(words []Word) (msg []Word, rest []Word) {
+	if len(words) == 0 {
+		return nil, nil
+	}
+	n := Size(words[0])
+	if n > len(words) {
+		return nil, words
+	}
+	return words[:n], words[n:]
+}
+
+// Split appends each complete message in words to dst, returning the
+// extended slice. Message slices share storage with words. Any trailing
+// incomplete message is discarded.
+func Split(dst [][]Word, words []Word) [][]Word {
+	for len(words) > 0 {
+		msg, rest := Next(words)
+		if msg == nil {
+			break
+		}
+		dst = append(dst, msg)
+		words = rest
+	}
+	return dst
+}
@@ -7,8 +7,25 @@ const (
 	Stop          = Word(MsgTypeSystem | (0xFC << 16))
 	ActiveSensing = Word(MsgTypeSystem | (0xFE << 16))
 	Reset         = Word(MsgTypeSystem | (0xFF << 16))
+	TuneRequest   = Word(MsgTypeSystem | (0xF6 << 16))
 )
 
+// TimeCode returns a MIDI Time Code quarter frame message; value holds the
+// message type in bits 4-6 and the nibble in bits 0-3.
+func TimeCode(value uint8) Word {
+	return MsgTypeSystem | (0xF1 << 16) | Word(value&0x7F)<<8
+}
+
+// SongPosition returns a song position pointer message; position is in
+// sixteenth notes (14 bits).
+func SongPosition(position uint16) Word {
+	return MsgTypeSystem | (0xF2 << 16) | Word(position&0x7F)<<8 | Word(position>>7)&0x7F
+}
+
+func SongSelect(song uint8) Word {
+	return MsgTypeSystem | (0xF3 << 16) | Word(song&0x7F)<<8
+}
+
 const (
 	noteOff         = MsgTypeMIDIv1 | (0b1000 << 20)
 	noteOn          = MsgTypeMIDIv1 | (0b1001 << 20)
@@ -35,7 +52,12 @@ func NoteOn(channel uint8, note int8, velocity int8) Word {
 		Word(velocity)
 }
 
-// TODO: poly pressure
+func PolyPressure(channel uint8, note int8, pressure int8) Word {
+	return polyPressure |
+		(Word(channel&0x0F) << channelShift) |
+		(Word(note) << 8) |
+		Word(pressure)
+}
 
 func ControlChange(channel uint8, controller, value int8) Word {
 	return controlChange |
@@ -44,6 +66,23 @@ func ControlChange(channel uint8, controller, value int8) Word {
 		Word(value)
 }
 
-// TODO: program change
-// TODO: channel pressure
-// TODO: pitch bend
+func ProgramChange(channel uint8, program int8) Word {
+	return programChange |
+		(Word(channel&0x0F) << channelShift) |
+		(Word(program) << 8)
+}
+
+func ChannelPressure(channel uint8, pressure int8) Word {
+	return channelPressure |
+		(Word(channel&0x0F) << channelShift) |
+		(Word(pressure) << 8)
+}
+
+// PitchBend returns a pitch bend message with the given 14-bit value;
+// 0x2000 is centre.
+func PitchBend(channel uint8, value uint16) Word {
+	return pitchBend |
+		(Word(channel&0x0F) << channelShift) |
+		(Word(value&0x7F) << 8) |
+		Word((value>>7)&0x7F)
+}
@@ -0,0 +1,102 @@
+package ump
+
+// MIDI 2.0 channel voice message opcodes (the high nibble of the status byte)
+const (
+	OpRegisteredPerNoteController = 0x0
+	OpAssignablePerNoteController = 0x1
+	OpRegisteredController        = 0x2
+	OpAssignableController        = 0x3
+	OpRelativeRegisteredCtrl      = 0x4
+	OpRelativeAssignableCtrl      = 0x5
+	OpPerNotePitchBend            = 0x6
+	OpNoteOff                     = 0x8
+	OpNoteOn                      = 0x9
+	OpPolyPressure                = 0xA
+	OpControlChange               = 0xB
+	OpProgramChange               = 0xC
+	OpChannelPressure             = 0xD
+	OpPitchBend                   = 0xE
+	OpPerNoteManagement           = 0xF
+)
+
+// Opcode returns the opcode (high nibble of the status byte) of a MIDI 1.0
+// or MIDI 2.0 channel voice message.
+func Opcode(w Word) uint8 {
+	return uint8(w>>20) & 0x0F
+}
+
+func midi2Header(group uint8, op uint8, channel uint8, b2, b3 uint8) Word {
+	return MsgTypeMIDIv2 |
+		Word(group&0x0F)<<24 |
+		Word(op&0x0F)<<20 |
+		Word(channel&0x0F)<<channelShift |
+		Word(b2)<<8 |
+		Word(b3)
+}
+
+// NoteOnV2 returns a MIDI 2.0 note on message with a 16-bit velocity and no
+// attribute.
+func NoteOnV2(group, channel, note uint8, velocity uint16) [2]Word {
+	return [2]Word{midi2Header(group, OpNoteOn, channel, note&0x7F, 0), Word(velocity) << 16}
+}
+
+// NoteOffV2 returns a MIDI 2.0 note off message with a 16-bit velocity and
+// no attribute.
+func NoteOffV2(group, channel, note uint8, velocity uint16) [2]Word {
+	return [2]Word{midi2Header(group, OpNoteOff, channel, note&0x7F, 0), Word(velocity) << 16}
+}
+
+// PolyPressureV2 returns a MIDI 2.0 poly pressure message.
+func PolyPressureV2(group, channel, note uint8, pressure uint32) [2]Word {
+	return [2]Word{midi2Header(group, OpPolyPressure, channel, note&0x7F, 0), Word(pressure)}
+}
+
+// ControlChangeV2 returns a MIDI 2.0 control change message.
+func ControlChangeV2(group, channel, index uint8, value uint32) [2]Word {
+	return [2]Word{midi2Header(group, OpControlChange, channel, index&0x7F, 0), Word(value)}
+}
+
+// ProgramChangeV2 returns a MIDI 2.0 program change message with no bank
+// select.
+func ProgramChangeV2(group, channel, program uint8) [2]Word {
+	return [2]Word{midi2Header(group, OpProgramChange, channel, 0, 0), Word(program&0x7F) << 24}
+}
+
+// ChannelPressureV2 returns a MIDI 2.0 channel pressure message.
+func ChannelPressureV2(group, channel uint8, pressure uint32) [2]Word {
+	return [2]Word{midi2Header(group, OpChannelPressure, channel, 0, 0), Word(pressure)}
+}
+
+// PitchBendV2 returns a MIDI 2.0 pitch bend message; 0x80000000 is centre.
+func PitchBendV2(group, channel uint8, value uint32) [2]Word {
+	return [2]Word{midi2Header(group, OpPitchBend, channel, 0, 0), Word(value)}
+}
+
+// PerNotePitchBend returns a MIDI 2.0 per-note pitch bend message;
+// 0x80000000 is centre.
+func PerNotePitchBend(group, channel, note uint8, value uint32) [2]Word {
+	return [2]Word{midi2Header(group, OpPerNotePitchBend, channel, note&0x7F, 0), Word(value)}
+}
+
+// RegisteredPerNoteController returns a MIDI 2.0 registered per-note
+// controller message.
+func RegisteredPerNoteController(group, channel, note, index uint8, value uint32) [2]Word {
+	return [2]Word{midi2Header(group, OpRegisteredPerNoteController, channel, note&0x7F, index), Word(value)}
+}
+
+// AssignablePerNoteController returns a MIDI 2.0 assignable per-note
+// controller message.
+func AssignablePerNoteController(group, channel, note, index uint8, value uint32) [2]Word {
+	return [2]Word{midi2Header(group, OpAssignablePerNoteController, channel, note&0x7F, index), Word(value)}
+}
+
+// Per-note management option flags
+const (
+	PerNoteReset  = 1 << 0
+	PerNoteDetach = 1 << 1
+)
+
+// PerNoteManagement returns a MIDI 2.0 per-note management message.
+func PerNoteManagement(group, channel, note, flags uint8) [2]Word {
+	return [2]Word{midi2Header(group, OpPerNoteManagement, channel, note&0x7F, flags&0x03), 0}
+}
@@ -0,0 +1,32 @@
+package ump
+
+// ScaleUp converts a value of srcBits resolution to dstBits using the
+// min-centre-max algorithm from the UMP specification, so that the minimum,
+// centre and maximum of the source range map to those of the destination.
+func ScaleUp(value uint32, srcBits, dstBits uint) uint32 {
+	scaleBits := dstBits - srcBits
+	shifted := value << scaleBits
+	center := uint32(1) << (srcBits - 1)
+	if value <= center {
+		return shifted
+	}
+
+	repeatBits := srcBits - 1
+	repeat := value & (1<<repeatBits - 1)
+	if scaleBits > repeatBits {
+		repeat <<= scaleBits - repeatBits
+	} else {
+		repeat >>= repeatBits - scaleBits
+	}
+	for repeat != 0 {
+		shifted |= repeat
+		repeat >>= repeatBits
+	}
+	return shifted
+}
+
+// ScaleDown converts a value of srcBits resolution to dstBits by
+// discarding the least significant bits.
+func ScaleDown(value uint32, srcBits, dstBits uint) uint32 {
+	return value >> (srcBits - dstBits)
+}
@@ -0,0 +1,36 @@
+package ump
+
+// UMP Stream message statuses
+const (
+	StreamEndpointDiscovery       = 0x00
+	StreamEndpointInfoNotify      = 0x01
+	StreamDeviceIdentityNotify    = 0x02
+	StreamEndpointNameNotify      = 0x03
+	StreamProductInstanceIDNotify = 0x04
+	StreamConfigRequest           = 0x05
+	StreamConfigNotify            = 0x06
+	StreamFunctionBlockDiscovery  = 0x10
+	StreamFunctionBlockInfoNotify = 0x11
+	StreamFunctionBlockNameNotify = 0x12
+	StreamStartOfClip             = 0x20
+	StreamEndOfClip               = 0x21
+)
+
+// StreamStatus returns the 10-bit status of a UMP Stream message.
+func StreamStatus(w Word) uint16 {
+	return uint16(w>>16) & 0x3FF
+}
+
+// StreamFormat returns the 2-bit format field of a UMP Stream message.
+func StreamFormat(w Word) uint8 {
+	return uint8(w>>26) & 0x03
+}
+
+func streamHeader(format uint8, status uint16) Word {
+	return MsgTypeStream | Word(format&0x03)<<26 | Word(status&0x3FF)<<16
+}
+
+var (
+	StartOfClip = [4]Word{streamHeader(0, StreamStartOfClip), 0, 0, 0}
+	EndOfClip   = [4]Word{streamHeader(0, StreamEndOfClip), 0, 0, 0}
+)
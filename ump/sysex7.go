@@ -0,0 +1,125 @@
+package ump
+
+// SysEx7 packet status values
+const (
+	SysEx7Complete = 0x0
+	SysEx7Start    = 0x1
+	SysEx7Continue = 0x2
+	SysEx7End      = 0x3
+)
+
+// SysEx7Status returns the packet status (one of the SysEx7* constants) of
+// the 64-bit data message whose first word is w.
+func SysEx7Status(w Word) uint8 {
+	return uint8(w>>20) & 0x0F
+}
+
+// AppendSysEx7Payload appends the payload bytes carried by the 64-bit data
+// message msg to dst.
+func AppendSysEx7Payload(dst []byte, msg []Word) []byte {
+	n := min(int(msg[0]>>16)&0x0F, 6)
+	payload := [6]byte{
+		byte(msg[0] >> 8), byte(msg[0]),
+		byte(msg[1] >> 24), byte(msg[1] >> 16), byte(msg[1] >> 8), byte(msg[1]),
+	}
+	return append(dst, payload[:n]...)
+}
+
+// AppendSysEx7 encodes a MIDI 1.0 System Exclusive message as a series of
+// 64-bit data messages on the given group and appends them to dst. The
+// leading 0xF0 and trailing 0xF7, if present, are stripped.
+func AppendSysEx7(dst []Word, group uint8, data []byte) []Word {
+	if len(data) > 0 && data[0] == 0xF0 {
+		data = data[1:]
+	}
+	if len(data) > 0 && data[len(data)-1] == 0xF7 {
+		data = data[:len(data)-1]
+	}
+
+	first := true
+	for {
+		n := min(6, len(data))
+		last := n == len(data)
+
+		var status Word
+		switch {
+		case first && last:
+			status = SysEx7Complete
+		case first:
+			status = SysEx7Start
+		case last:
+			status = SysEx7End
+		default:
+			status = SysEx7Continue
+		}
+
+		var payload [6]byte
+		copy(payload[:], data[:n])
+
+		dst = append(dst,
+			MsgTypeData|Word(group&0x0F)<<24|status<<20|Word(n)<<16|Word(payload[0])<<8|Word(payload[1]),
+			Word(payload[2])<<24|Word(payload[3])<<16|Word(payload[4])<<8|Word(payload[5]),
+		)
+
+		data = data[n:]
+		first = false
+		if last {
+			return dst
+		}
+	}
+}
+
+// SysEx7Assembler reassembles 64-bit data messages into complete MIDI 1.0
+// System Exclusive messages. Each group is tracked independently.
+//
+// The zero value is ready to use.
+type SysEx7Assembler struct {
+	buf    [16][]byte
+	active [16]bool
+}
+
+// Push adds a single 64-bit data message to the assembler. When msg
+// completes a System Exclusive message, the message is returned, including
+// its 0xF0/0xF7 framing, and ok is true. The returned slice is only valid
+// until the next call to Push.
+//
+// Packets received out of sequence (e.g. a continue packet with no
+// preceding start) are discarded.
+func (a *SysEx7Assembler) Push(msg []Word) (data []byte, ok bool) {
+	if len(msg) < 2 || MessageType(msg[0]) != MsgTypeData {
+		return nil, false
+	}
+
+	g := Group(msg[0])
+	switch SysEx7Status(msg[0]) {
+	case SysEx7Complete:
+		a.buf[g] = append(a.buf[g][:0], 0xF0)
+		a.buf[g] = AppendSysEx7Payload(a.buf[g], msg)
+		a.active[g] = false
+		return append(a.buf[g], 0xF7), true
+	case SysEx7Start:
+		a.buf[g] = append(a.buf[g][:0], 0xF0)
+		a.buf[g] = AppendSysEx7Payload(a.buf[g], msg)
+		a.active[g] = true
+	case SysEx7Continue:
+		if a.active[g] {
+			a.buf[g] = AppendSysEx7Payload(a.buf[g], msg)
+		}
+	case SysEx7End:
+		if a.active[g] {
+			a.buf[g] = AppendSysEx7Payload(a.buf[g], msg)
+			a.active[g] = false
+			return append(a.buf[g], 0xF7), true
+		}
+	}
+
+	return nil, false
+}
+
+// Reset discards any partially assembled messages.
+func (a *SysEx7Assembler) Reset() {
+	for i := range a.buf {
+		a.buf[i] = a.buf[i][:0]
+		a.active[i] = false
+	}
+}
@@ -0,0 +1,239 @@
+package ump
+
+import (
+	"fmt"
+	"strings"
+)
+
+var systemNames = map[uint8]string{
+	0xF6: "tune-request",
+	0xF8: "clock",
+	0xFA: "start",
+	0xFB: "continue",
+	0xFC: "stop",
+	0xFE: "active-sensing",
+	0xFF: "reset",
+}
+
+var utilityNames = [...]string{
+	UtilityNoOp:               "noop",
+	UtilityJRClock:            "jr-clock",
+	UtilityJRTimestamp:        "jr-timestamp",
+	UtilityDeltaClockstampTPQ: "dctpq",
+	UtilityDeltaClockstamp:    "dc",
+}
+
+var midi1Names = [...]string{
+	0x8: "note-off",
+	0x9: "note-on",
+	0xA: "poly-pressure",
+	0xB: "cc",
+	0xC: "program",
+	0xD: "channel-pressure",
+	0xE: "pitch-bend",
+}
+
+var midi2Names = [...]string{
+	OpRegisteredPerNoteController: "v2.note-rpn",
+	OpAssignablePerNoteController: "v2.note-nrpn",
+	OpRegisteredController:        "v2.rpn",
+	OpAssignableController:        "v2.nrpn",
+	OpRelativeRegisteredCtrl:      "v2.rel-rpn",
+	OpRelativeAssignableCtrl:      "v2.rel-nrpn",
+	OpPerNotePitchBend:            "v2.note-pitch-bend",
+	OpNoteOff:                     "v2.note-off",
+	OpNoteOn:                      "v2.note-on",
+	OpPolyPressure:                "v2.poly-pressure",
+	OpControlChange:               "v2.cc",
+	OpProgramChange:               "v2.program",
+	OpChannelPressure:             "v2.channel-pressure",
+	OpPitchBend:                   "v2.pitch-bend",
+	OpPerNoteManagement:           "v2.note-management",
+}
+
+var sysEx7Names = [...]string{
+	SysEx7Complete: "sysex7",
+	SysEx7Start:    "sysex7.start",
+	SysEx7Continue: "sysex7.continue",
+	SysEx7End:      "sysex7.end",
+}
+
+var streamNames = map[uint16]string{
+	StreamEndpointDiscovery:       "stream.endpoint-discovery",
+	StreamEndpointInfoNotify:      "stream.endpoint-info",
+	StreamDeviceIdentityNotify:    "stream.device-identity",
+	StreamEndpointNameNotify:      "stream.endpoint-name",
+	StreamProductInstanceIDNotify: "stream.product-instance-id",
+	StreamConfigRequest:           "stream.config-request",
+	StreamConfigNotify:            "stream.config",
+	StreamFunctionBlockDiscovery:  "stream.function-block-discovery",
+	StreamFunctionBlockInfoNotify: "stream.function-block-info",
+	StreamFunctionBlockNameNotify: "stream.function-block-name",
+	StreamStartOfClip:             "stream.start-of-clip",
+	StreamEndOfClip:               "stream.end-of-clip",
+}
+
+// Format returns a one-line text form of the message msg, e.g.
+//
+//	note-on g=0 ch=0 note=60 vel=100
+//
+// The mnemonic comes first, followed by the group and channel where the
+// message has them and then its fields. Messages without a specific form
+// are shown as their mnemonic and raw words in hex.
+func Format(msg []Word) string {
+	if len(msg) == 0 {
+		return ""
+	}
+	if len(msg) < Size(msg[0]) {
+		return "truncated " + hexWords(msg)
+	}
+
+	w := msg[0]
+	g := Group(w)
+	b2, b3 := uint8(w>>8), uint8(w)
+
+	switch MessageType(w) {
+	case MsgTypeUtility:
+		s := UtilityStatus(w)
+		switch s {
+		case UtilityNoOp:
+			return "noop"
+		case UtilityJRClock, UtilityJRTimestamp, UtilityDeltaClockstampTPQ:
+			return fmt.Sprintf("%s %d", utilityNames[s], uint16(w))
+		case UtilityDeltaClockstamp:
+			return fmt.Sprintf("dc %d", DeltaClockstampTicks(w))
+		}
+
+	case MsgTypeSystem:
+		s := Status(w)
+		if name, ok := systemNames[s]; ok {
+			return fmt.Sprintf("%s g=%d", name, g)
+		}
+		switch s {
+		case 0xF1:
+			return fmt.Sprintf("time-code g=%d type=%d value=%d", g, b2>>4&0x07, b2&0x0F)
+		case 0xF2:
+			return fmt.Sprintf("song-position g=%d pos=%d", g, uint16(b2&0x7F)|uint16(b3&0x7F)<<7)
+		case 0xF3:
+			return fmt.Sprintf("song-select g=%d song=%d", g, b2&0x7F)
+		}
+
+	case MsgTypeMIDIv1:
+		return formatMIDI1(w)
+
+	case MsgTypeMIDIv2:
+		return formatMIDI2(msg[0], msg[1])
+
+	case MsgTypeData:
+		s := SysEx7Status(w)
+		if int(s) < len(sysEx7Names) {
+			data := AppendSysEx7Payload(nil, msg)
+			return strings.TrimSpace(fmt.Sprintf("%s g=%d % x", sysEx7Names[s], g, data))
+		}
+
+	case MsgTypeFlexData:
+		if FlexStatusBank(w) == 0 {
+			switch FlexStatus(w) {
+			case FlexSetTempo:
+				return fmt.Sprintf("flex.tempo g=%d tempo=%d", g, msg[1])
+			case FlexSetTimeSignature:
+				return fmt.Sprintf("flex.time-signature g=%d %d/%d 32nds=%d", g, msg[1]>>24, 1<<(msg[1]>>16&0xFF), msg[1]>>8&0xFF)
+			}
+		}
+		return "flex " + hexWords(msg)
+
+	case MsgTypeStream:
+		if name, ok := streamNames[StreamStatus(w)]; ok {
+			return name + " " + hexWords(msg)
+		}
+	}
+
+	return "raw " + hexWords(msg)
+}
+
+func formatMIDI1(w Word) string {
+	g, ch := Group(w), Channel(w)
+	b2, b3 := uint8(w>>8)&0x7F, uint8(w)&0x7F
+	op := Opcode(w)
+
+	switch op {
+	case 0x8, 0x9:
+		return fmt.Sprintf("%s g=%d ch=%d note=%d vel=%d", midi1Names[op], g, ch, b2, b3)
+	case 0xA:
+		return fmt.Sprintf("poly-pressure g=%d ch=%d note=%d value=%d", g, ch, b2, b3)
+	case 0xB:
+		return fmt.Sprintf("cc g=%d ch=%d cc=%d value=%d", g, ch, b2, b3)
+	case 0xC:
+		return fmt.Sprintf("program g=%d ch=%d program=%d", g, ch, b2)
+	case 0xD:
+		return fmt.Sprintf("channel-pressure g=%d ch=%d value=%d", g, ch, b2)
+	case 0xE:
+		return fmt.Sprintf("pitch-bend g=%d ch=%d value=%d", g, ch, uint16(b2)|uint16(b3)<<7)
+	}
+	return "raw " + hexWords([]Word{w})
+}
+
+func formatMIDI2(w, data Word) string {
+	g, ch := Group(w), Channel(w)
+	b2, b3 := uint8(w>>8), uint8(w)
+	op := Opcode(w)
+	name := midi2Names[op]
+	if name == "" {
+		return "raw " + hexWords([]Word{w, data})
+	}
+
+	switch op {
+	case OpNoteOff, OpNoteOn:
+		s := fmt.Sprintf("%s g=%d ch=%d note=%d vel=%d", name, g, ch, b2&0x7F, data>>16)
+		if b3 != 0 {
+			s += fmt.Sprintf(" attr=%d:%d", b3, data&0xFFFF)
+		}
+		return s
+	case OpPolyPressure, OpPerNotePitchBend:
+		return fmt.Sprintf("%s g=%d ch=%d note=%d value=%d", name, g, ch, b2&0x7F, data)
+	case OpRegisteredPerNoteController, OpAssignablePerNoteController:
+		return fmt.Sprintf("%s g=%d ch=%d note=%d index=%d value=%d", name, g, ch, b2&0x7F, b3, data)
+	case OpRegisteredController, OpAssignableController, OpRelativeRegisteredCtrl, OpRelativeAssignableCtrl:
+		value := fmt.Sprint(data)
+		if op == OpRelativeRegisteredCtrl || op == OpRelativeAssignableCtrl {
+			value = fmt.Sprint(int32(data))
+		}
+		return fmt.Sprintf("%s g=%d ch=%d bank=%d index=%d value=%s", name, g, ch, b2&0x7F, b3&0x7F, value)
+	case OpControlChange:
+		return fmt.Sprintf("%s g=%d ch=%d cc=%d value=%d", name, g, ch, b2&0x7F, data)
+	case OpProgramChange:
+		s := fmt.Sprintf("%s g=%d ch=%d program=%d", name, g, ch, data>>24&0x7F)
+		if b3&0x01 != 0 {
+			s += fmt.Sprintf(" bank=%d:%d", data>>8&0x7F, data&0x7F)
+		}
+		return s
+	case OpChannelPressure, OpPitchBend:
+		return fmt.Sprintf("%s g=%d ch=%d value=%d", name, g, ch, data)
+	case OpPerNoteManagement:
+		return fmt.Sprintf("%s g=%d ch=%d note=%d flags=%d", name, g, ch, b2&0x7F, b3)
+	}
+	return "raw " + hexWords([]Word{w, data})
+}
+
+// Disassemble formats each message in words with Format, one per line.
+func Disassemble(words []Word) string {
+	var lines []string
+	for len(words) > 0 {
+		msg, rest := Next(words)
+		if msg == nil {
+			lines = append(lines, Format(rest))
+			break
+		}
+		lines = append(lines, Format(msg))
+		words = rest
+	}
+	return strings.Join(lines, "\n")
+}
+
+func hexWords(words []Word) string {
+	parts := make([]string, len(words))
+	for i, w := range words {
+		parts[i] = fmt.Sprintf("%08x", uint32(w))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,119 @@
+package ump
+
+import "testing"
+
+func TestFormat(t *testing.T) {
+	g1 := Word(1) << 24
+	midi2 := func(op, channel, b2, b3 uint8, data Word) []Word {
+		return []Word{midi2Header(2, op, channel, b2, b3), data}
+	}
+	words := func(w ...Word) []Word { return w }
+	flex := func(w [4]Word) []Word { return w[:] }
+	v2 := func(w [2]Word) []Word { return w[:] }
+
+	tests := []struct {
+		name string
+		msg  []Word
+		want string
+	}{
+		{"empty", nil, ""},
+		{"truncated", words(0x40903c00), "truncated 40903c00"},
+
+		// utility
+		{"noop", words(NoOp), "noop"},
+		{"jr-clock", words(MsgTypeUtility | UtilityJRClock<<20 | 1234), "jr-clock 1234"},
+		{"jr-timestamp", words(MsgTypeUtility | UtilityJRTimestamp<<20 | 99), "jr-timestamp 99"},
+		{"dctpq", words(DeltaClockstampTPQ(480)), "dctpq 480"},
+		{"dc", words(DeltaClockstamp(70000)), "dc 70000"},
+		{"utility unknown", words(MsgTypeUtility | 0x9<<20), "raw 00900000"},
+
+		// system
+		{"clock", words(g1 | Clock), "clock g=1"},
+		{"start", words(Start), "start g=0"},
+		{"continue", words(Continue), "continue g=0"},
+		{"stop", words(Stop), "stop g=0"},
+		{"active-sensing", words(ActiveSensing), "active-sensing g=0"},
+		{"reset", words(Reset), "reset g=0"},
+		{"tune-request", words(TuneRequest), "tune-request g=0"},
+		{"time-code", words(TimeCode(0x35)), "time-code g=0 type=3 value=5"},
+		{"song-position", words(SongPosition(1000)), "song-position g=0 pos=1000"},
+		{"song-select", words(SongSelect(7)), "song-select g=0 song=7"},
+		{"system unknown", words(MsgTypeSystem | 0xF4<<16), "raw 10f40000"},
+
+		// MIDI 1.0 channel voice
+		{"note-off", words(g1 | NoteOff(3, 60, 0)), "note-off g=1 ch=3 note=60 vel=0"},
+		{"note-on", words(NoteOn(0, 60, 100)), "note-on g=0 ch=0 note=60 vel=100"},
+		{"poly-pressure", words(PolyPressure(1, 64, 20)), "poly-pressure g=0 ch=1 note=64 value=20"},
+		{"cc", words(ControlChange(2, 7, 127)), "cc g=0 ch=2 cc=7 value=127"},
+		{"program", words(ProgramChange(9, 42)), "program g=0 ch=9 program=42"},
+		{"channel-pressure", words(ChannelPressure(4, 88)), "channel-pressure g=0 ch=4 value=88"},
+		{"pitch-bend", words(PitchBend(15, 0x2000)), "pitch-bend g=0 ch=15 value=8192"},
+		{"midi1 unknown", words(MsgTypeMIDIv1 | 0x30<<16), "raw 20300000"},
+
+		// MIDI 2.0 channel voice
+		{"v2.note-on", v2(NoteOnV2(2, 1, 60, 0x8000)), "v2.note-on g=2 ch=1 note=60 vel=32768"},
+		{"v2.note-on attr", midi2(OpNoteOn, 1, 60, 3, 0x8000_1234), "v2.note-on g=2 ch=1 note=60 vel=32768 attr=3:4660"},
+		{"v2.note-off", v2(NoteOffV2(2, 1, 60, 0)), "v2.note-off g=2 ch=1 note=60 vel=0"},
+		{"v2.poly-pressure", v2(PolyPressureV2(2, 0, 61, 5)), "v2.poly-pressure g=2 ch=0 note=61 value=5"},
+		{"v2.note-pitch-bend", v2(PerNotePitchBend(2, 0, 62, 0x80000000)), "v2.note-pitch-bend g=2 ch=0 note=62 value=2147483648"},
+		{"v2.note-rpn", v2(RegisteredPerNoteController(2, 0, 63, 1, 9)), "v2.note-rpn g=2 ch=0 note=63 index=1 value=9"},
+		{"v2.note-nrpn", v2(AssignablePerNoteController(2, 0, 63, 74, 9)), "v2.note-nrpn g=2 ch=0 note=63 index=74 value=9"},
+		{"v2.rpn", midi2(OpRegisteredController, 0, 0, 6, 100), "v2.rpn g=2 ch=0 bank=0 index=6 value=100"},
+		{"v2.nrpn", midi2(OpAssignableController, 0, 5, 6, 100), "v2.nrpn g=2 ch=0 bank=5 index=6 value=100"},
+		{"v2.rel-rpn", midi2(OpRelativeRegisteredCtrl, 0, 0, 6, 0xFFFFFFFF), "v2.rel-rpn g=2 ch=0 bank=0 index=6 value=-1"},
+		{"v2.rel-nrpn", midi2(OpRelativeAssignableCtrl, 0, 1, 2, 3), "v2.rel-nrpn g=2 ch=0 bank=1 index=2 value=3"},
+		{"v2.cc", v2(ControlChangeV2(2, 3, 74, 0xFFFFFFFF)), "v2.cc g=2 ch=3 cc=74 value=4294967295"},
+		{"v2.program", v2(ProgramChangeV2(2, 3, 5)), "v2.program g=2 ch=3 program=5"},
+		{"v2.program bank", midi2(OpProgramChange, 3, 0, 1, 5<<24|0x79<<8|2), "v2.program g=2 ch=3 program=5 bank=121:2"},
+		{"v2.channel-pressure", v2(ChannelPressureV2(2, 3, 77)), "v2.channel-pressure g=2 ch=3 value=77"},
+		{"v2.pitch-bend", v2(PitchBendV2(2, 3, 0x80000000)), "v2.pitch-bend g=2 ch=3 value=2147483648"},
+		{"v2.note-management", v2(PerNoteManagement(2, 3, 60, PerNoteReset|PerNoteDetach)), "v2.note-management g=2 ch=3 note=60 flags=3"},
+		{"midi2 unknown", midi2(0x7, 0, 0, 0, 0), "raw 42700000 00000000"},
+
+		// data
+		{"sysex7", AppendSysEx7(nil, 0, []byte{0xF0, 0x7E, 0x7F, 0x06, 0x01, 0xF7}), "sysex7 g=0 7e 7f 06 01"},
+		{"sysex7 empty", AppendSysEx7(nil, 4, nil), "sysex7 g=4"},
+		{"sysex7.start", AppendSysEx7(nil, 0, []byte{1, 2, 3, 4, 5, 6, 7})[:2], "sysex7.start g=0 01 02 03 04 05 06"},
+		{"sysex7.continue", AppendSysEx7(nil, 0, make([]byte, 13))[2:4], "sysex7.continue g=0 00 00 00 00 00 00"},
+		{"sysex7.end", AppendSysEx7(nil, 0, []byte{1, 2, 3, 4, 5, 6, 7})[2:], "sysex7.end g=0 07"},
+		{"data unknown", words(MsgTypeData|0x8<<20, 0), "raw 30800000 00000000"},
+
+		// flex data
+		{"flex.tempo", flex(SetTempo(0, 50_000_000)), "flex.tempo g=0 tempo=50000000"},
+		{"flex.time-signature", flex(SetTimeSignature(1, 6, 3, 8)), "flex.time-signature g=1 6/8 32nds=8"},
+		{"flex other", flex([4]Word{flexHeader(0, FlexAddressGroup, 0, 1, 0), 1, 2, 3}), "flex d0100100 00000001 00000002 00000003"},
+
+		// stream
+		{"stream.endpoint-discovery", words(MsgTypeStream|StreamEndpointDiscovery<<16, 0, 0, 0), "stream.endpoint-discovery f0000000 00000000 00000000 00000000"},
+		{"stream.start-of-clip", words(MsgTypeStream|StreamStartOfClip<<16, 0, 0, 0), "stream.start-of-clip f0200000 00000000 00000000 00000000"},
+		{"stream unknown", words(MsgTypeStream|0x3FF<<16, 0, 0, 0), "raw f3ff0000 00000000 00000000 00000000"},
+
+		// reserved types
+		{"data128", words(MsgTypeData128, 0, 0, 0), "raw 50000000 00000000 00000000 00000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Format(tt.msg); got != tt.want {
+				t.Errorf("Format(% x) = %q, want %q", tt.msg, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	tempo := SetTempo(0, 500)
+	words := []Word{NoteOn(0, 60, 100)}
+	words = append(words, tempo[:]...)
+	words = append(words, Clock, 0x40903c00)
+
+	want := "note-on g=0 ch=0 note=60 vel=100\n" +
+		"flex.tempo g=0 tempo=500\n" +
+		"clock g=0\n" +
+		"truncated 40903c00"
+	if got := Disassemble(words); got != want {
+		t.Errorf("Disassemble = %q, want %q", got, want)
+	}
+	if got := Disassemble(nil); got != "" {
+		t.Errorf("Disassemble(nil) = %q, want empty", got)
+	}
+}
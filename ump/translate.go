@@ -0,0 +1,72 @@
+package ump
+
+func midi1Word(group, status, data1, data2 uint8) Word {
+	return MsgTypeMIDIv1 |
+		Word(group&0x0F)<<24 |
+		Word(status)<<16 |
+		Word(data1&0x7F)<<8 |
+		Word(data2&0x7F)
+}
+
+// ToMIDI1 translates the MIDI 2.0 channel voice message msg into one or more
+// MIDI 1.0 channel voice messages on the same group and channel, appending
+// them to dst. Values are scaled down as described by the UMP specification.
+//
+// ok is false, and dst is returned unmodified, if msg has no MIDI 1.0
+// equivalent (per-note controllers, per-note pitch bend, per-note management
+// and relative controllers).
+func ToMIDI1(dst []Word, msg []Word) (out []Word, ok bool) {
+	if len(msg) < 2 || MessageType(msg[0]) != MsgTypeMIDIv2 {
+		return dst, false
+	}
+
+	w0, w1 := msg[0], msg[1]
+	group := Group(w0)
+	channel := Channel(w0)
+	index := uint8(w0>>8) & 0x7F
+	status := func(op uint8) uint8 { return op<<4 | channel }
+
+	switch Opcode(w0) {
+	case OpNoteOff:
+		return append(dst, midi1Word(group, status(0x8), index, uint8(w1>>25))), true
+	case OpNoteOn:
+		velocity := uint8(w1 >> 25)
+		if velocity == 0 {
+			// velocity 0 would be interpreted as note off
+			velocity = 1
+		}
+		return append(dst, midi1Word(group, status(0x9), index, velocity)), true
+	case OpPolyPressure:
+		return append(dst, midi1Word(group, status(0xA), index, uint8(w1>>25))), true
+	case OpControlChange:
+		return append(dst, midi1Word(group, status(0xB), index, uint8(w1>>25))), true
+	case OpProgramChange:
+		if w0&1 != 0 {
+			dst = append(dst,
+				midi1Word(group, status(0xB), 0, uint8(w1>>8)),
+				midi1Word(group, status(0xB), 32, uint8(w1)),
+			)
+		}
+		return append(dst, midi1Word(group, status(0xC), uint8(w1>>24), 0)), true
+	case OpChannelPressure:
+		return append(dst, midi1Word(group, status(0xD), uint8(w1>>25), 0)), true
+	case OpPitchBend:
+		bend := w1 >> 18
+		return append(dst, midi1Word(group, status(0xE), uint8(bend), uint8(bend>>7))), true
+	case OpRegisteredController, OpAssignableController:
+		msb, lsb := uint8(101), uint8(100)
+		if Opcode(w0) == OpAssignableController {
+			msb, lsb = 99, 98
+		}
+		bank := uint8(w0>>8) & 0x7F
+		ctrl := uint8(w0) & 0x7F
+		return append(dst,
+			midi1Word(group, status(0xB), msb, bank),
+			midi1Word(group, status(0xB), lsb, ctrl),
+			midi1Word(group, status(0xB), 6, uint8(w1>>25)),
+			midi1Word(group, status(0xB), 38, uint8(w1>>18)),
+		), true
+	}
+
+	return dst, false
+}
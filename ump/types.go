@@ -8,4 +8,12 @@ const (
 	MsgTypeMIDIv1
 	MsgTypeData
 	MsgTypeMIDIv2
+	MsgTypeData128
+)
+
+const (
+	MsgTypeFlexData = 0xD << 28
+	MsgTypeStream   = 0xF << 28
+
+	msgTypeMask = 0xF << 28
 )
@@ -0,0 +1,41 @@
+package ump
+
+// Utility message statuses
+const (
+	UtilityNoOp               = 0x0
+	UtilityJRClock            = 0x1
+	UtilityJRTimestamp        = 0x2
+	UtilityDeltaClockstampTPQ = 0x3
+	UtilityDeltaClockstamp    = 0x4
+)
+
+const (
+	NoOp = Word(MsgTypeUtility)
+
+	// Largest tick count that fits in a single Delta Clockstamp message
+	MaxDeltaClockstamp = 0xFFFFF
+
+	utilityStatusShift = 20
+)
+
+// UtilityStatus returns the status of a utility message.
+func UtilityStatus(w Word) uint8 {
+	return uint8(w>>utilityStatusShift) & 0x0F
+}
+
+// DeltaClockstampTPQ returns a Delta Clockstamp Ticks Per Quarter Note
+// message.
+func DeltaClockstampTPQ(ticks uint16) Word {
+	return MsgTypeUtility | UtilityDeltaClockstampTPQ<<utilityStatusShift | Word(ticks)
+}
+
+// DeltaClockstamp returns a Delta Clockstamp message. ticks is truncated to
+// 20 bits.
+func DeltaClockstamp(ticks uint32) Word {
+	return MsgTypeUtility | UtilityDeltaClockstamp<<utilityStatusShift | Word(ticks&MaxDeltaClockstamp)
+}
+
+// DeltaClockstampTicks returns the tick count of a Delta Clockstamp message.
+func DeltaClockstampTicks(w Word) uint32 {
+	return uint32(w) & MaxDeltaClockstamp
+}